@@ -1,7 +1,10 @@
 package asr
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
 
     "github.com/k2-fsa/sherpa-onnx-go/sherpa_onnx"
@@ -10,19 +13,39 @@ import (
 type Config struct {
 	ModelDir   string
 	SampleRate int
+
+	// Горячие слова: по строке на фразу. С ними декодер переключается
+	// на modified_beam_search, для bpe-моделей нужен bpe.vocab в ModelDir.
+	HotwordsFile  string
+	HotwordsScore float32
 }
 
 type Response struct {
 	Type string `json:"type"` // "interim" или "final"
 	Text string `json:"text"`
+	// Words слова final со временем от начала потока; у interim пусто
+	Words []Word `json:"words,omitempty"`
+}
+
+// Word слово распознанной фразы, время в секундах от начала потока
+type Word struct {
+	Text  string  `json:"text"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
 }
 
+// tokenDuration длительность последнего токена фразы, если после него
+// нечего взять за конец
+const tokenDuration = 0.32
+
 type ASRModule struct {
 	recognizer    *sherpa_onnx.OnlineRecognizer
 	stream        *sherpa_onnx.OnlineStream
 	mu            sync.Mutex
 	lastSentFinal string // Для исключения дублей в Finish()
     lastSentInterim string // <--- для фильтрации дублей
+	samples       int64  // принято отсчётов с начала потока
+	segmentStart  int64  // отсчёт, с которого началась текущая фраза
 }
 
 func New(cfg Config) (*ASRModule, error) {
@@ -40,6 +63,20 @@ func New(cfg Config) (*ASRModule, error) {
 	config.Rule1MinTrailingSilence = 1.2
 	config.DecodingMethod = "greedy_search"
 
+	if cfg.HotwordsFile != "" {
+		config.DecodingMethod = "modified_beam_search"
+		config.MaxActivePaths = 4
+		config.HotwordsFile = cfg.HotwordsFile
+		config.HotwordsScore = cfg.HotwordsScore
+		if config.HotwordsScore == 0 {
+			config.HotwordsScore = 1.5
+		}
+		if vocab := cfg.ModelDir + "/bpe.vocab"; fileExists(vocab) {
+			config.ModelConfig.ModelingUnit = "bpe"
+			config.ModelConfig.BpeVocab = vocab
+		}
+	}
+
 	recognizer := sherpa_onnx.NewOnlineRecognizer(&config)
 	if recognizer == nil {
 		return nil, fmt.Errorf("failed to create recognizer")
@@ -56,6 +93,7 @@ func (m *ASRModule) Write(pcm []float32) Response {
 	defer m.mu.Unlock()
 
 	m.stream.AcceptWaveform(16000, pcm)
+	m.samples += int64(len(pcm))
 	for m.recognizer.IsReady(m.stream) {
 		m.recognizer.Decode(m.stream)
 	}
@@ -67,8 +105,10 @@ func (m *ASRModule) Write(pcm []float32) Response {
 		text := res.Text
 		m.lastSentFinal = text
 		m.lastSentInterim = "" // Сбрасываем промежуточный при фиксации фразы
+		words := m.words(res)
 		m.recognizer.Reset(m.stream)
-		return Response{Type: "final", Text: text}
+		m.segmentStart = m.samples
+		return Response{Type: "final", Text: text, Words: words}
 	}
 
 	// 2. ФИЛЬТР ДУБЛИКАТОВ ДЛЯ INTERIM
@@ -97,7 +137,48 @@ func (m *ASRModule) Finish() Response {
 		return Response{}
 	}
 
-	return Response{Type: "final", Text: res.Text}
+	return Response{Type: "final", Text: res.Text, Words: m.words(res)}
+}
+
+// words собирает токены фразы в слова. Время токенов — от начала фразы,
+// начало фразы sherpa-onnx отдаёт в JSON результата (start_time).
+func (m *ASRModule) words(res *sherpa_onnx.OnlineRecognizerResult) []Word {
+	if len(res.Tokens) == 0 || len(res.Timestamps) != len(res.Tokens) {
+		return nil
+	}
+	var meta struct {
+		StartTime *float64 `json:"start_time"`
+	}
+	offset := float64(m.segmentStart) / 16000
+	if json.Unmarshal([]byte(res.Json), &meta) == nil && meta.StartTime != nil {
+		offset = *meta.StartTime
+	}
+	now := float64(m.samples) / 16000
+
+	var words []Word
+	for i, tok := range res.Tokens {
+		start := offset + float64(res.Timestamps[i])
+		piece := strings.TrimLeft(tok, " ▁")
+		if len(words) == 0 || piece != tok {
+			if n := len(words); n > 0 {
+				words[n-1].End = start
+			}
+			words = append(words, Word{Start: start})
+		}
+		words[len(words)-1].Text += piece
+	}
+	if n := len(words); n > 0 {
+		last := offset + float64(res.Timestamps[len(res.Timestamps)-1])
+		words[n-1].End = min(last+tokenDuration, now)
+	}
+
+	// текст берём из распознанной фразы, если слова сошлись по числу
+	if fields := strings.Fields(res.Text); len(fields) == len(words) {
+		for i := range words {
+			words[i].Text = fields[i]
+		}
+	}
+	return words
 }
 
 func (m *ASRModule) Close() {
@@ -108,3 +189,8 @@ func (m *ASRModule) Close() {
 		sherpa_onnx.DeleteOnlineRecognizer(m.recognizer)
 	}
 }
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -74,6 +74,11 @@ func NewResolver(configPath string) (*CommandResolver, error) {
         return nil, fmt.Errorf("parse config: %w", err)
     }
 
+    return New(cfg), nil
+}
+
+// New создает резолвер из готового конфига (например, секции чужого YAML)
+func New(cfg Config) *CommandResolver {
     httpClient := &http.Client{
         Timeout: time.Duration(cfg.Qwen.TimeoutSec) * time.Second,
     }
@@ -82,12 +87,15 @@ func NewResolver(configPath string) (*CommandResolver, error) {
         config:     &cfg,
         httpClient: httpClient,
         logger:     log.New(log.Writer(), "[QWEN] ", log.LstdFlags),
-    }, nil
+    }
 }
 
 // determineCommandType определяет, создание это или модификация
 func (r *CommandResolver) determineCommandType(req CommandRequest) (string, string, string) {
-    // Контекст всегда есть!
+    // Первая фраза сессии приходит без контекста - это CREATE
+    if req.Context == nil {
+        return "CREATE", "", req.CurrentText
+    }
 
     if req.Context.Type == "final" {
         // Контекст из Vosk - это CREATE
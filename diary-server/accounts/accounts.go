@@ -0,0 +1,323 @@
+// Package accounts учётные записи дневника: пароли (Argon2id), вход по
+// паролю, сессии по cookie или токену и личные настройки диктовки.
+// Имя учётной записи — то же имя пользователя, которым хранилище
+// разделяет записи, так что вошедший видит только своё.
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"bhl-diary/store"
+)
+
+var (
+	ErrBadCredentials = errors.New("wrong user name or password")
+	ErrBadName        = errors.New("user name: 2-32 lowercase latin letters, digits, '.', '-' or '_'")
+	ErrWeakPassword   = fmt.Errorf("password must be at least %d characters", MinPassword)
+	ErrNameTaken      = errors.New("user name is taken")
+)
+
+const (
+	// CookieName cookie сессии после входа
+	CookieName = "bhl_session"
+	// MinPassword короче пароль не принимаем
+	MinPassword = 8
+)
+
+// Config секция accounts в config.yaml
+type Config struct {
+	Enabled      bool   `yaml:"enabled"`
+	Registration bool   `yaml:"registration"` // открытая регистрация через /api/v1/auth/register
+	SessionDays  int    `yaml:"session_days"` // срок входа, по умолчанию 30 дней
+	Argon2       Argon2 `yaml:"argon2"`
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,31}$`)
+
+// Manager учётные записи и сессии поверх хранилища
+type Manager struct {
+	st       store.Store
+	cfg      Config
+	reserved map[string]bool // пользователи статических токенов
+
+	dummyOnce sync.Once
+	dummy     string // хеш для входа под несуществующим именем
+}
+
+func New(st store.Store, cfg Config) *Manager {
+	if cfg.SessionDays <= 0 {
+		cfg.SessionDays = 30
+	}
+	return &Manager{st: st, cfg: cfg}
+}
+
+// Registration разрешена ли регистрация через API
+func (m *Manager) Registration() bool {
+	return m.cfg.Registration
+}
+
+// Reserve имена пользователей статических токенов из auth.tokens:
+// зарегистрироваться под ними через API нельзя
+func (m *Manager) Reserve(names ...string) {
+	if m.reserved == nil {
+		m.reserved = map[string]bool{}
+	}
+	for _, n := range names {
+		m.reserved[n] = true
+	}
+}
+
+// Register открытая регистрация. Кроме занятого учётной записью имени
+// (store.ErrUserExists) отказывает с ErrNameTaken, если у имени уже есть
+// данные в дневнике или это пользователь статического токена: иначе
+// новичок получил бы чужие записи.
+func (m *Manager) Register(ctx context.Context, name, password string) (*store.User, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrBadName
+	}
+	if m.reserved[name] {
+		return nil, ErrNameTaken
+	}
+	owns, err := m.ownsData(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if owns {
+		return nil, ErrNameTaken
+	}
+	return m.Create(ctx, name, password)
+}
+
+// Create заводит учётную запись без проверки данных (bhl-diary users add):
+// так администратор даёт пароль пользователю токена или удалённой записи,
+// и тот видит свои прежние записи. Имя занято — store.ErrUserExists.
+func (m *Manager) Create(ctx context.Context, name, password string) (*store.User, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrBadName
+	}
+	hash, err := m.hash(password)
+	if err != nil {
+		return nil, err
+	}
+	u := &store.User{Name: name, PasswordHash: hash}
+	if err := m.st.CreateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Login проверяет пароль и открывает сессию. Токен возвращается один
+// раз, в хранилище — только его хеш.
+func (m *Manager) Login(ctx context.Context, name, password string) (string, *store.Session, error) {
+	u, err := m.st.GetUser(ctx, name)
+	if errors.Is(err, store.ErrUserNotFound) {
+		// столько же работы, сколько с настоящим паролем: по времени
+		// ответа не узнать, есть ли такой пользователь
+		m.dummyOnce.Do(func() { m.dummy, _ = HashPassword("dummy password", m.cfg.Argon2) })
+		CheckPassword(m.dummy, password)
+		return "", nil, ErrBadCredentials
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if ok, err := CheckPassword(u.PasswordHash, password); err != nil || !ok {
+		return "", nil, ErrBadCredentials
+	}
+	return m.newSession(ctx, u.Name)
+}
+
+func (m *Manager) newSession(ctx context.Context, user string) (string, *store.Session, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	now := time.Now()
+	s := &store.Session{
+		TokenHash: tokenHash(token),
+		User:      user,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, m.cfg.SessionDays),
+	}
+	if err := m.st.CreateSession(ctx, s); err != nil {
+		return "", nil, err
+	}
+	return token, s, nil
+}
+
+// Logout закрывает сессию токена
+func (m *Manager) Logout(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	return m.st.DeleteSession(ctx, tokenHash(token))
+}
+
+// ChangePassword меняет пароль, если старый верен. Все входы
+// закрываются, взамен открывается одна новая сессия.
+func (m *Manager) ChangePassword(ctx context.Context, name, old, password string) (string, *store.Session, error) {
+	u, err := m.st.GetUser(ctx, name)
+	if errors.Is(err, store.ErrUserNotFound) {
+		return "", nil, ErrBadCredentials
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if ok, err := CheckPassword(u.PasswordHash, old); err != nil || !ok {
+		return "", nil, ErrBadCredentials
+	}
+	if err := m.SetPassword(ctx, name, password); err != nil {
+		return "", nil, err
+	}
+	return m.newSession(ctx, name)
+}
+
+// SetPassword ставит пароль без проверки старого (bhl-diary users passwd)
+// и закрывает все входы пользователя
+func (m *Manager) SetPassword(ctx context.Context, name, password string) error {
+	hash, err := m.hash(password)
+	if err != nil {
+		return err
+	}
+	u, err := m.st.GetUser(ctx, name)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hash
+	if err := m.st.UpdateUser(ctx, u); err != nil {
+		return err
+	}
+	return m.st.DeleteSessions(ctx, name)
+}
+
+// ownsData есть ли у имени записи, дела, правила замен или задачи
+func (m *Manager) ownsData(ctx context.Context, name string) (bool, error) {
+	entries, err := m.st.ListEntries(ctx, store.Filter{User: name, Limit: 1})
+	if err != nil || len(entries) > 0 {
+		return len(entries) > 0, err
+	}
+	tasks, err := m.st.ListTasks(ctx, store.TaskFilter{User: name, Limit: 1})
+	if err != nil || len(tasks) > 0 {
+		return len(tasks) > 0, err
+	}
+	rules, err := m.st.ListRules(ctx, name)
+	if err != nil || len(rules) > 0 {
+		return len(rules) > 0, err
+	}
+	jobs, err := m.st.ListJobs(ctx, name, 1)
+	return len(jobs) > 0, err
+}
+
+func (m *Manager) hash(password string) (string, error) {
+	if len([]rune(password)) < MinPassword {
+		return "", ErrWeakPassword
+	}
+	return HashPassword(password, m.cfg.Argon2)
+}
+
+// Authenticate реализует wshandler.Authenticator: пользователь открытой сессии
+func (m *Manager) Authenticate(r *http.Request) (string, bool) {
+	token := Token(r)
+	if token == "" {
+		return "", false
+	}
+	s, err := m.st.GetSession(r.Context(), tokenHash(token))
+	if err != nil {
+		if !errors.Is(err, store.ErrSessionNotFound) {
+			log.Printf("⚠️ Проверка сессии: %v", err)
+		}
+		return "", false
+	}
+	return s.User, true
+}
+
+// Token токен сессии из cookie, Authorization: Bearer или ?token=
+// (браузер не ставит заголовки на WebSocket)
+func Token(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	if c, err := r.Cookie(CookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	return r.URL.Query().Get("token")
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Settings личные настройки; у пользователя без учётной записи
+// (статический токен, без входа) — пустые
+func (m *Manager) Settings(ctx context.Context, user string) (store.UserSettings, error) {
+	u, err := m.st.GetUser(ctx, user)
+	if errors.Is(err, store.ErrUserNotFound) {
+		return store.UserSettings{}, nil
+	}
+	if err != nil {
+		return store.UserSettings{}, err
+	}
+	return u.Settings, nil
+}
+
+// SaveSettings сохраняет личные настройки
+func (m *Manager) SaveSettings(ctx context.Context, user string, s store.UserSettings) error {
+	u, err := m.st.GetUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	u.Settings = normalize(s)
+	return m.st.UpdateUser(ctx, u)
+}
+
+// normalize горячие слова в нижнем регистре, как токены русских моделей, без повторов
+func normalize(s store.UserSettings) store.UserSettings {
+	seen := map[string]bool{}
+	var words []string
+	for _, w := range s.Hotwords {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w == "" || seen[w] {
+			continue
+		}
+		seen[w] = true
+		words = append(words, w)
+	}
+	s.Hotwords = words
+	if len(s.Stages) == 0 {
+		s.Stages = nil
+	}
+	return s
+}
+
+// Hotwords свои горячие слова пользователя; для corrections.Engine.SetHotwords
+func (m *Manager) Hotwords(user string) []string {
+	return m.settings(user).Hotwords
+}
+
+// Stages стадии конвейера пользователя; для wshandler.SetUserStages
+func (m *Manager) Stages(user string) map[string]bool {
+	return m.settings(user).Stages
+}
+
+func (m *Manager) settings(user string) store.UserSettings {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := m.Settings(ctx, user)
+	if err != nil {
+		log.Printf("⚠️ Настройки %s: %v", user, err)
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2 стоимость хеша пароля. Вход — на каждый логин, поэтому
+// по умолчанию дешевле, чем ключ шифрования: рекомендация OWASP.
+type Argon2 struct {
+	Time     uint32 `yaml:"time"`      // проходов, по умолчанию 2
+	MemoryMB uint32 `yaml:"memory_mb"` // по умолчанию 19
+	Threads  uint8  `yaml:"threads"`   // по умолчанию 1
+}
+
+func (a Argon2) withDefaults() Argon2 {
+	if a.Time == 0 {
+		a.Time = 2
+	}
+	if a.MemoryMB == 0 {
+		a.MemoryMB = 19
+	}
+	if a.Threads == 0 {
+		a.Threads = 1
+	}
+	return a
+}
+
+var errBadHash = errors.New("unsupported password hash")
+
+// HashPassword хеш в формате PHC: $argon2id$v=19$m=19456,t=2,p=1$соль$хеш
+func HashPassword(password string, a Argon2) (string, error) {
+	a = a.withDefaults()
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.MemoryMB*1024, a.Threads, 32)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.MemoryMB*1024, a.Time, a.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// CheckPassword сверяет пароль с хешем; параметры берутся из самого хеша,
+// так что смена стоимости в конфиге не ломает старые пароли
+func CheckPassword(hash, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errBadHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errBadHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errBadHash
+	}
+	b64 := base64.RawStdEncoding
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, errBadHash
+	}
+	want, err := b64.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, errBadHash
+	}
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
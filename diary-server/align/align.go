@@ -0,0 +1,197 @@
+// Package align привязка слов текста записи ко времени в аудио: текст
+// после конвейера и ручной правки сопоставляется с тем, что услышал
+// распознаватель.
+package align
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"bhl-diary/diff"
+	"bhl-diary/store"
+)
+
+// Word слово текста записи. Offset и Length в символах (рунах) Entry.Text,
+// время в секундах от начала аудио записи.
+type Word struct {
+	Text     string  `json:"text"`
+	Offset   int     `json:"offset"`
+	Length   int     `json:"length"`
+	Sentence int     `json:"sentence"` // номер предложения, с нуля
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Timed    bool    `json:"timed"` // false — слово не из диктовки, времени нет
+}
+
+// Entry выравнивает текст записи по словам её фраз. Слова, которых
+// распознаватель не слышал в таком виде (пунктуация, числа цифрами,
+// исправления), получают время заменённых слов или промежутка между
+// соседями. Без времени слов в фразах возвращает nil.
+func Entry(e *store.Entry) []Word {
+	var spoken []store.Word
+	for _, f := range e.Finals {
+		if f.Type != store.FinalEdit {
+			spoken = append(spoken, f.Words...)
+		}
+	}
+	if len(spoken) == 0 {
+		return nil
+	}
+
+	words := tokenize(e.Text)
+	a := make([]string, len(spoken))
+	for i, w := range spoken {
+		a[i] = normalize(w.Text)
+	}
+	b := make([]string, len(words))
+	for i, w := range words {
+		b[i] = normalize(w.Text)
+	}
+
+	// i, j — позиции в spoken и words; run — несовпавший участок
+	i, j := 0, 0
+	runI, runJ := 0, 0
+	flush := func() {
+		fill(words[runJ:j], spoken, runI, i)
+	}
+	for _, op := range diff.Words(strings.Join(a, " "), strings.Join(b, " ")) {
+		n := len(strings.Fields(op.Text))
+		switch op.Op {
+		case diff.Equal:
+			flush()
+			for k := 0; k < n; k++ {
+				words[j+k].Start, words[j+k].End, words[j+k].Timed = spoken[i+k].Start, spoken[i+k].End, true
+			}
+			i, j = i+n, j+n
+			runI, runJ = i, j
+		case diff.Delete:
+			i += n
+		case diff.Insert:
+			j += n
+		}
+	}
+	flush()
+	return words
+}
+
+// fill раздаёт вставленным словам время удалённых spoken[from:to]
+// пропорционально длине; если удалённых нет — промежуток между соседями
+func fill(ins []Word, spoken []store.Word, from, to int) {
+	if len(ins) == 0 {
+		return
+	}
+	var start, end float64
+	switch {
+	case to > from:
+		start, end = spoken[from].Start, spoken[to-1].End
+	case from > 0 && from < len(spoken):
+		start, end = spoken[from-1].End, spoken[from].Start
+	case from > 0:
+		start, end = spoken[from-1].End, spoken[from-1].End
+	default:
+		start, end = spoken[0].Start, spoken[0].Start
+	}
+	if end < start {
+		end = start
+	}
+
+	total := 0
+	for _, w := range ins {
+		total += w.Length
+	}
+	at := start
+	for k := range ins {
+		d := (end - start) * float64(ins[k].Length) / float64(total)
+		ins[k].Start, ins[k].End, ins[k].Timed = at, at+d, true
+		at += d
+	}
+}
+
+// tokenize слова текста по пробелам с позициями и номерами предложений.
+// Предложение кончается на .!?… или на границе абзаца.
+func tokenize(text string) []Word {
+	var words []Word
+	sentence := 0
+	pos, start := 0, -1
+	newlines := 0
+	var sb strings.Builder
+	emit := func() {
+		if start < 0 {
+			return
+		}
+		w := sb.String()
+		if len(words) > 0 && (newlines >= 2 || endsSentence(words[len(words)-1].Text)) {
+			sentence++
+		}
+		words = append(words, Word{Text: w, Offset: start, Length: utf8.RuneCountInString(w), Sentence: sentence})
+		sb.Reset()
+		start = -1
+		newlines = 0
+	}
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			emit()
+			if r == '\n' {
+				newlines++
+			}
+		} else {
+			if start < 0 {
+				start = pos
+			}
+			sb.WriteRune(r)
+		}
+		pos++
+	}
+	emit()
+	return words
+}
+
+func endsSentence(w string) bool {
+	w = strings.TrimRight(w, "\"'»)]")
+	return strings.HasSuffix(w, ".") || strings.HasSuffix(w, "!") || strings.HasSuffix(w, "?") || strings.HasSuffix(w, "…")
+}
+
+// normalize слово для сравнения: без регистра, ё и пунктуации по краям
+func normalize(w string) string {
+	w = strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+	w = strings.ReplaceAll(w, "ё", "е")
+	if w == "" {
+		return "·" // пунктуация отдельным словом: число слов должно сохраниться
+	}
+	return w
+}
+
+// Span время от начала первого до конца последнего слова с временем
+// среди words[from:to+1]; ok=false, если времени нет ни у одного
+func Span(words []Word, from, to int) (start, end float64, ok bool) {
+	for _, w := range words[from : to+1] {
+		if !w.Timed {
+			continue
+		}
+		if !ok || w.Start < start {
+			start = w.Start
+		}
+		if !ok || w.End > end {
+			end = w.End
+		}
+		ok = true
+	}
+	return start, end, ok
+}
+
+// Sentence границы предложения n в words; ok=false, если такого нет
+func Sentence(words []Word, n int) (from, to int, ok bool) {
+	from = -1
+	for i, w := range words {
+		if w.Sentence == n {
+			if from < 0 {
+				from = i
+			}
+			to = i
+		}
+	}
+	return from, to, from >= 0
+}
@@ -0,0 +1,221 @@
+// Package analytics статистика письма: слова и минуты диктовки по дням,
+// серии дней подряд, частые слова и темп речи. Считается по записи при
+// каждом сохранении и хранится по одному файлу на пользователя.
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+	"github.com/kljensen/snowball/russian"
+)
+
+// minLemmaRunes короткие слова в частые не попадают
+const minLemmaRunes = 3
+
+// lemma основа слова в записи: сколько раз и в какой форме чаще всего
+type lemma struct {
+	Count int
+	Form  string
+}
+
+// entryStats статистика одной записи
+type entryStats struct {
+	ID      string
+	Created time.Time
+	Updated time.Time
+	Words   int
+	Speech  float64 // секунд речи по времени слов распознавателя
+	Spoken  int     // слов со временем
+	Lemmas  map[string]lemma
+}
+
+// userStats статистика пользователя; сохраняется в stats/<user>.gob
+type userStats struct {
+	Entries map[string]*entryStats
+}
+
+// Index статистика всех пользователей. Как и поисковый индекс, загружается
+// лениво и сверяется с хранилищем; пересчитываются только изменённые записи.
+type Index struct {
+	dir   string
+	store store.Store
+	keys  *crypt.Keyring
+
+	mu    sync.Mutex
+	users map[string]*userStats
+}
+
+func Open(dir string, st store.Store) (*Index, error) {
+	dir = filepath.Join(dir, "stats")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create stats dir: %w", err)
+	}
+	return &Index{dir: dir, store: st, users: map[string]*userStats{}}, nil
+}
+
+// SetKeyring шифровать файлы статистики: в них частые слова
+func (ix *Index) SetKeyring(k *crypt.Keyring) {
+	ix.keys = k
+}
+
+// compute статистика записи по тексту и по времени слов
+func compute(e *store.Entry) *entryStats {
+	s := &entryStats{ID: e.ID, Created: e.CreatedAt, Updated: e.UpdatedAt, Lemmas: map[string]lemma{}}
+
+	forms := map[string]map[string]int{}
+	for _, w := range words(e.Text) {
+		s.Words++
+		lower := strings.ReplaceAll(strings.ToLower(w), "ё", "е")
+		if utf8.RuneCountInString(lower) < minLemmaRunes || russian.IsStopWord(lower) || !unicode.IsLetter([]rune(lower)[0]) {
+			continue
+		}
+		stem := russian.Stem(lower, true)
+		if forms[stem] == nil {
+			forms[stem] = map[string]int{}
+		}
+		forms[stem][strings.ToLower(w)]++
+	}
+	for stem, fs := range forms {
+		l := lemma{}
+		for form, n := range fs {
+			l.Count += n
+			if n > fs[l.Form] || n == fs[l.Form] && form < l.Form {
+				l.Form = form
+			}
+		}
+		s.Lemmas[stem] = l
+	}
+
+	for _, f := range e.Finals {
+		if len(f.Words) == 0 {
+			continue
+		}
+		if d := f.Words[len(f.Words)-1].End - f.Words[0].Start; d > 0 {
+			s.Speech += d
+			s.Spoken += len(f.Words)
+		}
+	}
+	return s
+}
+
+// words слова текста: буквы и цифры, дефис внутри слова ("как-то")
+func words(text string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	}) {
+		if w = strings.Trim(w, "-"); w != "" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// user статистика пользователя, сверенная с хранилищем; вызывать под ix.mu
+func (ix *Index) user(ctx context.Context, user string) (*userStats, error) {
+	u, ok := ix.users[user]
+	if !ok {
+		u = &userStats{Entries: map[string]*entryStats{}}
+		if data, err := crypt.ReadFile(ix.keys, user, ix.path(user)); err == nil {
+			if err := gob.NewDecoder(bytes.NewReader(data)).Decode(u); err != nil || u.Entries == nil {
+				u = &userStats{Entries: map[string]*entryStats{}}
+			}
+		}
+		ix.users[user] = u
+	}
+
+	// записи могли меняться в обход статистики (импорт, CLI)
+	entries, err := ix.store.ListEntries(ctx, store.Filter{User: user})
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	live := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		live[e.ID] = true
+		if s, ok := u.Entries[e.ID]; ok && s.Updated.Equal(e.UpdatedAt) {
+			continue
+		}
+		full, err := ix.store.GetEntry(ctx, user, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		u.Entries[e.ID] = compute(full)
+		changed = true
+	}
+	for id := range u.Entries {
+		if !live[id] {
+			delete(u.Entries, id)
+			changed = true
+		}
+	}
+	if changed {
+		if err := ix.save(user, u); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// Put пересчитывает статистику записи
+func (ix *Index) Put(ctx context.Context, e *store.Entry) error {
+	// запись из списка приходит без фраз — время слов берём из хранилища
+	if len(e.Finals) == 0 {
+		full, err := ix.store.GetEntry(ctx, e.User, e.ID)
+		if err != nil {
+			return err
+		}
+		e = full
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	u, ok := ix.users[e.User]
+	if !ok {
+		// первая загрузка сама посчитает и эту запись
+		_, err := ix.user(ctx, e.User)
+		return err
+	}
+	u.Entries[e.ID] = compute(e)
+	return ix.save(e.User, u)
+}
+
+// Delete убирает запись из статистики
+func (ix *Index) Delete(ctx context.Context, user, id string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	u, ok := ix.users[user]
+	if !ok {
+		return nil
+	}
+	delete(u.Entries, id)
+	return ix.save(user, u)
+}
+
+func (ix *Index) path(user string) string {
+	if user == "" {
+		user = "_anonymous"
+	}
+	return filepath.Join(ix.dir, url.PathEscape(user)+".gob")
+}
+
+// save пишет статистику атомарно: во временный файл и rename
+func (ix *Index) save(user string, u *userStats) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(u); err != nil {
+		return err
+	}
+	return crypt.WriteFile(ix.keys, user, ix.path(user), buf.Bytes())
+}
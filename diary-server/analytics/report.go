@@ -0,0 +1,313 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Группировка ряда
+const (
+	GroupDay   = "day"
+	GroupWeek  = "week" // с понедельника
+	GroupMonth = "month"
+)
+
+// Query отчёт за период; нулевые From/To — с первой записи / по сегодня
+type Query struct {
+	User  string
+	From  time.Time // включительно
+	To    time.Time // не включительно
+	Group string    // day по умолчанию
+	Top   int       // сколько частых слов, по умолчанию 20
+	Now   time.Time // для текущей серии, по умолчанию time.Now()
+}
+
+// Point точка ряда: день, неделя или месяц
+type Point struct {
+	Date    string  `json:"date"` // начало периода, YYYY-MM-DD
+	Entries int     `json:"entries"`
+	Words   int     `json:"words"`
+	Minutes float64 `json:"minutes"`       // минут речи
+	WPM     float64 `json:"wpm,omitempty"` // темп речи, слов в минуту
+}
+
+// Totals итоги периода
+type Totals struct {
+	Entries     int     `json:"entries"`
+	Words       int     `json:"words"`
+	Minutes     float64 `json:"minutes"`
+	WPM         float64 `json:"wpm,omitempty"`
+	ActiveDays  int     `json:"active_days"`
+	WordsPerDay float64 `json:"words_per_day"` // в среднем за день с записями
+}
+
+// Streak дни подряд с записями
+type Streak struct {
+	Days int    `json:"days"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Lemma частое слово: самая частая форма и число употреблений всех форм
+type Lemma struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+type Report struct {
+	From          string  `json:"from,omitempty"`
+	To            string  `json:"to,omitempty"` // включительно
+	Group         string  `json:"group"`
+	Totals        Totals  `json:"totals"`
+	CurrentStreak Streak  `json:"current_streak"`
+	LongestStreak Streak  `json:"longest_streak"`
+	Series        []Point `json:"series"`
+	Lemmas        []Lemma `json:"lemmas"`
+}
+
+// bucket накопитель точки ряда
+type bucket struct {
+	entries, words, spoken int
+	speech                 float64
+}
+
+func (b *bucket) add(s *entryStats) {
+	b.entries++
+	b.words += s.Words
+	b.spoken += s.Spoken
+	b.speech += s.Speech
+}
+
+func (b *bucket) point(date string) Point {
+	p := Point{Date: date, Entries: b.entries, Words: b.words, Minutes: round1(b.speech / 60)}
+	if b.speech > 0 {
+		p.WPM = round1(float64(b.spoken) / (b.speech / 60))
+	}
+	return p
+}
+
+func round1(x float64) float64 {
+	return math.Round(x*10) / 10
+}
+
+// Report статистика пользователя за период
+func (ix *Index) Report(ctx context.Context, q Query) (*Report, error) {
+	switch q.Group {
+	case "":
+		q.Group = GroupDay
+	case GroupDay, GroupWeek, GroupMonth:
+	default:
+		return nil, fmt.Errorf("unknown group %q", q.Group)
+	}
+	if q.Top <= 0 {
+		q.Top = 20
+	}
+	if q.Now.IsZero() {
+		q.Now = time.Now()
+	}
+
+	ix.mu.Lock()
+	u, err := ix.user(ctx, q.User)
+	if err != nil {
+		ix.mu.Unlock()
+		return nil, err
+	}
+	var picked []*entryStats
+	for _, s := range u.Entries {
+		if (q.From.IsZero() || !s.Created.Before(q.From)) && (q.To.IsZero() || s.Created.Before(q.To)) {
+			picked = append(picked, s)
+		}
+	}
+	ix.mu.Unlock()
+
+	r := &Report{Group: q.Group, Series: []Point{}, Lemmas: []Lemma{}}
+	first, last := day(q.From), day(q.To.Add(-time.Nanosecond))
+	if q.To.IsZero() {
+		last = day(q.Now)
+	}
+	if q.From.IsZero() {
+		first = last
+		for _, s := range picked {
+			if d := day(s.Created); d.Before(first) {
+				first = d
+			}
+		}
+	}
+	if len(picked) == 0 && q.From.IsZero() {
+		return r, nil
+	}
+	r.From, r.To = first.Format(time.DateOnly), last.Format(time.DateOnly)
+
+	// ряд с нулями там, где записей не было
+	buckets := map[string]*bucket{}
+	for d := periodStart(first, q.Group); !d.After(last); d = nextPeriod(d, q.Group) {
+		key := d.Format(time.DateOnly)
+		buckets[key] = &bucket{}
+		r.Series = append(r.Series, Point{Date: key})
+	}
+
+	var total bucket
+	active := map[string]bool{}
+	lemmas := map[string]lemma{}
+	forms := map[string]map[string]int{}
+	for _, s := range picked {
+		d := day(s.Created)
+		if b := buckets[periodStart(d, q.Group).Format(time.DateOnly)]; b != nil {
+			b.add(s)
+		}
+		total.add(s)
+		active[d.Format(time.DateOnly)] = true
+		for stem, l := range s.Lemmas {
+			agg := lemmas[stem]
+			agg.Count += l.Count
+			lemmas[stem] = agg
+			if forms[stem] == nil {
+				forms[stem] = map[string]int{}
+			}
+			forms[stem][l.Form] += l.Count
+		}
+	}
+	for i, p := range r.Series {
+		r.Series[i] = buckets[p.Date].point(p.Date)
+	}
+
+	tp := total.point("")
+	r.Totals = Totals{Entries: tp.Entries, Words: tp.Words, Minutes: tp.Minutes, WPM: tp.WPM, ActiveDays: len(active)}
+	if len(active) > 0 {
+		r.Totals.WordsPerDay = round1(float64(tp.Words) / float64(len(active)))
+	}
+	r.CurrentStreak, r.LongestStreak = streaks(active, first, last)
+
+	for stem, l := range lemmas {
+		best := ""
+		for form, n := range forms[stem] {
+			if n > forms[stem][best] || n == forms[stem][best] && form < best {
+				best = form
+			}
+		}
+		r.Lemmas = append(r.Lemmas, Lemma{Word: best, Count: l.Count})
+	}
+	sort.Slice(r.Lemmas, func(i, j int) bool {
+		if r.Lemmas[i].Count != r.Lemmas[j].Count {
+			return r.Lemmas[i].Count > r.Lemmas[j].Count
+		}
+		return r.Lemmas[i].Word < r.Lemmas[j].Word
+	})
+	if len(r.Lemmas) > q.Top {
+		r.Lemmas = r.Lemmas[:q.Top]
+	}
+	return r, nil
+}
+
+// streaks текущая серия (заканчивается последним днём периода или накануне —
+// сегодня ещё можно успеть) и самая длинная
+func streaks(active map[string]bool, first, last time.Time) (current, longest Streak) {
+	var run Streak
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		key := d.Format(time.DateOnly)
+		if !active[key] {
+			run = Streak{}
+			continue
+		}
+		if run.Days == 0 {
+			run.From = key
+		}
+		run.Days++
+		run.To = key
+		if run.Days > longest.Days {
+			longest = run
+		}
+	}
+	if run.Days > 0 {
+		return run, longest
+	}
+	// последний день пуст — серия жива, если был записан предыдущий
+	for d := last.AddDate(0, 0, -1); !d.Before(first) && active[d.Format(time.DateOnly)]; d = d.AddDate(0, 0, -1) {
+		if current.Days == 0 {
+			current.To = d.Format(time.DateOnly)
+		}
+		current.Days++
+		current.From = d.Format(time.DateOnly)
+	}
+	return current, longest
+}
+
+func day(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func periodStart(d time.Time, group string) time.Time {
+	switch group {
+	case GroupWeek:
+		return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+	case GroupMonth:
+		return time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.Local)
+	}
+	return d
+}
+
+func nextPeriod(d time.Time, group string) time.Time {
+	switch group {
+	case GroupWeek:
+		return d.AddDate(0, 0, 7)
+	case GroupMonth:
+		return d.AddDate(0, 1, 0)
+	}
+	return d.AddDate(0, 0, 1)
+}
+
+// WriteText отчёт для терминала
+func WriteText(w io.Writer, r *Report) error {
+	var b strings.Builder
+	if r.From == "" {
+		b.WriteString("Записей нет.\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	t := r.Totals
+	fmt.Fprintf(&b, "Период: %s — %s\n\n", r.From, r.To)
+	fmt.Fprintf(&b, "Записей:           %d\n", t.Entries)
+	fmt.Fprintf(&b, "Слов:              %d (в среднем %.0f за день с записями)\n", t.Words, t.WordsPerDay)
+	fmt.Fprintf(&b, "Дней с записями:   %d\n", t.ActiveDays)
+	fmt.Fprintf(&b, "Надиктовано:       %.1f мин\n", t.Minutes)
+	if t.WPM > 0 {
+		fmt.Fprintf(&b, "Темп речи:         %.0f слов/мин\n", t.WPM)
+	}
+	fmt.Fprintf(&b, "Текущая серия:     %s\n", streakText(r.CurrentStreak))
+	fmt.Fprintf(&b, "Самая длинная:     %s\n", streakText(r.LongestStreak))
+
+	if len(r.Lemmas) > 0 {
+		b.WriteString("\nЧастые слова:\n")
+		for i, l := range r.Lemmas {
+			fmt.Fprintf(&b, "  %2d. %-20s %d\n", i+1, l.Word, l.Count)
+		}
+	}
+
+	maxWords := 0
+	for _, p := range r.Series {
+		maxWords = max(maxWords, p.Words)
+	}
+	b.WriteString("\n" + map[string]string{GroupDay: "По дням", GroupWeek: "По неделям", GroupMonth: "По месяцам"}[r.Group] + ":\n")
+	for _, p := range r.Series {
+		bar := ""
+		if maxWords > 0 {
+			bar = strings.Repeat("█", int(math.Ceil(float64(p.Words)*30/float64(maxWords))))
+		}
+		fmt.Fprintf(&b, "  %s %6d сл. %6.1f мин  %s\n", p.Date, p.Words, p.Minutes, bar)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func streakText(s Streak) string {
+	if s.Days == 0 {
+		return "нет"
+	}
+	return fmt.Sprintf("%d дн. (%s — %s)", s.Days, s.From, s.To)
+}
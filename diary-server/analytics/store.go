@@ -0,0 +1,53 @@
+package analytics
+
+import (
+	"context"
+	"log"
+
+	"bhl-diary/store"
+)
+
+// TrackedStore обёртка над store.Store: статистика записи пересчитывается
+// при каждом сохранении, правке и удалении.
+type TrackedStore struct {
+	store.Store
+	Stats *Index
+}
+
+func NewTrackedStore(st store.Store, ix *Index) *TrackedStore {
+	return &TrackedStore{Store: st, Stats: ix}
+}
+
+func (s *TrackedStore) CreateEntry(ctx context.Context, e *store.Entry) error {
+	if err := s.Store.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+	s.track(ctx, e)
+	return nil
+}
+
+func (s *TrackedStore) UpdateEntry(ctx context.Context, e *store.Entry) error {
+	if err := s.Store.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+	s.track(ctx, e)
+	return nil
+}
+
+func (s *TrackedStore) DeleteEntry(ctx context.Context, user, id string) error {
+	if err := s.Store.DeleteEntry(ctx, user, id); err != nil {
+		return err
+	}
+	if err := s.Stats.Delete(ctx, user, id); err != nil {
+		log.Printf("⚠️ Статистика: не удалось убрать %s: %v", id, err)
+	}
+	return nil
+}
+
+// track ошибка статистики не отменяет запись: при следующем отчёте
+// статистика сверится с хранилищем
+func (s *TrackedStore) track(ctx context.Context, e *store.Entry) {
+	if err := s.Stats.Put(ctx, e); err != nil {
+		log.Printf("⚠️ Статистика: не удалось обновить %s: %v", e.ID, err)
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"bhl-diary/accounts"
+	"bhl-diary/store"
+)
+
+// SetAccounts включает вход по паролю (/api/v1/auth) и личные настройки (/api/v1/me)
+func (s *Server) SetAccounts(m *accounts.Manager) {
+	s.accounts = m
+}
+
+type credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type loginResponse struct {
+	User      string    `json:"user"`
+	Token     string    `json:"token"` // для Authorization: Bearer и ?token= у WebSocket
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	u, err := s.accounts.Register(r.Context(), req.User, req.Password)
+	switch {
+	case errors.Is(err, accounts.ErrBadName), errors.Is(err, accounts.ErrWeakPassword):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrUserExists), errors.Is(err, accounts.ErrNameTaken):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeStoreError(w, err)
+	default:
+		writeJSON(w, http.StatusCreated, u)
+	}
+}
+
+// login проверяет пароль, ставит cookie сессии и отдаёт тот же токен в ответе
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var req credentials
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	token, sess, err := s.accounts.Login(r.Context(), req.User, req.Password)
+	if errors.Is(err, accounts.ErrBadCredentials) {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	setSessionCookie(w, r, token, sess.ExpiresAt)
+	writeJSON(w, http.StatusOK, loginResponse{User: sess.User, Token: token, ExpiresAt: sess.ExpiresAt})
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	if err := s.accounts.Logout(r.Context(), accounts.Token(r)); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	setSessionCookie(w, r, "", time.Unix(0, 0))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setSessionCookie cookie недоступна скриптам и не уходит с чужих сайтов
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     accounts.CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+type meResponse struct {
+	Name     string             `json:"name"`
+	Settings store.UserSettings `json:"settings"`
+}
+
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request, user string) {
+	settings, err := s.accounts.Settings(r.Context(), user)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, meResponse{Name: user, Settings: settings})
+}
+
+type settingsRequest struct {
+	Hotwords *[]string        `json:"hotwords"`
+	Stages   map[string]*bool `json:"stages"` // null — стадия снова как в конфиге
+}
+
+// updateSettings меняет только присланное: {"stages":{"punctuation":false}}
+func (s *Server) updateSettings(w http.ResponseWriter, r *http.Request, user string) {
+	var req settingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	settings, err := s.accounts.Settings(r.Context(), user)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if req.Hotwords != nil {
+		settings.Hotwords = *req.Hotwords
+	}
+	for name, on := range req.Stages {
+		if on == nil {
+			delete(settings.Stages, name)
+			continue
+		}
+		if settings.Stages == nil {
+			settings.Stages = map[string]bool{}
+		}
+		settings.Stages[name] = *on
+	}
+	if err := s.accounts.SaveSettings(r.Context(), user, settings); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.getMe(w, r, user)
+}
+
+type passwordRequest struct {
+	Old string `json:"old_password"`
+	New string `json:"new_password"`
+}
+
+// changePassword закрывает все входы и открывает новый для этого клиента
+func (s *Server) changePassword(w http.ResponseWriter, r *http.Request, user string) {
+	var req passwordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	token, sess, err := s.accounts.ChangePassword(r.Context(), user, req.Old, req.New)
+	switch {
+	case errors.Is(err, accounts.ErrBadCredentials):
+		writeError(w, http.StatusForbidden, "wrong password")
+	case errors.Is(err, accounts.ErrWeakPassword):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeStoreError(w, err)
+	default:
+		setSessionCookie(w, r, token, sess.ExpiresAt)
+		writeJSON(w, http.StatusOK, loginResponse{User: sess.User, Token: token, ExpiresAt: sess.ExpiresAt})
+	}
+}
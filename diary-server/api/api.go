@@ -0,0 +1,604 @@
+// Package api версионированный JSON API дневника: /api/v1/...
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bhl-diary/accounts"
+	"bhl-diary/analytics"
+	"bhl-diary/corrections"
+	"bhl-diary/crypt"
+	"bhl-diary/diff"
+	"bhl-diary/export"
+	"bhl-diary/jobs"
+	"bhl-diary/search"
+	"bhl-diary/semantic"
+	"bhl-diary/store"
+)
+
+//go:embed openapi.yaml
+var openapiSpec []byte
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Authenticator тот же контракт, что и у WebSocket: запрос → пользователь
+type Authenticator func(r *http.Request) (user string, ok bool)
+
+type Server struct {
+	store     store.Store
+	auth      Authenticator
+	search    *search.Index
+	exportDir string // пользовательские шаблоны выгрузки
+
+	corrections *corrections.Engine
+	minCount    int // порог подсказок по умолчанию
+
+	jobs       *jobs.Queue
+	uploadsDir string
+	maxUpload  int64 // байт
+	insights   bool
+
+	semantic *semantic.Index
+	asker    *semantic.Asker
+	stats    *analytics.Index
+	keys     *crypt.Keyring // аудио записей зашифровано
+	accounts *accounts.Manager
+}
+
+func New(st store.Store, auth Authenticator) *Server {
+	return &Server{store: st, auth: auth}
+}
+
+// SetExport каталог пользовательских шаблонов для /api/v1/export
+func (s *Server) SetExport(templatesDir string) {
+	s.exportDir = templatesDir
+}
+
+// SetCorrections включает /api/v1/corrections: правила замен и подсказки
+func (s *Server) SetCorrections(e *corrections.Engine, minCount int) {
+	s.corrections = e
+	s.minCount = minCount
+}
+
+// SetKeyring ключи для чтения зашифрованного аудио записей
+func (s *Server) SetKeyring(k *crypt.Keyring) {
+	s.keys = k
+}
+
+// SetSearch включает /api/v1/search
+func (s *Server) SetSearch(ix *search.Index) {
+	s.search = ix
+}
+
+// Register вешает маршруты API на mux
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/openapi.yaml", s.openapi)
+	mux.HandleFunc("GET /api/v1/entries", s.withUser(s.listEntries))
+	mux.HandleFunc("GET /api/v1/entries/{id}", s.withUser(s.getEntry))
+	mux.HandleFunc("PATCH /api/v1/entries/{id}", s.withUser(s.updateEntry))
+	mux.HandleFunc("DELETE /api/v1/entries/{id}", s.withUser(s.deleteEntry))
+	mux.HandleFunc("POST /api/v1/entries/{id}/tags", s.withUser(s.addTag))
+	mux.HandleFunc("DELETE /api/v1/entries/{id}/tags/{tag}", s.withUser(s.removeTag))
+	mux.HandleFunc("GET /api/v1/entries/{id}/audio", s.withUser(s.entryAudio))
+	mux.HandleFunc("GET /api/v1/entries/{id}/revisions", s.withUser(s.listRevisions))
+	mux.HandleFunc("GET /api/v1/entries/{id}/diff", s.withUser(s.diffRevisions))
+	mux.HandleFunc("POST /api/v1/entries/{id}/revisions/{n}/restore", s.withUser(s.restoreRevision))
+	mux.HandleFunc("GET /api/v1/export", s.withUser(s.exportEntries))
+	mux.HandleFunc("GET /api/v1/tasks", s.withUser(s.listTasks))
+	mux.HandleFunc("GET /api/v1/tasks.ics", s.withUser(s.exportTasks))
+	mux.HandleFunc("PATCH /api/v1/tasks/{id}", s.withUser(s.updateTask))
+	mux.HandleFunc("DELETE /api/v1/tasks/{id}", s.withUser(s.deleteTask))
+	if s.accounts != nil {
+		if s.accounts.Registration() {
+			mux.HandleFunc("POST /api/v1/auth/register", s.register)
+		}
+		mux.HandleFunc("POST /api/v1/auth/login", s.login)
+		mux.HandleFunc("POST /api/v1/auth/logout", s.logout)
+		mux.HandleFunc("GET /api/v1/me", s.withUser(s.getMe))
+		mux.HandleFunc("PATCH /api/v1/me/settings", s.withUser(s.updateSettings))
+		mux.HandleFunc("POST /api/v1/me/password", s.withUser(s.changePassword))
+	}
+	if s.search != nil {
+		mux.HandleFunc("GET /api/v1/search", s.withUser(s.searchEntries))
+	}
+	if s.corrections != nil {
+		mux.HandleFunc("GET /api/v1/corrections", s.withUser(s.listRules))
+		mux.HandleFunc("POST /api/v1/corrections", s.withUser(s.saveRule))
+		mux.HandleFunc("DELETE /api/v1/corrections/{id}", s.withUser(s.deleteRule))
+		mux.HandleFunc("GET /api/v1/corrections/suggestions", s.withUser(s.suggestRules))
+		mux.HandleFunc("GET /api/v1/corrections/hotwords", s.withUser(s.hotwords))
+	}
+	if s.stats != nil {
+		mux.HandleFunc("GET /api/v1/stats", s.withUser(s.getStats))
+	}
+	if s.semantic != nil {
+		mux.HandleFunc("GET /api/v1/search/semantic", s.withUser(s.semanticSearch))
+	}
+	if s.asker != nil {
+		mux.HandleFunc("POST /api/v1/ask", s.withUser(s.ask))
+	}
+	if s.insights {
+		mux.HandleFunc("POST /api/v1/entries/{id}/insights", s.withUser(s.regenerateInsights))
+	}
+	if s.jobs != nil {
+		mux.HandleFunc("POST /api/v1/uploads", s.withUser(s.upload))
+		mux.HandleFunc("GET /api/v1/jobs", s.withUser(s.listJobs))
+		mux.HandleFunc("GET /api/v1/jobs/{id}", s.withUser(s.getJob))
+		mux.HandleFunc("POST /api/v1/jobs/{id}/cancel", s.withUser(s.cancelJob))
+	}
+}
+
+type userHandler func(w http.ResponseWriter, r *http.Request, user string)
+
+// withUser проверяет доступ; все запросы к хранилищу идут от имени пользователя
+func (s *Server) withUser(h userHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := ""
+		if s.auth != nil {
+			var ok bool
+			if user, ok = s.auth(r); !ok {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		h(w, r, user)
+	}
+}
+
+func (s *Server) openapi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openapiSpec)
+}
+
+type listResponse struct {
+	Entries    []*store.Entry `json:"entries"`
+	Limit      int            `json:"limit"`
+	Offset     int            `json:"offset"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+}
+
+func (s *Server) listEntries(w http.ResponseWriter, r *http.Request, user string) {
+	q := r.URL.Query()
+	f := store.Filter{User: user, Tag: q.Get("tag"), Limit: defaultLimit}
+
+	var err error
+	if f.From, err = parseTime(q.Get("from"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "bad from: "+err.Error())
+		return
+	}
+	if f.To, err = parseTime(q.Get("to"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "bad to: "+err.Error())
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 || f.Limit > maxLimit {
+			writeError(w, http.StatusBadRequest, "limit must be 1.."+strconv.Itoa(maxLimit))
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			writeError(w, http.StatusBadRequest, "bad offset")
+			return
+		}
+	}
+
+	entries, err := s.store.ListEntries(r.Context(), f)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	resp := listResponse{Entries: entries, Limit: f.Limit, Offset: f.Offset}
+	if resp.Entries == nil {
+		resp.Entries = []*store.Entry{}
+	}
+	if len(entries) == f.Limit {
+		next := f.Offset + f.Limit
+		resp.NextOffset = &next
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getEntry(w http.ResponseWriter, r *http.Request, user string) {
+	e, err := s.store.GetEntry(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	resp := newEntryResponse(e)
+	if resp.Tasks, err = s.store.ListTasks(r.Context(), store.TaskFilter{User: user, EntryID: e.ID}); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type updateRequest struct {
+	Title *string `json:"title"`
+	Text  *string `json:"text"`
+}
+
+func (s *Server) updateEntry(w http.ResponseWriter, r *http.Request, user string) {
+	var req updateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+
+	e, err := s.store.GetEntry(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if req.Title != nil {
+		e.Title = *req.Title
+	}
+	if req.Text != nil {
+		e.Text = *req.Text
+	}
+	if err := s.store.UpdateEntry(r.Context(), e); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+func (s *Server) deleteEntry(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.store.DeleteEntry(r.Context(), user, r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type tagRequest struct {
+	Tag string `json:"tag"`
+}
+
+func (s *Server) addTag(w http.ResponseWriter, r *http.Request, user string) {
+	var req tagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || store.NormalizeTag(req.Tag) == "" {
+		writeError(w, http.StatusBadRequest, `body must be {"tag": "..."}`)
+		return
+	}
+	id := r.PathValue("id")
+	if err := s.store.AddTag(r.Context(), user, id, req.Tag); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.getEntry(w, r, user)
+}
+
+func (s *Server) removeTag(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.store.RemoveTag(r.Context(), user, r.PathValue("id"), r.PathValue("tag")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request, user string) {
+	revs, err := s.store.ListRevisions(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"revisions": revs})
+}
+
+type diffResponse struct {
+	From int       `json:"from"`
+	To   int       `json:"to"`
+	Ops  []diff.Op `json:"ops"`
+}
+
+// diffRevisions ?from=1&to=3; по умолчанию последняя ревизия против предыдущей
+func (s *Server) diffRevisions(w http.ResponseWriter, r *http.Request, user string) {
+	revs, err := s.store.ListRevisions(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	to, err := revisionNumber(q.Get("to"), len(revs))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad to: "+err.Error())
+		return
+	}
+	from, err := revisionNumber(q.Get("from"), max(to-1, 1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad from: "+err.Error())
+		return
+	}
+	if from > len(revs) || to > len(revs) {
+		writeStoreError(w, store.ErrRevisionNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, diffResponse{
+		From: from,
+		To:   to,
+		Ops:  diff.Words(revs[from-1].Text, revs[to-1].Text),
+	})
+}
+
+// restoreRevision делает текст старой ревизии текущим; история не теряется,
+// возврат сам становится новой ревизией
+func (s *Server) restoreRevision(w http.ResponseWriter, r *http.Request, user string) {
+	id := r.PathValue("id")
+	revs, err := s.store.ListRevisions(r.Context(), user, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	n, err := revisionNumber(r.PathValue("n"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad revision: "+err.Error())
+		return
+	}
+	if n > len(revs) {
+		writeStoreError(w, store.ErrRevisionNotFound)
+		return
+	}
+
+	e, err := s.store.GetEntry(r.Context(), user, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	e.Text = revs[n-1].Text
+	e.Revisions = []store.Revision{{Kind: store.RevisionRestore, Text: e.Text, Author: user, RestoredFrom: n}}
+	if err := s.store.UpdateEntry(r.Context(), e); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// revisionNumber номер ревизии с 1; пустое значение — def
+func revisionNumber(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New("revisions are numbered from 1")
+	}
+	return n, nil
+}
+
+func (s *Server) searchEntries(w http.ResponseWriter, r *http.Request, user string) {
+	q := r.URL.Query()
+	sq := search.Query{User: user, Text: q.Get("q"), Limit: defaultLimit}
+	if sq.Text == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	var err error
+	if sq.From, err = parseTime(q.Get("from"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "bad from: "+err.Error())
+		return
+	}
+	if sq.To, err = parseTime(q.Get("to"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "bad to: "+err.Error())
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		if sq.Limit, err = strconv.Atoi(v); err != nil || sq.Limit <= 0 || sq.Limit > maxLimit {
+			writeError(w, http.StatusBadRequest, "limit must be 1.."+strconv.Itoa(maxLimit))
+			return
+		}
+	}
+
+	hits, err := s.search.Search(r.Context(), sq)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"hits": hits})
+}
+
+func (s *Server) listRules(w http.ResponseWriter, r *http.Request, user string) {
+	// свежие счётчики срабатываний
+	if err := s.corrections.Flush(r.Context()); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	rules, err := s.store.ListRules(r.Context(), user)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if rules == nil {
+		rules = []store.Rule{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"rules": rules})
+}
+
+type ruleRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status string `json:"status"` // accepted (по умолчанию) или rejected
+}
+
+// saveRule принимает подсказку (или заводит правило вручную) либо отклоняет её
+func (s *Server) saveRule(w http.ResponseWriter, r *http.Request, user string) {
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	if req.Status == "" {
+		req.Status = store.RuleAccepted
+	}
+	if strings.TrimSpace(req.From) == "" || strings.TrimSpace(req.To) == "" && req.Status == store.RuleAccepted {
+		writeError(w, http.StatusBadRequest, "from and to are required")
+		return
+	}
+	if req.Status != store.RuleAccepted && req.Status != store.RuleRejected {
+		writeError(w, http.StatusBadRequest, "status must be accepted or rejected")
+		return
+	}
+
+	rule := &store.Rule{User: user, From: req.From, To: req.To, Status: req.Status}
+	if err := s.store.SaveRule(r.Context(), rule); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.corrections.Invalidate(user)
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) deleteRule(w http.ResponseWriter, r *http.Request, user string) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad id")
+		return
+	}
+	if err := s.store.DeleteRule(r.Context(), user, id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.corrections.Invalidate(user)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) suggestRules(w http.ResponseWriter, r *http.Request, user string) {
+	minCount := s.minCount
+	if v := r.URL.Query().Get("min_count"); v != "" {
+		var err error
+		if minCount, err = strconv.Atoi(v); err != nil || minCount < 1 {
+			writeError(w, http.StatusBadRequest, "bad min_count")
+			return
+		}
+	}
+	sugg, err := corrections.Suggest(r.Context(), s.store, user, minCount)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"suggestions": sugg})
+}
+
+// hotwords файл горячих слов для распознавателя, по фразе на строку
+func (s *Server) hotwords(w http.ResponseWriter, r *http.Request, user string) {
+	rules, err := s.store.ListRules(r.Context(), user)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	var own store.UserSettings
+	if s.accounts != nil {
+		if own, err = s.accounts.Settings(r.Context(), user); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, h := range corrections.Hotwords(rules, own.Hotwords...) {
+		w.Write([]byte(h + "\n"))
+	}
+}
+
+// exportEntries выгрузка за период: ?format=latex&from=2025-01-01&to=2025-12-31
+func (s *Server) exportEntries(w http.ResponseWriter, r *http.Request, user string) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = export.Markdown
+	}
+	mime, ext, err := export.ContentType(format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f := store.Filter{User: user}
+	if f.From, err = parseTime(q.Get("from"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "bad from: "+err.Error())
+		return
+	}
+	if f.To, err = parseTime(q.Get("to"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "bad to: "+err.Error())
+		return
+	}
+
+	entries, err := s.store.ListEntries(r.Context(), f)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	// Рендерим в буфер, чтобы ошибка шаблона не оборвала ответ на середине
+	var buf bytes.Buffer
+	opts := export.Options{Title: q.Get("title"), From: f.From, To: f.To, TemplatesDir: s.exportDir}
+	// в шаблоне — последний день выгрузки, а не начало следующего
+	if _, err := time.ParseInLocation(time.DateOnly, q.Get("to"), time.Local); err == nil {
+		opts.To = f.To.AddDate(0, 0, -1)
+	}
+	if err := export.Render(&buf, format, entries, opts); err != nil {
+		log.Printf("❌ Export: %v", err)
+		writeError(w, http.StatusInternalServerError, "export failed: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", mime)
+	w.Header().Set("Content-Disposition", `attachment; filename="diary.`+ext+`"`)
+	w.Write(buf.Bytes())
+}
+
+// parseTime принимает RFC3339 или дату YYYY-MM-DD. Для верхней границы
+// дата включается целиком: to=2026-03-01 значит "до конца 1 марта".
+func parseTime(v string, upper bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrRevisionNotFound) || errors.Is(err, store.ErrRuleNotFound) ||
+		errors.Is(err, store.ErrJobNotFound) || errors.Is(err, store.ErrTaskNotFound) || errors.Is(err, store.ErrUserNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Printf("❌ API: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
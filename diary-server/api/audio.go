@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"strconv"
+
+	"bhl-diary/align"
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+)
+
+// audioPadding запас вокруг фрагмента, чтобы не срезать начало и конец слова
+const audioPadding = 0.15
+
+// entryResponse запись с привязкой слов ко времени для подсветки при
+// воспроизведении и делами, найденными в ней
+type entryResponse struct {
+	*store.Entry
+	Audio     string        `json:"audio,omitempty"` // URL аудио записи
+	Alignment []align.Word  `json:"alignment,omitempty"`
+	Tasks     []*store.Task `json:"tasks,omitempty"` // дела из этой записи
+}
+
+func newEntryResponse(e *store.Entry) entryResponse {
+	resp := entryResponse{Entry: e}
+	if e.Audio != "" {
+		resp.Audio = "/api/v1/entries/" + e.ID + "/audio"
+		resp.Alignment = align.Entry(e)
+	}
+	return resp
+}
+
+// entryAudio отрезок аудио записи как WAV с поддержкой Range:
+// ?word=N, ?from=N&to=M (слова включительно), ?sentence=N; без параметров — вся запись
+func (s *Server) entryAudio(w http.ResponseWriter, r *http.Request, user string) {
+	e, err := s.store.GetEntry(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if e.Audio == "" {
+		writeError(w, http.StatusNotFound, "entry has no audio")
+		return
+	}
+	words := align.Entry(e)
+	if len(words) == 0 {
+		writeError(w, http.StatusNotFound, "entry has no word timings")
+		return
+	}
+
+	from, to, err := audioSpan(r, words)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	start, end, ok := align.Span(words, from, to)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no timing for the requested words")
+		return
+	}
+
+	f, err := crypt.OpenFile(s.keys, user, e.Audio)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(w, http.StatusNotFound, "audio file is missing")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	defer f.Close()
+	total, err := wavSamples(f, f.Size())
+	if err != nil {
+		writeStoreError(w, fmt.Errorf("audio %s: %w", e.Audio, err))
+		return
+	}
+
+	first := max(int64(math.Floor((start-audioPadding)*wshandler.RecordingRate)), 0)
+	last := min(int64(math.Ceil((end+audioPadding)*wshandler.RecordingRate)), total)
+	if last <= first {
+		writeError(w, http.StatusNotFound, "span is outside the recording")
+		return
+	}
+
+	slice := &wavSlice{header: wshandler.WAVHeader((last - first) * 2), f: f, offset: 44 + first*2}
+	size := int64(len(slice.header)) + (last-first)*2
+	w.Header().Set("Content-Type", "audio/wav")
+	http.ServeContent(w, r, "", e.UpdatedAt, io.NewSectionReader(slice, 0, size))
+}
+
+// audioSpan номера первого и последнего слова из параметров запроса
+func audioSpan(r *http.Request, words []align.Word) (int, int, error) {
+	q := r.URL.Query()
+	index := func(name string) (int, error) {
+		n, err := strconv.Atoi(q.Get(name))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("bad %s", name)
+		}
+		return n, nil
+	}
+
+	switch {
+	case q.Has("sentence"):
+		n, err := index("sentence")
+		if err != nil {
+			return 0, 0, err
+		}
+		from, to, ok := align.Sentence(words, n)
+		if !ok {
+			return 0, 0, fmt.Errorf("sentence %d out of range", n)
+		}
+		return from, to, nil
+	case q.Has("word"):
+		n, err := index("word")
+		if err != nil {
+			return 0, 0, err
+		}
+		if n >= len(words) {
+			return 0, 0, fmt.Errorf("word %d out of range", n)
+		}
+		return n, n, nil
+	case q.Has("from") || q.Has("to"):
+		from, err := index("from")
+		if err != nil {
+			return 0, 0, err
+		}
+		to, err := index("to")
+		if err != nil {
+			return 0, 0, err
+		}
+		if from > to || to >= len(words) {
+			return 0, 0, fmt.Errorf("words %d..%d out of range", from, to)
+		}
+		return from, to, nil
+	}
+	return 0, len(words) - 1, nil
+}
+
+// wavSamples проверяет, что файл — запись wshandler (16 кГц моно 16 бит,
+// данные сразу за 44-байтным заголовком), и возвращает число отсчётов
+func wavSamples(f io.ReaderAt, size int64) (int64, error) {
+	var h [44]byte
+	if _, err := f.ReadAt(h[:], 0); err != nil {
+		return 0, err
+	}
+	if string(h[0:4]) != "RIFF" || string(h[8:16]) != "WAVEfmt " || string(h[36:40]) != "data" ||
+		binary.LittleEndian.Uint16(h[20:]) != 1 || binary.LittleEndian.Uint16(h[22:]) != 1 ||
+		binary.LittleEndian.Uint32(h[24:]) != wshandler.RecordingRate || binary.LittleEndian.Uint16(h[34:]) != 16 {
+		return 0, fmt.Errorf("not a 16 kHz mono PCM recording")
+	}
+	// размер в заголовке ставится при закрытии; у прерванной записи он 0
+	n := int64(binary.LittleEndian.Uint32(h[40:]))
+	if n == 0 || n > size-44 {
+		n = size - 44
+	}
+	return n / 2, nil
+}
+
+// wavSlice новый заголовок плюс участок данных исходного файла
+type wavSlice struct {
+	header []byte
+	f      io.ReaderAt
+	offset int64 // начало участка в файле
+}
+
+func (s *wavSlice) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < int64(len(s.header)) {
+		n = copy(p, s.header[off:])
+		if n == len(p) {
+			return n, nil
+		}
+	}
+	m, err := s.f.ReadAt(p[n:], s.offset+off+int64(n)-int64(len(s.header)))
+	return n + m, err
+}
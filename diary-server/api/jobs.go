@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bhl-diary/insights"
+	"bhl-diary/jobs"
+	"bhl-diary/store"
+)
+
+// KindTranscribe задача расшифровки загруженного аудио
+const KindTranscribe = "transcribe"
+
+// TranscribeInput параметры задачи transcribe
+type TranscribeInput struct {
+	File string `json:"file"` // путь к сохранённому файлу
+	Name string `json:"name"` // имя файла у пользователя
+}
+
+// uploadTimeout сколько можно загружать один файл: час диктофона в WAV — сотни МБ
+const uploadTimeout = 30 * time.Minute
+
+// SetUploads включает /api/v1/uploads и /api/v1/jobs
+func (s *Server) SetUploads(q *jobs.Queue, dir string, maxBytes int64) {
+	s.jobs = q
+	s.uploadsDir = dir
+	s.maxUpload = maxBytes
+}
+
+// upload сохраняет аудиофайл (multipart, поле file) и ставит расшифровку в очередь
+func (s *Server) upload(w http.ResponseWriter, r *http.Request, user string) {
+	// общий ReadTimeout сервера рассчитан на JSON, не на большие файлы
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(uploadTimeout))
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload+1<<20) // +1 МБ на заголовки multipart
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "multipart form expected")
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			writeError(w, http.StatusBadRequest, "file is required")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad multipart: "+err.Error())
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		s.saveUpload(w, r, user, part.FileName(), part)
+		return
+	}
+}
+
+func (s *Server) saveUpload(w http.ResponseWriter, r *http.Request, user, name string, body io.Reader) {
+	job := &store.Job{User: user, Kind: KindTranscribe, CreatedAt: time.Now()}
+	job.ID = store.NewID(job.CreatedAt)
+
+	if err := os.MkdirAll(s.uploadsDir, 0o755); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	path := filepath.Join(s.uploadsDir, job.ID+ext)
+	f, err := os.Create(path)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	n, err := io.Copy(f, io.LimitReader(body, s.maxUpload+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > s.maxUpload {
+		err = &http.MaxBytesError{Limit: s.maxUpload}
+	}
+	if err != nil {
+		os.Remove(path)
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than %d MB", s.maxUpload>>20))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "upload failed: "+err.Error())
+		return
+	}
+	if n == 0 {
+		os.Remove(path)
+		writeError(w, http.StatusBadRequest, "file is empty")
+		return
+	}
+
+	input, _ := json.Marshal(TranscribeInput{File: path, Name: filepath.Base(name)})
+	job.Input = string(input)
+	if err := s.jobs.Submit(r.Context(), job); err != nil {
+		os.Remove(path)
+		writeStoreError(w, err)
+		return
+	}
+	log.Printf("📥 Загружен %s (%d КБ), задача %s", name, n>>10, job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request, user string) {
+	limit := defaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxLimit {
+			writeError(w, http.StatusBadRequest, "bad limit")
+			return
+		}
+	}
+	list, err := s.store.ListJobs(r.Context(), user, limit)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if list == nil {
+		list = []*store.Job{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": list})
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request, user string) {
+	j, err := s.store.GetJob(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// cancelJob снимает задачу; завершённую возвращает как есть с 409
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request, user string) {
+	j, err := s.jobs.Cancel(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if j.Status != store.JobCanceled {
+		writeJSON(w, http.StatusConflict, j)
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// SetInsights включает POST /api/v1/entries/{id}/insights — повторный
+// разбор записи локальной моделью
+func (s *Server) SetInsights(q *jobs.Queue) {
+	s.jobs = q
+	s.insights = true
+}
+
+// regenerateInsights ставит запись на разбор заново, например после правки
+func (s *Server) regenerateInsights(w http.ResponseWriter, r *http.Request, user string) {
+	e, err := s.store.GetEntry(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	queued, err := insights.Enqueue(r.Context(), s.jobs, user, e.ID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, queued[0])
+}
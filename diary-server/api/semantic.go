@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bhl-diary/semantic"
+)
+
+// maxK больше записей не ищем и не отдаём модели
+const maxK = 20
+
+// SetSemantic включает /api/v1/search/semantic и /api/v1/ask.
+// asker может быть nil — тогда только поиск.
+func (s *Server) SetSemantic(ix *semantic.Index, asker *semantic.Asker) {
+	s.semantic = ix
+	s.asker = asker
+}
+
+func parseK(v string) (int, bool) {
+	if v == "" {
+		return 0, true
+	}
+	k, err := strconv.Atoi(v)
+	return k, err == nil && k > 0 && k <= maxK
+}
+
+// semanticSearch записи, близкие к запросу по смыслу, а не по словам
+func (s *Server) semanticSearch(w http.ResponseWriter, r *http.Request, user string) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	k, ok := parseK(r.URL.Query().Get("k"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "k must be 1.."+strconv.Itoa(maxK))
+		return
+	}
+
+	// векторы досчитываются фоновой задачей; здесь — догоняем то, что она не успела
+	if _, err := s.semantic.Sync(r.Context(), user); err != nil {
+		writeModelError(w, err)
+		return
+	}
+	hits, err := s.semantic.Search(r.Context(), user, q, k)
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	if hits == nil {
+		hits = []semantic.Hit{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"hits": hits})
+}
+
+// ask ответ на вопрос по дневнику со ссылками на записи
+func (s *Server) ask(w http.ResponseWriter, r *http.Request, user string) {
+	var req struct {
+		Question string `json:"question"`
+		K        int    `json:"k"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Question) == "" {
+		writeError(w, http.StatusBadRequest, "question is required")
+		return
+	}
+	if req.K < 0 || req.K > maxK {
+		writeError(w, http.StatusBadRequest, "k must be 1.."+strconv.Itoa(maxK))
+		return
+	}
+
+	if _, err := s.semantic.Sync(r.Context(), user); err != nil {
+		writeModelError(w, err)
+		return
+	}
+	answer, err := s.asker.Ask(r.Context(), user, strings.TrimSpace(req.Question), req.K)
+	if err != nil {
+		writeModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, answer)
+}
+
+// writeModelError модель недоступна или ответила не по формату
+func writeModelError(w http.ResponseWriter, err error) {
+	log.Printf("❌ API: модель: %v", err)
+	writeError(w, http.StatusBadGateway, "model unavailable")
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"bhl-diary/analytics"
+)
+
+// SetStats включает /api/v1/stats
+func (s *Server) SetStats(ix *analytics.Index) {
+	s.stats = ix
+}
+
+// getStats слова, минуты и темп по дням/неделям/месяцам, серии и частые слова
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request, user string) {
+	q := r.URL.Query()
+	aq := analytics.Query{User: user, Group: q.Get("group")}
+	switch aq.Group {
+	case "", analytics.GroupDay, analytics.GroupWeek, analytics.GroupMonth:
+	default:
+		writeError(w, http.StatusBadRequest, "group must be day, week or month")
+		return
+	}
+
+	var err error
+	if aq.From, err = parseTime(q.Get("from"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "bad from: "+err.Error())
+		return
+	}
+	if aq.To, err = parseTime(q.Get("to"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "bad to: "+err.Error())
+		return
+	}
+	if v := q.Get("top"); v != "" {
+		if aq.Top, err = strconv.Atoi(v); err != nil || aq.Top <= 0 || aq.Top > 100 {
+			writeError(w, http.StatusBadRequest, "top must be 1..100")
+			return
+		}
+	}
+
+	report, err := s.stats.Report(r.Context(), aq)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bhl-diary/export"
+	"bhl-diary/store"
+)
+
+// taskFilter общие параметры списка и выгрузки: ?done, ?from, ?to (по сроку), ?entry
+func taskFilter(r *http.Request, user string) (store.TaskFilter, string) {
+	q := r.URL.Query()
+	f := store.TaskFilter{User: user, EntryID: q.Get("entry")}
+	if v := q.Get("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, "done must be true or false"
+		}
+		f.Done = &done
+	}
+	var err error
+	if f.From, err = parseTime(q.Get("from"), false); err != nil {
+		return f, "bad from: " + err.Error()
+	}
+	if f.To, err = parseTime(q.Get("to"), true); err != nil {
+		return f, "bad to: " + err.Error()
+	}
+	return f, ""
+}
+
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request, user string) {
+	f, msg := taskFilter(r, user)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	f.Limit = maxLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 || f.Limit > maxLimit {
+			writeError(w, http.StatusBadRequest, "limit must be 1.."+strconv.Itoa(maxLimit))
+			return
+		}
+	}
+	tasks, err := s.store.ListTasks(r.Context(), f)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if tasks == nil {
+		tasks = []*store.Task{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tasks": tasks})
+}
+
+// exportTasks дела в iCalendar; по умолчанию только открытые
+func (s *Server) exportTasks(w http.ResponseWriter, r *http.Request, user string) {
+	f, msg := taskFilter(r, user)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if f.Done == nil {
+		open := false
+		f.Done = &open
+	}
+	tasks, err := s.store.ListTasks(r.Context(), f)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := export.Calendar(&buf, tasks, r.URL.Query().Get("title")); err != nil {
+		log.Printf("❌ Export: %v", err)
+		writeError(w, http.StatusInternalServerError, "export failed: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", export.ICSContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="tasks.ics"`)
+	w.Write(buf.Bytes())
+}
+
+type taskUpdate struct {
+	Text    *string `json:"text"`
+	Due     *string `json:"due"` // RFC 3339 — со временем, YYYY-MM-DD — на весь день, "" — без срока
+	HasTime *bool   `json:"has_time"`
+	Done    *bool   `json:"done"`
+}
+
+func (s *Server) updateTask(w http.ResponseWriter, r *http.Request, user string) {
+	var req taskUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+	t, err := s.store.GetTask(r.Context(), user, r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if req.Text != nil {
+		text := strings.TrimSpace(*req.Text)
+		if text == "" {
+			writeError(w, http.StatusBadRequest, "text must not be empty")
+			return
+		}
+		t.Text = text
+	}
+	if req.Due != nil {
+		switch v := *req.Due; {
+		case v == "":
+			t.Due, t.HasTime = time.Time{}, false
+		default:
+			if due, err := time.Parse(time.RFC3339, v); err == nil {
+				t.Due, t.HasTime = due, true
+			} else if due, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+				t.Due, t.HasTime = due, false
+			} else {
+				writeError(w, http.StatusBadRequest, "bad due: "+err.Error())
+				return
+			}
+		}
+	}
+	if req.HasTime != nil {
+		t.HasTime = *req.HasTime && !t.Due.IsZero()
+	}
+	if req.Done != nil {
+		t.Done = *req.Done
+	}
+
+	if err := s.store.UpdateTask(r.Context(), t); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) deleteTask(w http.ResponseWriter, r *http.Request, user string) {
+	if err := s.store.DeleteTask(r.Context(), user, r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mbykov/wshandler-go"
+)
+
+// tokenAuth проверка по статическим токенам из конфига (token → пользователь).
+// Браузер не умеет ставить заголовки на WebSocket, поэтому токен
+// принимается и из ?token=, и из Authorization: Bearer.
+func tokenAuth(tokens map[string]string) wshandler.Authenticator {
+	return func(r *http.Request) (string, bool) {
+		token := r.URL.Query().Get("token")
+		if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimPrefix(h, "Bearer ")
+		}
+		user, ok := tokens[token]
+		return user, ok && token != ""
+	}
+}
+
+// anyAuth пропускает запрос, если его принял хотя бы один способ; nil пропускаются
+func anyAuth(auths ...wshandler.Authenticator) wshandler.Authenticator {
+	return func(r *http.Request) (string, bool) {
+		for _, a := range auths {
+			if a == nil {
+				continue
+			}
+			if user, ok := a(r); ok {
+				return user, true
+			}
+		}
+		return "", false
+	}
+}
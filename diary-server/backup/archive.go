@@ -0,0 +1,265 @@
+// Package backup резервные копии дневника. Архив .tar.gz содержит
+// согласованный снимок базы (VACUUM INTO, сервер при этом работает),
+// аудио записей из этого снимка, индексы, keys.json и конфиг; последним
+// в архиве лежит manifest.json с SHA-256 каждого файла.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+)
+
+const (
+	ManifestName  = "manifest.json"
+	dbName        = "diary.db"
+	configName    = "config.yaml"
+	formatVersion = 1
+)
+
+// indexDirs каталоги search.Open, analytics.Open и semantic.Open в каталоге данных
+var indexDirs = []string{"index", "stats", "vectors"}
+
+// Snapshotter бэкенд, который умеет согласованный снимок и проверку
+// страниц (store.SQLite)
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+	Check(ctx context.Context) ([]string, error)
+}
+
+// Source что копировать
+type Source struct {
+	Store  store.Store
+	Dir    string // каталог данных
+	Config string // путь к config.yaml; пусто — без конфига
+}
+
+// File файл архива
+type File struct {
+	Name   string `json:"name"`           // путь в архиве
+	Path   string `json:"path,omitempty"` // исходный путь аудио: туда оно и вернётся
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest опись архива
+type Manifest struct {
+	Version   int       `json:"version"` // формат архива
+	Schema    int       `json:"schema"`  // версия схемы базы
+	Created   time.Time `json:"created"`
+	Encrypted bool      `json:"encrypted"`         // дневник зашифрован, в архиве keys.json
+	Files     []File    `json:"files"`             // без самого manifest.json
+	Missing   []string  `json:"missing,omitempty"` // аудио, на которое ссылаются записи, но файла нет
+}
+
+// Size сколько байт в файлах архива до сжатия
+func (m *Manifest) Size() int64 {
+	var n int64
+	for _, f := range m.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// Find файл архива по имени
+func (m *Manifest) Find(name string) (File, bool) {
+	for _, f := range m.Files {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return File{}, false
+}
+
+// ArchiveName имя копии по времени: bhl-diary-20261018T030000.tar.gz
+func ArchiveName(t time.Time) string {
+	return "bhl-diary-" + t.Format("20060102T150405") + ".tar.gz"
+}
+
+// CreateFile пишет копию в path; недописанный архив не остаётся
+func CreateFile(ctx context.Context, src Source, path string) (*Manifest, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Create(ctx, src, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return m, nil
+}
+
+// Create пишет копию в w. База — снимок на момент начала; аудио — то,
+// на которое ссылаются записи снимка (WAV идущей диктовки не попадает).
+// Индексы копируются как есть: при загрузке они сверяются с базой и
+// догоняют её сами.
+func Create(ctx context.Context, src Source, w io.Writer) (*Manifest, error) {
+	snap, ok := src.Store.(Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %T does not support backups", src.Store)
+	}
+	// снимок рядом с базой: в /tmp может не хватить места
+	tmp, err := os.MkdirTemp(src.Dir, ".backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	dbPath := filepath.Join(tmp, dbName)
+	if err := snap.Snapshot(ctx, dbPath); err != nil {
+		return nil, err
+	}
+	audio, err := snapshotAudio(ctx, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Version: formatVersion, Schema: store.SchemaVersion(), Created: time.Now()}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name, file, orig string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		f, err := addFile(tw, name, file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		f.Path = orig
+		m.Files = append(m.Files, f)
+		return nil
+	}
+
+	if err := add(dbName, dbPath, ""); err != nil {
+		return nil, err
+	}
+	if keys := filepath.Join(src.Dir, crypt.KeyringFile); exists(keys) {
+		m.Encrypted = true
+		if err := add(crypt.KeyringFile, keys, ""); err != nil {
+			return nil, err
+		}
+	}
+	if src.Config != "" && exists(src.Config) {
+		if err := add(configName, src.Config, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, dir := range indexDirs {
+		files, err := os.ReadDir(filepath.Join(src.Dir, dir))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() || strings.HasSuffix(f.Name(), ".tmp") {
+				continue
+			}
+			if err := add(path.Join(dir, f.Name()), filepath.Join(src.Dir, dir, f.Name()), ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	for _, a := range audio {
+		if !exists(a.Path) {
+			m.Missing = append(m.Missing, a.Path)
+			continue
+		}
+		// одинаковые имена из разных каталогов не должны затирать друг друга
+		name := "audio/" + filepath.Base(a.Path)
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("audio/%d-%s", i, filepath.Base(a.Path))
+		}
+		names[name] = true
+		if err := add(name, a.Path, a.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0o600, Size: int64(len(data)), ModTime: m.Created}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// snapshotAudio аудио записей из снимка базы в dir
+func snapshotAudio(ctx context.Context, dir string) ([]store.AudioFile, error) {
+	st, err := store.OpenSQLite(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	return st.ListAudioFiles(ctx)
+}
+
+// addFile кладёт файл в архив и считает его сумму по тем же байтам
+func addFile(tw *tar.Writer, name, path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return File{}, err
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, h), f, info.Size()); err != nil {
+		return File{}, err
+	}
+	return File{Name: name, Size: info.Size(), SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,205 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+)
+
+var (
+	ErrNotEmpty   = errors.New("data dir already has a diary")
+	ErrNoManifest = errors.New("archive has no manifest")
+	ErrDamaged    = errors.New("archive is damaged")
+)
+
+// Target куда восстанавливать
+type Target struct {
+	Dir    string // каталог данных
+	Config string // куда положить config.yaml из архива; пусто — не трогать конфиг
+	Force  bool   // заменить существующий дневник
+}
+
+// VerifyArchive читает архив целиком и сверяет каждый файл с описью
+func VerifyArchive(path string) (*Manifest, error) {
+	var m *Manifest
+	sums := map[string]File{}
+	err := walk(path, func(name string, r io.Reader) error {
+		if name == ManifestName {
+			m = &Manifest{}
+			return json.NewDecoder(r).Decode(m)
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return err
+		}
+		sums[name] = File{Name: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrNoManifest
+	}
+	if m.Version > formatVersion || m.Schema > store.SchemaVersion() {
+		return nil, fmt.Errorf("archive is from a newer bhl-diary (format %d, schema %d)", m.Version, m.Schema)
+	}
+
+	var problems []string
+	for _, f := range m.Files {
+		got, ok := sums[f.Name]
+		switch {
+		case !ok:
+			problems = append(problems, f.Name+": missing")
+		case got.Size != f.Size || got.SHA256 != f.SHA256:
+			problems = append(problems, f.Name+": checksum mismatch")
+		}
+		delete(sums, f.Name)
+	}
+	for name := range sums {
+		problems = append(problems, name+": not in manifest")
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return m, fmt.Errorf("%w: %s", ErrDamaged, strings.Join(problems, "; "))
+	}
+	return m, nil
+}
+
+// Restore проверяет архив и раскладывает его: базу, ключи и индексы — в
+// каталог данных, аудио — по исходным путям, конфиг — в t.Config.
+// Сервер должен быть остановлен.
+func Restore(path string, t Target) (*Manifest, error) {
+	m, err := VerifyArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	db := filepath.Join(t.Dir, dbName)
+	if exists(db) && !t.Force {
+		return nil, ErrNotEmpty
+	}
+	// журнал прежней базы к восстановленной не относится
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(db + suffix); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	err = walk(path, func(name string, r io.Reader) error {
+		f, ok := m.Find(name)
+		if !ok {
+			return nil
+		}
+		dst := destination(t, f)
+		if dst == "" {
+			return nil
+		}
+		return writeFile(dst, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func destination(t Target, f File) string {
+	switch {
+	case f.Name == configName:
+		return t.Config
+	case strings.HasPrefix(f.Name, "audio/"):
+		return f.Path
+	case f.Name == dbName, f.Name == crypt.KeyringFile:
+		return filepath.Join(t.Dir, f.Name)
+	}
+	for _, dir := range indexDirs {
+		if strings.HasPrefix(f.Name, dir+"/") {
+			return filepath.Join(t.Dir, filepath.FromSlash(f.Name))
+		}
+	}
+	return ""
+}
+
+// walk обходит обычные файлы архива; имена вне архива не принимаются
+func walk(path string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDamaged, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDamaged, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) {
+			return fmt.Errorf("%w: bad file name %q", ErrDamaged, hdr.Name)
+		}
+		if err := fn(hdr.Name, damagedReader{tr}); err != nil {
+			return err
+		}
+	}
+}
+
+// damagedReader ошибки чтения архива (обрыв, сумма gzip, испорченный
+// deflate) — это ErrDamaged, а не ошибки записи на диск
+type damagedReader struct{ r io.Reader }
+
+func (d damagedReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %v", ErrDamaged, err)
+	}
+	return n, err
+}
+
+// writeFile пишет через временный файл: прерванное восстановление не
+// оставляет полуфайлов
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config секция backup в config.yaml: копии по расписанию
+type Config struct {
+	Dir           string `yaml:"dir"`            // куда складывать копии; пусто — без расписания
+	IntervalHours int    `yaml:"interval_hours"` // по умолчанию 24
+	// Сколько хранить: по последней копии за день, неделю и месяц.
+	// Все три нуля — 7, 4 и 12.
+	KeepDaily   int `yaml:"keep_daily"`
+	KeepWeekly  int `yaml:"keep_weekly"`
+	KeepMonthly int `yaml:"keep_monthly"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.IntervalHours <= 0 {
+		c.IntervalHours = 24
+	}
+	if c.KeepDaily <= 0 && c.KeepWeekly <= 0 && c.KeepMonthly <= 0 {
+		c.KeepDaily, c.KeepWeekly, c.KeepMonthly = 7, 4, 12
+	}
+	return c
+}
+
+// Archive копия в каталоге расписания
+type Archive struct {
+	Path    string
+	Created time.Time
+}
+
+// List копии в dir по ArchiveName, новые первыми
+func List(dir string) ([]Archive, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []Archive
+	for _, f := range files {
+		stamp, ok := strings.CutPrefix(f.Name(), "bhl-diary-")
+		if !ok || f.IsDir() {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, ".tar.gz")
+		if !ok {
+			continue
+		}
+		t, err := time.ParseInLocation("20060102T150405", stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		out = append(out, Archive{Path: filepath.Join(dir, f.Name()), Created: t})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// Prune удаляет копии сверх правил хранения; самая новая остаётся всегда.
+// Возвращает удалённые.
+func Prune(dir string, c Config) ([]string, error) {
+	archives, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	keep := retain(archives, c.withDefaults())
+	var removed []string
+	for _, a := range archives {
+		if keep[a.Path] {
+			continue
+		}
+		if err := os.Remove(a.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, a.Path)
+	}
+	return removed, nil
+}
+
+// retain какие копии оставить: в каждом из последних n дней, недель и
+// месяцев — самую новую копию этого периода
+func retain(archives []Archive, c Config) map[string]bool {
+	keep := map[string]bool{}
+	if len(archives) > 0 {
+		keep[archives[0].Path] = true
+	}
+	periods := []struct {
+		n   int
+		key func(time.Time) string
+	}{
+		{c.KeepDaily, func(t time.Time) string { return t.Format(time.DateOnly) }},
+		{c.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}},
+		{c.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, p := range periods {
+		seen := map[string]bool{}
+		for _, a := range archives {
+			k := p.key(a.Created)
+			if seen[k] {
+				continue
+			}
+			if len(seen) >= p.n {
+				break
+			}
+			seen[k] = true
+			keep[a.Path] = true
+		}
+	}
+	return keep
+}
+
+// Run делает копии в c.Dir раз в interval_hours до отмены ctx. Первая —
+// через интервал после последней копии в каталоге, а если её нет — сразу.
+func Run(ctx context.Context, src Source, c Config) {
+	c = c.withDefaults()
+	interval := time.Duration(c.IntervalHours) * time.Hour
+
+	next := time.Now()
+	if archives, err := List(c.Dir); err != nil {
+		log.Printf("⚠️ Каталог резервных копий %s: %v", c.Dir, err)
+	} else if len(archives) > 0 {
+		next = archives[0].Created.Add(interval)
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		now := time.Now()
+		next = now.Add(interval)
+
+		path := filepath.Join(c.Dir, ArchiveName(now))
+		start := time.Now()
+		m, err := CreateFile(ctx, src, path)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("❌ Резервная копия не удалась: %v", err)
+			}
+			continue
+		}
+		log.Printf("💾 Резервная копия %s: %d файлов, %d МБ за %v",
+			path, len(m.Files), m.Size()>>20, time.Since(start).Round(time.Second))
+		if len(m.Missing) > 0 {
+			log.Printf("⚠️ Аудио нет на диске: %d файлов (bhl-diary verify)", len(m.Missing))
+		}
+		removed, err := Prune(c.Dir, c)
+		if err != nil {
+			log.Printf("⚠️ Ротация резервных копий: %v", err)
+		}
+		for _, p := range removed {
+			log.Printf("🗑 Старая копия удалена: %s", filepath.Base(p))
+		}
+	}
+}
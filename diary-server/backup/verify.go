@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"bhl-diary/store"
+)
+
+// Report итог проверки дневника на месте
+type Report struct {
+	DB       []string // ошибки страниц, индексов и связей базы
+	Audio    int      // проверено файлов аудио
+	Recorded int      // из них сумма записана впервые: аудио из времени до проверок
+	Missing  []string // файла нет
+	Changed  []string // сумма не совпала: файл повреждён или подменён
+}
+
+// OK проблем нет
+func (r *Report) OK() bool {
+	return len(r.DB) == 0 && len(r.Missing) == 0 && len(r.Changed) == 0
+}
+
+// Verify проверяет базу (integrity_check, foreign_key_check) и сверяет
+// аудио записей с контрольными суммами. Аудио без суммы получает её сейчас.
+func Verify(ctx context.Context, st store.Store) (*Report, error) {
+	snap, ok := st.(Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %T does not support checks", st)
+	}
+	rep := &Report{}
+	var err error
+	if rep.DB, err = snap.Check(ctx); err != nil {
+		return nil, err
+	}
+
+	audio, err := st.ListAudioFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range audio {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sum, size, err := store.FileChecksum(a.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			rep.Missing = append(rep.Missing, a.Path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rep.Audio++
+		if a.SHA256 == "" {
+			if err := st.SetAudioChecksum(ctx, &store.AudioFile{Path: a.Path, User: a.User, SHA256: sum, Size: size}); err != nil {
+				return nil, err
+			}
+			rep.Recorded++
+			continue
+		}
+		if sum != a.SHA256 || size != a.Size {
+			rep.Changed = append(rep.Changed, a.Path)
+		}
+	}
+	return rep, nil
+}
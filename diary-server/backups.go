@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bhl-diary/backup"
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+)
+
+// openPlainStore хранилище без ключей: копированию и проверке
+// расшифровка не нужна, парольная фраза не спрашивается
+func openPlainStore(cfg Config) store.Store {
+	st, err := store.Open(cfg.Storage)
+	if err != nil {
+		log.Fatalf("❌ Ошибка открытия хранилища: %v", err)
+	}
+	return st
+}
+
+// runBackup bhl-diary backup [-o archive.tar.gz]; без -o — в backup.dir с ротацией
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	out := fs.String("o", "", "файл архива (по умолчанию — новый архив в backup.dir)")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	path := *out
+	if path == "" {
+		if cfg.Backup.Dir == "" {
+			log.Fatal("❌ Укажите -o или backup.dir в конфиге")
+		}
+		path = filepath.Join(cfg.Backup.Dir, backup.ArchiveName(time.Now()))
+	}
+
+	st := openPlainStore(cfg)
+	defer st.Close()
+	start := time.Now()
+	m, err := backup.CreateFile(context.Background(), backup.Source{Store: st, Dir: cfg.Storage.Dir, Config: *configPath}, path)
+	if err != nil {
+		log.Fatalf("❌ Резервная копия не удалась: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "✅ %s: %d файлов, %d МБ за %v\n", path, len(m.Files), m.Size()>>20, time.Since(start).Round(time.Millisecond))
+	for _, p := range m.Missing {
+		fmt.Fprintf(os.Stderr, "⚠️ Аудио нет на диске: %s\n", p)
+	}
+
+	if *out == "" {
+		removed, err := backup.Prune(cfg.Backup.Dir, cfg.Backup)
+		if err != nil {
+			log.Fatalf("❌ Ротация копий: %v", err)
+		}
+		for _, p := range removed {
+			fmt.Fprintf(os.Stderr, "🗑 Старая копия удалена: %s\n", filepath.Base(p))
+		}
+	}
+}
+
+// runRestore bhl-diary restore -i archive.tar.gz [-force]; сервер должен быть остановлен
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	in := fs.String("i", "", "архив bhl-diary backup")
+	force := fs.Bool("force", false, "заменить существующий дневник")
+	fs.Parse(args)
+
+	if *in == "" {
+		log.Fatal("❌ Не указан -i")
+	}
+	cfg := loadConfig(*configPath)
+	// конфиг из архива кладём рядом: действующий может отличаться намеренно
+	restored := *configPath + ".restored"
+	m, err := backup.Restore(*in, backup.Target{Dir: cfg.Storage.Dir, Config: restored, Force: *force})
+	if errors.Is(err, backup.ErrNotEmpty) {
+		log.Fatalf("❌ В %s уже есть дневник: остановите сервер и повторите с -force", cfg.Storage.Dir)
+	}
+	if err != nil {
+		log.Fatalf("❌ Восстановление не удалось: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "✅ Восстановлено %d файлов из копии от %s\n", len(m.Files), m.Created.Format("2006-01-02 15:04"))
+	if _, ok := m.Find("config.yaml"); ok {
+		fmt.Fprintf(os.Stderr, "📄 Конфиг из копии: %s\n", restored)
+	}
+	if m.Encrypted {
+		fmt.Fprintln(os.Stderr, "🔒 Дневник зашифрован: нужна парольная фраза, действовавшая на момент копии")
+	}
+}
+
+// runVerify bhl-diary verify [-archive archive.tar.gz]: база и аудио на месте или архив
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	archive := fs.String("archive", "", "проверить архив вместо дневника")
+	fs.Parse(args)
+
+	if *archive != "" {
+		m, err := backup.VerifyArchive(*archive)
+		if err != nil {
+			log.Fatalf("❌ %s: %v", *archive, err)
+		}
+		fmt.Printf("✅ %s: %d файлов, копия от %s\n", *archive, len(m.Files), m.Created.Format("2006-01-02 15:04"))
+		return
+	}
+
+	cfg := loadConfig(*configPath)
+	st := openPlainStore(cfg)
+	defer st.Close()
+	rep, err := backup.Verify(context.Background(), st)
+	if err != nil {
+		log.Fatalf("❌ Проверка не удалась: %v", err)
+	}
+	for _, p := range rep.DB {
+		fmt.Printf("❌ База: %s\n", p)
+	}
+	for _, p := range rep.Missing {
+		fmt.Printf("❌ Аудио нет: %s\n", p)
+	}
+	for _, p := range rep.Changed {
+		fmt.Printf("❌ Аудио повреждено: %s\n", p)
+	}
+	ok := rep.OK()
+	if cfg.Encryption.Enabled && !crypt.Exists(cfg.Storage.Dir) {
+		fmt.Printf("❌ Шифрование включено, но %s нет\n", filepath.Join(cfg.Storage.Dir, crypt.KeyringFile))
+		ok = false
+	}
+	fmt.Printf("Аудио проверено: %d, сумм записано впервые: %d\n", rep.Audio, rep.Recorded)
+	if !ok {
+		os.Exit(1)
+	}
+	fmt.Println("✅ База и аудио в порядке")
+}
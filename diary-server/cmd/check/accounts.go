@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bhl-diary/accounts"
+	"bhl-diary/api"
+	"bhl-diary/corrections"
+	"bhl-diary/search"
+	"bhl-diary/store"
+	"bhl-diary/transcribe"
+	"github.com/mbykov/wshandler-go"
+)
+
+// suffixStage заглушка стадии конвейера под чужим именем: дописывает суффикс
+type suffixStage struct{ name, suffix string }
+
+func (s suffixStage) Name() string                   { return s.name }
+func (s suffixStage) Process(seg *wshandler.Segment) { seg.Text += s.suffix }
+
+// checkAccounts учётные записи: регистрация, вход по паролю с cookie и
+// токеном, выход, смена пароля; один пользователь не читает и не меняет
+// чужое ни через хранилище, ни через API; личные настройки доходят до
+// распознавателя и конвейера
+func checkAccounts(ctx context.Context, dir string) error {
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	ix, err := search.Open(dir, st)
+	if err != nil {
+		return err
+	}
+	indexed := search.NewIndexedStore(st, ix)
+
+	// данные анны: запись с ревизией и аудио, дело, правило, задача
+	anna := &store.Entry{User: "anna", Text: "Секретный рецепт пирога с черникой.", Audio: filepath.Join(dir, "anna.wav")}
+	if err := indexed.CreateEntry(ctx, anna); err != nil {
+		return err
+	}
+	os.WriteFile(anna.Audio, []byte("RIFF"), 0o600)
+	task := &store.Task{User: "anna", EntryID: anna.ID, Text: "Купить чернику"}
+	if err := st.CreateTask(ctx, task); err != nil {
+		return err
+	}
+	rule := &store.Rule{User: "anna", From: "пирага", To: "пирога", Status: store.RuleAccepted}
+	if err := st.SaveRule(ctx, rule); err != nil {
+		return err
+	}
+	job := &store.Job{User: "anna", Kind: "wait"}
+	if err := st.CreateJob(ctx, job); err != nil {
+		return err
+	}
+	bob := &store.Entry{User: "bob", Text: "Рыбалка на рассвете."}
+	if err := indexed.CreateEntry(ctx, bob); err != nil {
+		return err
+	}
+
+	// хранилище: боб с id анны ничего не находит и ничего не меняет
+	notFound := func(what string, err error) error {
+		if err == nil {
+			return fmt.Errorf("bob: %s of anna succeeded", what)
+		}
+		return nil
+	}
+	_, err1 := st.GetEntry(ctx, "bob", anna.ID)
+	err2 := st.UpdateEntry(ctx, &store.Entry{ID: anna.ID, User: "bob", Text: "взлом"})
+	err3 := st.AddTag(ctx, "bob", anna.ID, "взлом")
+	err4 := st.RemoveTag(ctx, "bob", anna.ID, "взлом")
+	_, err5 := st.ListRevisions(ctx, "bob", anna.ID)
+	err6 := st.SetInsights(ctx, "bob", anna.ID, store.Insights{Title: "взлом"})
+	_, err7 := st.GetTask(ctx, "bob", task.ID)
+	err8 := st.UpdateTask(ctx, &store.Task{ID: task.ID, User: "bob", Text: "взлом", Done: true})
+	err9 := st.CreateTask(ctx, &store.Task{User: "bob", EntryID: anna.ID, Text: "взлом"})
+	err10 := st.DeleteRule(ctx, "bob", rule.ID)
+	_, err11 := st.GetJob(ctx, "bob", job.ID)
+	err12 := st.UpdateJob(ctx, &store.Job{ID: job.ID, User: "bob", Status: store.JobFailed})
+	_, err13 := st.CancelJob(ctx, "bob", job.ID)
+	err14 := st.DeleteTask(ctx, "bob", task.ID)
+	err15 := st.DeleteEntry(ctx, "bob", anna.ID)
+	for i, err := range []error{err1, err2, err3, err4, err5, err6, err7, err8, err9, err10, err11, err12, err13, err14, err15} {
+		if err := notFound(fmt.Sprintf("call %d", i+1), err); err != nil {
+			return err
+		}
+	}
+	entries, _ := st.ListEntries(ctx, store.Filter{User: "bob"})
+	tasks, _ := st.ListTasks(ctx, store.TaskFilter{User: "bob"})
+	rules, _ := st.ListRules(ctx, "bob")
+	jobList, _ := st.ListJobs(ctx, "bob", 10)
+	if err := expect(len(entries) == 1 && entries[0].ID == bob.ID && len(tasks) == 0 && len(rules) == 0 && len(jobList) == 0,
+		"bob lists: %d entries, %d tasks, %d rules, %d jobs", len(entries), len(tasks), len(rules), len(jobList)); err != nil {
+		return err
+	}
+	hits, err := ix.Search(ctx, search.Query{User: "bob", Text: "черникой"})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(hits) == 0, "bob finds anna's entry: %+v", hits); err != nil {
+		return err
+	}
+
+	// API с учётными записями
+	mgr := accounts.New(st, accounts.Config{Enabled: true, Registration: true, Argon2: accounts.Argon2{Time: 1, MemoryMB: 8, Threads: 1}})
+	corrector := corrections.New(st, dir)
+	corrector.SetHotwords(true, mgr.Hotwords)
+	mgr.Reserve("dave") // пользователь статического токена
+	// у анны и боба уже есть записи: учётные записи им заводит администратор
+	if _, err := mgr.Create(ctx, "anna", "черника-2026"); err != nil {
+		return err
+	}
+	if _, err := mgr.Create(ctx, "bob", "рассвет-2026"); err != nil {
+		return err
+	}
+	srv := api.New(st, mgr.Authenticate)
+	srv.SetAccounts(mgr)
+	srv.SetSearch(ix)
+	srv.SetCorrections(corrector, 2)
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// у анны cookie, у боба только токен
+	jar, _ := cookiejar.New(nil)
+	annaClient := &http.Client{Jar: jar}
+	bobClient := &http.Client{}
+	call := func(c *http.Client, token, method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	login := func(c *http.Client, user, password string) (loginResp, int) {
+		code, body := call(c, "", "POST", "/api/v1/auth/login", `{"user":"`+user+`","password":"`+password+`"}`)
+		var lr loginResp
+		json.Unmarshal([]byte(body), &lr)
+		return lr, code
+	}
+
+	steps := []struct {
+		path, body, method string
+		status             int
+	}{
+		{"/api/v1/auth/register", `{"user":"anna","password":"другой пароль"}`, "POST", 409},
+		{"/api/v1/auth/register", `{"user":"erin","password":"другой пароль"}`, "POST", 201},
+		{"/api/v1/auth/register", `{"user":"erin","password":"другой пароль"}`, "POST", 409},
+		{"/api/v1/auth/register", `{"user":"dave","password":"токен-2026"}`, "POST", 409},
+		{"/api/v1/auth/register", `{"user":"Anna Smith","password":"черника-2026"}`, "POST", 400},
+		{"/api/v1/auth/register", `{"user":"carol","password":"short"}`, "POST", 400},
+		{"/api/v1/entries", "", "GET", 401},
+	}
+	for _, s := range steps {
+		if code, body := call(http.DefaultClient, "", s.method, s.path, s.body); code != s.status {
+			return fmt.Errorf("%s %s %s: %d %s", s.method, s.path, s.body, code, body)
+		}
+	}
+	if _, code := login(bobClient, "anna", "неверный пароль"); code != 401 {
+		return expect(false, "wrong password: %d", code)
+	}
+	if _, code := login(bobClient, "nobody", "черника-2026"); code != 401 {
+		return expect(false, "unknown user: %d", code)
+	}
+	bobLogin, code := login(bobClient, "bob", "рассвет-2026")
+	if code != 200 || bobLogin.Token == "" {
+		return expect(false, "bob login: %d", code)
+	}
+	bobToken := bobLogin.Token
+	lr, code := login(annaClient, "anna", "черника-2026")
+	if code != 200 || lr.User != "anna" {
+		return expect(false, "anna login: %d %+v", code, lr)
+	}
+
+	code, body := call(annaClient, "", "GET", "/api/v1/entries", "")
+	if err := expect(code == 200 && strings.Contains(body, anna.ID) && !strings.Contains(body, bob.ID), "anna entries: %d %s", code, body); err != nil {
+		return err
+	}
+	denied := []struct{ method, path, body string }{
+		{"GET", "/api/v1/entries/" + anna.ID, ""},
+		{"PATCH", "/api/v1/entries/" + anna.ID, `{"text":"взлом"}`},
+		{"POST", "/api/v1/entries/" + anna.ID + "/tags", `{"tag":"взлом"}`},
+		{"GET", "/api/v1/entries/" + anna.ID + "/revisions", ""},
+		{"GET", "/api/v1/entries/" + anna.ID + "/audio", ""},
+		{"PATCH", "/api/v1/tasks/" + task.ID, `{"done":true}`},
+		{"DELETE", "/api/v1/tasks/" + task.ID, ""},
+		{"DELETE", fmt.Sprintf("/api/v1/corrections/%d", rule.ID), ""},
+		{"DELETE", "/api/v1/entries/" + anna.ID, ""},
+	}
+	for _, d := range denied {
+		if code, body := call(bobClient, bobToken, d.method, d.path, d.body); code != 404 {
+			return fmt.Errorf("bob %s %s: %d %s", d.method, d.path, code, body)
+		}
+	}
+	for _, path := range []string{"/api/v1/entries", "/api/v1/tasks", "/api/v1/search?q=черникой", "/api/v1/export?format=jsonl", "/api/v1/corrections"} {
+		code, body := call(bobClient, bobToken, "GET", path, "")
+		if code != 200 || strings.Contains(body, anna.ID) || strings.Contains(body, "черник") || strings.Contains(body, "пирога") {
+			return fmt.Errorf("bob GET %s: %d %s", path, code, body)
+		}
+	}
+	got, err := st.GetEntry(ctx, "anna", anna.ID)
+	if err != nil {
+		return err
+	}
+	revs, _ := st.ListRevisions(ctx, "anna", anna.ID)
+	annaTask, _ := st.GetTask(ctx, "anna", task.ID)
+	if err := expect(got.Text == anna.Text && got.Title == "" && len(got.Tags) == 0 && len(revs) == 1 && annaTask != nil && !annaTask.Done,
+		"anna's data changed: %+v %d revisions, task %+v", got, len(revs), annaTask); err != nil {
+		return err
+	}
+
+	// личные настройки: горячие слова и выключенная пунктуация у анны
+	code, body = call(annaClient, "", "PATCH", "/api/v1/me/settings", `{"hotwords":["Черника"," пирог "],"stages":{"punctuation":false}}`)
+	if err := expect(code == 200 && strings.Contains(body, `"punctuation":false`) && strings.Contains(body, `"черника"`), "settings: %d %s", code, body); err != nil {
+		return err
+	}
+	code, body = call(annaClient, "", "GET", "/api/v1/corrections/hotwords", "")
+	if err := expect(code == 200 && body == "пирог\nпирога\nчерника\n", "hotwords: %d %q", code, body); err != nil {
+		return err
+	}
+	code, body = call(bobClient, bobToken, "GET", "/api/v1/me", "")
+	if err := expect(code == 200 && strings.Contains(body, `"name":"bob"`) && !strings.Contains(body, "черника"), "bob me: %d %s", code, body); err != nil {
+		return err
+	}
+
+	wav := filepath.Join(dir, "memo.wav")
+	if err := writeWAV(wav, []bool{true, false}); err != nil {
+		return err
+	}
+	var gotHotwords []string
+	tr := &transcribe.Transcriber{
+		NewEngine: func(hotwords string) (transcribe.Engine, error) {
+			gotHotwords = append(gotHotwords, hotwords)
+			return &stubEngine{}, nil
+		},
+		Pipeline: wshandler.NewPipeline(wshandler.Stage{Processor: suffixStage{"punctuation", "!"}, On: wshandler.OnFinal, Enabled: true}),
+		Segment:  wshandler.SegmentConfig{PauseMs: 2000, LongPauseMs: 8000, MaxChars: 1000},
+		Hotwords: corrector.HotwordsFile,
+		Stages:   mgr.Stages,
+	}
+	annaRec, err := tr.Run(ctx, "a", "anna", wav, time.Now(), nil)
+	if err != nil {
+		return err
+	}
+	bobRec, err := tr.Run(ctx, "b", "bob", wav, time.Now(), nil)
+	if err != nil {
+		return err
+	}
+	hotwords, _ := os.ReadFile(gotHotwords[0])
+	if err := expect(len(annaRec.Finals) == 1 && annaRec.Finals[0].Text == "фраза 1." &&
+		len(bobRec.Finals) == 1 && bobRec.Finals[0].Text == "фраза 1.!" &&
+		strings.Contains(string(hotwords), "черника") && gotHotwords[1] == "",
+		"per-user settings: anna %+v, bob %+v, hotwords %q %q", annaRec.Finals, bobRec.Finals, gotHotwords, hotwords); err != nil {
+		return err
+	}
+	code, body = call(annaClient, "", "PATCH", "/api/v1/me/settings", `{"stages":{"punctuation":null}}`)
+	if err := expect(code == 200 && !strings.Contains(body, "punctuation") && strings.Contains(body, "черника"), "reset stage: %d %s", code, body); err != nil {
+		return err
+	}
+
+	// смена пароля закрывает все входы боба
+	if code, _ := call(bobClient, bobToken, "POST", "/api/v1/me/password", `{"old_password":"неверный","new_password":"закат-2026!"}`); code != 403 {
+		return expect(false, "password change with wrong old: %d", code)
+	}
+	code, body = call(bobClient, bobToken, "POST", "/api/v1/me/password", `{"old_password":"рассвет-2026","new_password":"закат-2026!"}`)
+	var changed loginResp
+	json.Unmarshal([]byte(body), &changed)
+	if code != 200 || changed.Token == "" {
+		return expect(false, "password change: %d %s", code, body)
+	}
+	if code, _ := call(bobClient, bobToken, "GET", "/api/v1/entries", ""); code != 401 {
+		return expect(false, "old token after password change: %d", code)
+	}
+	if code, _ := call(bobClient, changed.Token, "GET", "/api/v1/entries", ""); code != 200 {
+		return expect(false, "new token after password change: %d", code)
+	}
+
+	// выход: cookie анны больше не действует
+	if code, _ := call(annaClient, "", "POST", "/api/v1/auth/logout", ""); code != 204 {
+		return expect(false, "logout: %d", code)
+	}
+	if code, _ := call(annaClient, "", "GET", "/api/v1/entries", ""); code != 401 {
+		return expect(false, "after logout: %d", code)
+	}
+	if code, _ := call(bobClient, lr.Token, "GET", "/api/v1/entries", ""); code != 401 {
+		return expect(false, "anna's token after logout: %d", code)
+	}
+
+	// истёкшая сессия не находится; удалённый пользователь теряет входы
+	if err := st.CreateSession(ctx, &store.Session{TokenHash: "expired", User: "anna", ExpiresAt: time.Now().Add(-time.Minute)}); err != nil {
+		return err
+	}
+	if _, err := st.GetSession(ctx, "expired"); !errors.Is(err, store.ErrSessionNotFound) {
+		return expect(false, "expired session: %v", err)
+	}
+	if err := st.DeleteUser(ctx, "bob"); err != nil {
+		return err
+	}
+	if code, _ := call(bobClient, changed.Token, "GET", "/api/v1/entries", ""); code != 401 {
+		return expect(false, "deleted user: %d", code)
+	}
+	return nil
+}
+
+type loginResp struct {
+	User  string `json:"user"`
+	Token string `json:"token"`
+}
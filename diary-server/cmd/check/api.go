@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"bhl-diary/api"
+	"bhl-diary/store"
+)
+
+// checkAPI REST поверх временного хранилища: список, правка, теги, удаление
+// и то, что чужой токен не видит и не меняет записи.
+func checkAPI(ctx context.Context, dir string) error {
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	e := &store.Entry{User: "anna", Text: "на даче", CreatedAt: day}
+	if err := st.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+
+	tokens := map[string]string{"ta": "anna", "tb": "boris"}
+	auth := func(r *http.Request) (string, bool) {
+		u, ok := tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		return u, ok
+	}
+	mux := http.NewServeMux()
+	api.New(st, auth).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	call := func(token, method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	steps := []struct {
+		token, method, path, body string
+		status                    int
+		contains                  string
+	}{
+		{"", "GET", "/api/v1/entries", "", 401, "unauthorized"},
+		{"ta", "GET", "/api/v1/entries?from=2026-03-01&to=2026-03-01", "", 200, e.ID},
+		{"ta", "GET", "/api/v1/entries?from=2026-03-02", "", 200, `"entries":[]`},
+		{"tb", "GET", "/api/v1/entries/" + e.ID, "", 404, ""},
+		{"tb", "PATCH", "/api/v1/entries/" + e.ID, `{"text":"взлом"}`, 404, ""},
+		{"ta", "PATCH", "/api/v1/entries/" + e.ID, `{"text":"На даче."}`, 200, "На даче."},
+		{"ta", "POST", "/api/v1/entries/" + e.ID + "/tags", `{"tag":"Дача"}`, 200, `"tags":["дача"]`},
+		{"ta", "GET", "/api/v1/entries?tag=дача", "", 200, e.ID},
+		{"ta", "DELETE", "/api/v1/entries/" + e.ID + "/tags/дача", "", 204, ""},
+		{"ta", "GET", "/api/v1/export?from=2026-03-01&to=2026-03-01", "", 200, "from: 2026-03-01\nto: 2026-03-01\n"},
+		{"tb", "DELETE", "/api/v1/entries/" + e.ID, "", 404, ""},
+		{"ta", "DELETE", "/api/v1/entries/" + e.ID, "", 204, ""},
+		{"ta", "GET", "/api/v1/openapi.yaml", "", 200, "openapi: 3"},
+	}
+	for _, s := range steps {
+		status, body := call(s.token, s.method, s.path, s.body)
+		if status != s.status || !strings.Contains(body, s.contains) {
+			return fmt.Errorf("%s %s as %q: got %d %s", s.method, s.path, s.token, status, body)
+		}
+		if status == 200 && strings.HasPrefix(body, "{") && !json.Valid([]byte(body)) {
+			return fmt.Errorf("%s %s: invalid json", s.method, s.path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	"bhl-diary/align"
+	"bhl-diary/api"
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkAudio выравнивание текста по словам диктовки и вырезание WAV
+// по слову и предложению с поддержкой Range
+func checkAudio(ctx context.Context, dir string) error {
+	// 3 секунды: отсчёт i равен i по модулю 1000 — легко проверить смещение
+	path := filepath.Join(dir, "audio", "s1.wav")
+	rec, err := wshandler.NewRecorder(path)
+	if err != nil {
+		return err
+	}
+	pcm := make([]float32, 3*wshandler.RecordingRate)
+	for i := range pcm {
+		pcm[i] = float32(i%1000) / 32767
+	}
+	rec.Write(pcm)
+	if err := rec.Close(); err != nil {
+		return err
+	}
+
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	e := &store.Entry{
+		User:  "", // API без авторизации работает от пустого пользователя
+		Audio: path,
+		Text:  "Привет, мир.\n\nВ 25 лет.",
+		Finals: []store.Final{
+			{Type: "final", Text: "Привет, мир.", Raw: "привет мир", At: time.Now(), Words: []store.Word{
+				{Text: "привет", Start: 0.5, End: 0.9}, {Text: "мир", Start: 0.9, End: 1.3},
+			}},
+			{Type: "final", Text: "В 25 лет.", Raw: "в двадцать пять лет", At: time.Now(), Words: []store.Word{
+				{Text: "в", Start: 2.0, End: 2.1}, {Text: "двадцать", Start: 2.1, End: 2.4},
+				{Text: "пять", Start: 2.4, End: 2.6}, {Text: "лет", Start: 2.6, End: 2.9},
+			}},
+		},
+	}
+	if err := st.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+
+	srv := api.New(st, nil)
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/entries/" + e.ID)
+	if err != nil {
+		return err
+	}
+	var got struct {
+		Audio     string       `json:"audio"`
+		Alignment []align.Word `json:"alignment"`
+	}
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	w := got.Alignment
+	if err := expect(got.Audio != "" && len(w) == 5, "alignment: %q %+v", got.Audio, w); err != nil {
+		return err
+	}
+	// "25" получает время "двадцать пять", предложения делятся по точке и абзацу
+	if err := expect(w[3].Text == "25" && w[3].Start == 2.1 && w[3].End == 2.6 && w[3].Offset == 16 && w[3].Sentence == 1 && w[1].Sentence == 0,
+		"word 25: %+v", w[3]); err != nil {
+		return err
+	}
+
+	fetch := func(query, rng string) (*http.Response, []byte, error) {
+		req, _ := http.NewRequest("GET", ts.URL+"/api/v1/entries/"+e.ID+"/audio"+query, nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, body, err
+	}
+
+	// слово "мир": 0.9..1.3 с запасом 0.15 с
+	resp, body, err := fetch("?word=1", "")
+	if err != nil {
+		return err
+	}
+	first := int(math.Floor((0.9 - 0.15) * wshandler.RecordingRate))
+	samples := int(math.Ceil((1.3+0.15)*wshandler.RecordingRate)) - first
+	if err := expect(resp.StatusCode == http.StatusOK && resp.Header.Get("Content-Type") == "audio/wav" && len(body) == 44+samples*2,
+		"word audio: %d %s %d bytes", resp.StatusCode, resp.Header.Get("Content-Type"), len(body)); err != nil {
+		return err
+	}
+	if v := int16(binary.LittleEndian.Uint16(body[44:])); int(v) != first%1000 {
+		return fmt.Errorf("word audio starts with sample %d, want %d", v, first%1000)
+	}
+
+	resp, body, err = fetch("?sentence=1", "bytes=0-99")
+	if err != nil {
+		return err
+	}
+	// конец предложения с запасом выходит за запись — обрезается по её концу
+	total := 44 + 2*(len(pcm)-int(math.Floor((2.0-0.15)*wshandler.RecordingRate)))
+	if err := expect(resp.StatusCode == http.StatusPartialContent && len(body) == 100 && string(body[:4]) == "RIFF" &&
+		resp.Header.Get("Content-Range") == fmt.Sprintf("bytes 0-99/%d", total),
+		"range: %d %q %d", resp.StatusCode, resp.Header.Get("Content-Range"), len(body)); err != nil {
+		return err
+	}
+
+	resp, _, err = fetch("?word=9", "")
+	if err != nil {
+		return err
+	}
+	if err := expect(resp.StatusCode == http.StatusBadRequest, "word out of range: %d", resp.StatusCode); err != nil {
+		return err
+	}
+
+	// после правки новые слова получают время соседей
+	e.Text = "Привет, мир.\n\nВ 26 лет, летом."
+	if err := st.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+	e, err = st.GetEntry(ctx, "", e.ID)
+	if err != nil {
+		return err
+	}
+	w = align.Entry(e)
+	return expect(len(w) == 6 && w[3].Start == 2.1 && w[5].Text == "летом." && w[5].Timed && w[5].Start == 2.9,
+		"alignment after edit: %+v", w)
+}
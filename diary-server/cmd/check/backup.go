@@ -0,0 +1,336 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bhl-diary/backup"
+	"bhl-diary/search"
+	"bhl-diary/store"
+)
+
+// checkBackup резервные копии: архив снимается с работающего хранилища,
+// восстанавливается в пустой каталог байт в байт, поверх дневника — только
+// с force; подмена и порча архива видны до распаковки; verify находит
+// изменённое и пропавшее аудио; ротация оставляет по копии за период
+func checkBackup(ctx context.Context, dir string) error {
+	data := filepath.Join(dir, "data")
+	st, err := store.Open(store.Config{Dir: data})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	ix, err := search.Open(data, st)
+	if err != nil {
+		return err
+	}
+	indexed := search.NewIndexedStore(st, ix)
+
+	// две записи с аудио: сумма первой записана при сохранении, вторая —
+	// как аудио из времени до проверок
+	var entries []*store.Entry
+	for i, text := range []string{"Утром ходили за грибами.", "Вечером сварили суп."} {
+		audio := filepath.Join(dir, "audio", fmt.Sprintf("s%d.wav", i+1))
+		os.MkdirAll(filepath.Dir(audio), 0o700)
+		if err := os.WriteFile(audio, bytes.Repeat([]byte{byte(i + 1)}, 4096), 0o600); err != nil {
+			return err
+		}
+		e := &store.Entry{User: "anna", Text: text, Audio: audio}
+		if err := indexed.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	if err := store.RecordAudio(ctx, st, "anna", entries[0].Audio); err != nil {
+		return err
+	}
+	config := filepath.Join(dir, "config.yaml")
+	os.WriteFile(config, []byte("storage:\n  dir: ./data\n"), 0o600)
+
+	// копия при открытом хранилище
+	archive := filepath.Join(dir, "backups", "copy.tar.gz")
+	m, err := backup.CreateFile(ctx, backup.Source{Store: st, Dir: data, Config: config}, archive)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"diary.db", "config.yaml", "audio/s1.wav", "audio/s2.wav"} {
+		if _, ok := m.Find(name); !ok {
+			return fmt.Errorf("archive has no %s: %+v", name, m.Files)
+		}
+	}
+	var indexFiles int
+	for _, f := range m.Files {
+		if filepath.Dir(filepath.FromSlash(f.Name)) == "index" {
+			indexFiles++
+		}
+	}
+	if err := expect(indexFiles > 0 && !m.Encrypted && len(m.Missing) == 0,
+		"manifest: %d index files, encrypted %v, missing %v", indexFiles, m.Encrypted, m.Missing); err != nil {
+		return err
+	}
+	if _, err := os.Stat(archive + ".tmp"); !os.IsNotExist(err) {
+		return fmt.Errorf("temporary archive left behind: %v", err)
+	}
+	if _, err := backup.VerifyArchive(archive); err != nil {
+		return err
+	}
+
+	// запись после копии в архив не попадает
+	late := &store.Entry{User: "anna", Text: "Запись после копии."}
+	if err := indexed.CreateEntry(ctx, late); err != nil {
+		return err
+	}
+
+	// восстановление в пустой каталог: аудио возвращается на свои пути
+	want := map[string][]byte{}
+	for _, e := range entries {
+		want[e.Audio], _ = os.ReadFile(e.Audio)
+		os.Remove(e.Audio)
+	}
+	restored := filepath.Join(dir, "restored")
+	if _, err := backup.Restore(archive, backup.Target{Dir: restored, Config: filepath.Join(restored, "config.yaml")}); err != nil {
+		return err
+	}
+	for path, b := range want {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := expect(bytes.Equal(got, b), "restored audio %s differs", path); err != nil {
+			return err
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(restored, "config.yaml")); !bytes.Contains(got, []byte("./data")) {
+		return fmt.Errorf("config not restored: %q", got)
+	}
+	back, err := store.Open(store.Config{Dir: restored})
+	if err != nil {
+		return err
+	}
+	list, err := back.ListEntries(ctx, store.Filter{User: "anna"})
+	if err != nil {
+		back.Close()
+		return err
+	}
+	if err := expect(len(list) == len(entries), "restored %d entries, want %d", len(list), len(entries)); err != nil {
+		back.Close()
+		return err
+	}
+	for _, e := range entries {
+		got, err := back.GetEntry(ctx, "anna", e.ID)
+		if err != nil {
+			back.Close()
+			return err
+		}
+		if err := expect(got.Text == e.Text && got.Audio == e.Audio, "restored entry %s: %q %q", e.ID, got.Text, got.Audio); err != nil {
+			back.Close()
+			return err
+		}
+	}
+	// индекс из архива сверяется с базой и находит то, что в ней есть
+	rix, err := search.Open(restored, back)
+	if err != nil {
+		back.Close()
+		return err
+	}
+	hits, err := rix.Search(ctx, search.Query{User: "anna", Text: "грибами", Limit: 10})
+	back.Close()
+	if err != nil {
+		return err
+	}
+	if err := expect(len(hits) == 1 && hits[0].EntryID == entries[0].ID, "search in restored index: %+v", hits); err != nil {
+		return err
+	}
+
+	// поверх дневника — только с force
+	if _, err := backup.Restore(archive, backup.Target{Dir: restored}); !errors.Is(err, backup.ErrNotEmpty) {
+		return fmt.Errorf("restore over a diary: %v, want ErrNotEmpty", err)
+	}
+	if _, err := backup.Restore(archive, backup.Target{Dir: restored, Force: true}); err != nil {
+		return fmt.Errorf("restore with force: %w", err)
+	}
+
+	// подменённый файл при верной описи и испорченный байт архива
+	swapped := filepath.Join(dir, "swapped.tar.gz")
+	if err := rewriteArchive(archive, swapped, "audio/s2.wav", []byte("not the audio")); err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(archive)
+	if err != nil {
+		return err
+	}
+	raw[len(raw)/2] ^= 0xff
+	flipped := filepath.Join(dir, "flipped.tar.gz")
+	os.WriteFile(flipped, raw, 0o600)
+	truncated := filepath.Join(dir, "truncated.tar.gz")
+	os.WriteFile(truncated, raw[:len(raw)/3], 0o600)
+	for _, bad := range []string{swapped, flipped, truncated} {
+		if _, err := backup.VerifyArchive(bad); !errors.Is(err, backup.ErrDamaged) {
+			return fmt.Errorf("verify %s: %v, want ErrDamaged", filepath.Base(bad), err)
+		}
+		empty := filepath.Join(dir, "empty-"+filepath.Base(bad))
+		if _, err := backup.Restore(bad, backup.Target{Dir: empty}); !errors.Is(err, backup.ErrDamaged) {
+			return fmt.Errorf("restore %s: %v, want ErrDamaged", filepath.Base(bad), err)
+		}
+		if _, err := os.Stat(filepath.Join(empty, "diary.db")); !os.IsNotExist(err) {
+			return fmt.Errorf("damaged archive %s was unpacked", filepath.Base(bad))
+		}
+	}
+
+	// verify на месте: первая проверка записывает недостающие суммы,
+	// следующие находят изменённое и пропавшее
+	rep, err := backup.Verify(ctx, st)
+	if err != nil {
+		return err
+	}
+	if err := expect(rep.OK() && rep.Audio == 2 && rep.Recorded == 1, "first verify: %+v", rep); err != nil {
+		return err
+	}
+	os.WriteFile(entries[0].Audio, []byte("bit rot"), 0o600)
+	os.Remove(entries[1].Audio)
+	rep, err = backup.Verify(ctx, st)
+	if err != nil {
+		return err
+	}
+	if err := expect(!rep.OK() && len(rep.DB) == 0 && rep.Recorded == 0 &&
+		len(rep.Changed) == 1 && rep.Changed[0] == entries[0].Audio &&
+		len(rep.Missing) == 1 && rep.Missing[0] == entries[1].Audio, "second verify: %+v", rep); err != nil {
+		return err
+	}
+	// копия без аудио на диске всё равно делается и перечисляет пропавшее
+	m, err = backup.CreateFile(ctx, backup.Source{Store: st, Dir: data}, filepath.Join(dir, "partial.tar.gz"))
+	if err != nil {
+		return err
+	}
+	if err := expect(len(m.Missing) == 1 && m.Missing[0] == entries[1].Audio, "missing in manifest: %v", m.Missing); err != nil {
+		return err
+	}
+
+	if err := checkBackupRotation(dir); err != nil {
+		return err
+	}
+
+	// расписание: первая копия сразу, остановка по отмене контекста
+	sched := filepath.Join(dir, "scheduled")
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		backup.Run(runCtx, backup.Source{Store: st, Dir: data}, backup.Config{Dir: sched})
+		close(done)
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	var archives []backup.Archive
+	for time.Now().Before(deadline) {
+		if archives, err = backup.List(sched); err == nil && len(archives) > 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("backup.Run did not stop")
+	}
+	if err := expect(len(archives) == 1, "scheduled archives: %+v", archives); err != nil {
+		return err
+	}
+	_, err = backup.VerifyArchive(archives[0].Path)
+	return err
+}
+
+// checkBackupRotation правила хранения на копиях с подставными датами
+func checkBackupRotation(dir string) error {
+	rot := filepath.Join(dir, "rotation")
+	os.MkdirAll(rot, 0o700)
+	day := time.Date(2026, 3, 20, 3, 0, 0, 0, time.Local)
+	var names []string
+	add := func(t time.Time) {
+		name := backup.ArchiveName(t)
+		os.WriteFile(filepath.Join(rot, name), nil, 0o600)
+		names = append(names, name)
+	}
+	// по копии в день за 70 дней и две лишние в последний день
+	for i := 0; i < 70; i++ {
+		add(day.AddDate(0, 0, -i))
+	}
+	add(day.Add(-time.Hour))
+	add(day.Add(-2 * time.Hour))
+	os.WriteFile(filepath.Join(rot, "notes.txt"), nil, 0o600)
+
+	removed, err := backup.Prune(rot, backup.Config{KeepDaily: 3, KeepMonthly: 3})
+	if err != nil {
+		return err
+	}
+	left, err := backup.List(rot)
+	if err != nil {
+		return err
+	}
+	var got []string
+	for _, a := range left {
+		got = append(got, a.Created.Format("01-02 15"))
+	}
+	want := []string{"03-20 03", "03-19 03", "03-18 03", "02-28 03", "01-31 03"}
+	if err := expect(fmt.Sprint(got) == fmt.Sprint(want) && len(removed) == len(names)-len(want),
+		"rotation kept %v (removed %d), want %v", got, len(removed), want); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(rot, "notes.txt")); err != nil {
+		return fmt.Errorf("rotation removed a foreign file: %w", err)
+	}
+
+	// все правила в нуле — значения по умолчанию, а не удаление всего
+	if _, err := backup.Prune(rot, backup.Config{}); err != nil {
+		return err
+	}
+	left, _ = backup.List(rot)
+	return expect(len(left) == len(want), "default rotation left %d archives", len(left))
+}
+
+// rewriteArchive копия архива с другим содержимым одного файла и прежней описью
+func rewriteArchive(src, dst, name string, content []byte) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tr, tw := tar.NewReader(gr), tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if hdr.Name == name {
+			body = content
+		}
+		hdr.Size = int64(len(body))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		tw.Write(body)
+	}
+	tw.Close()
+	gw.Close()
+	return os.WriteFile(dst, buf.Bytes(), 0o600)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"bhl-diary/api"
+	"bhl-diary/corrections"
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkCorrections подсказки из правок, принятое правило в конвейере,
+// счётчик срабатываний и горячие слова
+func checkCorrections(ctx context.Context, dir string) error {
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	edits := [][2]string{
+		{"Звонил бабушки вечером.", "Звонил бабушке вечером."},
+		{"Отвёз лекарства бабушки, видел Сидорова.", "Отвёз лекарства бабушке, видел Сидорова!"},
+		{"Написал петрову про отчёт.", "Написал Петрову про отчёт."},
+		{"Сидоров звал на дачу.", "Сидорова звал на дачу."},
+	}
+	for _, ed := range edits {
+		e := &store.Entry{
+			User:      "anna",
+			Text:      ed[0],
+			Revisions: []store.Revision{{Kind: store.RevisionProcessed, Text: ed[0], Author: "anna"}},
+		}
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+		e.Text = ed[1]
+		if err := st.UpdateEntry(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	engine := corrections.New(st, dir)
+	tokens := map[string]string{"ta": "anna", "tb": "boris"}
+	auth := func(r *http.Request) (string, bool) {
+		u, ok := tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		return u, ok
+	}
+	apiServer := api.New(st, auth)
+	apiServer.SetCorrections(engine, 2)
+	mux := http.NewServeMux()
+	apiServer.Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	call := func(token, method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, srv.URL+"/api/v1/corrections"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// только пунктуация и регистр (петрову → Петрову, ! вместо .) — не подсказки;
+	// Сидоров → Сидорова встретился один раз
+	status, body := call("ta", "GET", "/suggestions", "")
+	if err := expect(status == 200 && strings.Contains(body, `"from":"бабушки","to":"бабушке","count":2`) &&
+		!strings.Contains(body, "петрову") && !strings.Contains(body, "Сидорова"),
+		"suggestions: %d %s", status, body); err != nil {
+		return err
+	}
+	if status, body = call("ta", "GET", "/suggestions?min_count=1", ""); !strings.Contains(body, `"from":"сидоров","to":"Сидорова"`) {
+		return fmt.Errorf("suggestions min_count=1: %d %s", status, body)
+	}
+	if status, body = call("tb", "GET", "/suggestions", ""); !strings.Contains(body, `"suggestions":[]`) {
+		return fmt.Errorf("boris sees anna's suggestions: %s", body)
+	}
+
+	if status, body = call("ta", "POST", "", `{"from":"бабушки","to":"бабушке"}`); status != 201 {
+		return fmt.Errorf("accept: %d %s", status, body)
+	}
+	if status, body = call("ta", "POST", "", `{"from":"Сидоров","status":"rejected"}`); status != 201 {
+		return fmt.Errorf("reject: %d %s", status, body)
+	}
+	if status, body = call("ta", "GET", "/suggestions?min_count=1", ""); !strings.Contains(body, `"suggestions":[]`) {
+		return fmt.Errorf("accepted and rejected still suggested: %s", body)
+	}
+
+	// стадия после пунктуации, правила только владельца сессии
+	pipeline, err := wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "corrections"}}, nil)
+	if err != nil {
+		return err
+	}
+	pipeline.SetCorrector(engine)
+	run := func(user, text string) string {
+		seg := &wshandler.Segment{Type: "final", Text: text, User: user}
+		pipeline.Run(seg, nil)
+		return seg.Text
+	}
+	if got := run("anna", "Бабушки дома нет, передал бабушки привет."); got != "Бабушке дома нет, передал бабушке привет." {
+		return fmt.Errorf("corrections stage: %q", got)
+	}
+	// промежуточные исправляются, но не считаются: иначе одно слово
+	// засчитывалось бы на каждом interim
+	for _, text := range []string{"передал", "передал бабушки", "передал бабушки привет"} {
+		seg := &wshandler.Segment{Type: "interim", Text: text, User: "anna"}
+		pipeline.Run(seg, nil)
+		if strings.Contains(seg.Text, "бабушки") {
+			return fmt.Errorf("interim not corrected: %q", seg.Text)
+		}
+	}
+	// слово подряд: разделитель после первого не мешает второму
+	if got := run("anna", "бабушки бабушки, Бабушкин."); got != "бабушке бабушке, Бабушкин." {
+		return fmt.Errorf("repeated word: %q", got)
+	}
+	if got := run("anna", "Сидоров пришёл."); got != "Сидоров пришёл." {
+		return fmt.Errorf("rejected rule applied: %q", got)
+	}
+	if got := run("boris", "Передал бабушки привет."); got != "Передал бабушки привет." {
+		return fmt.Errorf("anna's rule applied to boris: %q", got)
+	}
+
+	// словарь replace из config.yaml — те же границы слов
+	dict, err := wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "replace", Replace: map[string]string{"кот": "кошка", "$": "доллар"}}}, nil)
+	if err != nil {
+		return err
+	}
+	seg := &wshandler.Segment{Type: "final", Text: "Кот кот котик, кот. $ 5"}
+	dict.Run(seg, nil)
+	if seg.Text != "кошка кошка котик, кошка. доллар 5" {
+		return fmt.Errorf("replace stage: %q", seg.Text)
+	}
+	// один проход: самая длинная фраза, замена не сканируется повторно
+	dict, err = wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "replace", Replace: map[string]string{"новый год": "Новый год", "год": "годик", "новый": "свежий"}}}, nil)
+	if err != nil {
+		return err
+	}
+	for text, want := range map[string]string{
+		"встретили новый год дома": "встретили Новый год дома",
+		"год прошёл, новый годами": "годик прошёл, свежий годами",
+	} {
+		seg := &wshandler.Segment{Type: "final", Text: text}
+		dict.Run(seg, nil)
+		if seg.Text != want {
+			return fmt.Errorf("replace stage %q: %q, want %q", text, seg.Text, want)
+		}
+	}
+
+	if status, body = call("ta", "GET", "", ""); !strings.Contains(body, `"from":"бабушки","to":"бабушке","status":"accepted","hits":4`) {
+		return fmt.Errorf("rules after hits: %d %s", status, body)
+	}
+	if status, body = call("ta", "GET", "/hotwords", ""); body != "бабушке\n" {
+		return fmt.Errorf("hotwords: %d %q", status, body)
+	}
+	path := engine.HotwordsFile("anna")
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "бабушке\n" {
+		return fmt.Errorf("hotwords file %q: %q %v", path, data, err)
+	}
+	if err := expect(engine.HotwordsFile("boris") == "", "boris has a hotwords file"); err != nil {
+		return err
+	}
+
+	rules, err := st.ListRules(ctx, "anna")
+	if err != nil {
+		return err
+	}
+	if status, _ = call("tb", "DELETE", fmt.Sprintf("/%d", rules[0].ID), ""); status != 404 {
+		return fmt.Errorf("boris deleted anna's rule: %d", status)
+	}
+	if status, _ = call("ta", "DELETE", fmt.Sprintf("/%d", rules[0].ID), ""); status != 204 {
+		return fmt.Errorf("delete rule: %d", status)
+	}
+	if got := run("anna", "Передал бабушки привет."); got != "Передал бабушки привет." {
+		return fmt.Errorf("deleted rule still applied: %q", got)
+	}
+	return nil
+}
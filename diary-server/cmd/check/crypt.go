@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bhl-diary/api"
+	"bhl-diary/crypt"
+	"bhl-diary/search"
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkCrypt шифрование на диске: уже накопленный дневник шифруется
+// keys init, открытого текста нет ни в базе, ни в индексе, ни в аудио;
+// аудио отдаётся кусками с Range; чужой ключ, неверная фраза и порча
+// файла не проходят; смена ключей и восстановление по коду
+func checkCrypt(ctx context.Context, dir string) error {
+	const pass = "correct horse battery"
+	argon := crypt.Argon2{Time: 1, MemoryMB: 8, Threads: 1}
+
+	// дневник до шифрования: запись с аудио и поисковый индекс
+	audio := filepath.Join(dir, "audio", "s1.wav")
+	rec, err := wshandler.NewRecorder(audio)
+	if err != nil {
+		return err
+	}
+	pcm := make([]float32, 3*wshandler.RecordingRate)
+	for i := range pcm {
+		pcm[i] = float32(i%1000) / 32767
+	}
+	rec.Write(pcm)
+	if err := rec.Close(); err != nil {
+		return err
+	}
+	plain, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	ix, err := search.Open(dir, plain)
+	if err != nil {
+		return err
+	}
+	old := &store.Entry{Text: "Поездка в Кёнигсберг.", Audio: audio, Finals: []store.Final{
+		{Type: store.FinalText, Text: "Поездка в Кёнигсберг.", Raw: "поездка в кёнигсберг", At: time.Now(), Words: []store.Word{
+			{Text: "поездка", Start: 0.5, End: 0.9}, {Text: "в", Start: 0.9, End: 1.0}, {Text: "кёнигсберг", Start: 1.0, End: 2.2},
+		}},
+	}}
+	if err := search.NewIndexedStore(plain, ix).CreateEntry(ctx, old); err != nil {
+		return err
+	}
+	want, _, err := getAudio(plain, nil, old.ID, "")
+	if err != nil {
+		return err
+	}
+	plain.Close()
+
+	// keys init: ключи и шифрование того, что уже есть
+	keys, code, err := crypt.Create(dir, pass, argon)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(store.Config{Dir: dir, Cipher: keys})
+	if err != nil {
+		return err
+	}
+	indexDir := filepath.Join(dir, "index")
+	rep, err := crypt.Reseal(ctx, keys, st, indexDir)
+	if err != nil {
+		return err
+	}
+	if err := expect(rep.Rows == 4 && rep.Audio == 1 && rep.Files == 1, "init reseal: %+v", rep); err != nil {
+		return err
+	}
+
+	// новая запись: текст, фразы, ревизии, дело, краткое содержание
+	ix, err = search.Open(dir, st)
+	if err != nil {
+		return err
+	}
+	ix.SetKeyring(keys)
+	indexed := search.NewIndexedStore(st, ix)
+	e := &store.Entry{Text: "Летом на Шпицберген.\n\nНадо купить билеты на Шпицберген.", Finals: []store.Final{
+		{Type: store.FinalText, Text: "Летом на Шпицберген.", Raw: "летом на шпицберген", At: time.Now(), Words: []store.Word{{Text: "шпицберген", Start: 1, End: 2}}},
+	}}
+	if err := indexed.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+	e.Text += "\n\nВзять тёплую куртку."
+	if err := indexed.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+	if err := st.SetInsights(ctx, "", e.ID, store.Insights{Title: "Шпицберген", Summary: "Планы на Шпицберген."}); err != nil {
+		return err
+	}
+	task := &store.Task{EntryID: e.ID, Text: "Купить билеты на Шпицберген", Source: "Надо купить билеты на Шпицберген."}
+	if err := st.CreateTask(ctx, task); err != nil {
+		return err
+	}
+
+	if err := noPlaintext(dir, "Кёнигсберг", "кёнигсберг", "кенигсберг", "Шпицберген", "шпицберген", "куртк"); err != nil {
+		return fmt.Errorf("plaintext on disk: %w", err)
+	}
+
+	got, err := st.GetEntry(ctx, "", e.ID)
+	if err != nil {
+		return err
+	}
+	revs, err := st.ListRevisions(ctx, "", e.ID)
+	if err != nil {
+		return err
+	}
+	tasks, err := st.ListTasks(ctx, store.TaskFilter{})
+	if err != nil {
+		return err
+	}
+	if err := expect(got.Text == e.Text && got.Title == "Шпицберген" && got.Summary == "Планы на Шпицберген." &&
+		len(got.Paragraphs) == 3 && got.Finals[0].Raw == "летом на шпицберген" && got.Finals[0].Words[0].Text == "шпицберген" &&
+		len(revs) == 2 && revs[1].Text == e.Text && len(tasks) == 1 && tasks[0].Source == task.Source,
+		"decrypted: %+v %+v %+v", got, revs, tasks); err != nil {
+		return err
+	}
+	// неизменённый текст — не новая ревизия, хотя шифротекст каждый раз другой
+	if err := st.UpdateEntry(ctx, got); err != nil {
+		return err
+	}
+	if revs, _ = st.ListRevisions(ctx, "", e.ID); len(revs) != 2 {
+		return expect(false, "unchanged text added a revision: %d", len(revs))
+	}
+
+	// индекс с диска расшифровывается и ищет
+	ix2, err := search.Open(dir, st)
+	if err != nil {
+		return err
+	}
+	ix2.SetKeyring(keys)
+	hits, err := ix2.Search(ctx, search.Query{Text: "Шпицберген"})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(hits) == 1 && hits[0].EntryID == e.ID, "search: %+v", hits); err != nil {
+		return err
+	}
+
+	// аудио: тот же WAV, что до шифрования, и Range по кускам
+	if sealed, _ := crypt.IsSealed(audio); !sealed {
+		return expect(false, "audio is not sealed")
+	}
+	body, code206, err := getAudio(st, keys, old.ID, "")
+	if err != nil {
+		return err
+	}
+	part, code206, err := getAudio(st, keys, old.ID, "bytes=100-50000")
+	if err != nil {
+		return err
+	}
+	if err := expect(bytes.Equal(body, want) && code206 == http.StatusPartialContent && bytes.Equal(part, want[100:50001]),
+		"audio: %d/%d bytes, range %d %d", len(body), len(want), code206, len(part)); err != nil {
+		return err
+	}
+	_, status, _ := getAudio(st, nil, old.ID, "")
+	if err := expect(status == http.StatusInternalServerError, "audio without keys: %d", status); err != nil {
+		return err
+	}
+
+	// порча файла, чужой пользователь, хранилище без ключей, неверная фраза
+	broken := filepath.Join(dir, "broken.wav")
+	data, _ := os.ReadFile(audio)
+	data[len(data)/2] ^= 1
+	os.WriteFile(broken, data, 0o600)
+	if _, err := crypt.ReadFile(keys, "", broken); err == nil {
+		return expect(false, "tampered file decrypted")
+	}
+	os.Remove(broken)
+	sealed, err := keys.Seal("anna", []byte("секрет"))
+	if err != nil {
+		return err
+	}
+	if _, err := keys.Open("bob", sealed); err == nil {
+		return expect(false, "bob opened anna's data")
+	}
+	st.Close()
+	locked, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	_, err = locked.GetEntry(ctx, "", e.ID)
+	locked.Close()
+	if err := expect(errors.Is(err, store.ErrEncrypted), "without keys: %v", err); err != nil {
+		return err
+	}
+	if _, err := crypt.Unlock(dir, "wrong horse"); !errors.Is(err, crypt.ErrWrongPassphrase) {
+		return expect(false, "wrong passphrase: %v", err)
+	}
+
+	// keys rotate: новые ключи, перешифровка, старые ключи удалены
+	keys, err = crypt.Unlock(dir, pass)
+	if err != nil {
+		return err
+	}
+	oldKeys, _ := keys.Status()
+	code2, err := keys.Rotate(pass, argon)
+	if err != nil {
+		return err
+	}
+	st, err = store.Open(store.Config{Dir: dir, Cipher: keys})
+	if err != nil {
+		return err
+	}
+	if _, err := crypt.Reseal(ctx, keys, st, indexDir); err != nil {
+		return err
+	}
+	st.Close()
+	dropped, err := keys.DropRetired()
+	if err != nil {
+		return err
+	}
+	if err := expect(dropped == oldKeys && dropped == 2, "rotate dropped %d of %d", dropped, oldKeys); err != nil {
+		return err
+	}
+
+	// recover: старый код не действует, новый ставит новую фразу
+	if _, _, err := crypt.Recover(dir, code, "new passphrase 42", argon); !errors.Is(err, crypt.ErrWrongCode) {
+		return expect(false, "old recovery code after rotate: %v", err)
+	}
+	if _, _, err := crypt.Recover(dir, code2, "new passphrase 42", argon); err != nil {
+		return err
+	}
+	if _, err := crypt.Unlock(dir, pass); !errors.Is(err, crypt.ErrWrongPassphrase) {
+		return expect(false, "old passphrase after recover: %v", err)
+	}
+	keys, err = crypt.Unlock(dir, "new passphrase 42")
+	if err != nil {
+		return err
+	}
+	st, err = store.Open(store.Config{Dir: dir, Cipher: keys})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	got, err = st.GetEntry(ctx, "", e.ID)
+	if err != nil {
+		return err
+	}
+	body, _, err = getAudio(st, keys, old.ID, "")
+	if err != nil {
+		return err
+	}
+	return expect(got.Text == e.Text && bytes.Equal(body, want), "after rotate and recover: %q, audio %d bytes", got.Text, len(body))
+}
+
+// getAudio вся запись или Range из /api/v1/entries/{id}/audio
+func getAudio(st store.Store, keys *crypt.Keyring, id, rng string) ([]byte, int, error) {
+	srv := api.New(st, nil)
+	srv.SetKeyring(keys)
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/entries/"+id+"/audio", nil)
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return body, resp.StatusCode, err
+}
+
+// noPlaintext ищет слова во всех файлах каталога, кроме keys.json
+func noPlaintext(dir string, words ...string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == crypt.KeyringFile {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, w := range words {
+			if bytes.Contains(data, []byte(w)) {
+				return errors.New(w + " in " + path)
+			}
+		}
+		return nil
+	})
+}
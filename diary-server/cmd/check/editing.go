@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkEditing грамматика голосовых команд и их действие на текст сессии
+func checkEditing(ctx context.Context, dir string) error {
+	for raw, want := range map[string]string{
+		"Новый абзац.":                wshandler.EditNewParagraph,
+		"удали последнее предложение": wshandler.EditDeleteSentence,
+		"сотри последнее слово":       wshandler.EditDeleteWord,
+		"замени вторник на среду":     wshandler.EditReplace,
+		"поставь вопросительный знак": wshandler.EditPunctuate,
+		"отмени": wshandler.EditUndo,
+		"удали последнее предложение про дачу": "",
+		"поставь чайник":                       "",
+		"в среду был новый абзац в романе":     "",
+	} {
+		cmd, ok := wshandler.ParseEdit(raw)
+		if err := expect(cmd.Name == want && ok == (want != ""), "ParseEdit(%q) = %q, %v", raw, cmd.Name, ok); err != nil {
+			return err
+		}
+	}
+
+	doc := wshandler.NewDocument(20, wshandler.SegmentConfig{})
+	at := time.Now() // без пауз: абзацы только по команде
+	edit := func(raw string) wshandler.DocumentState {
+		cmd, _ := wshandler.ParseEdit(raw)
+		return doc.Apply(cmd)
+	}
+
+	doc.AppendText("Во вторник поехали на дачу.", at, at)
+	doc.AppendText("Было холодно. Печку не топили.", at, at)
+	st := edit("удали последнее предложение")
+	if err := expect(st.Applied && st.Text == "Во вторник поехали на дачу. Было холодно.", "delete sentence: %q", st.Text); err != nil {
+		return err
+	}
+
+	edit("новый абзац")
+	doc.AppendText("Вечером пошёл дождь.", at, at)
+	st = edit("замени холодно на прохладно")
+	if err := expect(len(st.Paragraphs) == 2 && st.Paragraphs[0] == "Во вторник поехали на дачу. Было прохладно.",
+		"replace: %q", st.Paragraphs); err != nil {
+		return err
+	}
+
+	st = edit("поставь восклицательный знак")
+	if err := expect(st.Paragraphs[1] == "Вечером пошёл дождь!", "punctuate: %q", st.Paragraphs); err != nil {
+		return err
+	}
+	st = edit("удали последнее слово")
+	if err := expect(st.Paragraphs[1] == "Вечером пошёл", "delete word: %q", st.Paragraphs); err != nil {
+		return err
+	}
+
+	doc.AppendFormula(`\frac{a}{b}`, false, at)
+	doc.AppendFormula(`\frac{a}{c}`, true, at)
+	st = doc.State()
+	if err := expect(strings.Count(st.Text, "$$") == 2 && strings.HasSuffix(st.Text, `$$\frac{a}{c}$$`), "formula: %q", st.Text); err != nil {
+		return err
+	}
+
+	// отмена идёт назад по шагам, включая добавленные фразы
+	for range 3 {
+		edit("отмени")
+	}
+	st = doc.State()
+	if err := expect(st.Text == "Во вторник поехали на дачу. Было прохладно.\n\nВечером пошёл дождь!", "undo: %q", st.Text); err != nil {
+		return err
+	}
+
+	if st = edit("замени пятницу на субботу"); st.Applied {
+		return fmt.Errorf("replace of a missing word applied: %q", st.Text)
+	}
+	return nil
+}
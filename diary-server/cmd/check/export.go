@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bhl-diary/export"
+	"bhl-diary/store"
+)
+
+// checkExport все форматы, формулы как display math и переопределение шаблона
+func checkExport(ctx context.Context, dir string) error {
+	entries := []*store.Entry{
+		{ID: "b", Text: "Потом посчитали: $$\\int x\\,dx$$ и разошлись. Ещё: $$a +\nb$$", CreatedAt: time.Date(2026, 4, 2, 9, 0, 0, 0, time.UTC)},
+		{ID: "a", Title: "50% & #1", Text: "Начали с задачи.", Tags: []string{"учёба"}, CreatedAt: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	render := func(format, tmplDir string) (string, error) {
+		var buf bytes.Buffer
+		err := export.Render(&buf, format, entries, export.Options{Title: "Год", TemplatesDir: tmplDir})
+		return buf.String(), err
+	}
+
+	md, err := render(export.Markdown, "")
+	if err != nil {
+		return err
+	}
+	if err := expect(strings.HasPrefix(md, "---\ntitle: \"Год\"") && strings.Index(md, "Начали") < strings.Index(md, "Потом"),
+		"markdown: no front matter or wrong order:\n%s", md); err != nil {
+		return err
+	}
+
+	tex, err := render(export.LaTeX, "")
+	if err != nil {
+		return err
+	}
+	for _, want := range []string{`\[`, `\int x\,dx`, "\\[\na +\nb\n\\]", `50\% \& \#1`, `\chapter{март 2026}`, `\end{document}`} {
+		if err := expect(strings.Contains(tex, want), "latex: no %q in:\n%s", want, tex); err != nil {
+			return err
+		}
+	}
+
+	jl, err := render(export.JSONL, "")
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSpace(jl), "\n")
+	var first store.Entry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		return err
+	}
+	if err := expect(len(lines) == 2 && first.ID == "a", "jsonl: %s", jl); err != nil {
+		return err
+	}
+
+	txt, err := render(export.Text, "")
+	if err != nil {
+		return err
+	}
+	if err := expect(strings.Contains(txt, "[\\int x\\,dx]"), "text: formula not flattened:\n%s", txt); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "text.tmpl"), []byte(`{{range .Entries}}{{.ID}};{{end}}`), 0o644); err != nil {
+		return err
+	}
+	custom, err := render(export.Text, dir)
+	if err != nil {
+		return err
+	}
+	if err := expect(custom == "a;b;", "template override: %q", custom); err != nil {
+		return err
+	}
+
+	_, err = render("docx", "")
+	return expect(err != nil, "unknown format accepted")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bhl-diary/importer"
+	"bhl-diary/search"
+	"bhl-diary/store"
+)
+
+// checkImport три формата, пробный прогон, дубликаты и поиск по импортированному
+func checkImport(ctx context.Context, dir string) error {
+	src := filepath.Join(dir, "src")
+	files := map[string]string{
+		"notes/2023-07-14.md":       "# Пятница\n\nЕздили на озеро, вода тёплая.",
+		"notes/поход.md":            "---\ndate: 2023-08-02 07:30\ntitle: Поход\ntags: [лето]\n---\nВышли рано, к обеду были у перевала.",
+		"notes/без даты.md":         "Непонятно когда.",
+		"old/diary.txt":             "2019-01-05\nСнег всю ночь.\n\n06.01.2019\nКатались на лыжах.\n",
+		"old/2019-01-05-copy.txt":   "Снег  всю ночь!",
+		"dayone/Journal.json":       `{"metadata":{"version":"1.0"},"entries":[{"uuid":"A1","creationDate":"2021-03-08T09:00:00Z","timeZone":"Europe/Moscow","text":"# Праздник\nПодарили тюльпаны\\.","tags":["семья"]}]}`,
+		".obsidian/workspace.json":  `{"entries":[]}`,
+		"notes/attachments/pic.png": "png",
+	}
+	for name, body := range files {
+		p := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			return err
+		}
+	}
+
+	base, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+	ix, err := search.Open(dir, base)
+	if err != nil {
+		return err
+	}
+	st := search.NewIndexedStore(base, ix)
+
+	opts := importer.Options{User: "anna", DryRun: true}
+	rep, err := importer.Import(ctx, st, src, opts)
+	if err != nil {
+		return err
+	}
+	// 5 новых, копия снега — дубликат, файл без даты пропущен
+	if err := expect(rep.Counts[importer.StatusNew] == 5 && rep.Counts[importer.StatusDuplicate] == 1 && rep.Counts[importer.StatusSkipped] == 1,
+		"dry run counts: %v", rep.Counts); err != nil {
+		return err
+	}
+	entries, err := st.ListEntries(ctx, store.Filter{User: "anna"})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(entries) == 0, "dry run wrote %d entries", len(entries)); err != nil {
+		return err
+	}
+
+	opts.DryRun = false
+	if rep, err = importer.Import(ctx, st, src, opts); err != nil {
+		return err
+	}
+	if err := expect(rep.Counts[importer.StatusImported] == 5, "import counts: %v", rep.Counts); err != nil {
+		return err
+	}
+
+	entries, err = st.ListEntries(ctx, store.Filter{User: "anna"})
+	if err != nil {
+		return err
+	}
+	byTitle := map[string]*store.Entry{}
+	for _, e := range entries {
+		byTitle[e.Title] = e
+	}
+	hike := byTitle["Поход"]
+	if err := expect(hike != nil && hike.CreatedAt.Equal(time.Date(2023, 8, 2, 7, 30, 0, 0, time.Local)) && len(hike.Tags) == 1 && hike.Tags[0] == "лето",
+		"front matter not applied: %+v", hike); err != nil {
+		return err
+	}
+	holiday := byTitle["Праздник"]
+	if err := expect(holiday != nil && holiday.Text == "Подарили тюльпаны." && holiday.CreatedAt.Equal(time.Date(2021, 3, 8, 9, 0, 0, 0, time.UTC)),
+		"day one entry: %+v", holiday); err != nil {
+		return err
+	}
+
+	// повторный импорт ничего не добавляет
+	if rep, err = importer.Import(ctx, st, src, opts); err != nil {
+		return err
+	}
+	if err := expect(rep.Counts[importer.StatusImported] == 0 && rep.Counts[importer.StatusDuplicate] == 6,
+		"reimport counts: %v", rep.Counts); err != nil {
+		return err
+	}
+
+	hits, err := ix.Search(ctx, search.Query{User: "anna", Text: "лыжи"})
+	if err != nil {
+		return err
+	}
+	return expect(len(hits) == 1, "imported entries not searchable: %d hits", len(hits))
+}
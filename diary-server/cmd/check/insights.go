@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"bhl-diary/insights"
+	"bhl-diary/jobs"
+	"bhl-diary/llm"
+	"bhl-diary/store"
+)
+
+// checkInsights заголовок, краткое содержание, теги и настроение через
+// очередь задач и заглушку Ollama с заготовленными ответами
+func checkInsights(ctx context.Context, dir string) error {
+	var mu sync.Mutex
+	var prompts []string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Format   string `json:"format"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		user := req.Messages[len(req.Messages)-1].Content
+		mu.Lock()
+		prompts = append(prompts, req.Messages[0].Content+"\n"+user)
+		mu.Unlock()
+
+		// теги строкой, лишнее третье предложение, настроение с точкой
+		answer := `{"title": "«Поход на перевал.»", "summary": "Вышли затемно и к обеду дошли до перевала. Погода была ясная.  Вечером пели у костра.",
+			"tags": "Лето, #горы, горы, поход", "mood": "Радость."}`
+		if strings.Contains(user, "сломано") {
+			answer = "не JSON"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": answer}})
+	}))
+	defer ollama.Close()
+
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	gen, err := insights.New(insights.Config{
+		Enabled:  true,
+		LLM:      llm.Config{URL: ollama.URL, Model: "stub"},
+		MinChars: 40,
+		MaxTags:  2,
+		Prompts: insights.Prompts{
+			User: `Запись {{.Date}}{{if .Title}} «{{.Title}}»{{end}}: {{.Text}}` + "\n" + `Настроение одно из: {{join .Moods "|"}}`,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer gen.Close()
+
+	q := jobs.New(st, 2)
+	q.Handle(insights.Kind, gen.Handler(st))
+	qctx, stop := context.WithCancel(ctx)
+	if err := q.Start(qctx); err != nil {
+		stop()
+		return err
+	}
+	defer func() { stop(); q.Wait() }()
+
+	hike := &store.Entry{User: "anna", Tags: []string{"лето"}, Text: "Вышли рано, к обеду были у перевала. Вечером сидели у костра и пели."}
+	titled := &store.Entry{User: "anna", Title: "Мой день", Text: "Снова ходили в горы, вышли рано и вернулись к ужину усталые."}
+	short := &store.Entry{User: "anna", Text: "Дождь."}
+	broken := &store.Entry{User: "anna", Text: "Здесь всё сломано, модель ответит не тем, что нужно."}
+	var ids []string
+	for _, e := range []*store.Entry{hike, titled, short, broken} {
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+		ids = append(ids, e.ID)
+	}
+	queued, err := insights.Enqueue(ctx, q, "anna", ids...)
+	if err != nil {
+		return err
+	}
+	var done []*store.Job
+	for _, j := range queued {
+		d, err := waitJob(ctx, st, "anna", j.ID)
+		if err != nil {
+			return err
+		}
+		done = append(done, d)
+	}
+	if err := expect(done[0].Status == store.JobDone && done[1].Status == store.JobDone && done[2].Status == store.JobDone &&
+		done[3].Status == store.JobFailed && strings.Contains(done[3].Error, "json"),
+		"job statuses: %s %s %s %s %q", done[0].Status, done[1].Status, done[2].Status, done[3].Status, done[3].Error); err != nil {
+		return err
+	}
+
+	got, err := st.GetEntry(ctx, "anna", hike.ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(got.Title == "Поход на перевал" && got.Summary == "Вышли затемно и к обеду дошли до перевала. Погода была ясная." &&
+		strings.Join(got.SuggestedTags, ",") == "горы,поход" && got.Mood == "радость" && strings.Join(got.Tags, ",") == "лето" &&
+		got.UpdatedAt.Equal(hike.UpdatedAt),
+		"hike insights: %q %q %v %q", got.Title, got.Summary, got.SuggestedTags, got.Mood); err != nil {
+		return err
+	}
+
+	// заголовок пользователя модель не трогает, короткую запись не разбирает
+	got, _ = st.GetEntry(ctx, "anna", titled.ID)
+	if err := expect(got.Title == "Мой день" && got.Summary != "", "titled entry: %q %q", got.Title, got.Summary); err != nil {
+		return err
+	}
+	got, _ = st.GetEntry(ctx, "anna", short.ID)
+	if err := expect(got.Summary == "" && got.Title == "", "short entry: %+v", got); err != nil {
+		return err
+	}
+
+	// промпт из конфига: шаблон с датой, заголовком и списком настроений
+	mu.Lock()
+	defer mu.Unlock()
+	var sawTitled bool
+	for _, p := range prompts {
+		sawTitled = sawTitled || strings.Contains(p, "«Мой день»: Снова ходили") && strings.Contains(p, "радость|спокойствие")
+	}
+	return expect(len(prompts) == 3 && sawTitled && strings.Contains(prompts[0], "личный дневник"),
+		"prompts: %d %q", len(prompts), prompts)
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bhl-diary/api"
+	"bhl-diary/jobs"
+	"bhl-diary/store"
+	"bhl-diary/transcribe"
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/mbykov/wshandler-go"
+)
+
+// stubEngine выдаёт по фразе на каждую секунду звука, тишину пропускает
+type stubEngine struct {
+	delay   time.Duration
+	samples int
+	loud    bool
+	n       int
+}
+
+func (e *stubEngine) Write(pcm []float32) asr.Response {
+	time.Sleep(e.delay)
+	for _, v := range pcm {
+		if math.Abs(float64(v)) > 0.1 {
+			e.loud = true
+		}
+	}
+	e.samples += len(pcm)
+	if e.samples < transcribe.SampleRate {
+		return asr.Response{}
+	}
+	e.samples = 0
+	if !e.loud {
+		return asr.Response{}
+	}
+	e.loud = false
+	e.n++
+	return asr.Response{Type: "final", Text: fmt.Sprintf("фраза %d.", e.n)}
+}
+
+func (e *stubEngine) Finish() asr.Response { return asr.Response{} }
+func (e *stubEngine) Close()               {}
+
+// writeWAV стерео 44.1 кГц 16 бит: секунды со звуком и тишиной по pattern
+func writeWAV(path string, pattern []bool) error {
+	const rate, channels = 44100, 2
+	var data bytes.Buffer
+	for _, loud := range pattern {
+		for i := 0; i < rate; i++ {
+			v := int16(0)
+			if loud {
+				v = int16(16000 * math.Sin(2*math.Pi*440*float64(i)/rate))
+			}
+			for c := 0; c < channels; c++ {
+				binary.Write(&data, binary.LittleEndian, v)
+			}
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+data.Len()))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(channels), uint32(rate), uint32(rate * channels * 2), uint16(channels * 2), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(data.Len()))
+	b.Write(data.Bytes())
+	return os.WriteFile(path, b.Bytes(), 0o644)
+}
+
+// jobEvents копит сообщения Notify по задачам
+type jobEvents struct {
+	mu   sync.Mutex
+	list []store.Job
+}
+
+func (ev *jobEvents) notify(user string, msg any) {
+	e, ok := msg.(jobs.Event)
+	if !ok || e.Job.User != user {
+		return
+	}
+	ev.mu.Lock()
+	ev.list = append(ev.list, *e.Job)
+	ev.mu.Unlock()
+}
+
+func (ev *jobEvents) of(id string) []store.Job {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	var out []store.Job
+	for _, j := range ev.list {
+		if j.ID == id {
+			out = append(out, j)
+		}
+	}
+	return out
+}
+
+// waitJob ждёт, пока задача выйдет из queued/running
+func waitJob(ctx context.Context, st store.Store, user, id string) (*store.Job, error) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := st.GetJob(ctx, user, id)
+		if err != nil {
+			return nil, err
+		}
+		if j.Status != store.JobQueued && j.Status != store.JobRunning {
+			return j, nil
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("job %s did not finish", id)
+}
+
+// checkJobs загрузка WAV через API, расшифровка с прогрессом, отмена,
+// параллельные задачи и продолжение после перезапуска
+func checkJobs(ctx context.Context, dir string) error {
+	// чтение WAV: стерео 44.1 кГц → моно 16 кГц
+	wav := filepath.Join(dir, "memo.wav")
+	if err := writeWAV(wav, []bool{true, true, false, false, false, true, false}); err != nil {
+		return err
+	}
+	src, err := transcribe.Open(ctx, wav)
+	if err != nil {
+		return err
+	}
+	var total int
+	buf := make([]float32, 1000)
+	for {
+		n, err := src.Read(buf)
+		total += n
+		if err != nil {
+			break
+		}
+	}
+	src.Close()
+	if err := expect(math.Abs(src.Duration()-7) < 0.01 && math.Abs(float64(total-7*transcribe.SampleRate)) < 10,
+		"wav: duration %.2f, %d samples", src.Duration(), total); err != nil {
+		return err
+	}
+
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	tr := &transcribe.Transcriber{
+		NewEngine: func(string) (transcribe.Engine, error) { return &stubEngine{delay: 20 * time.Millisecond}, nil },
+		Segment:   wshandler.SegmentConfig{PauseMs: 2000, LongPauseMs: 8000, MaxChars: 1000},
+	}
+	var ev jobEvents
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+
+	start := func(ctx context.Context, workers int) *jobs.Queue {
+		q := jobs.New(st, workers)
+		q.SetNotify(ev.notify)
+		q.Handle(api.KindTranscribe, func(ctx context.Context, j *store.Job, progress func(float64)) (string, error) {
+			var in api.TranscribeInput
+			json.Unmarshal([]byte(j.Input), &in)
+			rec, err := tr.Run(ctx, "upload:"+j.ID, j.User, in.File, j.CreatedAt, progress)
+			if err != nil {
+				return "", err
+			}
+			e := &store.Entry{User: j.User, SessionID: rec.ID, CreatedAt: rec.Started}
+			for _, p := range rec.Paragraphs {
+				e.Paragraphs = append(e.Paragraphs, store.Paragraph{Text: p.Text, Start: p.Start, End: p.End})
+			}
+			e.Text = store.JoinParagraphs(e.Paragraphs)
+			if err := st.CreateEntry(ctx, e); err != nil {
+				return "", err
+			}
+			return e.ID, nil
+		})
+		// wait держит задачу до release или отмены и считает одновременные
+		q.Handle("wait", func(ctx context.Context, j *store.Job, progress func(float64)) (string, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-release:
+				return "ok", nil
+			}
+		})
+		if err := q.Start(ctx); err != nil {
+			panic(err)
+		}
+		return q
+	}
+
+	qctx, stop := context.WithCancel(ctx)
+	q := start(qctx, 2)
+	defer func() { stop(); q.Wait() }()
+
+	// загрузка через API
+	srv := api.New(st, nil)
+	srv.SetUploads(q, filepath.Join(dir, "uploads"), 4<<20)
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	upload := func(name string, body []byte) (*http.Response, error) {
+		var form bytes.Buffer
+		mw := multipart.NewWriter(&form)
+		fw, _ := mw.CreateFormFile("file", name)
+		fw.Write(body)
+		mw.Close()
+		return http.Post(ts.URL+"/api/v1/uploads", mw.FormDataContentType(), &form)
+	}
+	data, _ := os.ReadFile(wav)
+	resp, err := upload("memo.wav", data)
+	if err != nil {
+		return err
+	}
+	var job store.Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err := expect(resp.StatusCode == http.StatusAccepted && job.Status == store.JobQueued, "upload: %d %+v", resp.StatusCode, job); err != nil {
+		return err
+	}
+
+	done, err := waitJob(ctx, st, "", job.ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(done.Status == store.JobDone && done.Progress == 100, "transcribe job: %+v", done); err != nil {
+		return err
+	}
+	e, err := st.GetEntry(ctx, "", done.Result)
+	if err != nil {
+		return err
+	}
+	// две фразы подряд — один абзац, после трёх секунд тишины — новый
+	if err := expect(e.SessionID == "upload:"+job.ID && e.Text == "фраза 1. фраза 2.\n\nфраза 3.", "entry from upload: %q %q", e.SessionID, e.Text); err != nil {
+		return err
+	}
+	var partial bool
+	for _, j := range ev.of(job.ID) {
+		partial = partial || j.Status == store.JobRunning && j.Progress > 0 && j.Progress < 100
+	}
+	if err := expect(partial, "no progress events: %+v", ev.of(job.ID)); err != nil {
+		return err
+	}
+
+	// слишком большой файл
+	resp, err = upload("big.wav", make([]byte, 5<<20))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := expect(resp.StatusCode == http.StatusRequestEntityTooLarge, "big upload: %d", resp.StatusCode); err != nil {
+		return err
+	}
+
+	// две задачи идут параллельно, третья ждёт в очереди и снимается отменой
+	var ids []string
+	for i := 0; i < 3; i++ {
+		j := &store.Job{User: "anna", Kind: "wait"}
+		if err := q.Submit(ctx, j); err != nil {
+			return err
+		}
+		ids = append(ids, j.ID)
+	}
+	for i := 0; i < 100 && running.Load() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := expect(running.Load() == 2, "parallel: %d running", running.Load()); err != nil {
+		return err
+	}
+	queued, err := q.Cancel(ctx, "anna", ids[2])
+	if err != nil {
+		return err
+	}
+	running1, err := q.Cancel(ctx, "anna", ids[0])
+	if err != nil {
+		return err
+	}
+	if _, err := q.Cancel(ctx, "boris", ids[1]); err != store.ErrJobNotFound {
+		return fmt.Errorf("cancel by another user: %v", err)
+	}
+	close(release)
+	j0, _ := waitJob(ctx, st, "anna", ids[0])
+	j1, _ := waitJob(ctx, st, "anna", ids[1])
+	j2, _ := waitJob(ctx, st, "anna", ids[2])
+	if err := expect(queued.Status == store.JobCanceled && running1.Status == store.JobCanceled &&
+		j0.Status == store.JobCanceled && j1.Status == store.JobDone && j2.Status == store.JobCanceled && peak.Load() == 2,
+		"cancel: %s %s %s, peak %d", j0.Status, j1.Status, j2.Status, peak.Load()); err != nil {
+		return err
+	}
+
+	// остановка посреди задачи: после перезапуска она снова в очереди и доходит до конца
+	release = make(chan struct{})
+	j := &store.Job{User: "anna", Kind: "wait"}
+	if err := q.Submit(ctx, j); err != nil {
+		return err
+	}
+	for i := 0; i < 100 && running.Load() < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+	q.Wait()
+	if cur, _ := st.GetJob(ctx, "anna", j.ID); cur == nil || cur.Status != store.JobQueued {
+		return fmt.Errorf("job after shutdown: %+v", cur)
+	}
+
+	qctx2, stop2 := context.WithCancel(ctx)
+	defer stop2() // срабатывает раньше общего defer с q.Wait
+	q = start(qctx2, 1)
+	close(release)
+	after, err := waitJob(ctx, st, "anna", j.ID)
+	if err != nil {
+		return err
+	}
+	list, err := st.ListJobs(ctx, "anna", 0)
+	if err != nil {
+		return err
+	}
+	return expect(after.Status == store.JobDone && after.Result == "ok" && len(list) == 4 && !strings.Contains(after.Error, "context"),
+		"resume: %+v, %d jobs", after, len(list))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Самопроверка подсистем diary-server во временном каталоге.
+// Модели и внешние сервисы не нужны.
+//
+//	go run ./cmd/check            # все проверки
+//	go run ./cmd/check -only store
+
+type check struct {
+	name string
+	run  func(ctx context.Context, dir string) error
+}
+
+var checks = []check{
+	{"store", checkStore},
+	{"api", checkAPI},
+	{"search", checkSearch},
+	{"export", checkExport},
+	{"import", checkImport},
+	{"revisions", checkRevisions},
+	{"corrections", checkCorrections},
+	{"editing", checkEditing},
+	{"segment", checkSegment},
+	{"jobs", checkJobs},
+	{"audio", checkAudio},
+	{"insights", checkInsights},
+	{"semantic", checkSemantic},
+	{"tasks", checkTasks},
+	{"stages", checkStages},
+	{"math", checkMath},
+	{"stats", checkStats},
+	{"crypt", checkCrypt},
+	{"accounts", checkAccounts},
+	{"backup", checkBackup},
+	{"vault", checkVault},
+	{"webhooks", checkWebhooks},
+}
+
+func main() {
+	only := flag.String("only", "", "запустить только проверки с этими именами (через запятую)")
+	keep := flag.Bool("keep", false, "не удалять временные каталоги")
+	flag.Parse()
+
+	want := map[string]bool{}
+	for _, n := range strings.Split(*only, ",") {
+		if n != "" {
+			want[n] = true
+		}
+	}
+
+	ctx := context.Background()
+	failed := 0
+	for _, c := range checks {
+		if len(want) > 0 && !want[c.name] {
+			continue
+		}
+
+		dir, err := os.MkdirTemp("", "diary-check-"+c.name+"-")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		start := time.Now()
+		err = c.run(ctx, dir)
+		if err != nil {
+			failed++
+			log.Printf("❌ %s: %v", c.name, err)
+		} else {
+			log.Printf("✅ %s (за %v)", c.name, time.Since(start).Round(time.Millisecond))
+		}
+
+		if *keep {
+			log.Printf("   каталог: %s", dir)
+		} else {
+			os.RemoveAll(dir)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("Провалено: %d\n", failed)
+		os.Exit(1)
+	}
+}
+
+// expect короткий помощник для сравнений в проверках
+func expect(cond bool, format string, args ...any) error {
+	if cond {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkMath стадия math: формулы — команды, термин с числом в обычной
+// речи — нет; формы одного термина — один термин
+func checkMath(ctx context.Context, dir string) error {
+	pipeline, err := wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "math"}}, nil)
+	if err != nil {
+		return err
+	}
+	for text, want := range map[string]bool{
+		"икс в квадрате плюс два":           true,
+		"интеграл от синуса икс":            true,
+		"корень из двух равно одна целая":   true,
+		"в какой-то степени два":            false,
+		"потратили сумму двух тысяч":        false,
+		"сумму двух тысяч":                  false,
+		"в квадрате двора росли два тополя": false,
+		"сумма суммы":                       false,
+		"квадрат в квадрате":                false,
+	} {
+		seg := &wshandler.Segment{Type: "final", Text: text}
+		pipeline.Run(seg, nil)
+		if err := expect(seg.Command == want, "math %q: command %v, want %v", text, seg.Command, want); err != nil {
+			return err
+		}
+	}
+	return nil
+}
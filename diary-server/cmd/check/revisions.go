@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"bhl-diary/api"
+	"bhl-diary/diff"
+	"bhl-diary/store"
+)
+
+// checkRevisions история от сырого ASR до правок, пословный diff и возврат
+func checkRevisions(ctx context.Context, dir string) error {
+	ops := diff.Words("мы поехали на дачу вечером", "Мы поехали на дачу утром.")
+	got, _ := json.Marshal(ops)
+	want := `[{"op":"delete","text":"мы"},{"op":"insert","text":"Мы"},{"op":"equal","text":"поехали на дачу"},{"op":"delete","text":"вечером"},{"op":"insert","text":"утром."}]`
+	if err := expect(string(got) == want, "diff.Words:\n got %s\nwant %s", got, want); err != nil {
+		return err
+	}
+	if err := expect(len(diff.Words("", "")) == 0, "empty diff is not empty"); err != nil {
+		return err
+	}
+
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return revisionsScenario(ctx, st)
+}
+
+// revisionsScenario ревизии диктовки, правка, diff и возврат через API
+// на любом бэкенде хранилища
+func revisionsScenario(ctx context.Context, st store.Store) error {
+	raw, processed := "сегодня был на даче посадил горох", "Сегодня был на даче, посадил горох."
+	e := &store.Entry{
+		User:   "anna",
+		Text:   processed,
+		Finals: []store.Final{{Type: store.FinalText, Text: processed, Raw: raw}},
+		Revisions: []store.Revision{
+			{Kind: store.RevisionASR, Text: raw, Author: "anna"},
+			{Kind: store.RevisionProcessed, Text: processed, Author: "anna"},
+		},
+	}
+	if err := st.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+
+	tokens := map[string]string{"ta": "anna", "tb": "boris"}
+	auth := func(r *http.Request) (string, bool) {
+		u, ok := tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		return u, ok
+	}
+	mux := http.NewServeMux()
+	api.New(st, auth).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	call := func(token, method, path, body string) (int, string) {
+		req, _ := http.NewRequest(method, srv.URL+"/api/v1/entries/"+e.ID+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	steps := []struct {
+		token, method, path, body string
+		status                    int
+		contains                  string
+	}{
+		{"ta", "GET", "", "", 200, `"raw":"` + raw},
+		{"ta", "PATCH", "", `{"title":"Дача"}`, 200, ""}, // без смены текста ревизии нет
+		{"ta", "PATCH", "", `{"text":"Сегодня был на даче, посадил горох и укроп."}`, 200, ""},
+		{"ta", "GET", "/diff", "", 200, `{"from":2,"to":3,"ops":[{"op":"equal","text":"Сегодня был на даче, посадил"},{"op":"delete","text":"горох."},{"op":"insert","text":"горох и укроп."}]}`},
+		{"ta", "GET", "/diff?from=1&to=2", "", 200, `"op":"insert","text":"Сегодня"`},
+		{"ta", "GET", "/diff?from=1&to=9", "", 404, "revision not found"},
+		{"ta", "GET", "/diff?from=0", "", 400, ""},
+		{"tb", "GET", "/revisions", "", 404, ""},
+		{"tb", "POST", "/revisions/1/restore", "", 404, ""},
+		{"ta", "POST", "/revisions/1/restore", "", 200, `"text":"` + raw + `"`},
+		{"ta", "GET", "/revisions", "", 200, `"kind":"restore","text":"` + raw + `","author":"anna","restored_from":1`},
+	}
+	for _, s := range steps {
+		status, body := call(s.token, s.method, s.path, s.body)
+		if status != s.status || !strings.Contains(body, s.contains) {
+			return fmt.Errorf("%s %s as %q: got %d %s", s.method, s.path, s.token, status, body)
+		}
+	}
+
+	revs, err := st.ListRevisions(ctx, "anna", e.ID)
+	if err != nil {
+		return err
+	}
+	var kinds []string
+	for _, r := range revs {
+		kinds = append(kinds, r.Kind)
+	}
+	return expect(strings.Join(kinds, ",") == "asr,processed,edit,restore", "revision kinds: %v", kinds)
+}
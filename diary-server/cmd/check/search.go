@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bhl-diary/search"
+	"bhl-diary/store"
+)
+
+// checkSearch словоформы, фразы, даты, синхронизация при правке и после
+// перезапуска, запись индекса на диск только по Flush
+func checkSearch(ctx context.Context, dir string) error {
+	base, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+
+	ix, err := search.Open(dir, base)
+	if err != nil {
+		return err
+	}
+	st := search.NewIndexedStore(base, ix)
+
+	day := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	texts := []string{
+		"Поехали на дачу, поставили новый забор.",
+		"На даче холодно, печку не топили.",
+		"Весь день работал, про дачу не думал.",
+		"Купил забор новый для соседа.",
+	}
+	ids := make([]string, len(texts))
+	for i, t := range texts {
+		e := &store.Entry{User: "anna", Text: t, CreatedAt: day.AddDate(i, 0, 0)}
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+		ids[i] = e.ID
+	}
+	if err := st.CreateEntry(ctx, &store.Entry{User: "boris", Text: "Моя дача лучше.", CreatedAt: day}); err != nil {
+		return err
+	}
+
+	find := func(ix *search.Index, q search.Query) ([]string, []search.Hit, error) {
+		q.User = "anna"
+		hits, err := ix.Search(ctx, q)
+		var got []string
+		for _, h := range hits {
+			got = append(got, h.EntryID)
+		}
+		return got, hits, err
+	}
+
+	got, hits, err := find(ix, search.Query{Text: "дача"})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(got) == 3, "дача: got %d hits, want 3 (другие формы и не чужие)", len(got)); err != nil {
+		return err
+	}
+	if err := expect(strings.Contains(hits[0].Snippet, "<mark>"), "no highlight in %q", hits[0].Snippet); err != nil {
+		return err
+	}
+
+	got, _, err = find(ix, search.Query{Text: `"новый забор"`})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(got) == 1 && got[0] == ids[0], "phrase: got %v", got); err != nil {
+		return err
+	}
+
+	got, _, err = find(ix, search.Query{Text: "дачу", From: day.AddDate(1, 0, 0), To: day.AddDate(2, 0, 0)})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(got) == 1 && got[0] == ids[1], "date filter: got %v", got); err != nil {
+		return err
+	}
+
+	// Правка записи сразу видна в поиске
+	e, err := st.GetEntry(ctx, "anna", ids[2])
+	if err != nil {
+		return err
+	}
+	if err := ix.Flush(); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, "index", "anna.gob")
+	before, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	e.Text = "Весь день работал, про гараж не думал."
+	if err := st.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+	// на диск — только по Flush, а не на каждую запись
+	after, _ := os.ReadFile(file)
+	if err := expect(bytes.Equal(before, after), "index file rewritten on update"); err != nil {
+		return err
+	}
+	if err := ix.Flush(); err != nil {
+		return err
+	}
+	after, _ = os.ReadFile(file)
+	if err := expect(!bytes.Equal(before, after), "index file not written by Flush"); err != nil {
+		return err
+	}
+	got, _, _ = find(ix, search.Query{Text: "гаражом"})
+	if err := expect(len(got) == 1, "edit not indexed: %v", got); err != nil {
+		return err
+	}
+
+	// Запись мимо индекса: новый индекс заметит расхождение и перестроится
+	if err := base.DeleteEntry(ctx, "anna", ids[0]); err != nil {
+		return err
+	}
+	ix2, err := search.Open(dir, base)
+	if err != nil {
+		return err
+	}
+	got, _, err = find(ix2, search.Query{Text: "дача"})
+	if err != nil {
+		return err
+	}
+	return expect(len(got) == 1 && got[0] == ids[1], "reload out of sync: %v", got)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"bhl-diary/llm"
+	"bhl-diary/segment"
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkSegment абзацы по паузам и пунктуации, хранение абзацев и деление
+// по темам через заглушку Ollama
+func checkSegment(ctx context.Context, dir string) error {
+	doc := wshandler.NewDocument(0, wshandler.SegmentConfig{PauseMs: 2000, LongPauseMs: 8000, MaxChars: 1000})
+	t := time.Date(2026, 5, 1, 9, 0, 0, 0, time.Local)
+	say := func(text string, pause time.Duration) {
+		start := t.Add(pause)
+		t = start.Add(3 * time.Second)
+		doc.AppendText(text, start, t)
+	}
+	say("Утром шёл дождь.", 0)
+	say("Потом распогодилось.", time.Second)            // короткая пауза — тот же абзац
+	say("После обеда поехали на рынок,", 3*time.Second) // пауза после точки — новый абзац
+	say("купили рассаду.", 3*time.Second)               // после запятой держим абзац
+	say("вечером читал", 9*time.Second)                 // очень длинная пауза — всегда новый
+
+	paras := doc.Paragraphs()
+	got := make([]string, len(paras))
+	for i, p := range paras {
+		got[i] = p.Text
+	}
+	want := []string{"Утром шёл дождь. Потом распогодилось.", "После обеда поехали на рынок, купили рассаду.", "вечером читал"}
+	if err := expect(strings.Join(got, "|") == strings.Join(want, "|"), "paragraphs: %q", got); err != nil {
+		return err
+	}
+	if err := expect(paras[1].Start.Before(paras[1].End) && paras[0].End.Before(paras[1].Start), "paragraph times: %+v", paras); err != nil {
+		return err
+	}
+
+	// хранение: абзацы с временем, правка текста пересобирает их
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	e := &store.Entry{User: "anna"}
+	for _, p := range paras {
+		e.Paragraphs = append(e.Paragraphs, store.Paragraph{Text: p.Text, Start: p.Start, End: p.End})
+	}
+	e.Text = store.JoinParagraphs(e.Paragraphs)
+	if err := st.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+	got1, err := st.GetEntry(ctx, "anna", e.ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(got1.Paragraphs) == 3 && got1.Paragraphs[2].Start.Equal(paras[2].Start), "stored paragraphs: %+v", got1.Paragraphs); err != nil {
+		return err
+	}
+
+	got1.Text = strings.Replace(got1.Text, "вечером читал", "Вечером читал.\n\nНочью не спалось.", 1)
+	if err := st.UpdateEntry(ctx, got1); err != nil {
+		return err
+	}
+	got2, err := st.GetEntry(ctx, "anna", e.ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(got2.Paragraphs) == 4 && got2.Paragraphs[0].Start.Equal(paras[0].Start) && got2.Paragraphs[3].Start.IsZero(),
+		"paragraphs after edit: %+v", got2.Paragraphs); err != nil {
+		return err
+	}
+
+	// импортированная запись без абзацев получает их из текста
+	plain := &store.Entry{User: "anna", Text: "Первый.\n\n\nВторой."}
+	if err := st.CreateEntry(ctx, plain); err != nil {
+		return err
+	}
+	if got, _ := st.GetEntry(ctx, "anna", plain.ID); got == nil || len(got.Paragraphs) != 2 {
+		return expect(false, "plain text paragraphs: %+v", got)
+	}
+
+	// деление по темам: модель говорит, что с третьего абзаца новая тема
+	var prompt string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Format   string `json:"format"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": `{"starts": [3, 3, 99]}`}})
+	}))
+	defer ollama.Close()
+
+	splitter := segment.NewTopicSplitter(segment.TopicConfig{Enabled: true, MinParagraphs: 3, LLM: llm.Config{URL: ollama.URL, Model: "stub"}})
+	defer splitter.Close()
+	groups, err := splitter.Split(ctx, got2.Paragraphs)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(groups) == 2 && len(groups[0]) == 2 && len(groups[1]) == 2 && strings.Contains(prompt, "[4] Ночью не спалось."),
+		"topic split: %d groups, prompt %q", len(groups), prompt); err != nil {
+		return err
+	}
+
+	// короткие сессии модель не спрашивает
+	prompt = ""
+	groups, err = splitter.Split(ctx, got2.Paragraphs[:2])
+	if err != nil {
+		return err
+	}
+	return expect(len(groups) == 1 && prompt == "", "short session was split: %d groups", len(groups))
+}
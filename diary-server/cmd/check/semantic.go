@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"bhl-diary/api"
+	"bhl-diary/jobs"
+	"bhl-diary/llm"
+	"bhl-diary/semantic"
+	"bhl-diary/store"
+)
+
+// stubConcepts «смысл» для заглушки векторов: разные слова об одном и том же
+// попадают в одно измерение, остальные слова — в хешированные
+var stubConcepts = [][]string{
+	{"болел", "болезн", "температур", "больнич", "простуд", "врач"},
+	{"дач", "огород", "забор", "грядк"},
+	{"кот", "кош"},
+}
+
+const stubHashDims = 61
+
+func stubVector(text string) []float32 {
+	v := make([]float32, len(stubConcepts)+stubHashDims)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		concept := -1
+		for i, prefixes := range stubConcepts {
+			for _, p := range prefixes {
+				if strings.HasPrefix(w, p) {
+					concept = i
+				}
+			}
+		}
+		if concept >= 0 {
+			v[concept] += 3
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(w))
+		v[len(stubConcepts)+int(h.Sum32()%stubHashDims)]++
+	}
+	return v
+}
+
+// checkSemantic смысловой поиск и ответы на вопросы: векторы через очередь,
+// догон после правок, сохранение на диск, ссылки в ответе — на заглушке Ollama
+func checkSemantic(ctx context.Context, dir string) error {
+	var mu sync.Mutex
+	var embedded, chats []string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/embed":
+			var req struct {
+				Input []string `json:"input"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			embedded = append(embedded, req.Input...)
+			mu.Unlock()
+			var out [][]float32
+			for _, t := range req.Input {
+				out = append(out, stubVector(t))
+			}
+			json.NewEncoder(w).Encode(map[string]any{"embeddings": out})
+		case "/api/chat":
+			var req struct {
+				Messages []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			prompt := req.Messages[len(req.Messages)-1].Content
+			mu.Lock()
+			chats = append(chats, prompt)
+			mu.Unlock()
+			// несуществующий номер и повтор должны отсеяться
+			answer := `{"answer": "Ты болел в начале марта [1].", "sources": [1, 3, 1]}`
+			if strings.Contains(prompt, "врач") {
+				answer = `{"answer": ""}`
+			}
+			json.NewEncoder(w).Encode(map[string]any{"message": map[string]string{"role": "assistant", "content": answer}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ollama.Close()
+
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	cfg := semantic.Config{
+		Enabled:    true,
+		Embeddings: semantic.EmbedConfig{Provider: semantic.ProviderOllama, Model: "stub", URL: ollama.URL + "/api/embed"},
+		LLM:        llm.Config{Model: "stub", URL: ollama.URL + "/api/chat"},
+		MinScore:   0.5,
+	}
+	emb, err := semantic.NewEmbedder(cfg.Embeddings)
+	if err != nil {
+		return err
+	}
+	ix, err := semantic.Open(dir, st, emb)
+	if err != nil {
+		return err
+	}
+	defer ix.Close()
+
+	q := jobs.New(st, 1)
+	q.Handle(semantic.Kind, ix.Handler())
+	qctx, stop := context.WithCancel(ctx)
+	if err := q.Start(qctx); err != nil {
+		stop()
+		return err
+	}
+	defer func() { stop(); q.Wait() }()
+
+	ill := &store.Entry{Title: "Простыл", Text: "Поднялась температура, взял больничный и весь день лежал.",
+		CreatedAt: time.Date(2026, 3, 2, 20, 0, 0, 0, time.Local)}
+	dacha := &store.Entry{Text: "Поехали на дачу, поправили забор и вскопали грядки."}
+	// длинная запись режется на два фрагмента; про кошку — только во втором
+	long := &store.Entry{Text: strings.Repeat("Весь день разбирал старые бумаги и письма из ящика. ", 25) +
+		"\n\nВечером кошка принесла котят на балкон."}
+	other := &store.Entry{User: "boris", Text: "Болел неделю, температура держалась три дня."}
+	for _, e := range []*store.Entry{ill, dacha, long, other} {
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	j, err := semantic.Enqueue(ctx, q, "")
+	if err != nil {
+		return err
+	}
+	if j, err = waitJob(ctx, st, "", j.ID); err != nil {
+		return err
+	}
+	if err := expect(j.Status == store.JobDone && j.Result == "3", "embed job: %s %q %q", j.Status, j.Result, j.Error); err != nil {
+		return err
+	}
+	mu.Lock()
+	n := len(embedded)
+	titled := false
+	for _, t := range embedded {
+		titled = titled || t == "Простыл\nПоднялась температура, взял больничный и весь день лежал."
+	}
+	mu.Unlock()
+	if err := expect(n == 4 && titled, "embedded chunks: %d %v", n, titled); err != nil {
+		return err
+	}
+
+	srv := api.New(st, nil)
+	srv.SetSemantic(ix, semantic.NewAsker(ix, cfg))
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	search := func(query string) ([]semantic.Hit, int, error) {
+		resp, err := http.Get(ts.URL + "/api/v1/search/semantic?q=" + url.QueryEscape(query))
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Hits []semantic.Hit `json:"hits"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out.Hits, resp.StatusCode, nil
+	}
+
+	// ни одного общего слова с записью, но смысл тот же; чужая запись не видна
+	hits, code, err := search("когда я болел")
+	if err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusOK && len(hits) == 3 && hits[0].EntryID == ill.ID && hits[0].Title == "Простыл" && hits[0].Score > 0.5,
+		"illness search: %d %+v", code, hits); err != nil {
+		return err
+	}
+	hits, _, err = search("кошка")
+	if err != nil {
+		return err
+	}
+	if err := expect(len(hits) > 0 && hits[0].EntryID == long.ID && len(hits[0].Snippet) < len(long.Text)/2 && strings.HasSuffix(hits[0].Snippet, "котят на балкон."),
+		"best chunk: %+v", hits); err != nil {
+		return err
+	}
+
+	// правка и удаление догоняются перед поиском
+	dacha.Text = "Весь вечер кот спал на подоконнике."
+	if err := st.UpdateEntry(ctx, dacha); err != nil {
+		return err
+	}
+	if err := st.DeleteEntry(ctx, "", long.ID); err != nil {
+		return err
+	}
+	hits, _, err = search("кот")
+	if err != nil {
+		return err
+	}
+	if err := expect(len(hits) == 2 && hits[0].EntryID == dacha.ID, "after edit: %+v", hits); err != nil {
+		return err
+	}
+
+	// векторы на диске: новый индекс ничего не пересчитывает
+	ix2, err := semantic.Open(dir, st, emb)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	n = len(embedded)
+	mu.Unlock()
+	synced, err := ix2.Sync(ctx, "")
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	again := len(embedded) - n
+	mu.Unlock()
+	if err := expect(synced == 0 && again == 0, "reopen: synced %d, embedded %d", synced, again); err != nil {
+		return err
+	}
+
+	ask := func(question string) (*semantic.Answer, int, error) {
+		body, _ := json.Marshal(map[string]any{"question": question})
+		resp, err := http.Post(ts.URL+"/api/v1/ask", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+		var out semantic.Answer
+		json.NewDecoder(resp.Body).Decode(&out)
+		return &out, resp.StatusCode, nil
+	}
+
+	ans, code, err := ask("Когда я болел?")
+	if err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusOK && ans.Answer == "Ты болел в начале марта [1]." && len(ans.Citations) == 1 &&
+		ans.Citations[0].N == 1 && ans.Citations[0].EntryID == ill.ID,
+		"ask: %d %+v", code, ans); err != nil {
+		return err
+	}
+	mu.Lock()
+	prompt := chats[len(chats)-1]
+	mu.Unlock()
+	if err := expect(strings.Contains(prompt, "[1] 02.03.2026, «Простыл»:") && strings.Contains(prompt, "Сегодня") &&
+		!strings.Contains(prompt, "[2]"), "ask prompt: %q", prompt); err != nil {
+		return err
+	}
+
+	// ничего близкого — модель не спрашиваем; пустой ответ модели — 502
+	ans, code, err = ask("Что я думаю о квантовой механике?")
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	asked := len(chats)
+	mu.Unlock()
+	if err := expect(code == http.StatusOK && len(ans.Citations) == 0 && strings.Contains(ans.Answer, "ничего") && asked == 1,
+		"nothing found: %d %+v, chats %d", code, ans, asked); err != nil {
+		return err
+	}
+	if _, code, err = ask("Какой врач меня лечил?"); err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusBadGateway, "empty answer: %d", code); err != nil {
+		return err
+	}
+	_, code, err = ask("")
+	if err != nil {
+		return err
+	}
+	return expect(code == http.StatusBadRequest, "empty question: %d", code)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkStages стадии конвейера без моделей: числительные цифрами,
+// маска мата без обычных слов с похожим началом
+func checkStages(ctx context.Context, dir string) error {
+	pipeline, err := wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "itn"}}, nil)
+	if err != nil {
+		return err
+	}
+	for text, want := range map[string]string{
+		"двадцать пять лет":                      "25 лет",
+		"триста тысяч сорок":                     "300040",
+		"два миллиона пятьсот тысяч":             "2500000",
+		"пять тысяч три миллиона":                "5000 3000000",
+		"тысяча миллион":                         "1000 1000000",
+		"один из них, два три":                   "один из них, 2 3",
+		"сто двадцать три тысячи четыреста пять": "123405",
+	} {
+		seg := &wshandler.Segment{Type: "final", Text: text}
+		pipeline.Run(seg, nil)
+		if err := expect(seg.Text == want, "itn %q: %q, want %q", text, seg.Text, want); err != nil {
+			return err
+		}
+	}
+	pipeline, err = wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "profanity"}}, nil)
+	if err != nil {
+		return err
+	}
+	for text, want := range map[string]string{
+		"Бляшка на ремне":         "Бляшка на ремне",
+		"сукно и суконная куртка": "сукно и суконная куртка",
+		"Бля, опять эта сука":     "Б**, опять эта с***",
+		"пиздец":                  "п*****",
+	} {
+		seg := &wshandler.Segment{Type: "final", Text: text}
+		pipeline.Run(seg, nil)
+		if err := expect(seg.Text == want, "profanity %q: %q, want %q", text, seg.Text, want); err != nil {
+			return err
+		}
+	}
+	return nil
+}
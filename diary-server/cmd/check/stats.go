@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"bhl-diary/analytics"
+	"bhl-diary/api"
+	"bhl-diary/store"
+)
+
+// checkStats статистика письма: слова и минуты по дням, темп речи по
+// времени слов, серии, частые слова, пересчёт при правке и отчёт для CLI
+func checkStats(ctx context.Context, dir string) error {
+	base, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+	stats, err := analytics.Open(dir, base)
+	if err != nil {
+		return err
+	}
+	st := analytics.NewTrackedStore(base, stats)
+
+	at := func(d, h int) time.Time { return time.Date(2026, 10, d, h, 0, 0, 0, time.Local) }
+	// четыре слова за две секунды — 120 слов в минуту
+	spoken := []store.Final{{Type: store.FinalText, Text: "Поехали на дачу утром.", At: at(10, 9), Words: []store.Word{
+		{Text: "поехали", Start: 1, End: 1.5}, {Text: "на", Start: 1.5, End: 1.7},
+		{Text: "дачу", Start: 1.7, End: 2.4}, {Text: "утром", Start: 2.4, End: 3},
+	}}}
+	dacha := &store.Entry{Text: "Поехали на дачу утром. На даче хорошо. Дача старая, дачу люблю.", Finals: spoken, CreatedAt: at(10, 9)}
+	entries := []*store.Entry{
+		dacha,
+		{Text: "Читал книгу весь вечер.", CreatedAt: at(11, 21)},
+		{Text: "Снова дача, снова грядки.", CreatedAt: at(12, 8)},
+		{Text: "Работа, работа.", CreatedAt: at(14, 19)},
+		{Text: "Спокойный день.", CreatedAt: at(15, 22)},
+	}
+	for _, e := range entries {
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	srv := api.New(st, nil)
+	srv.SetStats(stats)
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(query string) (*analytics.Report, int, error) {
+		resp, err := http.Get(ts.URL + "/api/v1/stats" + query)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+		var r analytics.Report
+		json.NewDecoder(resp.Body).Decode(&r)
+		return &r, resp.StatusCode, nil
+	}
+
+	r, code, err := get("?from=2026-10-10&to=2026-10-16&top=3")
+	if err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusOK && len(r.Series) == 7 && r.Series[0].Date == "2026-10-10" && r.Series[0].Words == 11 &&
+		r.Series[0].Minutes == 0 && r.Series[0].WPM == 120 && r.Series[3].Words == 0 && r.Series[3].Entries == 0,
+		"series: %d %+v", code, r.Series); err != nil {
+		return err
+	}
+	if err := expect(r.Totals.Entries == 5 && r.Totals.Words == 23 && r.Totals.ActiveDays == 5 && r.Totals.WordsPerDay == 4.6,
+		"totals: %+v", r.Totals); err != nil {
+		return err
+	}
+	// 10–12 подряд, 13-го пропуск; 16-го ещё не писал — серия 14–15 жива
+	if err := expect(r.LongestStreak == analytics.Streak{Days: 3, From: "2026-10-10", To: "2026-10-12"} &&
+		r.CurrentStreak == analytics.Streak{Days: 2, From: "2026-10-14", To: "2026-10-15"},
+		"streaks: %+v %+v", r.CurrentStreak, r.LongestStreak); err != nil {
+		return err
+	}
+	if err := expect(len(r.Lemmas) == 3 && r.Lemmas[0] == analytics.Lemma{Word: "дачу", Count: 5} && r.Lemmas[1].Word == "работа",
+		"lemmas: %+v", r.Lemmas); err != nil {
+		return err
+	}
+
+	// правка текста: слова пересчитаны, темп речи по фразам остался
+	edited, err := st.GetEntry(ctx, "", dacha.ID)
+	if err != nil {
+		return err
+	}
+	edited.Text = "Поехали на дачу утром."
+	if err := st.UpdateEntry(ctx, edited); err != nil {
+		return err
+	}
+	if err := st.DeleteEntry(ctx, "", entries[4].ID); err != nil {
+		return err
+	}
+	// запись мимо обёртки (импорт из CLI) учитывается при следующем отчёте
+	if err := base.CreateEntry(ctx, &store.Entry{Text: "Тихо.", CreatedAt: at(16, 10)}); err != nil {
+		return err
+	}
+	r, _, err = get("?from=2026-10-10&to=2026-10-16&group=week")
+	if err != nil {
+		return err
+	}
+	if err := expect(len(r.Series) == 2 && r.Series[0].Date == "2026-10-05" && r.Series[0].Entries == 2 && r.Series[0].Words == 8 && r.Series[0].WPM == 120 &&
+		r.Series[1].Date == "2026-10-12" && r.Series[1].Entries == 3 && r.Totals.Words == 15,
+		"after edit: %+v %+v", r.Series, r.Totals); err != nil {
+		return err
+	}
+	if err := expect(r.CurrentStreak.Days == 1 && r.CurrentStreak.From == "2026-10-16", "current after edit: %+v", r.CurrentStreak); err != nil {
+		return err
+	}
+
+	// статистика на диске: новый индекс даёт тот же отчёт
+	reopened, err := analytics.Open(dir, base)
+	if err != nil {
+		return err
+	}
+	r2, err := reopened.Report(ctx, analytics.Query{From: at(10, 0), To: at(17, 0), Group: analytics.GroupWeek})
+	if err != nil {
+		return err
+	}
+	if err := expect(r2.Totals == r.Totals && len(r2.Series) == 2, "reopened: %+v", r2.Totals); err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	if err := analytics.WriteText(&text, r2); err != nil {
+		return err
+	}
+	if err := expect(strings.Contains(text.String(), "Самая длинная:     3 дн. (2026-10-10 — 2026-10-12)") &&
+		strings.Contains(text.String(), "Темп речи:         120 слов/мин") && strings.Contains(text.String(), "По неделям:"),
+		"text report:\n%s", text.String()); err != nil {
+		return err
+	}
+
+	_, code, err = get("?group=year")
+	if err != nil {
+		return err
+	}
+	return expect(code == http.StatusBadRequest, "bad group: %d", code)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"bhl-diary/store"
+)
+
+// checkStore CRUD, фильтры по дате и повторное открытие (миграции не падают)
+func checkStore(ctx context.Context, dir string) error {
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		e := &store.Entry{
+			User:      "anna",
+			SessionID: fmt.Sprintf("s%d", i),
+			Text:      fmt.Sprintf("Запись номер %d.", i),
+			CreatedAt: day.AddDate(0, 0, i),
+			Finals: []store.Final{
+				{Type: store.FinalText, Text: "Запись номер.", At: day},
+				{Type: store.FinalCommand, Name: "createLatex", Script: "2+3", Text: "два плюс три", At: day},
+			},
+		}
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+	}
+	if err := st.CreateEntry(ctx, &store.Entry{User: "boris", Text: "чужое", CreatedAt: day}); err != nil {
+		return err
+	}
+
+	list, err := st.ListEntries(ctx, store.Filter{User: "anna", From: day.AddDate(0, 0, 1)})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(list) == 2, "filter from: got %d entries, want 2", len(list)); err != nil {
+		return err
+	}
+
+	page, err := st.ListEntries(ctx, store.Filter{User: "anna", Limit: 1, Offset: 1})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(page) == 1 && page[0].SessionID == "s1", "pagination: got %+v", page); err != nil {
+		return err
+	}
+
+	e, err := st.GetEntry(ctx, "anna", list[0].ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(e.Finals) == 2 && e.Finals[1].Script == "2+3", "finals not restored: %+v", e.Finals); err != nil {
+		return err
+	}
+
+	e.Text = "Исправленный текст."
+	if err := st.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+
+	if _, err := st.GetEntry(ctx, "boris", e.ID); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("other user got entry: %v", err)
+	}
+	if err := st.DeleteEntry(ctx, "boris", e.ID); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("other user deleted entry: %v", err)
+	}
+	if err := st.Close(); err != nil {
+		return err
+	}
+
+	// Повторное открытие: миграции уже применены, данные на месте
+	st, err = store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	got, err := st.GetEntry(ctx, "anna", e.ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(got.Text == "Исправленный текст.", "update lost after reopen: %q", got.Text); err != nil {
+		return err
+	}
+	if err := st.DeleteEntry(ctx, "anna", e.ID); err != nil {
+		return err
+	}
+	_, err = st.GetEntry(ctx, "anna", e.ID)
+	return expect(errors.Is(err, store.ErrNotFound), "entry not deleted: %v", err)
+}
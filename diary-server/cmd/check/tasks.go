@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"bhl-diary/api"
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+)
+
+// checkTasks дела и сроки из диктовки: разбор русских выражений времени,
+// стадия конвейера, хранение, API и выгрузка в iCalendar
+func checkTasks(ctx context.Context, dir string) error {
+	ref := time.Date(2026, 10, 14, 10, 0, 0, 0, time.Local) // среда, 10:00
+	day := func(m time.Month, d, h, min int) time.Time { return time.Date(2026, m, d, h, min, 0, 0, time.Local) }
+
+	x := wshandler.NewTaskExtractor(nil)
+	cases := []struct {
+		text    string
+		task    string
+		due     time.Time
+		hasTime bool
+	}{
+		{"Надо позвонить маме в пятницу.", "Позвонить маме", day(10, 16, 0, 0), false},
+		{"Послезавтра забрать посылку на почте.", "Забрать посылку на почте", day(10, 16, 0, 0), false},
+		{"В следующий вторник в пять встреча с Петей.", "Встреча с Петей", day(10, 20, 17, 0), true},
+		{"Завтра вечером надо погладить рубашку.", "Погладить рубашку", day(10, 15, 19, 0), true},
+		{"Напомни мне через два часа выключить духовку.", "Выключить духовку", day(10, 14, 12, 0), true},
+		{"Нужно оплатить интернет до пятнадцатого ноября.", "Оплатить интернет", day(11, 15, 0, 0), false},
+		{"Мне надо двадцать первого мая сдать отчёт.", "Сдать отчёт", time.Date(2027, 5, 21, 0, 0, 0, 0, time.Local), false},
+		{"На следующей неделе нужно записаться к стоматологу.", "Записаться к стоматологу", day(10, 19, 0, 0), false},
+		{"В 9 утра надо выйти.", "Выйти", day(10, 15, 9, 0), true},
+		{"Не забыть купить хлеб.", "Купить хлеб", time.Time{}, false},
+	}
+	for _, c := range cases {
+		got := x.Extract(c.text, ref)
+		if len(got) != 1 {
+			return fmt.Errorf("%q: %d tasks", c.text, len(got))
+		}
+		t := got[0]
+		due := time.Time{}
+		if t.Due != nil {
+			due = *t.Due
+		}
+		if err := expect(t.Text == c.task && due.Equal(c.due) && t.HasTime == c.hasTime,
+			"%q: %q %v %v", c.text, t.Text, due, t.HasTime); err != nil {
+			return err
+		}
+	}
+	// прошедшее, вопросы и обычные фразы — не дела
+	for _, text := range []string{"В пятницу ходили в кино.", "Надо ли мне это?", "Сегодня был хороший день."} {
+		if got := x.Extract(text, ref); len(got) != 0 {
+			return fmt.Errorf("%q: unexpected tasks %+v", text, got)
+		}
+	}
+
+	// стадия конвейера: срок от времени фразы, свои маркеры
+	pipeline, err := wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "tasks", Words: []string{"хочу"}}}, nil)
+	if err != nil {
+		return err
+	}
+	seg := &wshandler.Segment{Type: "final", Text: "Хочу в субботу сходить в музей. Надо бы поспать.", Start: ref}
+	pipeline.Run(seg, nil)
+	if err := expect(len(seg.Tasks) == 1 && seg.Tasks[0].Text == "Сходить в музей" && seg.Tasks[0].When == "в субботу" &&
+		seg.Tasks[0].Due.Equal(day(10, 17, 0, 0)), "stage tasks: %+v", seg.Tasks); err != nil {
+		return err
+	}
+
+	// хранение: порядок по сроку, фильтры, каскадное удаление с записью
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	entry := &store.Entry{Text: "Надо позвонить маме в пятницу. Не забыть купить хлеб. Завтра в 9 утра стоматолог.", CreatedAt: ref}
+	other := &store.Entry{Text: "Послезавтра забрать посылку.", CreatedAt: ref.Add(time.Hour)}
+	for _, e := range []*store.Entry{entry, other} {
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+	}
+	for _, e := range []*store.Entry{entry, other} {
+		for _, t := range x.Extract(e.Text, e.CreatedAt) {
+			task := &store.Task{EntryID: e.ID, Text: t.Text, Source: t.Source, HasTime: t.HasTime}
+			if t.Due != nil {
+				task.Due = *t.Due
+			}
+			if err := st.CreateTask(ctx, task); err != nil {
+				return err
+			}
+		}
+	}
+	if err := expect(st.CreateTask(ctx, &store.Task{User: "boris", EntryID: entry.ID, Text: "чужое"}) == store.ErrNotFound,
+		"task for another user's entry must fail"); err != nil {
+		return err
+	}
+
+	srv := api.New(st, nil)
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	list := func(query string) ([]store.Task, error) {
+		resp, err := http.Get(ts.URL + "/api/v1/tasks" + query)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Tasks []store.Task `json:"tasks"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return nil, fmt.Errorf("tasks%s: %d %w", query, resp.StatusCode, err)
+		}
+		return out.Tasks, nil
+	}
+	tasks, err := list("")
+	if err != nil {
+		return err
+	}
+	var texts []string
+	for _, t := range tasks {
+		texts = append(texts, t.Text)
+	}
+	// срок одинаковый — раньше найденное первым, без срока — в конце
+	if err := expect(strings.Join(texts, "|") == "Стоматолог|Позвонить маме|Забрать посылку|Купить хлеб", "task order: %v", texts); err != nil {
+		return err
+	}
+	call, bread := tasks[1], tasks[3]
+	if err := expect(bread.Due.IsZero() && call.EntryID == entry.ID && tasks[0].HasTime && !call.HasTime, "tasks: %+v", tasks); err != nil {
+		return err
+	}
+
+	// отметить сделанным и перенести срок
+	patch := func(id, body string) (int, store.Task, error) {
+		req, _ := http.NewRequest(http.MethodPatch, ts.URL+"/api/v1/tasks/"+id, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, store.Task{}, err
+		}
+		defer resp.Body.Close()
+		var t store.Task
+		json.NewDecoder(resp.Body).Decode(&t)
+		return resp.StatusCode, t, nil
+	}
+	code, got, err := patch(bread.ID, `{"done": true}`)
+	if err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusOK && got.Done && !got.DoneAt.IsZero(), "done: %d %+v", code, got); err != nil {
+		return err
+	}
+	code, got, err = patch(call.ID, `{"due": "2026-10-18T12:30:00+03:00", "text": "Позвонить маме и папе"}`)
+	if err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusOK && got.HasTime && got.Text == "Позвонить маме и папе" &&
+		got.Due.Equal(time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)), "reschedule: %d %+v", code, got); err != nil {
+		return err
+	}
+	if code, _, err = patch(call.ID, `{"due": "вчера"}`); err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusBadRequest, "bad due: %d", code); err != nil {
+		return err
+	}
+	if code, _, err = patch("nope", `{"done": true}`); err != nil {
+		return err
+	}
+	if err := expect(code == http.StatusNotFound, "missing task: %d", code); err != nil {
+		return err
+	}
+
+	open, err := list("?done=false&from=2026-10-15&to=2026-10-16")
+	if err != nil {
+		return err
+	}
+	if err := expect(len(open) == 2 && open[0].Text == "Стоматолог" && open[1].Text == "Забрать посылку", "filtered: %+v", open); err != nil {
+		return err
+	}
+
+	// дела записи — в ответе на запись
+	resp, err := http.Get(ts.URL + "/api/v1/entries/" + entry.ID)
+	if err != nil {
+		return err
+	}
+	var withTasks struct {
+		Tasks []store.Task `json:"tasks"`
+	}
+	json.NewDecoder(resp.Body).Decode(&withTasks)
+	resp.Body.Close()
+	if err := expect(len(withTasks.Tasks) == 3, "entry tasks: %d", len(withTasks.Tasks)); err != nil {
+		return err
+	}
+
+	// iCalendar: открытые дела, событие со временем — с напоминанием
+	resp, err = http.Get(ts.URL + "/api/v1/tasks.ics")
+	if err != nil {
+		return err
+	}
+	ics, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	cal := string(ics)
+	if err := expect(resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar") &&
+		strings.HasPrefix(cal, "BEGIN:VCALENDAR\r\n") && strings.HasSuffix(cal, "END:VCALENDAR\r\n") &&
+		strings.Count(cal, "BEGIN:VEVENT") == 3 && !strings.Contains(cal, "Купить хлеб") &&
+		strings.Contains(cal, "SUMMARY:Позвонить маме и папе\r\n") && strings.Contains(cal, "DTSTART:20261018T093000Z\r\n") &&
+		strings.Contains(cal, "TRIGGER:-PT15M") && strings.Contains(cal, "UID:"+call.ID+"@bhl-diary"),
+		"ics: %d\n%s", resp.StatusCode, cal); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(cal, "\r\n") {
+		if len(line) > 75 {
+			return fmt.Errorf("ics line longer than 75 octets: %q", line)
+		}
+	}
+
+	// удаление дела и записи вместе с её делами
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/tasks/"+bread.ID, nil)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := expect(resp.StatusCode == http.StatusNoContent, "delete task: %d", resp.StatusCode); err != nil {
+		return err
+	}
+	if err := st.DeleteEntry(ctx, "", entry.ID); err != nil {
+		return err
+	}
+	left, err := list("")
+	if err != nil {
+		return err
+	}
+	if err := expect(len(left) == 1 && left[0].EntryID == other.ID, "after entry delete: %+v", left); err != nil {
+		return err
+	}
+
+	return expect(len(left) == 1 && left[0].EntryID == other.ID, "after entry delete: %+v", left)
+}
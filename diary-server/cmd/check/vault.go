@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bhl-diary/crypt"
+	"bhl-diary/search"
+	"bhl-diary/store"
+	"github.com/go-git/go-git/v5"
+)
+
+// checkVault Markdown-хранилище: дневник из SQLite переезжает в git с
+// историей ревизий; каждое сохранение — файл и коммит; ревизии и возврат
+// через API — из git; правки, новые, перенесённые и удалённые файлы
+// подхватываются на лету и при открытии, поиск видит ручные правки
+func checkVault(ctx context.Context, dir string) error {
+	// дневник на SQLite до переезда
+	plain, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	old := &store.Entry{User: "anna", Text: "Ходили за грибами.", Tags: []string{"лес"},
+		CreatedAt: time.Date(2026, 9, 14, 18, 30, 0, 0, time.Local),
+		Revisions: []store.Revision{
+			{Kind: store.RevisionASR, Text: "ходили за грибами", Author: "anna"},
+			{Kind: store.RevisionProcessed, Text: "Ходили за грибами.", Author: "anna"},
+		}}
+	if err := plain.CreateEntry(ctx, old); err != nil {
+		return err
+	}
+	plain.Close()
+
+	vaultDir := filepath.Join(dir, "vault")
+	st, err := store.Open(store.Config{Driver: "vault", Dir: dir})
+	if err != nil {
+		return err
+	}
+	oldFile := filepath.Join(vaultDir, "anna", "2026", "09", old.ID+".md")
+	data, err := os.ReadFile(oldFile)
+	if err != nil {
+		return fmt.Errorf("exported file: %w", err)
+	}
+	if err := expect(strings.Contains(string(data), "id: "+old.ID) && strings.Contains(string(data), "- лес") &&
+		strings.HasSuffix(string(data), "\n\nХодили за грибами.\n"), "exported file:\n%s", data); err != nil {
+		return err
+	}
+	if err := expectKinds(ctx, st, "anna", old.ID, "asr,processed"); err != nil {
+		return err
+	}
+
+	// ревизии, diff и возврат через API — на git
+	if err := revisionsScenario(ctx, st); err != nil {
+		return fmt.Errorf("revisions on vault: %w", err)
+	}
+	if err := noTempFiles(vaultDir); err != nil {
+		return err
+	}
+	if err := st.AddTag(ctx, "anna", old.ID, "Грибы"); err != nil {
+		return err
+	}
+	if data, _ := os.ReadFile(oldFile); !strings.Contains(string(data), "- грибы") {
+		return fmt.Errorf("tag is not in the file:\n%s", data)
+	}
+	if err := expectKinds(ctx, st, "anna", old.ID, "asr,processed"); err != nil {
+		return fmt.Errorf("tag made a revision: %w", err)
+	}
+
+	if err := vaultRollback(ctx, st, vaultDir, old.ID); err != nil {
+		return err
+	}
+
+	err = watchVault(ctx, dir, st, old.ID, oldFile)
+	st.Close()
+	if err != nil {
+		return err
+	}
+
+	// правка и удаление, пока сервер остановлен, — при следующем открытии
+	data, _ = os.ReadFile(oldFile)
+	os.WriteFile(oldFile, []byte(strings.Replace(string(data), "и черникой", "и брусникой", 1)), 0o600)
+	cache, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	list, err := cache.ListEntries(ctx, store.Filter{User: "anna"})
+	cache.Close()
+	if err != nil {
+		return err
+	}
+	var other string
+	for _, e := range list {
+		if e.ID != old.ID {
+			other = e.ID
+		}
+	}
+	otherFile, _ := filepath.Glob(filepath.Join(vaultDir, "anna", "*", "*", other+".md"))
+	if len(otherFile) != 1 {
+		return fmt.Errorf("file of %s: %v", other, otherFile)
+	}
+	os.Remove(otherFile[0])
+	if st, err = store.Open(store.Config{Driver: "vault", Dir: dir}); err != nil {
+		return err
+	}
+	defer st.Close()
+	e, err := st.GetEntry(ctx, "anna", old.ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(strings.Contains(e.Text, "брусникой"), "offline edit: %q", e.Text); err != nil {
+		return err
+	}
+	if _, err := st.GetEntry(ctx, "anna", other); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("offline removal: %v", err)
+	}
+	if err := expectKinds(ctx, st, "anna", old.ID, "asr,processed,edit,edit"); err != nil {
+		return err
+	}
+
+	// файлы открыты по замыслу: с ключами vault не открывается
+	keys, _, err := crypt.Create(filepath.Join(dir, "keys"), "correct horse battery", crypt.Argon2{Time: 1, MemoryMB: 8, Threads: 1})
+	if err != nil {
+		return err
+	}
+	if _, err := store.Open(store.Config{Driver: "vault", Dir: dir, Cipher: keys}); !errors.Is(err, store.ErrVaultEncrypted) {
+		return fmt.Errorf("encrypted vault: %v", err)
+	}
+	return nil
+}
+
+// vaultRollback сбой git не оставляет записи в кеше, сбой кеша — коммита
+// и файла: снаружи хранилище такое же, как до сохранения
+func vaultRollback(ctx context.Context, st store.Store, vaultDir, existing string) error {
+	repo, err := git.PlainOpen(vaultDir)
+	if err != nil {
+		return err
+	}
+	head := func() string {
+		ref, err := repo.Head()
+		if err != nil {
+			return err.Error()
+		}
+		return ref.Hash().String()
+	}
+	before := head()
+	list := func() int {
+		l, _ := st.ListEntries(ctx, store.Filter{User: "anna"})
+		return len(l)
+	}
+	count := list()
+
+	// git: каталог года занят файлом, записать запись некуда
+	blocker := filepath.Join(vaultDir, "anna", "2027")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		return err
+	}
+	e := &store.Entry{ID: "20270101T000000-rollback", User: "anna", Text: "Не сохранится.",
+		CreatedAt: time.Date(2027, 1, 1, 0, 0, 0, 0, time.Local)}
+	err = st.CreateEntry(ctx, e)
+	os.Remove(blocker)
+	if err == nil {
+		return fmt.Errorf("create with a broken vault succeeded")
+	}
+	if _, err := st.GetEntry(ctx, "anna", e.ID); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("entry is in the cache after git failed: %v", err)
+	}
+
+	// кеш: такой id уже есть, а файл — по другой дате
+	dup := &store.Entry{ID: existing, User: "anna", Text: "Дубликат.", CreatedAt: time.Date(2027, 2, 1, 0, 0, 0, 0, time.Local)}
+	if err := st.CreateEntry(ctx, dup); err == nil {
+		return fmt.Errorf("duplicate id accepted")
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "anna", "2027", "02", existing+".md")); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("file left after the cache failed: %v", err)
+	}
+	return expect(head() == before && list() == count, "rollback: head %s → %s, entries %d → %d", before, head(), count, list())
+}
+
+// watchVault правки в редакторе, новый, перенесённый и удалённый файл
+// при работающем Watch
+func watchVault(ctx context.Context, dir string, st store.Store, id, oldFile string) error {
+	vaultDir := filepath.Join(dir, "vault")
+	// слежение: правки с диска идут через обёртку с индексом
+	ix, err := search.Open(dir, st)
+	if err != nil {
+		return err
+	}
+	indexed := search.NewIndexedStore(st, ix)
+	vault := st.(*store.Vault)
+	watchCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- vault.Watch(watchCtx, indexed) }()
+	defer func() {
+		stop()
+		<-done
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// правка текста и тегов в редакторе
+	data, _ := os.ReadFile(oldFile)
+	edited := strings.Replace(string(data), "Ходили за грибами.", "Ходили за грибами и черникой.", 1)
+	edited = strings.Replace(edited, "- лес\n", "- ягоды\n", 1)
+	if err := os.WriteFile(oldFile, []byte(edited), 0o600); err != nil {
+		return err
+	}
+	if err := waitFor(func() bool {
+		e, err := st.GetEntry(ctx, "anna", id)
+		return err == nil && strings.Contains(e.Text, "черникой") && strings.Join(e.Tags, ",") == "грибы,ягоды"
+	}); err != nil {
+		return fmt.Errorf("edit on disk: %w", err)
+	}
+	if err := expectSearch(ctx, ix, "черникой", id); err != nil {
+		return err
+	}
+	revs, err := st.ListRevisions(ctx, "anna", id)
+	if err != nil {
+		return err
+	}
+	last := revs[len(revs)-1]
+	if err := expect(len(revs) == 3 && last.Kind == store.RevisionEdit && last.Author == "anna" &&
+		last.Text == "Ходили за грибами и черникой.", "revisions after disk edit: %+v", revs); err != nil {
+		return err
+	}
+	if data, _ := os.ReadFile(oldFile); string(data) != edited {
+		return fmt.Errorf("edited file was rewritten:\n%s", data)
+	}
+
+	// новый файл без шапки становится записью и получает id
+	note := filepath.Join(vaultDir, "anna", "2026", "10", "поход.md")
+	os.MkdirAll(filepath.Dir(note), 0o700)
+	if err := os.WriteFile(note, []byte("Собрали рюкзаки в поход.\n"), 0o600); err != nil {
+		return err
+	}
+	var noteID string
+	if err := waitFor(func() bool {
+		hits, _ := ix.Search(ctx, search.Query{User: "anna", Text: "рюкзаки", Limit: 5})
+		if len(hits) == 1 {
+			noteID = hits[0].EntryID
+		}
+		data, _ := os.ReadFile(note)
+		return noteID != "" && strings.Contains(string(data), "id: "+noteID)
+	}); err != nil {
+		return fmt.Errorf("new file: %w", err)
+	}
+	// заметка вне каталогов года — не запись
+	os.WriteFile(filepath.Join(vaultDir, "README.md"), []byte("Мой дневник\n"), 0o600)
+
+	// перенос файла — та же запись
+	moved := filepath.Join(vaultDir, "anna", "2026", "10", "поход в горы.md")
+	if err := os.Rename(note, moved); err != nil {
+		return err
+	}
+	time.Sleep(1500 * time.Millisecond)
+	list, err := st.ListEntries(ctx, store.Filter{User: "anna"})
+	if err != nil {
+		return err
+	}
+	if err := expect(len(list) == 3, "entries after move: %d, want 3", len(list)); err != nil {
+		return err
+	}
+	if _, err := st.GetEntry(ctx, "anna", noteID); err != nil {
+		return fmt.Errorf("moved entry: %w", err)
+	}
+
+	// удалённый файл удаляет запись
+	if err := os.Remove(moved); err != nil {
+		return err
+	}
+	if err := waitFor(func() bool {
+		_, err := st.GetEntry(ctx, "anna", noteID)
+		hits, _ := ix.Search(ctx, search.Query{User: "anna", Text: "рюкзаки", Limit: 5})
+		return errors.Is(err, store.ErrNotFound) && len(hits) == 0
+	}); err != nil {
+		return fmt.Errorf("removed file: %w", err)
+	}
+	return nil
+}
+
+func expectKinds(ctx context.Context, st store.Store, user, id, want string) error {
+	revs, err := st.ListRevisions(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	var kinds []string
+	for _, r := range revs {
+		kinds = append(kinds, r.Kind)
+	}
+	return expect(strings.Join(kinds, ",") == want, "revision kinds of %s: %v, want %s", id, kinds, want)
+}
+
+func expectSearch(ctx context.Context, ix *search.Index, text, id string) error {
+	hits, err := ix.Search(ctx, search.Query{User: "anna", Text: text, Limit: 5})
+	if err != nil {
+		return err
+	}
+	return expect(len(hits) == 1 && hits[0].EntryID == id, "search %q: %+v", text, hits)
+}
+
+// noTempFiles после записи файлов не остаётся временных
+func noTempFiles(vaultDir string) error {
+	return filepath.WalkDir(vaultDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(path, ".tmp") {
+			return fmt.Errorf("temporary file left: %s", path)
+		}
+		return nil
+	})
+}
+
+// waitFor ждёт условия до 5 секунд: Watch применяет правки с задержкой
+func waitFor(cond func() bool) error {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return errors.New("timed out")
+}
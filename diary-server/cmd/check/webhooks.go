@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"bhl-diary/events"
+	"bhl-diary/store"
+)
+
+// checkWebhooks шина и вебхуки: записи публикуют события, вебхук получает
+// их по порядку с верной подписью и после отказов сервера; фильтры по
+// типу и пользователю; отказ 4xx и исчерпанные повторы — в журнале
+// недоставленных; остановка не теряет событий
+func checkWebhooks(ctx context.Context, dir string) error {
+	st, err := store.Open(store.Config{Dir: dir})
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	bus := events.NewBus()
+	es := events.NewStore(st, bus)
+
+	// подписка по типам и отписка
+	var got []string
+	cancel := bus.Subscribe(func(e events.Event) { got = append(got, e.Type) }, events.SessionStarted)
+	bus.Publish(events.SessionStarted, "anna", events.SessionData{ID: "s1"})
+	bus.Publish(events.SessionEnded, "anna", events.SessionData{ID: "s1"})
+	cancel()
+	bus.Publish(events.SessionStarted, "anna", events.SessionData{ID: "s2"})
+	if err := expect(strings.Join(got, ",") == events.SessionStarted, "subscription got %v", got); err != nil {
+		return err
+	}
+	if _, err := events.NewWebhooks(events.Config{DeadLetter: "x", Hooks: []events.Hook{{URL: "http://h", Events: []string{"entry.saved"}}}}); err == nil {
+		return fmt.Errorf("unknown event type accepted")
+	}
+
+	// получатель с подписью: каждую доставку принимает с третьей попытки
+	const secret = "s3cret"
+	var mu sync.Mutex
+	var dash []events.Event
+	attempts := map[string]int{}
+	var badSig []string
+	dashSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		id := r.Header.Get("X-BHL-Delivery")
+		mu.Lock()
+		defer mu.Unlock()
+		if !events.Verify(secret, r.Header.Get("X-BHL-Timestamp"), r.Header.Get("X-BHL-Signature"), body) ||
+			events.Verify("other", r.Header.Get("X-BHL-Timestamp"), r.Header.Get("X-BHL-Signature"), body) {
+			badSig = append(badSig, id)
+		}
+		if attempts[id]++; attempts[id] < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		var e events.Event
+		if err := json.Unmarshal(body, &e); err != nil || e.ID != id || e.Type != r.Header.Get("X-BHL-Event") {
+			badSig = append(badSig, id+" body")
+		}
+		dash = append(dash, e)
+	}))
+	defer dashSrv.Close()
+	var tasks []string
+	tasksSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tasks = append(tasks, r.Header.Get("X-BHL-Event"))
+		mu.Unlock()
+	}))
+	defer tasksSrv.Close()
+	strictSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unknown event", http.StatusBadRequest)
+	}))
+	defer strictSrv.Close()
+	downSrv := httptest.NewServer(http.NotFoundHandler())
+	downURL := downSrv.URL
+	downSrv.Close()
+
+	deadLog := filepath.Join(dir, "webhooks-dead.jsonl")
+	hooks, err := events.NewWebhooks(events.Config{
+		Retries: 3, BackoffMs: 10, TimeoutSec: 2, DeadLetter: deadLog,
+		Hooks: []events.Hook{
+			{URL: dashSrv.URL, Secret: secret},
+			{URL: tasksSrv.URL, Events: []string{events.EntryCreated}, User: "boris"},
+			{URL: strictSrv.URL, Events: []string{events.SessionStarted}},
+			{URL: downURL, Events: []string{events.EntryUpdated}, User: "anna"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	bus.Subscribe(hooks.Handle)
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		hooks.Run(runCtx)
+		close(done)
+	}()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	// события идут от обёртки хранилища; ошибка хранилища — без события
+	e := &store.Entry{User: "anna", Text: "Купить хлеба."}
+	if err := es.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+	e.Text = "Купить хлеба и молока."
+	if err := es.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+	if err := es.AddTag(ctx, "anna", e.ID, "Дела"); err != nil {
+		return err
+	}
+	if err := es.UpdateEntry(ctx, &store.Entry{ID: "missing", User: "anna", Text: "нет"}); err == nil {
+		return fmt.Errorf("update of a missing entry succeeded")
+	}
+	if err := es.CreateEntry(ctx, &store.Entry{User: "boris", Text: "Позвонить маме."}); err != nil {
+		return err
+	}
+	bus.Publish(events.SessionStarted, "anna", events.SessionData{ID: "s3", Started: time.Now()})
+
+	want := []string{"entry.created anna", "entry.updated anna", "entry.updated anna", "entry.created boris", "session.started anna"}
+	var dead []events.DeadLetter
+	if err := waitFor(func() bool {
+		dead, _ = events.ReadDeadLetters(deadLog)
+		mu.Lock()
+		defer mu.Unlock()
+		return len(dash) == len(want) && len(tasks) == 1 && len(dead) == 3
+	}); err != nil {
+		mu.Lock()
+		defer mu.Unlock()
+		return fmt.Errorf("deliveries: dash %d, tasks %v, dead %+v", len(dash), tasks, dead)
+	}
+	mu.Lock()
+	var order []string
+	for _, ev := range dash {
+		order = append(order, ev.Type+" "+ev.User)
+	}
+	retried := true
+	for _, n := range attempts {
+		retried = retried && n == 3
+	}
+	last, _ := dash[2].Data.(map[string]any)
+	mu.Unlock()
+	if err := expect(strings.Join(order, ",") == strings.Join(want, ",") && retried && len(badSig) == 0,
+		"dash got %v, attempts %v, bad %v", order, attempts, badSig); err != nil {
+		return err
+	}
+	if err := expect(last["text"] == "Купить хлеба и молока." && fmt.Sprint(last["tags"]) == "[дела]",
+		"entry.updated after tag: %v", last); err != nil {
+		return err
+	}
+	if err := expect(tasks[0] == events.EntryCreated, "tasks got %v", tasks); err != nil {
+		return err
+	}
+
+	// журнал: отказ 4xx — без повторов, недоступный адрес — после всех
+	byURL := map[string][]events.DeadLetter{}
+	for _, d := range dead {
+		byURL[d.URL] = append(byURL[d.URL], d)
+	}
+	strict, down := byURL[strictSrv.URL], byURL[downURL]
+	if err := expect(len(strict) == 1 && strict[0].Attempts == 1 && strict[0].Status == http.StatusBadRequest &&
+		strict[0].Event.Type == events.SessionStarted, "dead letters of 4xx: %+v", strict); err != nil {
+		return err
+	}
+	if err := expect(len(down) == 2 && down[0].Attempts == 4 && down[0].Status == 0 && down[0].Event.User == "anna",
+		"dead letters of unreachable: %+v", down); err != nil {
+		return err
+	}
+
+	return checkWebhooksStop(ctx, dir)
+}
+
+// checkWebhooksStop остановка во время паузы между повторами: ожидающее
+// повтора, очередь и события после остановки — в журнале
+func checkWebhooksStop(ctx context.Context, dir string) error {
+	first := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case first <- struct{}{}:
+		default:
+		}
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	deadLog := filepath.Join(dir, "stop-dead.jsonl")
+	hooks, err := events.NewWebhooks(events.Config{BackoffMs: 60000, DeadLetter: deadLog,
+		Hooks: []events.Hook{{URL: srv.URL}}})
+	if err != nil {
+		return err
+	}
+	bus := events.NewBus()
+	bus.Subscribe(hooks.Handle)
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		hooks.Run(runCtx)
+		close(done)
+	}()
+	bus.Publish(events.SessionStarted, "anna", events.SessionData{ID: "a"})
+	select {
+	case <-first:
+	case <-time.After(5 * time.Second):
+		stop()
+		return fmt.Errorf("no first attempt")
+	}
+	bus.Publish(events.SessionEnded, "anna", events.SessionData{ID: "a"})
+	stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("webhooks did not stop")
+	}
+	bus.Publish(events.CommandResolved, "anna", events.CommandData{Session: "a"})
+
+	dead, err := events.ReadDeadLetters(deadLog)
+	if err != nil {
+		return err
+	}
+	var kinds []string
+	for _, d := range dead {
+		kinds = append(kinds, fmt.Sprintf("%s/%d", d.Event.Type, d.Attempts))
+	}
+	return expect(strings.Join(kinds, ",") == "session.started/1,session.ended/0,command.resolved/0",
+		"dead letters on stop: %v", kinds)
+}
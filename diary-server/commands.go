@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"bhl-diary/analytics"
+	"bhl-diary/export"
+	"bhl-diary/importer"
+	"bhl-diary/search"
+	"bhl-diary/store"
+)
+
+// subcommands подкоманды: bhl-diary <команда> [флаги]
+var subcommands = map[string]func(args []string){
+	"backup":  runBackup,
+	"export":  runExport,
+	"import":  runImport,
+	"keys":    runKeys,
+	"restore": runRestore,
+	"stats":   runStats,
+	"users":   runUsers,
+	"verify":  runVerify,
+}
+
+// runExport bhl-diary export -user anna -from 2025-01-01 -to 2025-12-31 -format latex -o book.tex
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	user := fs.String("user", "", "пользователь")
+	from := fs.String("from", "", "с даты YYYY-MM-DD включительно")
+	to := fs.String("to", "", "по дату YYYY-MM-DD включительно")
+	format := fs.String("format", export.Markdown, "markdown, jsonl, text или latex")
+	title := fs.String("title", "", "заголовок документа")
+	templates := fs.String("templates", "", "каталог шаблонов (по умолчанию из конфига)")
+	out := fs.String("o", "", "файл результата (по умолчанию stdout)")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	if *templates == "" {
+		*templates = cfg.Export.TemplatesDir
+	}
+
+	filter := store.Filter{User: *user, From: parseDay(*from, false), To: parseDay(*to, true)}
+
+	st, _ := openStore(cfg)
+	defer st.Close()
+
+	entries, err := st.ListEntries(context.Background(), filter)
+	if err != nil {
+		log.Fatalf("❌ Ошибка чтения записей: %v", err)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	opts := export.Options{Title: *title, From: filter.From, To: filter.To, TemplatesDir: *templates}
+	if err := export.Render(w, *format, entries, opts); err != nil {
+		log.Fatalf("❌ Ошибка выгрузки: %v", err)
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "✅ %d записей → %s\n", len(entries), *out)
+	}
+}
+
+// runImport bhl-diary import -user anna -dir ~/notes [-dry-run]
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	user := fs.String("user", "", "пользователь, которому достанутся записи")
+	dir := fs.String("dir", "", "каталог с Markdown, Day One JSON или текстовыми файлами")
+	dryRun := fs.Bool("dry-run", false, "только отчёт, без записи")
+	fs.Parse(args)
+
+	if *dir == "" {
+		log.Fatal("❌ Не указан -dir")
+	}
+	cfg := loadConfig(*configPath)
+
+	base, keys := openStore(cfg)
+	defer base.Close()
+
+	// пишем через индекс, чтобы импортированное сразу находилось поиском
+	index, err := search.Open(cfg.Storage.Dir, base)
+	if err != nil {
+		log.Fatalf("❌ Ошибка открытия поискового индекса: %v", err)
+	}
+	index.SetKeyring(keys)
+	st := search.NewIndexedStore(base, index)
+
+	rep, err := importer.Import(context.Background(), st, *dir, importer.Options{User: *user, DryRun: *dryRun})
+	if err != nil {
+		log.Fatalf("❌ Ошибка импорта: %v", err)
+	}
+	// индекс пишется один раз на весь импорт
+	if err := index.Flush(); err != nil {
+		log.Printf("⚠️ Не удалось сохранить поисковый индекс: %v", err)
+	}
+
+	for _, l := range rep.Lines {
+		date := ""
+		if !l.Date.IsZero() {
+			date = l.Date.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-10s %-16s %s", l.Status, date, l.Source)
+		if l.Title != "" {
+			fmt.Printf(" «%s»", l.Title)
+		}
+		if l.Reason != "" {
+			fmt.Printf(" (%s)", l.Reason)
+		}
+		fmt.Println()
+	}
+
+	done := importer.StatusImported
+	if rep.DryRun {
+		done = importer.StatusNew
+	}
+	fmt.Fprintf(os.Stderr, "✅ %s: %d, дубликатов: %d, пропущено: %d\n",
+		done, rep.Counts[done], rep.Counts[importer.StatusDuplicate], rep.Counts[importer.StatusSkipped])
+}
+
+// runStats bhl-diary stats -user anna -from 2026-01-01 -to 2026-03-31 -group week [-json]
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	user := fs.String("user", "", "пользователь")
+	from := fs.String("from", "", "с даты YYYY-MM-DD включительно (по умолчанию с первой записи)")
+	to := fs.String("to", "", "по дату YYYY-MM-DD включительно (по умолчанию по сегодня)")
+	group := fs.String("group", analytics.GroupDay, "day, week или month")
+	top := fs.Int("top", 20, "сколько частых слов показать")
+	asJSON := fs.Bool("json", false, "отчёт в JSON, как /api/v1/stats")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	st, keys := openStore(cfg)
+	defer st.Close()
+
+	stats, err := analytics.Open(cfg.Storage.Dir, st)
+	if err != nil {
+		log.Fatalf("❌ Ошибка открытия статистики: %v", err)
+	}
+	stats.SetKeyring(keys)
+	report, err := stats.Report(context.Background(), analytics.Query{
+		User:  *user,
+		From:  parseDay(*from, false),
+		To:    parseDay(*to, true),
+		Group: *group,
+		Top:   *top,
+	})
+	if err != nil {
+		log.Fatalf("❌ Ошибка статистики: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = analytics.WriteText(os.Stdout, report)
+	}
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+// parseDay дата YYYY-MM-DD; для верхней границы — конец дня
+func parseDay(v string, upper bool) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	if err != nil {
+		log.Fatalf("❌ Неверная дата %q: %v", v, err)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
@@ -0,0 +1,239 @@
+package corrections
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+)
+
+// Config секция corrections в config.yaml
+type Config struct {
+	MinCount int  `yaml:"min_count"` // сколько одинаковых правок нужно для подсказки, по умолчанию 2
+	Hotwords bool `yaml:"hotwords"`  // передавать принятые замены распознавателю как горячие слова
+}
+
+type compiled struct {
+	id int64
+	re *regexp.Regexp
+	to string
+}
+
+// Engine применяет принятые правила пользователя к диктовке. Правила
+// кэшируются до Invalidate, срабатывания копятся в памяти до Flush.
+type Engine struct {
+	st  store.Store
+	dir string
+
+	ruleHotwords bool
+	ownHotwords  func(user string) []string
+
+	mu    sync.Mutex
+	rules map[string][]compiled
+	hits  map[string]map[int64]int
+}
+
+// New dir — каталог данных, файлы горячих слов лежат в dir/hotwords
+func New(st store.Store, dir string) *Engine {
+	return &Engine{
+		st:           st,
+		dir:          dir,
+		ruleHotwords: true,
+		rules:        map[string][]compiled{},
+		hits:         map[string]map[int64]int{},
+	}
+}
+
+// Correct реализует wshandler.Corrector; срабатывания копятся только
+// для окончательных фраз
+func (e *Engine) Correct(user, text string, final bool) string {
+	rules, err := e.userRules(user)
+	if err != nil {
+		log.Printf("⚠️ Правила замен %s: %v", user, err)
+		return text
+	}
+
+	for _, r := range rules {
+		var n int
+		text, n = wshandler.ReplaceWords(r.re, text, func(m string) string { return matchCase(m, r.to) })
+		if n > 0 && final {
+			e.mu.Lock()
+			if e.hits[user] == nil {
+				e.hits[user] = map[int64]int{}
+			}
+			e.hits[user][r.id] += n
+			e.mu.Unlock()
+		}
+	}
+	return text
+}
+
+// userRules принятые правила из кэша или хранилища, длинные фразы первыми
+func (e *Engine) userRules(user string) ([]compiled, error) {
+	e.mu.Lock()
+	rules, ok := e.rules[user]
+	e.mu.Unlock()
+	if ok {
+		return rules, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	all, err := e.st.ListRules(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool { return len(all[i].From) > len(all[j].From) })
+
+	rules = []compiled{}
+	for _, r := range all {
+		if r.Status != store.RuleAccepted {
+			continue
+		}
+		words := strings.Fields(r.From)
+		for i, w := range words {
+			words[i] = regexp.QuoteMeta(w)
+		}
+		// между словами фразы пунктуатор мог поставить запятую
+		re, err := regexp.Compile(`(?i)` + strings.Join(words, `[\s,]+`))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, compiled{id: r.ID, re: re, to: r.To})
+	}
+
+	e.mu.Lock()
+	e.rules[user] = rules
+	e.mu.Unlock()
+	return rules, nil
+}
+
+// matchCase сохраняет заглавную букву в начале предложения
+func matchCase(orig, to string) string {
+	o, _ := utf8.DecodeRuneInString(orig)
+	t, size := utf8.DecodeRuneInString(to)
+	if unicode.IsUpper(o) && unicode.IsLower(t) {
+		return string(unicode.ToUpper(t)) + to[size:]
+	}
+	return to
+}
+
+// Invalidate сбрасывает кэш после изменения правил пользователя
+func (e *Engine) Invalidate(user string) {
+	e.mu.Lock()
+	delete(e.rules, user)
+	e.mu.Unlock()
+}
+
+// Flush записывает накопленные срабатывания в хранилище
+func (e *Engine) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	pending := e.hits
+	e.hits = map[string]map[int64]int{}
+	e.mu.Unlock()
+
+	for user, hits := range pending {
+		if err := e.st.AddRuleHits(ctx, user, hits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run сбрасывает срабатывания раз в interval до отмены ctx
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Flush(ctx); err != nil {
+				log.Printf("⚠️ Не удалось сохранить срабатывания замен: %v", err)
+			}
+		}
+	}
+}
+
+// Hotwords фразы для распознавателя: правильные написания из принятых
+// правил и свои слова пользователя
+func Hotwords(rules []store.Rule, own ...string) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(w string) {
+		w = strings.ToLower(strings.TrimSpace(w)) // токены русских моделей в нижнем регистре
+		if w == "" || seen[w] {
+			return
+		}
+		seen[w] = true
+		out = append(out, w)
+	}
+	for _, r := range rules {
+		if r.Status == store.RuleAccepted {
+			add(r.To)
+		}
+	}
+	for _, w := range own {
+		add(w)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SetHotwords что попадает в файл горячих слов: написания из принятых
+// правил (rules) и свои слова пользователя из настроек (own, может быть nil)
+func (e *Engine) SetHotwords(rules bool, own func(user string) []string) {
+	e.ruleHotwords = rules
+	e.ownHotwords = own
+}
+
+// HotwordsFile пишет файл горячих слов пользователя и возвращает путь;
+// без слов — пустая строка. Подходит для wshandler.SetHotwords.
+func (e *Engine) HotwordsFile(user string) string {
+	var rules []store.Rule
+	if e.ruleHotwords {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var err error
+		if rules, err = e.st.ListRules(ctx, user); err != nil {
+			log.Printf("⚠️ Горячие слова %s: %v", user, err)
+			return ""
+		}
+	}
+	var own []string
+	if e.ownHotwords != nil {
+		own = e.ownHotwords(user)
+	}
+	words := Hotwords(rules, own...)
+	if len(words) == 0 {
+		return ""
+	}
+
+	path := filepath.Join(e.dir, "hotwords", url.PathEscape(user)+".txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		log.Printf("⚠️ Горячие слова %s: %v", user, err)
+		return ""
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(words, "\n")+"\n"), 0o600); err != nil {
+		log.Printf("⚠️ Горячие слова %s: %v", user, err)
+		return ""
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("⚠️ Горячие слова %s: %v", user, err)
+		return ""
+	}
+	return path
+}
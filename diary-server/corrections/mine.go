@@ -0,0 +1,162 @@
+// Package corrections словарь замен, выученный из правок пользователя:
+// подсказки по истории ревизий, применение принятых правил к диктовке
+// и горячие слова для распознавателя.
+package corrections
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"bhl-diary/diff"
+	"bhl-diary/store"
+)
+
+const (
+	maxPhraseWords = 3 // длиннее — это уже переписанный текст, а не ошибка распознавания
+	maxExamples    = 5
+)
+
+// Suggestion кандидат в правило: одна и та же правка в нескольких записях
+type Suggestion struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Count   int      `json:"count"`   // сколько раз так правили
+	Entries []string `json:"entries"` // примеры записей
+}
+
+// Suggest ищет повторяющиеся замены между текстом после конвейера
+// (или сырым ASR) и последней версией каждой исправленной записи.
+// Замены, для которых уже есть правило (в том числе отклонённое), не
+// предлагаются.
+func Suggest(ctx context.Context, st store.Store, user string, minCount int) ([]Suggestion, error) {
+	if minCount <= 0 {
+		minCount = 2
+	}
+
+	rules, err := st.ListRules(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, r := range rules {
+		known[strings.ToLower(r.From)] = true // кандидаты сравниваются в нижнем регистре
+	}
+
+	entries, err := st.ListEntries(ctx, store.Filter{User: user})
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ from, to string }
+	found := map[key]*Suggestion{}
+	for _, e := range entries {
+		revs, err := st.ListRevisions(ctx, user, e.ID)
+		if err != nil {
+			return nil, err
+		}
+		base, edited, ok := editedPair(revs)
+		if !ok {
+			continue
+		}
+
+		seen := map[key]bool{}
+		for _, p := range substitutions(diff.Words(base, edited)) {
+			k := key{strings.ToLower(p.from), p.to}
+			if known[k.from] || seen[k] {
+				continue
+			}
+			seen[k] = true // в одной записи правка считается один раз
+			s := found[k]
+			if s == nil {
+				s = &Suggestion{From: k.from, To: k.to}
+				found[k] = s
+			}
+			s.Count++
+			if len(s.Entries) < maxExamples {
+				s.Entries = append(s.Entries, e.ID)
+			}
+		}
+	}
+
+	out := []Suggestion{}
+	for _, s := range found {
+		if s.Count >= minCount {
+			out = append(out, *s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].From < out[j].From
+	})
+	return out, nil
+}
+
+// editedPair исходный машинный текст и итоговый, если запись правили руками
+func editedPair(revs []store.Revision) (base, edited string, ok bool) {
+	for _, r := range revs {
+		switch r.Kind {
+		case store.RevisionASR:
+			if base == "" {
+				base = r.Text
+			}
+		case store.RevisionProcessed:
+			base = r.Text
+		case store.RevisionEdit:
+			ok = true
+		}
+	}
+	if !ok || base == "" {
+		return "", "", false
+	}
+	return base, revs[len(revs)-1].Text, true
+}
+
+type substitution struct{ from, to string }
+
+// substitutions пары "удалено → вставлено" из соседних операций diff.
+// Правки только пунктуации и регистра пропускаются: это работа
+// пунктуатора, а не ошибка распознавания.
+func substitutions(ops []diff.Op) []substitution {
+	var out []substitution
+	for i := 0; i+1 < len(ops); i++ {
+		a, b := ops[i], ops[i+1]
+		var from, to string
+		switch {
+		case a.Op == diff.Delete && b.Op == diff.Insert:
+			from, to = a.Text, b.Text
+		case a.Op == diff.Insert && b.Op == diff.Delete:
+			from, to = b.Text, a.Text
+		default:
+			continue
+		}
+		i++
+
+		from, to = trimPunct(from), trimPunct(to)
+		if from == "" || to == "" || strings.EqualFold(letters(from), letters(to)) {
+			continue
+		}
+		if len(strings.Fields(from)) > maxPhraseWords || len(strings.Fields(to)) > maxPhraseWords {
+			continue
+		}
+		out = append(out, substitution{from, to})
+	}
+	return out
+}
+
+func trimPunct(s string) string {
+	return strings.TrimFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// letters только буквы и цифры: "бабушке," и "Бабушке" совпадают
+func letters(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
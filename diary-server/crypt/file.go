@@ -0,0 +1,283 @@
+package crypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Зашифрованный файл: заголовок (magic, id ключа, префикс nonce) и куски
+// по chunkSize байт открытых данных, каждый со своим тегом GCM. Последний
+// кусок короче chunkSize (бывает и пустым) — так видно обрезанный файл.
+// Куски расшифровываются независимо, поэтому аудио отдаётся с Range
+// без расшифровки всего файла.
+const (
+	magic      = "BHLENC1\n"
+	headerSize = len(magic) + 4 + 8
+	chunkSize  = 64 << 10
+	tagSize    = 16
+)
+
+// IsSealed зашифрован ли файл
+func IsSealed(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	var h [len(magic)]byte
+	if _, err := io.ReadFull(f, h[:]); err != nil {
+		return false, nil
+	}
+	return string(h[:]) == magic, nil
+}
+
+// chunkAAD кусок привязан к пользователю, заголовку, номеру и признаку конца
+func chunkAAD(user string, header []byte, i uint32, last bool) []byte {
+	a := append(aad(user), header...)
+	a = binary.BigEndian.AppendUint32(a, i)
+	if last {
+		return append(a, 1)
+	}
+	return append(a, 0)
+}
+
+func chunkNonce(header []byte, i uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[len(magic)+4:headerSize])
+	binary.BigEndian.PutUint32(nonce[8:], i)
+	return nonce
+}
+
+// sealWriter шифрует поток кусками
+type sealWriter struct {
+	w      io.Writer
+	dk     *dataKey
+	user   string
+	header []byte
+	buf    []byte
+	n      uint32
+}
+
+func newSealWriter(w io.Writer, k *Keyring, user string) (*sealWriter, error) {
+	dk, err := k.key(user)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(magic), dk.id[:]...)
+	header = append(header, random(8)...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &sealWriter{w: w, dk: dk, user: user, header: header, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		m := copy(s.buf[len(s.buf):chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		written += m
+		if len(s.buf) == chunkSize {
+			if err := s.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (s *sealWriter) flush(last bool) error {
+	ct := s.dk.aead.Seal(nil, chunkNonce(s.header, s.n), s.buf, chunkAAD(s.user, s.header, s.n, last))
+	s.n++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(ct)
+	return err
+}
+
+// Close дописывает последний кусок
+func (s *sealWriter) Close() error {
+	return s.flush(true)
+}
+
+// File файл для чтения с произвольного места; зашифрованный расшифровывается
+// по кускам, обычный читается как есть
+type File struct {
+	f    *os.File
+	size int64
+
+	// только у зашифрованного
+	dk     *dataKey
+	user   string
+	header []byte
+	chunks int64
+	cached int64 // номер куска в plain, -1 — нет
+	plain  []byte
+}
+
+// OpenFile открывает файл пользователя. k может быть nil — тогда читаются
+// только незашифрованные файлы.
+func OpenFile(k *Keyring, user, path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	file := &File{f: f, size: st.Size(), cached: -1}
+
+	header := make([]byte, headerSize)
+	if n, _ := f.ReadAt(header, 0); n < len(magic) || string(header[:len(magic)]) != magic {
+		return file, nil
+	}
+	fail := func(err error) (*File, error) {
+		f.Close()
+		return nil, err
+	}
+	if k == nil {
+		return fail(ErrLocked)
+	}
+	body := st.Size() - int64(headerSize)
+	if body < tagSize {
+		return fail(errors.New("sealed file is truncated"))
+	}
+	if file.dk, err = k.lookup(user, header[len(magic):len(magic)+4]); err != nil {
+		return fail(err)
+	}
+	file.user, file.header = user, header
+	file.chunks = (body-tagSize)/(chunkSize+tagSize) + 1
+	file.size = body - file.chunks*tagSize
+	if last := body - (file.chunks-1)*(chunkSize+tagSize) - tagSize; last < 0 || last >= chunkSize {
+		return fail(errors.New("sealed file is truncated"))
+	}
+	return file, nil
+}
+
+// Size размер открытых данных
+func (f *File) Size() int64 {
+	return f.size
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.dk == nil {
+		return f.f.ReadAt(p, off)
+	}
+	n := 0
+	for n < len(p) {
+		if off >= f.size {
+			return n, io.EOF
+		}
+		i := off / chunkSize
+		if err := f.load(i); err != nil {
+			return n, err
+		}
+		m := copy(p[n:], f.plain[off-i*chunkSize:])
+		n += m
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// load расшифровывает кусок i в кэш
+func (f *File) load(i int64) error {
+	if f.cached == i {
+		return nil
+	}
+	last := i == f.chunks-1
+	size := chunkSize + tagSize
+	if last {
+		size = int(f.size-i*chunkSize) + tagSize
+	}
+	ct := make([]byte, size)
+	if _, err := f.f.ReadAt(ct, int64(headerSize)+i*(chunkSize+tagSize)); err != nil {
+		return err
+	}
+	plain, err := f.dk.aead.Open(f.plain[:0], chunkNonce(f.header, uint32(i)), ct, chunkAAD(f.user, f.header, uint32(i), last))
+	if err != nil {
+		f.cached = -1
+		return fmt.Errorf("decrypt chunk %d: %w", i, err)
+	}
+	f.plain, f.cached = plain, i
+	return nil
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+// ReadFile читает файл целиком, расшифровывая при необходимости
+func ReadFile(k *Keyring, user, path string) ([]byte, error) {
+	f, err := OpenFile(k, user, path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, f.Size())
+	if _, err := f.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// WriteFile пишет файл атомарно: во временный файл и rename. С ключами
+// файл шифруется ключом пользователя, k == nil — пишется как есть.
+func WriteFile(k *Keyring, user, path string, data []byte) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		if k == nil {
+			_, err := w.Write(data)
+			return err
+		}
+		sw, err := newSealWriter(w, k, user)
+		if err != nil {
+			return err
+		}
+		if _, err := sw.Write(data); err != nil {
+			return err
+		}
+		return sw.Close()
+	})
+}
+
+// SealFile шифрует файл на месте действующим ключом пользователя; уже
+// зашифрованный файл перешифровывается (после Rotate)
+func SealFile(k *Keyring, user, path string) error {
+	src, err := OpenFile(k, user, path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return writeAtomic(path, func(w io.Writer) error {
+		sw, err := newSealWriter(w, k, user)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(sw, io.NewSectionReader(src, 0, src.Size())); err != nil {
+			return err
+		}
+		return sw.Close()
+	})
+}
+
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
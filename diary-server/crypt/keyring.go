@@ -0,0 +1,517 @@
+// Package crypt шифрование дневника на диске. У каждого пользователя свой
+// ключ данных (AES-256-GCM); ключи данных зашифрованы мастер-ключом, а
+// мастер-ключ — ключом из парольной фразы (Argon2id) и, отдельно, кодом
+// восстановления. Всё это лежит в <storage.dir>/keys.json.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrWrongCode       = errors.New("wrong recovery code")
+	ErrNoKeyring       = errors.New("keyring not found")
+	ErrKeyringExists   = errors.New("keyring already exists")
+	ErrLocked          = errors.New("data is encrypted, keyring is not unlocked")
+	ErrUnknownKey      = errors.New("data is encrypted with an unknown key")
+)
+
+// KeyringFile имя файла ключей в каталоге данных
+const KeyringFile = "keys.json"
+
+// Config секция encryption конфига
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// PassphraseFile файл с парольной фразой; пусто — переменная
+	// BHL_DIARY_PASSPHRASE или вопрос в терминале
+	PassphraseFile string `yaml:"passphrase_file"`
+	Argon2         Argon2 `yaml:"argon2"`
+}
+
+// Argon2 стоимость вывода ключа из парольной фразы
+type Argon2 struct {
+	Time     uint32 `yaml:"time"`      // проходов, по умолчанию 3
+	MemoryMB uint32 `yaml:"memory_mb"` // по умолчанию 64
+	Threads  uint8  `yaml:"threads"`   // по умолчанию 4
+}
+
+func (a Argon2) withDefaults() Argon2 {
+	if a.Time == 0 {
+		a.Time = 3
+	}
+	if a.MemoryMB == 0 {
+		a.MemoryMB = 64
+	}
+	if a.Threads == 0 {
+		a.Threads = 4
+	}
+	return a
+}
+
+// kdf параметры Argon2id, с которыми зашифрован мастер-ключ
+type kdf struct {
+	Salt     []byte `json:"salt"`
+	Time     uint32 `json:"time"`
+	MemoryKB uint32 `json:"memory_kb"`
+	Threads  uint8  `json:"threads"`
+}
+
+func newKDF(a Argon2) kdf {
+	a = a.withDefaults()
+	return kdf{Salt: random(16), Time: a.Time, MemoryKB: a.MemoryMB * 1024, Threads: a.Threads}
+}
+
+func (k kdf) key(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), k.Salt, k.Time, k.MemoryKB, k.Threads, 32)
+}
+
+// userKey ключ данных пользователя, зашифрованный мастер-ключом
+type userKey struct {
+	ID      string    `json:"id"`
+	User    string    `json:"user"`
+	Key     []byte    `json:"key"`
+	Created time.Time `json:"created"`
+	// Retired ключ после смены ключей: им только расшифровывают
+	Retired bool `json:"retired,omitempty"`
+}
+
+// keyFile содержимое keys.json
+type keyFile struct {
+	Version  int       `json:"version"`
+	KDF      kdf       `json:"kdf"`
+	Master   []byte    `json:"master"`   // мастер-ключ под ключом из парольной фразы
+	Recovery []byte    `json:"recovery"` // он же под кодом восстановления
+	Keys     []userKey `json:"keys"`
+}
+
+// dataKey расшифрованный ключ данных
+type dataKey struct {
+	id   [4]byte
+	user string
+	aead cipher.AEAD
+}
+
+// Keyring открытые ключи. Ключ пользователя создаётся при первой записи
+// его данных и сразу сохраняется в keys.json.
+type Keyring struct {
+	path string
+
+	mu      sync.Mutex
+	file    keyFile
+	master  []byte
+	keys    map[[4]byte]*dataKey
+	current map[string]*dataKey // пользователь → ключ для новых данных
+}
+
+// Exists есть ли в каталоге данных файл ключей
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, KeyringFile))
+	return err == nil
+}
+
+// Create создаёт файл ключей и возвращает код восстановления — он
+// показывается один раз и нигде не хранится
+func Create(dir, passphrase string, a Argon2) (*Keyring, string, error) {
+	if Exists(dir) {
+		return nil, "", ErrKeyringExists
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, "", fmt.Errorf("create data dir: %w", err)
+	}
+	k := &Keyring{path: filepath.Join(dir, KeyringFile), file: keyFile{Version: 1}}
+	k.master = random(32)
+	code, err := k.wrapMaster(passphrase, a)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := k.load(); err != nil {
+		return nil, "", err
+	}
+	return k, code, k.save()
+}
+
+// Unlock открывает ключи парольной фразой
+func Unlock(dir, passphrase string) (*Keyring, error) {
+	k, err := read(dir)
+	if err != nil {
+		return nil, err
+	}
+	master, err := unwrap(k.file.KDF.key(passphrase), k.file.Master, "master")
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	k.master = master
+	return k, k.load()
+}
+
+// Recover открывает ключи кодом восстановления и ставит новую парольную
+// фразу. Возвращает новый код: старый после этого не действует.
+func Recover(dir, code, passphrase string, a Argon2) (*Keyring, string, error) {
+	k, err := read(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	raw, err := parseCode(code)
+	if err != nil {
+		return nil, "", ErrWrongCode
+	}
+	master, err := unwrap(codeKey(raw), k.file.Recovery, "recovery")
+	if err != nil {
+		return nil, "", ErrWrongCode
+	}
+	k.master = master
+	if err := k.load(); err != nil {
+		return nil, "", err
+	}
+	if code, err = k.wrapMaster(passphrase, a); err != nil {
+		return nil, "", err
+	}
+	return k, code, k.save()
+}
+
+func read(dir string) (*Keyring, error) {
+	path := filepath.Join(dir, KeyringFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoKeyring
+	}
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{path: path}
+	if err := json.Unmarshal(data, &k.file); err != nil {
+		return nil, fmt.Errorf("read %s: %w", KeyringFile, err)
+	}
+	return k, nil
+}
+
+// load расшифровывает ключи данных мастер-ключом
+func (k *Keyring) load() error {
+	k.keys = map[[4]byte]*dataKey{}
+	k.current = map[string]*dataKey{}
+	for _, uk := range k.file.Keys {
+		raw, err := unwrap(k.master, uk.Key, "user:"+uk.ID)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", uk.ID, err)
+		}
+		dk, err := newDataKey(uk.ID, uk.User, raw)
+		if err != nil {
+			return err
+		}
+		k.keys[dk.id] = dk
+		if !uk.Retired {
+			k.current[uk.User] = dk
+		}
+	}
+	return nil
+}
+
+func newDataKey(id, user string, raw []byte) (*dataKey, error) {
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	dk := &dataKey{user: user, aead: aead}
+	if n, err := hex.Decode(dk.id[:], []byte(id)); err != nil || n != 4 {
+		return nil, fmt.Errorf("bad key id %q", id)
+	}
+	return dk, nil
+}
+
+// wrapMaster шифрует мастер-ключ новой парольной фразой и новым кодом
+// восстановления; вызывать под k.mu или до того, как ключи в ходу
+func (k *Keyring) wrapMaster(passphrase string, a Argon2) (string, error) {
+	k.file.KDF = newKDF(a)
+	master, err := wrap(k.file.KDF.key(passphrase), k.master, "master")
+	if err != nil {
+		return "", err
+	}
+	raw := random(20)
+	recovery, err := wrap(codeKey(raw), k.master, "recovery")
+	if err != nil {
+		return "", err
+	}
+	k.file.Master, k.file.Recovery = master, recovery
+	return formatCode(raw), nil
+}
+
+// ChangePassphrase ставит новую парольную фразу; код восстановления
+// остаётся прежним
+func (k *Keyring) ChangePassphrase(passphrase string, a Argon2) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.file.KDF = newKDF(a)
+	master, err := wrap(k.file.KDF.key(passphrase), k.master, "master")
+	if err != nil {
+		return err
+	}
+	k.file.Master = master
+	return k.save()
+}
+
+// Rotate смена ключей: новый мастер-ключ, новый код восстановления и новые
+// ключи данных для всех пользователей. Старые ключи остаются для чтения,
+// пока данные не перешифрованы (Reseal) и не вызван DropRetired.
+func (k *Keyring) Rotate(passphrase string, a Argon2) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// ключи данных расшифровываем прежним мастер-ключом, пока он есть
+	raws := make([][]byte, len(k.file.Keys))
+	for i, uk := range k.file.Keys {
+		raw, err := unwrap(k.master, uk.Key, "user:"+uk.ID)
+		if err != nil {
+			return "", fmt.Errorf("key %s: %w", uk.ID, err)
+		}
+		raws[i] = raw
+	}
+
+	k.master = random(32)
+	code, err := k.wrapMaster(passphrase, a)
+	if err != nil {
+		return "", err
+	}
+	users := map[string]bool{}
+	for i := range k.file.Keys {
+		uk := &k.file.Keys[i]
+		if uk.Key, err = wrap(k.master, raws[i], "user:"+uk.ID); err != nil {
+			return "", err
+		}
+		uk.Retired = true
+		users[uk.User] = true
+	}
+	for user := range users {
+		if _, err := k.newKey(user); err != nil {
+			return "", err
+		}
+	}
+	if err := k.load(); err != nil {
+		return "", err
+	}
+	return code, k.save()
+}
+
+// DropRetired удаляет ключи, которыми после Rotate и Reseal уже ничего
+// не зашифровано
+func (k *Keyring) DropRetired() (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var keep []userKey
+	for _, uk := range k.file.Keys {
+		if !uk.Retired {
+			keep = append(keep, uk)
+		}
+	}
+	dropped := len(k.file.Keys) - len(keep)
+	k.file.Keys = keep
+	if err := k.load(); err != nil {
+		return 0, err
+	}
+	return dropped, k.save()
+}
+
+// Users пользователи, у которых есть ключ
+func (k *Keyring) Users() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var out []string
+	for user := range k.current {
+		out = append(out, user)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Status сколько ключей действующих и сколько ждут удаления
+func (k *Keyring) Status() (active, retired int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, uk := range k.file.Keys {
+		if uk.Retired {
+			retired++
+		} else {
+			active++
+		}
+	}
+	return active, retired
+}
+
+// newKey создаёт ключ данных пользователя; вызывать под k.mu, keys.json
+// сохраняет вызывающий
+func (k *Keyring) newKey(user string) (*dataKey, error) {
+	raw := random(32)
+	id := hex.EncodeToString(random(4))
+	wrapped, err := wrap(k.master, raw, "user:"+id)
+	if err != nil {
+		return nil, err
+	}
+	dk, err := newDataKey(id, user, raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, dup := k.keys[dk.id]; dup {
+		return k.newKey(user)
+	}
+	k.file.Keys = append(k.file.Keys, userKey{ID: id, User: user, Key: wrapped, Created: time.Now()})
+	k.keys[dk.id] = dk
+	k.current[user] = dk
+	return dk, nil
+}
+
+// key действующий ключ пользователя, при необходимости новый
+func (k *Keyring) key(user string) (*dataKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if dk, ok := k.current[user]; ok {
+		return dk, nil
+	}
+	dk, err := k.newKey(user)
+	if err != nil {
+		return nil, err
+	}
+	return dk, k.save()
+}
+
+// lookup ключ по идентификатору из зашифрованных данных
+func (k *Keyring) lookup(user string, id []byte) (*dataKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	dk, ok := k.keys[[4]byte(id)]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if dk.user != user {
+		return nil, fmt.Errorf("data of another user")
+	}
+	return dk, nil
+}
+
+// Seal шифрует данные пользователя его действующим ключом:
+// id ключа (4 байта), nonce, шифротекст
+func (k *Keyring) Seal(user string, plain []byte) ([]byte, error) {
+	dk, err := k.key(user)
+	if err != nil {
+		return nil, err
+	}
+	n := dk.aead.NonceSize()
+	out := make([]byte, 4+n, 4+n+len(plain)+dk.aead.Overhead())
+	copy(out, dk.id[:])
+	copy(out[4:], random(n))
+	return dk.aead.Seal(out, out[4:], plain, aad(user)), nil
+}
+
+// Open расшифровывает то, что записал Seal
+func (k *Keyring) Open(user string, sealed []byte) ([]byte, error) {
+	if len(sealed) < 4+12 {
+		return nil, errors.New("sealed data is too short")
+	}
+	dk, err := k.lookup(user, sealed[:4])
+	if err != nil {
+		return nil, err
+	}
+	n := 4 + dk.aead.NonceSize()
+	plain, err := dk.aead.Open(nil, sealed[4:n], sealed[n:], aad(user))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	return plain, nil
+}
+
+// aad данные одного пользователя не расшифровать как данные другого
+func aad(user string) []byte {
+	return []byte("bhl-diary\x00" + user)
+}
+
+// save пишет keys.json атомарно: во временный файл и rename
+func (k *Keyring) save() error {
+	data, err := json.MarshalIndent(k.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrap шифрует ключ ключом; label не даёт подставить один ключ вместо другого
+func wrap(kek, key []byte, label string) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := random(aead.NonceSize())
+	return aead.Seal(nonce, nonce, key, []byte(label)), nil
+}
+
+func unwrap(kek, wrapped []byte, label string) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, errors.New("wrapped key is too short")
+	}
+	return aead.Open(nil, wrapped[:n], wrapped[n:], []byte(label))
+}
+
+// codeKey ключ из кода восстановления: в коде 160 случайных бит,
+// медленный вывод не нужен
+func codeKey(raw []byte) []byte {
+	sum := sha256.Sum256(append([]byte("bhl-diary recovery\x00"), raw...))
+	return sum[:]
+}
+
+var codeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// formatCode код восстановления: 8 групп по 4 символа через дефис
+func formatCode(raw []byte) string {
+	s := codeEncoding.EncodeToString(raw)
+	var groups []string
+	for i := 0; i < len(s); i += 4 {
+		groups = append(groups, s[i:min(i+4, len(s))])
+	}
+	return strings.Join(groups, "-")
+}
+
+func parseCode(code string) ([]byte, error) {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	raw, err := codeEncoding.DecodeString(code)
+	if err != nil || len(raw) != 20 {
+		return nil, errors.New("bad recovery code")
+	}
+	return raw, nil
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
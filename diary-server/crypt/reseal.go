@@ -0,0 +1,98 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bhl-diary/store"
+)
+
+// Resealer бэкенд, который умеет перешифровать свои данные действующими
+// ключами (store.SQLite)
+type Resealer interface {
+	Reseal(ctx context.Context) (int, error)
+}
+
+// ResealReport сколько перешифровано
+type ResealReport struct {
+	Rows  int // строк в хранилище
+	Audio int // аудио записей
+	Files int // файлов индексов
+}
+
+// Reseal шифрует действующими ключами всё, что лежит на диске: записи
+// хранилища (st должно быть открыто с этими ключами), аудио записей и
+// файлы индексов <user>.gob в dirs. Незашифрованное шифруется, так что
+// этим же включается шифрование уже накопленного дневника.
+func Reseal(ctx context.Context, k *Keyring, st store.Store, dirs ...string) (ResealReport, error) {
+	var rep ResealReport
+	rs, ok := st.(Resealer)
+	if !ok {
+		return rep, fmt.Errorf("storage backend %T does not support encryption", st)
+	}
+	var err error
+	if rep.Rows, err = rs.Reseal(ctx); err != nil {
+		return rep, err
+	}
+
+	// после хранилища ключ есть у каждого, у кого есть записи
+	for _, user := range k.Users() {
+		entries, err := st.ListEntries(ctx, store.Filter{User: user})
+		if err != nil {
+			return rep, err
+		}
+		seen := map[string]bool{}
+		for _, e := range entries {
+			if e.Audio == "" || seen[e.Audio] {
+				continue
+			}
+			seen[e.Audio] = true
+			err := SealFile(k, user, e.Audio)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return rep, fmt.Errorf("audio %s: %w", e.Audio, err)
+			}
+			// файл другой — старая сумма для bhl-diary verify больше не годится
+			if err := store.RecordAudio(ctx, st, user, e.Audio); err != nil {
+				return rep, fmt.Errorf("audio %s: %w", e.Audio, err)
+			}
+			rep.Audio++
+		}
+	}
+
+	for _, dir := range dirs {
+		files, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return rep, err
+		}
+		for _, f := range files {
+			name, ok := strings.CutSuffix(f.Name(), ".gob")
+			if !ok || f.IsDir() {
+				continue
+			}
+			user, err := url.PathUnescape(name)
+			if err != nil {
+				continue
+			}
+			if user == "_anonymous" {
+				user = ""
+			}
+			if err := SealFile(k, user, filepath.Join(dir, f.Name())); err != nil {
+				return rep, fmt.Errorf("%s: %w", f.Name(), err)
+			}
+			rep.Files++
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"bhl-diary/api"
+	"bhl-diary/crypt"
+	"bhl-diary/insights"
+	"bhl-diary/jobs"
+	"bhl-diary/segment"
+	"bhl-diary/semantic"
+	"bhl-diary/store"
+	"bhl-diary/transcribe"
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/mbykov/wshandler-go"
+)
+
+// saveSession превращает завершённую сессию в запись дневника. Текст
+// берётся по абзацам, которые сложил wshandler; если включено деление по
+// темам, длинная диктовка становится несколькими записями. Возвращает
+// ID созданных записей.
+func saveSession(st store.Store, topics *segment.TopicSplitter, rec wshandler.SessionRecord) ([]string, error) {
+	if len(rec.Finals) == 0 {
+		return nil, nil
+	}
+
+	var finals []store.Final
+	for _, f := range rec.Finals {
+		finals = append(finals, store.Final{
+			Type:   f.Type,
+			Text:   f.Text,
+			Raw:    f.Raw,
+			Name:   f.Name,
+			Script: f.Script,
+			At:     f.At,
+			Words:  storeWords(f.Words),
+		})
+	}
+
+	var paras []store.Paragraph
+	for _, p := range rec.Paragraphs {
+		paras = append(paras, store.Paragraph{Text: p.Text, Start: p.Start, End: p.End})
+	}
+	if len(paras) == 0 {
+		// всё удалено голосовыми командами — сохраняем хотя бы то, что было сказано
+		paras = []store.Paragraph{{Text: assembleText(finals), Start: rec.Started, End: rec.Ended}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	groups := [][]store.Paragraph{paras}
+	if topics != nil {
+		var err error
+		if groups, err = topics.Split(ctx, paras); err != nil {
+			log.Printf("⚠️ Деление сессии %s по темам не удалось: %v", rec.ID, err)
+		}
+	}
+
+	var ids []string
+	from := 0
+	for i, group := range groups {
+		// фразы достаются записи по времени: до конца её последнего абзаца
+		to := len(finals)
+		if i < len(groups)-1 {
+			end := group[len(group)-1].End
+			to = from
+			for to < len(finals) && !finals[to].At.After(end) {
+				to++
+			}
+		}
+		part := finals[from:to]
+		recFinals := rec.Finals[from:to]
+		from = to
+
+		entry := &store.Entry{
+			User:       rec.User,
+			SessionID:  rec.ID,
+			Paragraphs: group,
+			Text:       store.JoinParagraphs(group),
+			Finals:     part,
+			Audio:      rec.Audio,
+			CreatedAt:  rec.Started,
+		}
+		if i > 0 && !group[0].Start.IsZero() {
+			entry.CreatedAt = group[0].Start
+		}
+
+		// первые две ревизии: что услышал распознаватель и что вышло после конвейера
+		entry.Revisions = []store.Revision{
+			{Kind: store.RevisionASR, Text: assembleRaw(part), Author: rec.User, CreatedAt: rec.Ended},
+			{Kind: store.RevisionProcessed, Text: entry.Text, Author: rec.User, CreatedAt: rec.Ended},
+		}
+
+		if err := st.CreateEntry(ctx, entry); err != nil {
+			log.Printf("❌ Не удалось сохранить запись сессии %s: %v", rec.ID, err)
+			return ids, err
+		}
+		ids = append(ids, entry.ID)
+		log.Printf("💾 Запись %s сохранена (%d абзацев, %d фраз)", entry.ID, len(entry.Paragraphs), len(entry.Finals))
+		saveTasks(ctx, st, entry, recFinals)
+	}
+	// сумма — для bhl-diary verify: аудио к этому моменту уже зашифровано
+	if rec.Audio != "" {
+		if err := store.RecordAudio(ctx, st, rec.User, rec.Audio); err != nil {
+			log.Printf("⚠️ Контрольная сумма аудио %s: %v", rec.Audio, err)
+		}
+	}
+	return ids, nil
+}
+
+// saveTasks дела, найденные стадией tasks. Если предложение потом удалили
+// голосовой правкой, его дело тоже не сохраняется.
+func saveTasks(ctx context.Context, st store.Store, entry *store.Entry, finals []wshandler.FinalRecord) {
+	n := 0
+	for _, f := range finals {
+		for _, t := range f.Tasks {
+			if !strings.Contains(entry.Text, t.Source) {
+				continue
+			}
+			task := &store.Task{User: entry.User, EntryID: entry.ID, Text: t.Text, Source: t.Source, HasTime: t.HasTime, CreatedAt: f.At}
+			if t.Due != nil {
+				task.Due = *t.Due
+			}
+			if err := st.CreateTask(ctx, task); err != nil {
+				log.Printf("⚠️ Не удалось сохранить дело %q записи %s: %v", t.Text, entry.ID, err)
+				continue
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		log.Printf("📌 Запись %s: дел и напоминаний %d", entry.ID, n)
+	}
+}
+
+// transcribeJob обработчик загруженного аудио: расшифровка и запись
+// дневника, как после живой сессии. Результат — ID записей через запятую;
+// saved получает новые записи так же, как после сессии. С шифрованием
+// загруженный файл удаляется после расшифровки: остаётся только
+// зашифрованная копия (если включена запись аудио).
+func transcribeJob(st store.Store, topics *segment.TopicSplitter, tr *transcribe.Transcriber, keys *crypt.Keyring, saved func(user string, ids []string)) jobs.Handler {
+	return func(ctx context.Context, j *store.Job, progress func(float64)) (string, error) {
+		var in api.TranscribeInput
+		if err := json.Unmarshal([]byte(j.Input), &in); err != nil {
+			return "", fmt.Errorf("bad job input: %w", err)
+		}
+		rec, err := tr.Run(ctx, "upload:"+j.ID, j.User, in.File, j.CreatedAt, progress)
+		if err != nil {
+			return "", err
+		}
+		if len(rec.Finals) == 0 {
+			return "", errors.New("no speech recognized")
+		}
+		sealAudio(keys, rec)
+		ids, err := saveSession(st, topics, rec)
+		if err != nil {
+			return "", err
+		}
+		if keys != nil {
+			if err := os.Remove(in.File); err != nil {
+				log.Printf("⚠️ Не удалось удалить загруженный файл %s: %v", in.File, err)
+			}
+		}
+		saved(j.User, ids)
+		return strings.Join(ids, ","), nil
+	}
+}
+
+// enqueueInsights ставит новые записи на разбор локальной моделью
+func enqueueInsights(q *jobs.Queue, user string, ids []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := insights.Enqueue(ctx, q, user, ids...); err != nil {
+		log.Printf("⚠️ Не удалось поставить разбор записей %v: %v", ids, err)
+	}
+}
+
+func enqueueEmbeddings(q *jobs.Queue, user string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := semantic.Enqueue(ctx, q, user); err != nil {
+		log.Printf("⚠️ Не удалось поставить пересчёт векторов: %v", err)
+	}
+}
+
+func storeWords(words []asr.Word) []store.Word {
+	if len(words) == 0 {
+		return nil
+	}
+	out := make([]store.Word, len(words))
+	for i, w := range words {
+		out[i] = store.Word{Text: w.Text, Start: w.Start, End: w.End}
+	}
+	return out
+}
+
+// assembleText склеивает фразы в текст записи. Формулы идут как $$...$$,
+// editLatex заменяет предыдущую формулу, а не добавляет новую.
+func assembleText(finals []store.Final) string {
+	var parts []string
+	lastFormula := -1
+	for _, f := range finals {
+		if f.Type == store.FinalEdit {
+			continue
+		}
+		if f.Type != store.FinalCommand {
+			parts = append(parts, f.Text)
+			continue
+		}
+		formula := "$$" + strings.Trim(f.Script, "$ \n") + "$$"
+		if f.Name == "editLatex" && lastFormula >= 0 {
+			parts[lastFormula] = formula
+			continue
+		}
+		lastFormula = len(parts)
+		parts = append(parts, formula)
+	}
+	return strings.Join(parts, " ")
+}
+
+// assembleRaw текст распознавателя без пост-обработки, включая
+// произнесённые команды
+func assembleRaw(finals []store.Final) string {
+	parts := make([]string, 0, len(finals))
+	for _, f := range finals {
+		if f.Raw != "" {
+			parts = append(parts, f.Raw)
+		}
+	}
+	return strings.Join(parts, " ")
+}
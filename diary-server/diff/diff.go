@@ -0,0 +1,129 @@
+// Package diff пословное сравнение двух версий текста (алгоритм Майерса)
+package diff
+
+import "strings"
+
+// Виды операций
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// Op подряд идущие слова с одной операцией
+type Op struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Words сравнивает тексты по словам. Пунктуация остаётся частью слова,
+// поэтому "привет" → "привет," — это замена слова.
+func Words(a, b string) []Op {
+	x, y := strings.Fields(a), strings.Fields(b)
+
+	// общие начало и конец не гоняем через алгоритм
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+
+	var ops []Op
+	ops = appendOp(ops, Equal, x[:pre]...)
+	for _, o := range myers(x[pre:len(x)-suf], y[pre:len(y)-suf]) {
+		ops = appendOp(ops, o.Op, o.Text)
+	}
+	ops = appendOp(ops, Equal, x[len(x)-suf:]...)
+	return ops
+}
+
+// appendOp добавляет слова, склеивая с последней операцией того же вида
+func appendOp(ops []Op, op string, words ...string) []Op {
+	if len(words) == 0 {
+		return ops
+	}
+	text := strings.Join(words, " ")
+	if n := len(ops); n > 0 && ops[n-1].Op == op {
+		ops[n-1].Text += " " + text
+		return ops
+	}
+	return append(ops, Op{Op: op, Text: text})
+}
+
+// myers кратчайший редакционный скрипт по словам, по одному слову на операцию
+func myers(x, y []string) []Op {
+	n, m := len(x), len(y)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[k+max] — самый дальний x на диагонали k; trace — v после каждого шага d
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || k != d && v[k-1+max] < v[k+1+max] {
+				i = v[k+1+max] // шаг вниз: вставка
+			} else {
+				i = v[k-1+max] + 1 // шаг вправо: удаление
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[k+max] = i
+			if i >= n && j >= m {
+				return backtrack(x, y, trace, d, max)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(x, y []string, trace [][]int, d, max int) []Op {
+	var rev []Op
+	i, j := len(x), len(y)
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := i - j
+		var prevK int
+		if k == -d || k != d && v[k-1+max] < v[k+1+max] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevI := v[prevK+max]
+		prevJ := prevI - prevK
+
+		for i > prevI && j > prevJ {
+			i--
+			j--
+			rev = append(rev, Op{Op: Equal, Text: x[i]})
+		}
+		if i == prevI {
+			j--
+			rev = append(rev, Op{Op: Insert, Text: y[j]})
+		} else {
+			i--
+			rev = append(rev, Op{Op: Delete, Text: x[i]})
+		}
+	}
+	for i > 0 && j > 0 {
+		i--
+		j--
+		rev = append(rev, Op{Op: Equal, Text: x[i]})
+	}
+
+	ops := make([]Op, len(rev))
+	for n, o := range rev {
+		ops[len(rev)-1-n] = o
+	}
+	return ops
+}
@@ -0,0 +1,114 @@
+// Package events шина событий дневника: записи, сессии диктовки и команды
+// публикуют события, подписчики (исходящие вебхуки) получают их в том же
+// процессе.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Типы событий
+const (
+	EntryCreated    = "entry.created"
+	EntryUpdated    = "entry.updated"
+	SessionStarted  = "session.started"
+	SessionEnded    = "session.ended"
+	CommandResolved = "command.resolved"
+)
+
+// Types все типы событий
+var Types = []string{EntryCreated, EntryUpdated, SessionStarted, SessionEnded, CommandResolved}
+
+// Event событие: Data — EntryData, SessionData или CommandData по Type
+type Event struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	User string    `json:"user"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// EntryData запись для entry.created и entry.updated
+type EntryData struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Text      string    `json:"text"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SessionData сессия диктовки; Ended и Entries — только в session.ended
+type SessionData struct {
+	ID      string     `json:"id"`
+	Started time.Time  `json:"started"`
+	Ended   *time.Time `json:"ended,omitempty"`
+	Finals  int        `json:"finals,omitempty"`
+	Entries []string   `json:"entries,omitempty"` // записи дневника из сессии
+}
+
+// CommandData команда, которую разобрал command-qwen
+type CommandData struct {
+	Session    string `json:"session"`
+	Name       string `json:"name"`
+	Text       string `json:"text"`
+	Script     string `json:"script"`
+	Raw        string `json:"raw"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Bus шина событий в процессе
+type Bus struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]subscriber
+}
+
+type subscriber struct {
+	types []string
+	fn    func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int]subscriber{}}
+}
+
+// Subscribe fn получает события перечисленных типов (без типов — все).
+// fn вызывается в горутине Publish и не должна блокировать. Возвращает
+// отписку.
+func (b *Bus) Subscribe(fn func(Event), types ...string) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subs[id] = subscriber{types: types, fn: fn}
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// Publish раздаёт событие подписчикам и возвращает его с ID и временем
+func (b *Bus) Publish(typ, user string, data any) Event {
+	e := Event{ID: newID(), Type: typ, User: user, Time: time.Now(), Data: data}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subs {
+		if len(s.types) == 0 || slices.Contains(s.types, typ) {
+			s.fn(e)
+		}
+	}
+	return e
+}
+
+func newID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
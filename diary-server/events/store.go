@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"log"
+
+	"bhl-diary/store"
+)
+
+// Store обёртка над store.Store: созданная запись — entry.created; правка
+// текста, заголовка и тегов — entry.updated.
+type Store struct {
+	store.Store
+	Bus *Bus
+}
+
+func NewStore(st store.Store, b *Bus) *Store {
+	return &Store{Store: st, Bus: b}
+}
+
+func (s *Store) CreateEntry(ctx context.Context, e *store.Entry) error {
+	if err := s.Store.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+	s.Bus.Publish(EntryCreated, e.User, Entry(e))
+	return nil
+}
+
+func (s *Store) UpdateEntry(ctx context.Context, e *store.Entry) error {
+	if err := s.Store.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+	s.Bus.Publish(EntryUpdated, e.User, Entry(e))
+	return nil
+}
+
+func (s *Store) AddTag(ctx context.Context, user, id, tag string) error {
+	if err := s.Store.AddTag(ctx, user, id, tag); err != nil {
+		return err
+	}
+	s.updated(ctx, user, id)
+	return nil
+}
+
+func (s *Store) RemoveTag(ctx context.Context, user, id, tag string) error {
+	if err := s.Store.RemoveTag(ctx, user, id, tag); err != nil {
+		return err
+	}
+	s.updated(ctx, user, id)
+	return nil
+}
+
+// updated событие с записью после смены тегов
+func (s *Store) updated(ctx context.Context, user, id string) {
+	e, err := s.Store.GetEntry(ctx, user, id)
+	if err != nil {
+		log.Printf("⚠️ События: не удалось прочитать %s: %v", id, err)
+		return
+	}
+	s.Bus.Publish(EntryUpdated, user, Entry(e))
+}
+
+// Entry данные события о записи
+func Entry(e *store.Entry) EntryData {
+	tags := e.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return EntryData{ID: e.ID, SessionID: e.SessionID, Title: e.Title, Text: e.Text,
+		Tags: tags, CreatedAt: e.CreatedAt, UpdatedAt: e.UpdatedAt}
+}
@@ -0,0 +1,301 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxBackoff пауза между повторами больше не растёт
+const maxBackoff = 5 * time.Minute
+
+var errStopped = errors.New("delivery stopped")
+
+// Config секция webhooks в config.yaml
+type Config struct {
+	Hooks      []Hook `yaml:"hooks"`
+	Retries    int    `yaml:"retries"`     // повторов после первой попытки: 0 — 5, -1 — без повторов
+	BackoffMs  int    `yaml:"backoff_ms"`  // пауза перед первым повтором, дальше вдвое; по умолчанию 1000
+	TimeoutSec int    `yaml:"timeout_sec"` // на попытку, по умолчанию 10
+	Queue      int    `yaml:"queue"`       // событий в очереди вебхука, по умолчанию 256
+	DeadLetter string `yaml:"dead_letter"` // журнал недоставленных (JSON Lines)
+}
+
+// Hook один исходящий вебхук
+type Hook struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // ключ подписи HMAC-SHA256; пусто — без подписи
+	Events []string `yaml:"events"` // типы событий; пусто — все
+	User   string   `yaml:"user"`   // только события этого пользователя; пусто — всех
+}
+
+func (c Config) withDefaults() Config {
+	if c.Retries == 0 {
+		c.Retries = 5
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	}
+	if c.BackoffMs <= 0 {
+		c.BackoffMs = 1000
+	}
+	if c.TimeoutSec <= 0 {
+		c.TimeoutSec = 10
+	}
+	if c.Queue <= 0 {
+		c.Queue = 256
+	}
+	return c
+}
+
+// DeadLetter событие, которое вебхук так и не принял
+type DeadLetter struct {
+	Time     time.Time `json:"time"`
+	URL      string    `json:"url"`
+	Attempts int       `json:"attempts"`
+	Status   int       `json:"status,omitempty"` // последний ответ; 0 — ответа не было
+	Error    string    `json:"error"`
+	Event    Event     `json:"event"`
+}
+
+// Webhooks доставка событий на исходящие вебхуки. У каждого вебхука своя
+// очередь: события приходят в порядке публикации, медленный получатель
+// не задерживает остальных. Ответ 2xx — доставлено; 408, 429, 5xx и
+// сетевые ошибки повторяются с растущей паузой; другие ответы и
+// исчерпанные повторы уходят в журнал недоставленных.
+type Webhooks struct {
+	cfg    Config
+	client *http.Client
+	hooks  []*hookQueue
+
+	mu      sync.Mutex // журнал и stopped
+	stopped bool
+}
+
+type hookQueue struct {
+	Hook
+	ch chan Event
+}
+
+// NewWebhooks проверяет адреса и типы событий. DeadLetter обязателен.
+func NewWebhooks(cfg Config) (*Webhooks, error) {
+	cfg = cfg.withDefaults()
+	if cfg.DeadLetter == "" {
+		return nil, fmt.Errorf("webhooks: dead_letter is not set")
+	}
+	w := &Webhooks{cfg: cfg, client: &http.Client{Timeout: time.Duration(cfg.TimeoutSec) * time.Second}}
+	for i, h := range cfg.Hooks {
+		u, err := url.Parse(h.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %d: bad url %q", i+1, h.URL)
+		}
+		for _, t := range h.Events {
+			if !slices.Contains(Types, t) {
+				return nil, fmt.Errorf("webhook %d: unknown event %q", i+1, t)
+			}
+		}
+		w.hooks = append(w.hooks, &hookQueue{Hook: h, ch: make(chan Event, cfg.Queue)})
+	}
+	return w, nil
+}
+
+// Handle ставит событие в очереди подходящих вебхуков; подписчик шины.
+// Переполненная очередь и остановленная доставка — сразу в журнал.
+func (w *Webhooks) Handle(e Event) {
+	for _, h := range w.hooks {
+		if (len(h.Events) > 0 && !slices.Contains(h.Events, e.Type)) || (h.User != "" && h.User != e.User) {
+			continue
+		}
+		var err error
+		w.mu.Lock()
+		if w.stopped {
+			err = errStopped
+		} else {
+			select {
+			case h.ch <- e:
+			default:
+				err = fmt.Errorf("queue is full")
+			}
+		}
+		w.mu.Unlock()
+		if err != nil {
+			w.dead(h, e, 0, 0, err)
+		}
+	}
+}
+
+// Run доставляет события до отмены ctx. Что осталось в очередях и ждёт
+// повтора, уходит в журнал недоставленных.
+func (w *Webhooks) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, h := range w.hooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case e := <-h.ch:
+					if ctx.Err() != nil {
+						w.dead(h, e, 0, 0, errStopped)
+						return
+					}
+					w.deliver(ctx, h, e)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+	for _, h := range w.hooks {
+		for len(h.ch) > 0 {
+			w.dead(h, <-h.ch, 0, 0, errStopped)
+		}
+	}
+}
+
+// deliver одно событие одному вебхуку с повторами
+func (w *Webhooks) deliver(ctx context.Context, h *hookQueue, e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		w.dead(h, e, 0, 0, err)
+		return
+	}
+	delay := time.Duration(w.cfg.BackoffMs) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		status, retryAfter, err := w.post(ctx, h, e, body)
+		if err == nil {
+			return
+		}
+		if !retryable(status) || attempt > w.cfg.Retries {
+			w.dead(h, e, attempt, status, err)
+			return
+		}
+		wait := max(delay, retryAfter)
+		select {
+		case <-ctx.Done():
+			w.dead(h, e, attempt, status, err)
+			return
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// post одна попытка: код ответа и Retry-After получателя
+func (w *Webhooks) post(ctx context.Context, h *hookQueue, e Event, body []byte) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bhl-diary")
+	req.Header.Set("X-BHL-Event", e.Type)
+	req.Header.Set("X-BHL-Delivery", e.ID)
+	req.Header.Set("X-BHL-Timestamp", ts)
+	if h.Secret != "" {
+		req.Header.Set("X-BHL-Signature", Sign(h.Secret, ts, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 == 2 {
+		return resp.StatusCode, 0, nil
+	}
+	var retryAfter time.Duration
+	if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && sec > 0 {
+		retryAfter = min(time.Duration(sec)*time.Second, maxBackoff)
+	}
+	return resp.StatusCode, retryAfter, fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+}
+
+// retryable сетевая ошибка (status 0), таймаут, лимит запросов и ошибки сервера
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// dead пишет событие в журнал недоставленных
+func (w *Webhooks) dead(h *hookQueue, e Event, attempts, status int, cause error) {
+	log.Printf("❌ Вебхук %s: событие %s %s не доставлено (попыток %d): %v", h.URL, e.Type, e.ID, attempts, cause)
+	line, err := json.Marshal(DeadLetter{Time: time.Now(), URL: h.URL, Attempts: attempts,
+		Status: status, Error: cause.Error(), Event: e})
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	os.MkdirAll(filepath.Dir(w.cfg.DeadLetter), 0o700)
+	f, err := os.OpenFile(w.cfg.DeadLetter, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		log.Printf("⚠️ Журнал недоставленных %s: %v", w.cfg.DeadLetter, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("⚠️ Журнал недоставленных %s: %v", w.cfg.DeadLetter, err)
+	}
+}
+
+// Sign подпись тела запроса: "sha256=" и HMAC-SHA256 от "<timestamp>.<тело>"
+// в hex. Метка времени — из заголовка X-BHL-Timestamp, по ней получатель
+// отбрасывает старые повторы.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверка подписи на стороне получателя
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// ReadDeadLetters журнал недоставленных; нет файла — пусто
+func ReadDeadLetters(path string) ([]DeadLetter, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []DeadLetter
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var d DeadLetter
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			return out, fmt.Errorf("%s: %w", path, err)
+		}
+		out = append(out, d)
+	}
+	return out, sc.Err()
+}
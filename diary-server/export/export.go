@@ -0,0 +1,196 @@
+// Package export выгрузка записей дневника в Markdown, JSON Lines,
+// простой текст и LaTeX. Шаблоны встроены, но их можно переопределить
+// файлами <формат>.tmpl в каталоге шаблонов.
+package export
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"bhl-diary/store"
+)
+
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+// Форматы выгрузки
+const (
+	Markdown = "markdown"
+	JSONL    = "jsonl"
+	Text     = "text"
+	LaTeX    = "latex"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Options параметры выгрузки
+type Options struct {
+	Title        string
+	From, To     time.Time // To — последний день выгрузки, включительно
+	TemplatesDir string    // пользовательские шаблоны, пусто — только встроенные
+}
+
+// Doc данные для шаблона
+type Doc struct {
+	Title     string
+	From, To  time.Time
+	Generated time.Time
+	Entries   []*store.Entry
+	Months    []Month
+}
+
+// Month записи одного месяца — главы книги
+type Month struct {
+	Date    time.Time
+	Entries []*store.Entry
+}
+
+// ContentType MIME-тип и расширение файла для формата
+func ContentType(format string) (mime, ext string, err error) {
+	switch format {
+	case Markdown:
+		return "text/markdown; charset=utf-8", "md", nil
+	case JSONL:
+		return "application/x-ndjson", "jsonl", nil
+	case Text:
+		return "text/plain; charset=utf-8", "txt", nil
+	case LaTeX:
+		return "application/x-tex", "tex", nil
+	}
+	return "", "", fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// Render пишет записи в w в хронологическом порядке
+func Render(w io.Writer, format string, entries []*store.Entry, opts Options) error {
+	if _, _, err := ContentType(format); err != nil {
+		return err
+	}
+
+	sorted := append([]*store.Entry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedAt.Before(sorted[j].CreatedAt) })
+
+	if format == JSONL {
+		enc := json.NewEncoder(w)
+		for _, e := range sorted {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tmpl, err := loadTemplate(format, opts.TemplatesDir)
+	if err != nil {
+		return err
+	}
+
+	doc := Doc{
+		Title:     opts.Title,
+		From:      opts.From,
+		To:        opts.To,
+		Generated: time.Now(),
+		Entries:   sorted,
+		Months:    byMonth(sorted),
+	}
+	if doc.Title == "" {
+		doc.Title = "Дневник"
+	}
+	return tmpl.Execute(w, doc)
+}
+
+func loadTemplate(format, dir string) (*template.Template, error) {
+	name := format + ".tmpl"
+	t := template.New(name).Funcs(funcs)
+
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return t.Parse(string(data))
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read template %s: %w", name, err)
+		}
+	}
+	return t.ParseFS(builtin, "templates/"+name)
+}
+
+func byMonth(entries []*store.Entry) []Month {
+	var out []Month
+	for _, e := range entries {
+		m := time.Date(e.CreatedAt.Year(), e.CreatedAt.Month(), 1, 0, 0, 0, 0, e.CreatedAt.Location())
+		if len(out) == 0 || !out[len(out)-1].Date.Equal(m) {
+			out = append(out, Month{Date: m})
+		}
+		out[len(out)-1].Entries = append(out[len(out)-1].Entries, e)
+	}
+	return out
+}
+
+var monthNames = [...]string{"", "январь", "февраль", "март", "апрель", "май", "июнь",
+	"июль", "август", "сентябрь", "октябрь", "ноябрь", "декабрь"}
+
+var monthGenitive = [...]string{"", "января", "февраля", "марта", "апреля", "мая", "июня",
+	"июля", "августа", "сентября", "октября", "ноября", "декабря"}
+
+var funcs = template.FuncMap{
+	// "март 2026"
+	"month": func(t time.Time) string { return fmt.Sprintf("%s %d", monthNames[t.Month()], t.Year()) },
+	// "1 марта 2026, 10:00"
+	"day": func(t time.Time) string {
+		return fmt.Sprintf("%d %s %d, %s", t.Day(), monthGenitive[t.Month()], t.Year(), t.Format("15:04"))
+	},
+	"iso":      func(t time.Time) string { return t.Format(time.RFC3339) },
+	"date":     func(t time.Time) string { return t.Format(time.DateOnly) },
+	"join":     strings.Join,
+	"latex":    latexBody,
+	"latexEsc": latexEscape,
+	"plain":    plainText,
+	"yaml":     yamlString,
+}
+
+// formulaRe формулы в тексте записи хранятся как $$...$$, в том числе
+// многострочные
+var formulaRe = regexp.MustCompile(`(?s)\$\$(.+?)\$\$`)
+
+// latexBody экранирует текст, а формулы command-qwen выносит в display math
+func latexBody(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range formulaRe.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(latexEscape(text[last:m[0]]))
+		b.WriteString("\n\\[\n" + strings.TrimSpace(text[m[2]:m[3]]) + "\n\\]\n")
+		last = m[1]
+	}
+	b.WriteString(latexEscape(text[last:]))
+	return b.String()
+}
+
+var latexReplacer = strings.NewReplacer(
+	`\`, `\textbackslash{}`, `{`, `\{`, `}`, `\}`, `$`, `\$`, `&`, `\&`,
+	`#`, `\#`, `^`, `\textasciicircum{}`, `_`, `\_`, `~`, `\textasciitilde{}`, `%`, `\%`,
+)
+
+func latexEscape(s string) string {
+	return latexReplacer.Replace(s)
+}
+
+// plainText формулы в простом тексте остаются как есть, без $$
+func plainText(text string) string {
+	return formulaRe.ReplaceAllString(text, "[$1]")
+}
+
+// yamlString значение для front matter в двойных кавычках
+func yamlString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
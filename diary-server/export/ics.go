@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bhl-diary/store"
+)
+
+// ICSContentType тип ответа для выгрузки дел
+const ICSContentType = "text/calendar; charset=utf-8"
+
+// eventLength длительность события для дела со временем
+const eventLength = 30 * time.Minute
+
+// Calendar выгружает дела в iCalendar (RFC 5545). Открытые дела со сроком
+// становятся событиями — их понимают все календари, со временем — ещё и с
+// напоминанием за 15 минут; без срока и сделанные — задачами (VTODO).
+func Calendar(w io.Writer, tasks []*store.Task, name string) error {
+	if name == "" {
+		name = "Дела из дневника"
+	}
+	c := &icsWriter{w: bufio.NewWriter(w)}
+	c.line("BEGIN:VCALENDAR")
+	c.line("VERSION:2.0")
+	c.line("PRODID:-//bhl-diary//tasks//RU")
+	c.line("CALSCALE:GREGORIAN")
+	c.line("X-WR-CALNAME:" + icsText(name))
+
+	for _, t := range tasks {
+		kind := "VTODO"
+		if !t.Done && !t.Due.IsZero() {
+			kind = "VEVENT"
+		}
+		c.line("BEGIN:" + kind)
+		c.line("UID:" + t.ID + "@bhl-diary")
+		c.line("DTSTAMP:" + icsUTC(t.UpdatedAt))
+		c.line("CREATED:" + icsUTC(t.CreatedAt))
+		c.line("SUMMARY:" + icsText(t.Text))
+		desc := t.Source
+		if desc != "" {
+			desc += "\n"
+		}
+		c.line("DESCRIPTION:" + icsText(desc+"Запись дневника "+t.EntryID))
+
+		switch {
+		case kind == "VEVENT" && t.HasTime:
+			c.line("DTSTART:" + icsUTC(t.Due))
+			c.line("DTEND:" + icsUTC(t.Due.Add(eventLength)))
+			c.line("BEGIN:VALARM")
+			c.line("ACTION:DISPLAY")
+			c.line("DESCRIPTION:" + icsText(t.Text))
+			c.line("TRIGGER:-PT15M")
+			c.line("END:VALARM")
+		case kind == "VEVENT":
+			c.line("DTSTART;VALUE=DATE:" + t.Due.Format("20060102"))
+			c.line("DTEND;VALUE=DATE:" + t.Due.AddDate(0, 0, 1).Format("20060102"))
+		default:
+			if !t.Due.IsZero() && t.HasTime {
+				c.line("DUE:" + icsUTC(t.Due))
+			} else if !t.Due.IsZero() {
+				c.line("DUE;VALUE=DATE:" + t.Due.Format("20060102"))
+			}
+			if t.Done {
+				c.line("STATUS:COMPLETED")
+				c.line("COMPLETED:" + icsUTC(t.DoneAt))
+			} else {
+				c.line("STATUS:NEEDS-ACTION")
+			}
+		}
+		c.line("END:" + kind)
+	}
+	c.line("END:VCALENDAR")
+	if c.err != nil {
+		return c.err
+	}
+	return c.w.Flush()
+}
+
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line пишет строку с CRLF, перенося её по 75 байт (не разрывая символы)
+func (c *icsWriter) line(s string) {
+	if c.err != nil {
+		return
+	}
+	for first := true; ; first = false {
+		limit := 75
+		if !first {
+			limit = 74 // пробел продолжения
+			c.w.WriteByte(' ')
+		}
+		if len(s) <= limit {
+			_, c.err = c.w.WriteString(s + "\r\n")
+			return
+		}
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, c.err = c.w.WriteString(s[:cut] + "\r\n"); c.err != nil {
+			return
+		}
+		s = s[cut:]
+	}
+}
+
+func icsUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icsText(s string) string {
+	return icsEscaper.Replace(s)
+}
@@ -8,20 +8,62 @@ replace github.com/mbykov/wshandler-go => ../wshandler-go
 
 replace github.com/mbykov/vosk-punct => ../vosk-punct
 
+replace github.com/mbykov/grpchandler-go => ../grpchandler-go
+
+replace github.com/michael/bhl-qwen-go => ../command-qwen-gguf
+
 require (
+	github.com/Hank-Kuo/go-bert-tokenizer v1.0.0
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/go-git/go-git/v5 v5.19.2
+	github.com/kljensen/snowball v0.10.0
 	github.com/mbykov/asr-zipformer-go v0.0.0-00010101000000-000000000000
+	github.com/mbykov/grpchandler-go v0.0.0-00010101000000-000000000000
 	github.com/mbykov/vosk-punct v0.0.0-00010101000000-000000000000
 	github.com/mbykov/wshandler-go v0.0.0-00010101000000-000000000000
+	github.com/michael/bhl-qwen-go v0.0.0-00010101000000-000000000000
+	github.com/yalue/onnxruntime_go v1.27.0
+	golang.org/x/crypto v0.54.0
+	golang.org/x/term v0.45.0
+	google.golang.org/grpc v1.84.0
 	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.58.0
 )
 
 require (
-	github.com/Hank-Kuo/go-bert-tokenizer v1.0.0 // indirect
+	dario.cat/mergo v1.0.0 // indirect
+	github.com/Microsoft/go-winio v0.6.2 // indirect
+	github.com/ProtonMail/go-crypto v1.1.6 // indirect
+	github.com/cloudflare/circl v1.6.3 // indirect
+	github.com/cyphar/filepath-securejoin v0.6.1 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/emirpasic/gods v1.18.1 // indirect
+	github.com/go-git/gcfg v1.5.1-0.20230307220236-3a3c6141e376 // indirect
+	github.com/go-git/go-billy/v5 v5.9.0 // indirect
+	github.com/golang/groupcache v0.0.0-20241129210726-2c02b8208cf8 // indirect
+	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
 	github.com/k2-fsa/sherpa-onnx-go v1.12.34 // indirect
 	github.com/k2-fsa/sherpa-onnx-go-linux v1.12.34 // indirect
 	github.com/k2-fsa/sherpa-onnx-go-macos v1.12.34 // indirect
 	github.com/k2-fsa/sherpa-onnx-go-windows v1.12.34 // indirect
-	github.com/yalue/onnxruntime_go v1.27.0 // indirect
-	golang.org/x/text v0.25.0 // indirect
+	github.com/kevinburke/ssh_config v1.2.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.3.0 // indirect
+	github.com/mattn/go-isatty v0.0.24 // indirect
+	github.com/ncruces/go-strftime v1.0.0 // indirect
+	github.com/pjbgf/sha1cd v0.6.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	github.com/sergi/go-diff v1.3.2-0.20230802210424-5b0b94c5c0d3 // indirect
+	github.com/skeema/knownhosts v1.3.1 // indirect
+	github.com/xanzy/ssh-agent v0.3.3 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+	gopkg.in/warnings.v0 v0.1.2 // indirect
+	modernc.org/libc v1.75.6 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.12.1 // indirect
 )
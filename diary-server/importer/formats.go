@@ -0,0 +1,197 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var errNoDate = errors.New("no date in front matter or file name")
+
+// Форматы дат в именах файлов и заголовках: 2024-03-15, 2024_03_15,
+// 20240315, 15.03.2024. Время (если есть) — 2024-03-15 09:30.
+var (
+	isoDateRe   = regexp.MustCompile(`(\d{4})[-_](\d{2})[-_](\d{2})(?:[ T_](\d{2})[:.-](\d{2}))?`)
+	compactRe   = regexp.MustCompile(`(?:^|\D)(\d{4})(\d{2})(\d{2})(?:\D|$)`)
+	dottedRe    = regexp.MustCompile(`(\d{2})\.(\d{2})\.(\d{4})(?:[ ,]+(\d{2}):(\d{2}))?`)
+	dateLineRe  = regexp.MustCompile(`^\s*#*\s*(\d{4}-\d{2}-\d{2}(?:[ T]\d{2}:\d{2})?|\d{2}\.\d{2}\.\d{4}(?:[ ,]+\d{2}:\d{2})?)\s*$`)
+	frontMatter = []byte("---")
+)
+
+// findDate ищет дату в строке (имя файла, строка текста)
+func findDate(s string) (time.Time, bool) {
+	if m := isoDateRe.FindStringSubmatch(s); m != nil {
+		return makeDate(m[1], m[2], m[3], m[4], m[5])
+	}
+	if m := dottedRe.FindStringSubmatch(s); m != nil {
+		return makeDate(m[3], m[2], m[1], m[4], m[5])
+	}
+	if m := compactRe.FindStringSubmatch(s); m != nil {
+		return makeDate(m[1], m[2], m[3], "", "")
+	}
+	return time.Time{}, false
+}
+
+func makeDate(y, mo, d, h, mi string) (time.Time, bool) {
+	if h == "" {
+		h, mi = "00", "00"
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("%s-%s-%s %s:%s", y, mo, d, h, mi), time.Local)
+	return t, err == nil
+}
+
+// --- Markdown ---
+
+type markdownMeta struct {
+	Date    string   `yaml:"date"`
+	Created string   `yaml:"created"`
+	Title   string   `yaml:"title"`
+	Tags    []string `yaml:"tags"`
+}
+
+// parseMarkdown одна запись на файл. Дата — из front matter (date или
+// created), иначе из имени файла. Заголовок — title или первый "# ".
+func parseMarkdown(source string, data []byte) ([]Item, error) {
+	var meta markdownMeta
+	body := data
+	if bytes.HasPrefix(data, frontMatter) {
+		rest := data[len(frontMatter):]
+		if end := bytes.Index(rest, []byte("\n---")); end >= 0 {
+			if err := yaml.Unmarshal(rest[:end], &meta); err != nil {
+				return nil, fmt.Errorf("front matter: %w", err)
+			}
+			body = rest[end+len("\n---"):]
+		}
+	}
+
+	it := Item{Source: source, Title: meta.Title, Tags: meta.Tags}
+	var ok bool
+	for _, v := range []string{meta.Date, meta.Created, filepath.Base(source)} {
+		if it.CreatedAt, ok = findDate(v); ok {
+			break
+		}
+	}
+	if !ok {
+		return nil, errNoDate
+	}
+
+	text := strings.TrimSpace(string(body))
+	if first, rest, _ := strings.Cut(text, "\n"); strings.HasPrefix(first, "# ") {
+		if it.Title == "" {
+			it.Title = strings.TrimSpace(first[2:])
+		}
+		text = strings.TrimSpace(rest)
+	}
+	it.Text = text
+	return []Item{it}, nil
+}
+
+// --- Day One ---
+
+type dayOneExport struct {
+	Entries []struct {
+		UUID         string   `json:"uuid"`
+		CreationDate string   `json:"creationDate"`
+		TimeZone     string   `json:"timeZone"`
+		Text         string   `json:"text"`
+		Tags         []string `json:"tags"`
+	} `json:"entries"`
+}
+
+// parseDayOne разбирает Journal.json из экспорта Day One
+func parseDayOne(source string, data []byte) ([]Item, error) {
+	var exp dayOneExport
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return nil, fmt.Errorf("day one json: %w", err)
+	}
+	if exp.Entries == nil {
+		return nil, errors.New("not a Day One export: no entries")
+	}
+
+	items := make([]Item, 0, len(exp.Entries))
+	for i, e := range exp.Entries {
+		t, err := time.Parse(time.RFC3339, e.CreationDate)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if loc, err := time.LoadLocation(e.TimeZone); err == nil && e.TimeZone != "" {
+			t = t.In(loc)
+		} else {
+			t = t.Local()
+		}
+
+		// Day One кладёт заголовок первой строкой в виде "# ..."
+		title := ""
+		text := strings.TrimSpace(dayOneUnescape(e.Text))
+		if first, rest, _ := strings.Cut(text, "\n"); strings.HasPrefix(first, "# ") {
+			title, text = strings.TrimSpace(first[2:]), strings.TrimSpace(rest)
+		}
+		items = append(items, Item{
+			Source:    fmt.Sprintf("%s#%d", source, i+1),
+			SourceID:  "dayone:" + e.UUID,
+			Title:     title,
+			Text:      text,
+			Tags:      e.Tags,
+			CreatedAt: t,
+		})
+	}
+	return items, nil
+}
+
+// dayOneUnescape убирает markdown-экранирование, которое добавляет Day One
+var dayOneEscapes = strings.NewReplacer(`\.`, ".", `\!`, "!", `\-`, "-", `\(`, "(", `\)`, ")", `\*`, "*", `\_`, "_")
+
+func dayOneUnescape(s string) string { return dayOneEscapes.Replace(s) }
+
+// --- текст ---
+
+// parseText текстовый файл: либо одна запись с датой в имени, либо
+// несколько записей, каждая начинается строкой с одной только датой.
+func parseText(source string, data []byte) ([]Item, error) {
+	var items []Item
+	var cur *Item
+	var buf []string
+
+	flush := func() {
+		if cur != nil {
+			cur.Text = strings.TrimSpace(strings.Join(buf, "\n"))
+			items = append(items, *cur)
+		}
+		buf = buf[:0]
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if dateLineRe.MatchString(line) {
+			if t, ok := findDate(line); ok {
+				flush()
+				cur = &Item{Source: fmt.Sprintf("%s#%d", source, len(items)+1), CreatedAt: t}
+				continue
+			}
+		}
+		if cur == nil && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if cur == nil {
+			// текст до первой даты — запись с датой из имени файла
+			t, ok := findDate(filepath.Base(source))
+			if !ok {
+				return nil, errNoDate
+			}
+			cur = &Item{Source: source, CreatedAt: t}
+		}
+		buf = append(buf, line)
+	}
+	flush()
+
+	if len(items) == 1 && items[0].Source != source {
+		items[0].Source = source
+	}
+	return items, nil
+}
@@ -0,0 +1,224 @@
+// Package importer перенос записей из чужих дневников: папка Markdown-файлов
+// (дата во front matter или в имени), экспорт Day One (JSON) и текстовые
+// файлы с датами. Дубликаты отсеиваются, есть пробный прогон с отчётом.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"bhl-diary/store"
+)
+
+// Статусы строк отчёта
+const (
+	StatusNew       = "new"
+	StatusImported  = "imported"
+	StatusDuplicate = "duplicate"
+	StatusSkipped   = "skipped"
+)
+
+// Item запись, найденная в источнике
+type Item struct {
+	Source    string // файл (и номер записи в нём)
+	SourceID  string // устойчивый ID в источнике (uuid Day One), если есть
+	Title     string
+	Text      string
+	Tags      []string
+	CreatedAt time.Time
+}
+
+// ReportLine результат по одной записи
+type ReportLine struct {
+	Source  string    `json:"source"`
+	Date    time.Time `json:"date"`
+	Title   string    `json:"title,omitempty"`
+	Status  string    `json:"status"`
+	Reason  string    `json:"reason,omitempty"`
+	EntryID string    `json:"entry_id,omitempty"`
+}
+
+// Report итог импорта
+type Report struct {
+	DryRun bool           `json:"dry_run"`
+	Lines  []ReportLine   `json:"lines"`
+	Counts map[string]int `json:"counts"`
+}
+
+func (r *Report) add(l ReportLine) {
+	r.Lines = append(r.Lines, l)
+	r.Counts[l.Status]++
+}
+
+// Options параметры импорта
+type Options struct {
+	User   string
+	DryRun bool
+}
+
+// Scan обходит каталог и разбирает все поддерживаемые файлы
+func Scan(dir string) ([]Item, []ReportLine, error) {
+	var items []Item
+	var skipped []ReportLine
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir // .git, .obsidian и т.п.
+			}
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var found []Item
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".md", ".markdown":
+			found, err = parseMarkdown(rel, data)
+		case ".json":
+			found, err = parseDayOne(rel, data)
+		case ".txt":
+			found, err = parseText(rel, data)
+		default:
+			return nil
+		}
+		if err != nil {
+			skipped = append(skipped, ReportLine{Source: rel, Status: StatusSkipped, Reason: err.Error()})
+			return nil
+		}
+		items = append(items, found...)
+		return nil
+	})
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+	return items, skipped, err
+}
+
+// Import сканирует каталог и переносит новые записи в хранилище.
+// Дубликат — запись того же дня с тем же текстом (без учёта регистра,
+// пробелов и пунктуации) или с тем же ID источника.
+func Import(ctx context.Context, st store.Store, dir string, opts Options) (*Report, error) {
+	items, skipped, err := Scan(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{DryRun: opts.DryRun, Counts: map[string]int{}}
+	for _, l := range skipped {
+		rep.add(l)
+	}
+
+	seen := map[string]bool{} // ключи уже существующих и уже принятых записей
+	loadedDays := map[string]bool{}
+
+	for _, it := range items {
+		line := ReportLine{Source: it.Source, Date: it.CreatedAt, Title: it.Title}
+		if strings.TrimSpace(it.Text) == "" {
+			line.Status, line.Reason = StatusSkipped, "empty text"
+			rep.add(line)
+			continue
+		}
+
+		day := dayKey(it.CreatedAt)
+		if !loadedDays[day] {
+			if err := loadDay(ctx, st, opts.User, it.CreatedAt, seen); err != nil {
+				return nil, err
+			}
+			loadedDays[day] = true
+		}
+
+		key := day + "|" + fingerprint(it.Text)
+		if seen[key] || it.SourceID != "" && seen["src|"+it.SourceID] {
+			line.Status = StatusDuplicate
+			rep.add(line)
+			continue
+		}
+		seen[key] = true
+
+		if opts.DryRun {
+			line.Status = StatusNew
+			rep.add(line)
+			continue
+		}
+
+		e := &store.Entry{
+			User:      opts.User,
+			SessionID: sessionID(it),
+			Title:     it.Title,
+			Text:      it.Text,
+			Tags:      it.Tags,
+			CreatedAt: it.CreatedAt,
+			Revisions: []store.Revision{{Kind: store.RevisionImport, Text: it.Text, Author: opts.User, CreatedAt: time.Now()}},
+		}
+		if err := st.CreateEntry(ctx, e); err != nil {
+			return nil, fmt.Errorf("%s: %w", it.Source, err)
+		}
+		if it.SourceID != "" {
+			seen["src|"+it.SourceID] = true
+		}
+		line.Status, line.EntryID = StatusImported, e.ID
+		rep.add(line)
+	}
+	return rep, nil
+}
+
+// sessionID у импортированных записей вместо сессии — источник
+func sessionID(it Item) string {
+	if it.SourceID != "" {
+		return "import:" + it.SourceID
+	}
+	return "import:" + it.Source
+}
+
+// loadDay добавляет в seen ключи записей пользователя за этот день
+func loadDay(ctx context.Context, st store.Store, user string, t time.Time, seen map[string]bool) error {
+	t = t.Local()
+	from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	entries, err := st.ListEntries(ctx, store.Filter{User: user, From: from, To: from.AddDate(0, 0, 1)})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		seen[dayKey(e.CreatedAt)+"|"+fingerprint(e.Text)] = true
+		if src, ok := strings.CutPrefix(e.SessionID, "import:"); ok {
+			seen["src|"+src] = true
+		}
+	}
+	return nil
+}
+
+// dayKey день по местному времени: хранилище не сохраняет часовой пояс
+func dayKey(t time.Time) string {
+	return t.Local().Format(time.DateOnly)
+}
+
+// fingerprint текст без регистра, пунктуации и лишних пробелов
+func fingerprint(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,267 @@
+// Package insights заголовок, краткое содержание, теги и настроение записи
+// от локальной модели. Работает фоновой задачей после сохранения записи.
+package insights
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"bhl-diary/jobs"
+	"bhl-diary/llm"
+	"bhl-diary/store"
+)
+
+// Kind вид задачи в очереди
+const Kind = "insights"
+
+// Config секция insights в config.yaml
+type Config struct {
+	Enabled  bool       `yaml:"enabled"`
+	LLM      llm.Config `yaml:"llm"`
+	MinChars int        `yaml:"min_chars"` // короче — не разбираем, по умолчанию 80
+	MaxTags  int        `yaml:"max_tags"`  // по умолчанию 5
+	Moods    []string   `yaml:"moods"`     // допустимые метки настроения
+	Prompts  Prompts    `yaml:"prompts"`
+}
+
+// Prompts шаблоны text/template. В user доступны .Text, .Title, .Date,
+// .Tags (уже стоящие), .Moods и .MaxTags.
+type Prompts struct {
+	System string `yaml:"system"`
+	User   string `yaml:"user"`
+}
+
+var defaultMoods = []string{"радость", "спокойствие", "воодушевление", "усталость", "грусть", "тревога", "раздражение", "нейтрально"}
+
+const defaultSystem = `Ты помогаешь вести личный дневник. По тексту записи ты придумываешь
+короткий заголовок, пишешь краткое содержание и подбираешь теги и настроение.
+Пиши по-русски, от первого лица автора, ничего не выдумывай.`
+
+const defaultUser = `Запись от {{.Date}}:
+"""
+{{.Text}}
+"""
+Ответь JSON:
+{"title": "заголовок до 6 слов, без точки",
+ "summary": "ровно два предложения о главном",
+ "tags": ["не больше {{.MaxTags}} тегов, одно-два слова строчными"{{if .Tags}}, кроме: {{join .Tags ", "}}{{end}}],
+ "mood": "одно из: {{join .Moods ", "}}"}`
+
+const (
+	maxTitleRunes    = 80
+	summarySentences = 2
+)
+
+// Generator спрашивает модель и чистит ответ
+type Generator struct {
+	cfg    Config
+	client *llm.Client
+	system *template.Template
+	user   *template.Template
+}
+
+func New(cfg Config) (*Generator, error) {
+	if cfg.MinChars <= 0 {
+		cfg.MinChars = 80
+	}
+	if cfg.MaxTags <= 0 {
+		cfg.MaxTags = 5
+	}
+	if len(cfg.Moods) == 0 {
+		cfg.Moods = defaultMoods
+	}
+	if cfg.Prompts.System == "" {
+		cfg.Prompts.System = defaultSystem
+	}
+	if cfg.Prompts.User == "" {
+		cfg.Prompts.User = defaultUser
+	}
+
+	funcs := template.FuncMap{"join": strings.Join}
+	system, err := template.New("system").Funcs(funcs).Parse(cfg.Prompts.System)
+	if err != nil {
+		return nil, fmt.Errorf("insights system prompt: %w", err)
+	}
+	user, err := template.New("user").Funcs(funcs).Parse(cfg.Prompts.User)
+	if err != nil {
+		return nil, fmt.Errorf("insights user prompt: %w", err)
+	}
+	return &Generator{cfg: cfg, client: llm.New(cfg.LLM), system: system, user: user}, nil
+}
+
+type promptData struct {
+	Text    string
+	Title   string
+	Date    string
+	Tags    []string
+	Moods   []string
+	MaxTags int
+}
+
+// Generate разбирает запись. Пустой результат без ошибки — запись
+// слишком короткая.
+func (g *Generator) Generate(ctx context.Context, e *store.Entry) (store.Insights, error) {
+	if utf8.RuneCountInString(strings.TrimSpace(e.Text)) < g.cfg.MinChars {
+		return store.Insights{}, nil
+	}
+
+	data := promptData{
+		Text:    e.Text,
+		Title:   e.Title,
+		Date:    e.CreatedAt.Format("02.01.2006"),
+		Tags:    e.Tags,
+		Moods:   g.cfg.Moods,
+		MaxTags: g.cfg.MaxTags,
+	}
+	var system, user strings.Builder
+	if err := g.system.Execute(&system, data); err != nil {
+		return store.Insights{}, err
+	}
+	if err := g.user.Execute(&user, data); err != nil {
+		return store.Insights{}, err
+	}
+
+	var answer struct {
+		Title   string          `json:"title"`
+		Summary string          `json:"summary"`
+		Tags    json.RawMessage `json:"tags"`
+		Mood    string          `json:"mood"`
+	}
+	if _, err := g.client.Chat(ctx, system.String(), user.String(), &answer); err != nil {
+		return store.Insights{}, err
+	}
+
+	in := store.Insights{
+		Title:   cleanTitle(answer.Title),
+		Summary: firstSentences(answer.Summary, summarySentences),
+		Tags:    g.cleanTags(answer.Tags, e.Tags),
+		Mood:    g.cleanMood(answer.Mood),
+	}
+	if in.Title == "" && in.Summary == "" {
+		return in, fmt.Errorf("llm answer has neither title nor summary")
+	}
+	return in, nil
+}
+
+func (g *Generator) Close() {
+	g.client.Close()
+}
+
+func cleanTitle(t string) string {
+	t = strings.Join(strings.Fields(t), " ")
+	t = strings.Trim(t, "\"'«»“” ")
+	t = strings.TrimRight(t, ".")
+	if utf8.RuneCountInString(t) > maxTitleRunes {
+		r := []rune(t)[:maxTitleRunes]
+		t = strings.TrimSpace(string(r)) + "…"
+	}
+	return t
+}
+
+// firstSentences не больше n предложений: модели любят дописать лишнее
+func firstSentences(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	count := 0
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' && r != '…' {
+			continue
+		}
+		next := i + utf8.RuneLen(r)
+		if next < len(text) && text[next] != ' ' {
+			continue // сокращение или многоточие
+		}
+		if count++; count == n {
+			return text[:next]
+		}
+	}
+	return text
+}
+
+// cleanTags принимает и массив, и строку через запятую; убирает уже
+// стоящие у записи теги и повторы
+func (g *Generator) cleanTags(raw json.RawMessage, existing []string) []string {
+	var list []string
+	if json.Unmarshal(raw, &list) != nil {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			list = strings.Split(s, ",")
+		}
+	}
+	seen := map[string]bool{}
+	for _, t := range existing {
+		seen[store.NormalizeTag(t)] = true
+	}
+	var out []string
+	for _, t := range list {
+		t = store.NormalizeTag(strings.Trim(t, "#\"' "))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+		if len(out) == g.cfg.MaxTags {
+			break
+		}
+	}
+	return out
+}
+
+// cleanMood только из списка; "Грусть." тоже засчитывается
+func (g *Generator) cleanMood(m string) string {
+	m = strings.ToLower(strings.Trim(m, " .!\"'"))
+	for _, allowed := range g.cfg.Moods {
+		if m == strings.ToLower(allowed) {
+			return allowed
+		}
+	}
+	return ""
+}
+
+type input struct {
+	EntryID string `json:"entry_id"`
+}
+
+// Enqueue ставит разбор записей в очередь
+func Enqueue(ctx context.Context, q *jobs.Queue, user string, ids ...string) ([]*store.Job, error) {
+	var out []*store.Job
+	for _, id := range ids {
+		data, _ := json.Marshal(input{EntryID: id})
+		j := &store.Job{User: user, Kind: Kind, Input: string(data)}
+		if err := q.Submit(ctx, j); err != nil {
+			return out, err
+		}
+		out = append(out, j)
+	}
+	return out, nil
+}
+
+// Handler обработчик задач Kind: разбор записи и сохранение результата
+func (g *Generator) Handler(st store.Store) jobs.Handler {
+	return func(ctx context.Context, j *store.Job, progress func(float64)) (string, error) {
+		var in input
+		if err := json.Unmarshal([]byte(j.Input), &in); err != nil {
+			return "", fmt.Errorf("bad job input: %w", err)
+		}
+		e, err := st.GetEntry(ctx, j.User, in.EntryID)
+		if err != nil {
+			return "", err
+		}
+		progress(10)
+
+		res, err := g.Generate(ctx, e)
+		if err != nil {
+			return "", err
+		}
+		if res.Title == "" && res.Summary == "" {
+			return "skipped: too short", nil
+		}
+		if err := st.SetInsights(ctx, j.User, e.ID, res); err != nil {
+			return "", err
+		}
+		return e.ID, nil
+	}
+}
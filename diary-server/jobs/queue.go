@@ -0,0 +1,231 @@
+// Package jobs очередь фоновых задач поверх store: задачи переживают
+// перезапуск сервера, несколько выполняются параллельно.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"bhl-diary/store"
+)
+
+// Config секция jobs в config.yaml
+type Config struct {
+	Workers     int    `yaml:"workers"`       // сколько задач выполнять одновременно, по умолчанию 1
+	UploadsDir  string `yaml:"uploads_dir"`   // куда складывать загруженное аудио, по умолчанию <storage.dir>/uploads
+	MaxUploadMB int    `yaml:"max_upload_mb"` // предел размера файла, по умолчанию 500
+}
+
+// Handler выполняет задачу своего вида. progress принимает 0..100.
+// Возвращает результат (например, ID записи). Отмена — через ctx.
+type Handler func(ctx context.Context, j *store.Job, progress func(float64)) (string, error)
+
+// Event сообщение о задаче в WebSocket пользователя
+type Event struct {
+	Type string     `json:"type"` // "job"
+	Job  *store.Job `json:"job"`
+}
+
+// как часто проверять очередь, если Submit не разбудил, и отмену
+const (
+	pollInterval     = 2 * time.Second
+	progressInterval = 500 * time.Millisecond
+)
+
+// Queue исполнитель задач
+type Queue struct {
+	st       store.Store
+	workers  int
+	handlers map[string]Handler
+	notify   func(user string, msg any)
+
+	wake chan struct{}
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc // ID → отмена выполняемой задачи
+	wg      sync.WaitGroup
+}
+
+func New(st store.Store, workers int) *Queue {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Queue{
+		st:       st,
+		workers:  workers,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, 1),
+		running:  map[string]context.CancelFunc{},
+	}
+}
+
+// Handle регистрирует обработчик вида задач; до Start
+func (q *Queue) Handle(kind string, h Handler) {
+	q.handlers[kind] = h
+}
+
+// SetNotify задаёт доставку событий пользователю, например WSHandler.Notify
+func (q *Queue) SetNotify(fn func(user string, msg any)) {
+	q.notify = fn
+}
+
+// Start возвращает в очередь прерванные задачи и запускает обработчики.
+// Остановка — отмена ctx, затем Wait.
+func (q *Queue) Start(ctx context.Context) error {
+	n, err := q.st.RequeueRunningJobs(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("🔁 Возвращено в очередь прерванных задач: %d", n)
+	}
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+	return nil
+}
+
+// Wait ждёт завершения обработчиков после отмены контекста Start
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Submit ставит задачу в очередь
+func (q *Queue) Submit(ctx context.Context, j *store.Job) error {
+	if _, ok := q.handlers[j.Kind]; !ok {
+		return fmt.Errorf("unknown job kind %q", j.Kind)
+	}
+	j.Status = store.JobQueued
+	if err := q.st.CreateJob(ctx, j); err != nil {
+		return err
+	}
+	q.publish(j)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Cancel отменяет задачу: из очереди снимает сразу, выполняемую прерывает
+func (q *Queue) Cancel(ctx context.Context, user, id string) (*store.Job, error) {
+	j, err := q.st.CancelJob(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Status == store.JobCanceled {
+		q.mu.Lock()
+		if cancel, ok := q.running[id]; ok {
+			cancel()
+		}
+		q.mu.Unlock()
+		q.publish(j)
+	}
+	return j, nil
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	defer q.wg.Done()
+
+	kinds := make([]string, 0, len(q.handlers))
+	for k := range q.handlers {
+		kinds = append(kinds, k)
+	}
+
+	for {
+		j, err := q.st.ClaimJob(ctx, kinds)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("⚠️ Очередь задач: %v", err)
+		}
+		if j != nil {
+			q.run(ctx, j)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, j *store.Job) {
+	jctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.mu.Lock()
+	q.running[j.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, j.ID)
+		q.mu.Unlock()
+	}()
+
+	log.Printf("⚙️ Задача %s (%s) запущена", j.ID, j.Kind)
+	q.publish(j)
+
+	// прогресс пишем в базу и пользователю не чаще progressInterval
+	var last time.Time
+	progress := func(p float64) {
+		if p < 0 {
+			p = 0
+		} else if p > 100 {
+			p = 100
+		}
+		if time.Since(last) < progressInterval || jctx.Err() != nil {
+			return
+		}
+		last = time.Now()
+		j.Progress = p
+		q.save(j)
+	}
+
+	result, err := q.handlers[j.Kind](jctx, j, progress)
+
+	switch {
+	case ctx.Err() != nil:
+		// сервер останавливается — задачу подхватит следующий запуск
+		j.Status, j.Progress = store.JobQueued, 0
+		log.Printf("⏸ Задача %s прервана остановкой сервера", j.ID)
+	case jctx.Err() != nil || errors.Is(err, context.Canceled):
+		j.Status = store.JobCanceled
+		log.Printf("🚫 Задача %s отменена", j.ID)
+	case err != nil:
+		j.Status, j.Error = store.JobFailed, err.Error()
+		log.Printf("❌ Задача %s: %v", j.ID, err)
+	default:
+		j.Status, j.Progress, j.Result = store.JobDone, 100, result
+		log.Printf("✅ Задача %s выполнена: %s", j.ID, result)
+	}
+	q.save(j)
+}
+
+// save сохраняет состояние задачи и сообщает о нём пользователю.
+// Отменённую задачу store не перезаписывает — тогда шлём её как есть.
+func (q *Queue) save(j *store.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// ErrJobNotFound здесь значит, что задачу уже отменили
+	if err := q.st.UpdateJob(ctx, j); err != nil && !errors.Is(err, store.ErrJobNotFound) {
+		log.Printf("⚠️ Не удалось сохранить задачу %s: %v", j.ID, err)
+		return
+	}
+	cur, err := q.st.GetJob(ctx, j.User, j.ID)
+	if err != nil {
+		return
+	}
+	q.publish(cur)
+}
+
+func (q *Queue) publish(j *store.Job) {
+	if q.notify != nil {
+		q.notify(j.User, Event{Type: "job", Job: j})
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+	"github.com/mbykov/wshandler-go"
+	"golang.org/x/term"
+)
+
+// minPassphrase короче парольную фразу не принимаем
+const minPassphrase = 8
+
+// openKeyring ключи шифрования по конфигу; nil — шифрование выключено
+func openKeyring(cfg Config) *crypt.Keyring {
+	if !cfg.Encryption.Enabled {
+		return nil
+	}
+	if !crypt.Exists(cfg.Storage.Dir) {
+		log.Fatalf("❌ Шифрование включено, но ключей в %s нет: сначала bhl-diary keys init", cfg.Storage.Dir)
+	}
+	return unlockKeyring(cfg)
+}
+
+func unlockKeyring(cfg Config) *crypt.Keyring {
+	pass, err := passphrase(cfg.Encryption, false)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	k, err := crypt.Unlock(cfg.Storage.Dir, pass)
+	if err != nil {
+		log.Fatalf("❌ Не удалось открыть ключи: %v", err)
+	}
+	return k
+}
+
+// openStore хранилище по конфигу; с включённым шифрованием — с ключами
+func openStore(cfg Config) (store.Store, *crypt.Keyring) {
+	keys := openKeyring(cfg)
+	if keys != nil {
+		cfg.Storage.Cipher = keys
+	}
+	st, err := store.Open(cfg.Storage)
+	if err != nil {
+		log.Fatalf("❌ Ошибка открытия хранилища: %v", err)
+	}
+	return st, keys
+}
+
+// passphrase парольная фраза: BHL_DIARY_PASSPHRASE, encryption.passphrase_file
+// или вопрос в терминале (confirm — спросить дважды)
+func passphrase(c crypt.Config, confirm bool) (string, error) {
+	if p := os.Getenv("BHL_DIARY_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	if c.PassphraseFile != "" {
+		data, err := os.ReadFile(c.PassphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("passphrase file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if confirm {
+		return askNew("Парольная фраза")
+	}
+	return ask("Парольная фраза: ")
+}
+
+// newPassphrase новая парольная фраза: BHL_DIARY_NEW_PASSPHRASE или дважды из терминала
+func newPassphrase() (string, error) {
+	if p := os.Getenv("BHL_DIARY_NEW_PASSPHRASE"); p != "" {
+		return checkPassphrase(p)
+	}
+	return askNew("Новая парольная фраза")
+}
+
+func askNew(prompt string) (string, error) {
+	p, err := ask(prompt + ": ")
+	if err != nil {
+		return "", err
+	}
+	again, err := ask(prompt + " ещё раз: ")
+	if err != nil {
+		return "", err
+	}
+	if p != again {
+		return "", errors.New("passphrases do not match")
+	}
+	return checkPassphrase(p)
+}
+
+func checkPassphrase(p string) (string, error) {
+	if len([]rune(p)) < minPassphrase {
+		return "", fmt.Errorf("passphrase is too short, need at least %d characters", minPassphrase)
+	}
+	return p, nil
+}
+
+// ask читает строку из терминала без эха
+func ask(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no passphrase: set BHL_DIARY_PASSPHRASE or encryption.passphrase_file")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(p), err
+}
+
+// sealAudio шифрует аудио сессии, как только оно записано: открытым WAV
+// лежит только пока идёт диктовка или расшифровка
+func sealAudio(keys *crypt.Keyring, rec wshandler.SessionRecord) {
+	if keys == nil || rec.Audio == "" {
+		return
+	}
+	if err := crypt.SealFile(keys, rec.User, rec.Audio); err != nil {
+		log.Printf("⚠️ Не удалось зашифровать аудио %s: %v (зашифруется при bhl-diary keys rotate)", rec.Audio, err)
+	}
+}
+
+// runKeys bhl-diary keys init|passwd|rotate|recover|status [-config config.yaml]
+func runKeys(args []string) {
+	if len(args) == 0 {
+		log.Fatal("❌ bhl-diary keys init|passwd|rotate|recover|status")
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("keys "+action, flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	code := fs.String("code", "", "код восстановления (для recover)")
+	fs.Parse(args[1:])
+
+	cfg := loadConfig(*configPath)
+	if cfg.Storage.Driver == "vault" {
+		log.Fatalf("❌ %v", store.ErrVaultEncrypted)
+	}
+	dir := cfg.Storage.Dir
+	argon := cfg.Encryption.Argon2
+
+	switch action {
+	case "init":
+		// init включает шифрование на уже накопленном дневнике
+		pass, err := passphrase(cfg.Encryption, true)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		k, recovery, err := crypt.Create(dir, pass, argon)
+		if err != nil {
+			log.Fatalf("❌ Не удалось создать ключи: %v", err)
+		}
+		printRecoveryCode(recovery)
+		resealAll(cfg, k)
+		if !cfg.Encryption.Enabled {
+			fmt.Fprintln(os.Stderr, "⚠️ Включите encryption.enabled: true в конфиге, иначе сервер не прочитает записи")
+		}
+
+	case "passwd":
+		k := unlockKeyring(cfg)
+		pass, err := newPassphrase()
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := k.ChangePassphrase(pass, argon); err != nil {
+			log.Fatalf("❌ Не удалось сменить парольную фразу: %v", err)
+		}
+		fmt.Fprintln(os.Stderr, "✅ Парольная фраза изменена; код восстановления прежний")
+
+	case "rotate":
+		pass, err := passphrase(cfg.Encryption, false)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		k, err := crypt.Unlock(dir, pass)
+		if err != nil {
+			log.Fatalf("❌ Не удалось открыть ключи: %v", err)
+		}
+		recovery, err := k.Rotate(pass, argon)
+		if err != nil {
+			log.Fatalf("❌ Не удалось сменить ключи: %v", err)
+		}
+		printRecoveryCode(recovery)
+		resealAll(cfg, k)
+		n, err := k.DropRetired()
+		if err != nil {
+			log.Fatalf("❌ Не удалось удалить старые ключи: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "✅ Старых ключей удалено: %d\n", n)
+
+	case "recover":
+		if *code == "" {
+			fmt.Fprint(os.Stderr, "Код восстановления: ")
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			*code = line
+		}
+		pass, err := newPassphrase()
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		_, recovery, err := crypt.Recover(dir, *code, pass, argon)
+		if err != nil {
+			log.Fatalf("❌ Не удалось восстановить доступ: %v", err)
+		}
+		fmt.Fprintln(os.Stderr, "✅ Парольная фраза заменена; старый код восстановления больше не действует")
+		printRecoveryCode(recovery)
+
+	case "status":
+		k := unlockKeyring(cfg)
+		active, retired := k.Status()
+		fmt.Printf("Ключи: %s\nПользователей: %d\nДействующих ключей: %d\nСтарых ключей: %d\n",
+			filepath.Join(dir, crypt.KeyringFile), len(k.Users()), active, retired)
+		if retired > 0 {
+			fmt.Println("⚠️ Смена ключей не закончена: повторите bhl-diary keys rotate")
+		}
+
+	default:
+		log.Fatalf("❌ Неизвестное действие %q: init, passwd, rotate, recover или status", action)
+	}
+}
+
+func printRecoveryCode(code string) {
+	fmt.Printf("\n🔑 Код восстановления: %s\n\n", code)
+	fmt.Println("Запишите его и храните отдельно от сервера. Он показывается один раз;")
+	fmt.Println("без него и без парольной фразы дневник не расшифровать.")
+	fmt.Println()
+}
+
+// resealAll шифрует действующими ключами записи, аудио и файлы индексов
+func resealAll(cfg Config, k *crypt.Keyring) {
+	c := cfg.Storage
+	c.Cipher = k
+	st, err := store.Open(c)
+	if err != nil {
+		log.Fatalf("❌ Ошибка открытия хранилища: %v", err)
+	}
+	defer st.Close()
+
+	// каталоги search.Open, analytics.Open и semantic.Open
+	dirs := []string{
+		filepath.Join(c.Dir, "index"),
+		filepath.Join(c.Dir, "stats"),
+		filepath.Join(c.Dir, "vectors"),
+	}
+	rep, err := crypt.Reseal(context.Background(), k, st, dirs...)
+	if err != nil {
+		log.Fatalf("❌ Не удалось зашифровать данные: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "✅ Зашифровано: строк %d, аудио %d, файлов индексов %d\n", rep.Rows, rep.Audio, rep.Files)
+}
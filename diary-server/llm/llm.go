@@ -0,0 +1,96 @@
+// Package llm клиент локальной модели с Ollama-совместимым /api/chat
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config как у command-qwen: модель, адрес /api/chat и таймаут
+type Config struct {
+	Model      string `yaml:"model"`
+	URL        string `yaml:"url"`         // http://localhost:11434/api/chat
+	TimeoutSec int    `yaml:"timeout_sec"` // по умолчанию 30
+}
+
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+func New(cfg Config) *Client {
+	if cfg.TimeoutSec <= 0 {
+		cfg.TimeoutSec = 30
+	}
+	return &Client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: time.Duration(cfg.TimeoutSec) * time.Second},
+	}
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Chat один запрос без потока, temperature 0. Если out не nil, модель
+// просят ответить JSON-ом (format: json) и ответ разбирается в out.
+func (c *Client) Chat(ctx context.Context, system, user string, out any) (string, error) {
+	payload := map[string]any{
+		"model":    c.cfg.Model,
+		"messages": []message{{Role: "system", Content: system}, {Role: "user", Content: user}},
+		"stream":   false,
+		"options":  map[string]any{"temperature": 0.0},
+	}
+	if out != nil {
+		payload["format"] = "json"
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("llm status %d: %s", resp.StatusCode, data)
+	}
+
+	var r struct {
+		Message message `json:"message"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return "", fmt.Errorf("parse llm response: %w", err)
+	}
+	content := strings.TrimSpace(r.Message.Content)
+	if out != nil {
+		if err := json.Unmarshal([]byte(content), out); err != nil {
+			return content, fmt.Errorf("llm answer is not the expected json: %w", err)
+		}
+	}
+	return content, nil
+}
+
+// Close закрывает простаивающие соединения
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
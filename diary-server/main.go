@@ -6,13 +6,33 @@ import (
 	"net/http"
 	"os"
 	"log"
+	"net"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"bhl-diary/accounts"
+	"bhl-diary/analytics"
+	"bhl-diary/backup"
+	"bhl-diary/api"
+	"bhl-diary/corrections"
+	"bhl-diary/crypt"
+	"bhl-diary/events"
+	"bhl-diary/insights"
+	"bhl-diary/jobs"
+	"bhl-diary/search"
+	"bhl-diary/semantic"
+	"bhl-diary/segment"
+	"bhl-diary/store"
+	"bhl-diary/transcribe"
 	"github.com/mbykov/wshandler-go"
+	"github.com/mbykov/grpchandler-go"
 	"github.com/mbykov/asr-zipformer-go"
 	"github.com/mbykov/vosk-punct"  // добавляем импорт
+	"github.com/michael/bhl-qwen-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,6 +41,8 @@ type Config struct {
 		Port string `yaml:"port"`
 		Cert string `yaml:"cert"`
 		Key  string `yaml:"key"`
+		// Порт gRPC-сервиса Recognizer; пусто — gRPC выключен
+		GRPCPort string `yaml:"grpc_port"`
 	} `yaml:"server"`
 
 	ASR struct {
@@ -32,9 +54,89 @@ type Config struct {
 	Punctuation struct {
 		ModelDir string `yaml:"model_dir"`
 	} `yaml:"punctuation"`
+
+	// Конвейер пост-обработки текста, стадии выполняются по порядку
+	Pipeline []wshandler.StageConfig `yaml:"pipeline"`
+
+	// command-qwen для математических команд; пустой url — команды выключены
+	Command command.Config `yaml:"command"`
+
+	// Обратная связь по уровню сигнала (audio_stats, audio_warning)
+	AudioStats wshandler.AudioStatsConfig `yaml:"audio_stats"`
+
+	// Абзацы по паузам и деление длинной диктовки на записи по темам
+	Segmentation struct {
+		wshandler.SegmentConfig `yaml:",inline"`
+		Topics                  segment.TopicConfig `yaml:"topics"`
+	} `yaml:"segmentation"`
+
+	// Запись аудио сессий для воспроизведения слов из дневника;
+	// dir по умолчанию <storage.dir>/audio
+	Recording wshandler.RecordingConfig `yaml:"recording"`
+
+	// Голосовая правка: "новый абзац", "удали последнее предложение" и т.п.
+	Editing wshandler.EditingConfig `yaml:"editing"`
+
+	// Хранилище записей дневника
+	Storage store.Config `yaml:"storage"`
+
+	// Шифрование записей, аудио и индексов на диске
+	Encryption crypt.Config `yaml:"encryption"`
+
+	// Резервные копии по расписанию с ротацией
+	Backup backup.Config `yaml:"backup"`
+
+	// Заголовок, краткое содержание, теги и настроение от локальной модели
+	Insights insights.Config `yaml:"insights"`
+
+	// Смысловой поиск и ответы на вопросы по дневнику
+	Semantic semantic.Config `yaml:"semantic"`
+
+	// Замены, выученные из правок пользователей
+	Corrections corrections.Config `yaml:"corrections"`
+
+	// Загрузка аудиофайлов и фоновая расшифровка
+	Jobs jobs.Config `yaml:"jobs"`
+
+	// Исходящие вебхуки на события дневника
+	Webhooks events.Config `yaml:"webhooks"`
+
+	// Выгрузка: каталог с пользовательскими шаблонами <формат>.tmpl
+	Export struct {
+		TemplatesDir string `yaml:"templates_dir"`
+	} `yaml:"export"`
+
+	// Учётные записи: вход по паролю, сессии, личные настройки диктовки
+	Accounts accounts.Config `yaml:"accounts"`
+
+	// Доступ к диктовке и подпискам; без токенов и учётных записей сервер открыт
+	Auth struct {
+		Tokens map[string]string `yaml:"tokens"` // токен → пользователь
+	} `yaml:"auth"`
+}
+
+// loadConfig читает YAML-конфиг, при ошибке завершает процесс
+func loadConfig(path string) Config {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("❌ Ошибка чтения конфига: %v", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(f, &cfg); err != nil {
+		log.Fatalf("❌ Ошибка парсинга конфига: %v", err)
+	}
+	return cfg
 }
 
 func main() {
+	// Подкоманды: bhl-diary export ... и т.п.
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			run(os.Args[2:])
+			return
+		}
+	}
+
 	// Настройка логгера
 	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, opts))
@@ -42,14 +144,7 @@ func main() {
 	log.Println("🚀 Запуск сервера дневника...")
 
 	// 1. Загрузка конфига
-	f, err := os.ReadFile("config.yaml")
-	if err != nil {
-		log.Fatalf("❌ Ошибка чтения конфига: %v", err)
-	}
-	var cfg Config
-	if err := yaml.Unmarshal(f, &cfg); err != nil {
-		log.Fatalf("❌ Ошибка парсинга конфига: %v", err)
-	}
+	cfg := loadConfig("config.yaml")
 
 	if cfg.Server.Port == "" {
 		cfg.Server.Port = "6006"
@@ -64,6 +159,7 @@ func main() {
 
 	// 3. Инициализация пунктуатора
 	var punctuator *voskpunct.Punctuator
+	var err error
 	if cfg.Punctuation.ModelDir != "" {
 		log.Printf("🔍 Загрузка пунктуатора из: %s", cfg.Punctuation.ModelDir)
 		punctuator, err = voskpunct.New(voskpunct.Config{
@@ -79,12 +175,278 @@ func main() {
 		log.Println("⚠️ Пунктуация не настроена в config.yaml")
 	}
 
-	// 4. Инициализация хендлера с передачей пунктуатора
-	wsHandler := wshandler.NewWSHandler(asrParams, punctuator)
+	// 4. Сборка конвейера пост-обработки и хендлера
+	pipeline, err := wshandler.BuildPipeline(cfg.Pipeline, punctuator)
+	if err != nil {
+		log.Fatalf("❌ Ошибка конфигурации конвейера: %v", err)
+	}
+	log.Printf("🔧 Стадии конвейера: %v", pipeline.Names())
+	wsHandler := wshandler.NewWSHandler(asrParams, pipeline)
+
+	// Хранилище: каждая сессия становится записью дневника. С шифрованием
+	// парольная фраза спрашивается здесь, до загрузки индексов.
+	baseStore, keys := openStore(cfg)
+	log.Printf("💾 Хранилище: %s", cfg.Storage.Dir)
+	if keys != nil {
+		log.Printf("🔒 Шифрование: пользователей с ключами %d", len(keys.Users()))
+	}
+
+	// Поисковый индекс обновляется на каждой записи через обёртку хранилища
+	index, err := search.Open(cfg.Storage.Dir, baseStore)
+	if err != nil {
+		log.Fatalf("❌ Ошибка открытия поискового индекса: %v", err)
+	}
+	index.SetKeyring(keys)
+
+	// Статистика письма обновляется так же — обёрткой поверх индекса
+	stats, err := analytics.Open(cfg.Storage.Dir, baseStore)
+	if err != nil {
+		log.Fatalf("❌ Ошибка открытия статистики: %v", err)
+	}
+	stats.SetKeyring(keys)
+
+	// События о записях — внешней обёрткой: их видят и правки файлов, и задачи
+	bus := events.NewBus()
+	st := events.NewStore(analytics.NewTrackedStore(search.NewIndexedStore(baseStore, index), stats), bus)
+
+	// Исходящие вебхуки: события шины с подписью, повторами и журналом недоставленных
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	webhooksDone := make(chan struct{})
+	if len(cfg.Webhooks.Hooks) > 0 {
+		if cfg.Webhooks.DeadLetter == "" {
+			cfg.Webhooks.DeadLetter = filepath.Join(cfg.Storage.Dir, "webhooks-dead.jsonl")
+		}
+		hooks, err := events.NewWebhooks(cfg.Webhooks)
+		if err != nil {
+			log.Fatalf("❌ Ошибка конфигурации вебхуков: %v", err)
+		}
+		bus.Subscribe(hooks.Handle)
+		go func() {
+			defer close(webhooksDone)
+			hooks.Run(webhooksCtx)
+		}()
+		log.Printf("🪝 Вебхуки: %d, недоставленные — в %s", len(cfg.Webhooks.Hooks), cfg.Webhooks.DeadLetter)
+	} else {
+		close(webhooksDone)
+	}
+
+	// Markdown-хранилище: правки файлов на диске проходят через обёртки,
+	// поиск и статистика видят их сразу
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	watchDone := make(chan struct{})
+	if vault, ok := baseStore.(*store.Vault); ok {
+		go func() {
+			defer close(watchDone)
+			if err := vault.Watch(watchCtx, st); err != nil {
+				log.Printf("⚠️ Слежение за хранилищем %s: %v", vault.Dir(), err)
+			}
+		}()
+		log.Printf("📁 Записи в Markdown: %s (git)", vault.Dir())
+	} else {
+		close(watchDone)
+	}
+
+	// Очередь фоновых задач: обработчики регистрируются ниже, запуск — перед HTTP
+	queue := jobs.New(st, cfg.Jobs.Workers)
+
+	// Заголовок, краткое содержание, теги и настроение новых записей
+	var gen *insights.Generator
+	if cfg.Insights.Enabled {
+		if gen, err = insights.New(cfg.Insights); err != nil {
+			log.Fatalf("❌ Ошибка конфигурации insights: %v", err)
+		}
+		queue.Handle(insights.Kind, gen.Handler(st))
+		log.Printf("✅ Разбор записей: %s (%s)", cfg.Insights.LLM.Model, cfg.Insights.LLM.URL)
+	}
+
+	// Векторы записей для смыслового поиска досчитываются фоновой задачей
+	var vectors *semantic.Index
+	var asker *semantic.Asker
+	if cfg.Semantic.Enabled {
+		emb, err := semantic.NewEmbedder(cfg.Semantic.Embeddings)
+		if err != nil {
+			log.Fatalf("❌ Ошибка загрузки модели векторов: %v", err)
+		}
+		if vectors, err = semantic.Open(cfg.Storage.Dir, st, emb); err != nil {
+			log.Fatalf("❌ Ошибка открытия векторного индекса: %v", err)
+		}
+		vectors.SetKeyring(keys)
+		queue.Handle(semantic.Kind, vectors.Handler())
+		if cfg.Semantic.LLM.URL != "" {
+			asker = semantic.NewAsker(vectors, cfg.Semantic)
+		}
+		log.Printf("✅ Смысловой поиск: %s %s", cfg.Semantic.Embeddings.Provider, cfg.Semantic.Embeddings.Model)
+	}
+
+	saved := func(user string, ids []string) {
+		if gen != nil {
+			enqueueInsights(queue, user, ids)
+		}
+		if vectors != nil {
+			enqueueEmbeddings(queue, user)
+		}
+	}
+
+	wsHandler.SetSegmentation(cfg.Segmentation.SegmentConfig)
+	var topics *segment.TopicSplitter
+	if cfg.Segmentation.Topics.Enabled {
+		topics = segment.NewTopicSplitter(cfg.Segmentation.Topics)
+		log.Printf("✅ Деление по темам: %s (%s)", cfg.Segmentation.Topics.LLM.Model, cfg.Segmentation.Topics.LLM.URL)
+	}
+	// сессии WebSocket и gRPC сохраняются в дневник одинаково
+	sessionStarted := func(s wshandler.SessionStart) {
+		bus.Publish(events.SessionStarted, s.User, events.SessionData{ID: s.ID, Started: s.Started})
+	}
+	sessionEnded := func(rec wshandler.SessionRecord) {
+		sealAudio(keys, rec)
+		ids, _ := saveSession(st, topics, rec)
+		saved(rec.User, ids)
+		bus.Publish(events.SessionEnded, rec.User, events.SessionData{ID: rec.ID, Started: rec.Started,
+			Ended: &rec.Ended, Finals: len(rec.Finals), Entries: ids})
+	}
+	commandResolved := func(c wshandler.CommandRecord) {
+		bus.Publish(events.CommandResolved, c.User, events.CommandData{Session: c.Session, Name: c.Name,
+			Text: c.Text, Script: c.Script, Raw: c.Raw, DurationMs: c.Duration.Milliseconds()})
+	}
+	wsHandler.OnSessionStart(sessionStarted)
+	wsHandler.OnSessionEnd(sessionEnded)
+	wsHandler.OnCommand(commandResolved)
+
+	// Учётные записи: свои горячие слова и стадии конвейера у каждого
+	var accts *accounts.Manager
+	if cfg.Accounts.Enabled {
+		accts = accounts.New(st, cfg.Accounts)
+		for _, user := range cfg.Auth.Tokens {
+			accts.Reserve(user)
+		}
+		wsHandler.SetUserStages(accts.Stages)
+	}
+
+	// Принятые замены пользователя — стадия corrections конвейера
+	corrector := corrections.New(st, cfg.Storage.Dir)
+	pipeline.SetCorrector(corrector)
+	var ownHotwords func(user string) []string
+	if accts != nil {
+		ownHotwords = accts.Hotwords
+	}
+	corrector.SetHotwords(cfg.Corrections.Hotwords, ownHotwords)
+	hotwords := cfg.Corrections.Hotwords || accts != nil
+	if hotwords {
+		wsHandler.SetHotwords(corrector.HotwordsFile)
+	}
+	flushCtx, stopFlush := context.WithCancel(context.Background())
+	go corrector.Run(flushCtx, 30*time.Second)
+	go index.Run(flushCtx, 30*time.Second)
+
+	if cfg.Editing.Enabled {
+		wsHandler.SetEditing(cfg.Editing)
+	}
+
+	if cfg.Recording.Enabled {
+		if cfg.Recording.Dir == "" {
+			cfg.Recording.Dir = filepath.Join(cfg.Storage.Dir, "audio")
+		}
+		wsHandler.SetRecording(cfg.Recording)
+		log.Printf("🎙 Запись аудио сессий: %s", cfg.Recording.Dir)
+	}
+
+	if cfg.AudioStats.Enabled {
+		wsHandler.SetAudioStats(cfg.AudioStats)
+	}
+
+	var auth wshandler.Authenticator
+	if len(cfg.Auth.Tokens) > 0 {
+		auth = tokenAuth(cfg.Auth.Tokens)
+		log.Printf("🔐 Доступ по токенам: %d", len(cfg.Auth.Tokens))
+	}
+	if accts != nil {
+		auth = anyAuth(auth, accts.Authenticate)
+		log.Printf("🔐 Вход по паролю, регистрация: %v", cfg.Accounts.Registration)
+	}
+	if auth != nil {
+		wsHandler.SetAuthenticator(auth)
+	}
+
+	var resolver *command.CommandResolver
+	if cfg.Command.Qwen.URL != "" {
+		resolver = command.New(cfg.Command)
+		wsHandler.SetCommandResolver(resolver, time.Duration(cfg.Command.Qwen.TimeoutSec)*time.Second)
+		log.Printf("✅ command-qwen: %s (%s)", cfg.Command.Qwen.Model, cfg.Command.Qwen.URL)
+	}
+
+	// Очередь фоновых задач: расшифровка загруженного аудио тем же
+	// распознавателем и конвейером, прогресс — в WebSocket пользователя
+	if cfg.Jobs.UploadsDir == "" {
+		cfg.Jobs.UploadsDir = filepath.Join(cfg.Storage.Dir, "uploads")
+	}
+	if cfg.Jobs.MaxUploadMB <= 0 {
+		cfg.Jobs.MaxUploadMB = 500
+	}
+	transcriber := &transcribe.Transcriber{
+		NewEngine: func(hotwords string) (transcribe.Engine, error) {
+			c := asrParams
+			c.HotwordsFile = hotwords
+			m, err := asr.New(c)
+			if err != nil {
+				return nil, err
+			}
+			return m, nil
+		},
+		Pipeline: pipeline,
+		Segment:  cfg.Segmentation.SegmentConfig,
+	}
+	if hotwords {
+		transcriber.Hotwords = corrector.HotwordsFile
+	}
+	if accts != nil {
+		transcriber.Stages = accts.Stages
+	}
+	if cfg.Recording.Enabled {
+		transcriber.AudioDir = cfg.Recording.Dir
+	}
+	queue.Handle(api.KindTranscribe, transcribeJob(st, topics, transcriber, keys, saved))
+	queue.SetNotify(wsHandler.Notify)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	if err := queue.Start(jobsCtx); err != nil {
+		log.Fatalf("❌ Ошибка запуска очереди задач: %v", err)
+	}
+	log.Printf("⚙️ Очередь задач: %d обработчиков, загрузки в %s", max(cfg.Jobs.Workers, 1), cfg.Jobs.UploadsDir)
+
+	// Резервные копии: снимок базы не мешает диктовке
+	backupCtx, stopBackup := context.WithCancel(context.Background())
+	backupDone := make(chan struct{})
+	if cfg.Backup.Dir != "" {
+		go func() {
+			defer close(backupDone)
+			backup.Run(backupCtx, backup.Source{Store: baseStore, Dir: cfg.Storage.Dir, Config: "config.yaml"}, cfg.Backup)
+		}()
+		log.Printf("💾 Резервные копии: %s", cfg.Backup.Dir)
+	} else {
+		close(backupDone)
+	}
 
 	// 5. Настройка HTTP сервера
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", wsHandler.Handle)
+	mux.HandleFunc("/subscribe", wsHandler.Subscribe)
+	mux.HandleFunc("/events", wsHandler.Events)
+	apiServer := api.New(st, api.Authenticator(auth))
+	apiServer.SetKeyring(keys)
+	apiServer.SetSearch(index)
+	apiServer.SetStats(stats)
+	apiServer.SetExport(cfg.Export.TemplatesDir)
+	apiServer.SetCorrections(corrector, cfg.Corrections.MinCount)
+	if accts != nil {
+		apiServer.SetAccounts(accts)
+	}
+	apiServer.SetUploads(queue, cfg.Jobs.UploadsDir, int64(cfg.Jobs.MaxUploadMB)<<20)
+	if gen != nil {
+		apiServer.SetInsights(queue)
+	}
+	if vectors != nil {
+		apiServer.SetSemantic(vectors, asker)
+	}
+	apiServer.Register(mux)
 
 	server := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
@@ -101,6 +463,49 @@ func main() {
 		}
 	}()
 
+	// 7. gRPC сервер рядом с WebSocket (тот же ASR, конвейер и command-qwen)
+	var grpcServer *grpc.Server
+	var grpcHandler *grpchandler.Server
+	if cfg.Server.GRPCPort != "" {
+		var opts []grpc.ServerOption
+		if cfg.Server.Cert != "" {
+			creds, err := credentials.NewServerTLSFromFile(cfg.Server.Cert, cfg.Server.Key)
+			if err != nil {
+				log.Fatalf("❌ Ошибка загрузки сертификата для gRPC: %v", err)
+			}
+			opts = append(opts, grpc.Creds(creds))
+		}
+		// тот же доступ, что у HTTP и WebSocket: пользователь — в контексте сессии
+		opts = append(opts, grpchandler.Interceptors(auth)...)
+		grpcServer = grpc.NewServer(opts...)
+		grpcHandler = grpchandler.NewServer(asrParams, pipeline)
+		grpcHandler.SetSegmentation(cfg.Segmentation.SegmentConfig)
+		grpcHandler.OnSessionStart(sessionStarted)
+		grpcHandler.OnSessionEnd(sessionEnded)
+		grpcHandler.OnCommand(commandResolved)
+		if hotwords {
+			grpcHandler.SetHotwords(corrector.HotwordsFile)
+		}
+		if accts != nil {
+			grpcHandler.SetUserStages(accts.Stages)
+		}
+		if resolver != nil {
+			grpcHandler.SetCommandResolver(resolver, time.Duration(cfg.Command.Qwen.TimeoutSec)*time.Second)
+		}
+		grpcHandler.Register(grpcServer)
+
+		lis, err := net.Listen("tcp", ":"+cfg.Server.GRPCPort)
+		if err != nil {
+			log.Fatalf("❌ Ошибка открытия порта gRPC: %v", err)
+		}
+		go func() {
+			log.Printf("🌐 Запуск gRPC на порту %s...", cfg.Server.GRPCPort)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalf("❌ Ошибка gRPC сервера: %v", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -108,16 +513,73 @@ func main() {
 
 	log.Println("🛑 Останавливаем сервер...")
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Сначала сессии: они ещё сохраняют записи, пользуясь конвейером,
+	// command-qwen и хранилищем. Shutdown не ждёт WebSocket после Upgrade.
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Ошибка при остановке: %v", err)
+	}
+	if err := wsHandler.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Не дождались сессий WebSocket: %v", err)
+	}
+	if grpcServer != nil {
+		grpcServer.Stop()
+		if err := grpcHandler.Wait(ctx); err != nil {
+			log.Printf("⚠️ Не дождались сессий gRPC: %v", err)
+		}
+	}
+
+	// прерванные задачи вернутся в очередь и продолжатся при следующем запуске
+	stopJobs()
+	queue.Wait()
+
+	// недописанная копия удаляется, следующая будет при запуске
+	stopBackup()
+	<-backupDone
+
+	if resolver != nil {
+		resolver.Close()
+	}
+	if topics != nil {
+		topics.Close()
+	}
+	if gen != nil {
+		gen.Close()
+	}
+	if asker != nil {
+		asker.Close()
+	}
+	if vectors != nil {
+		vectors.Close()
+	}
+
 	// Закрываем пунктуатор
 	if punctuator != nil {
 		punctuator.Close()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// слежение за файлами помечает индекс к записи — останавливаем его
+	// до последней выгрузки, иначе событие после неё потеряется
+	stopWatch()
+	<-watchDone
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("⚠️ Ошибка при остановке: %v", err)
+	stopFlush()
+	if err := corrector.Flush(context.Background()); err != nil {
+		log.Printf("⚠️ Не удалось сохранить срабатывания замен: %v", err)
+	}
+	if err := index.Flush(); err != nil {
+		log.Printf("⚠️ Не удалось сохранить поисковый индекс: %v", err)
+	}
+
+	// недоставленное к остановке — в журнал недоставленных
+	stopWebhooks()
+	<-webhooksDone
+
+	// Хранилище закрываем последним: завершающиеся сессии ещё пишут записи
+	if err := st.Close(); err != nil {
+		log.Printf("⚠️ Ошибка закрытия хранилища: %v", err)
 	}
 
 	log.Println("👋 Сервер остановлен")
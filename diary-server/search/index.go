@@ -0,0 +1,226 @@
+// Package search полнотекстовый поиск по записям дневника с учётом
+// русской морфологии: обратный индекс по основам слов, по одному на пользователя.
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+)
+
+// doc проиндексированная запись
+type doc struct {
+	ID      string
+	Created time.Time
+	Updated time.Time
+	Text    string
+	Length  int // число слов
+}
+
+// userIndex индекс одного пользователя; сохраняется в index/<user>.gob
+type userIndex struct {
+	Docs     map[string]*doc
+	Postings map[string]map[string][]int // основа → запись → позиции слов
+}
+
+func newUserIndex() *userIndex {
+	return &userIndex{Docs: map[string]*doc{}, Postings: map[string]map[string][]int{}}
+}
+
+func (u *userIndex) add(e *store.Entry) {
+	u.remove(e.ID)
+	toks := tokenize(e.Text)
+	u.Docs[e.ID] = &doc{ID: e.ID, Created: e.CreatedAt, Updated: e.UpdatedAt, Text: e.Text, Length: len(toks)}
+	for pos, t := range toks {
+		p := u.Postings[t.stem]
+		if p == nil {
+			p = map[string][]int{}
+			u.Postings[t.stem] = p
+		}
+		p[e.ID] = append(p[e.ID], pos)
+	}
+}
+
+func (u *userIndex) remove(id string) {
+	d, ok := u.Docs[id]
+	if !ok {
+		return
+	}
+	for _, t := range tokenize(d.Text) {
+		if p := u.Postings[t.stem]; p != nil {
+			delete(p, id)
+			if len(p) == 0 {
+				delete(u.Postings, t.stem)
+			}
+		}
+	}
+	delete(u.Docs, id)
+}
+
+// Index индексы всех пользователей. Загружаются с диска лениво и
+// сверяются с хранилищем: если записи менялись в обход индекса — переиндексация.
+// Правки копятся в памяти и пишутся на диск Flush: иначе импорт N записей
+// N раз перезаписывал бы весь индекс. Не записанное до падения догонит
+// та же сверка при следующей загрузке.
+type Index struct {
+	dir   string
+	store store.Store
+	keys  *crypt.Keyring
+
+	mu    sync.Mutex
+	users map[string]*userIndex
+	dirty map[string]bool // пользователи с незаписанными правками
+}
+
+func Open(dir string, st store.Store) (*Index, error) {
+	dir = filepath.Join(dir, "index")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create index dir: %w", err)
+	}
+	return &Index{dir: dir, store: st, users: map[string]*userIndex{}, dirty: map[string]bool{}}, nil
+}
+
+// SetKeyring шифровать файлы индекса: в них слова записей
+func (ix *Index) SetKeyring(k *crypt.Keyring) {
+	ix.keys = k
+}
+
+// user возвращает индекс пользователя; вызывать под ix.mu
+func (ix *Index) user(ctx context.Context, user string) (*userIndex, error) {
+	if u, ok := ix.users[user]; ok {
+		return u, nil
+	}
+
+	u := newUserIndex()
+	if data, err := crypt.ReadFile(ix.keys, user, ix.path(user)); err == nil {
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(u); err != nil {
+			u = newUserIndex()
+		}
+	}
+
+	fresh, err := ix.inSync(ctx, user, u)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		if u, err = ix.rebuild(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	ix.users[user] = u
+	return u, nil
+}
+
+// inSync совпадает ли индекс с хранилищем по набору записей и времени правки
+func (ix *Index) inSync(ctx context.Context, user string, u *userIndex) (bool, error) {
+	entries, err := ix.store.ListEntries(ctx, store.Filter{User: user})
+	if err != nil {
+		return false, err
+	}
+	if len(entries) != len(u.Docs) {
+		return false, nil
+	}
+	for _, e := range entries {
+		d, ok := u.Docs[e.ID]
+		if !ok || !d.Updated.Equal(e.UpdatedAt) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (ix *Index) rebuild(ctx context.Context, user string) (*userIndex, error) {
+	entries, err := ix.store.ListEntries(ctx, store.Filter{User: user})
+	if err != nil {
+		return nil, err
+	}
+	u := newUserIndex()
+	for _, e := range entries {
+		u.add(e)
+	}
+	if err := ix.save(user, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Put добавляет или обновляет запись в индексе
+func (ix *Index) Put(ctx context.Context, e *store.Entry) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	u, err := ix.user(ctx, e.User)
+	if err != nil {
+		return err
+	}
+	u.add(e)
+	ix.dirty[e.User] = true
+	return nil
+}
+
+// Delete убирает запись из индекса
+func (ix *Index) Delete(ctx context.Context, user, id string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	u, err := ix.user(ctx, user)
+	if err != nil {
+		return err
+	}
+	u.remove(id)
+	ix.dirty[user] = true
+	return nil
+}
+
+// Flush записывает на диск индексы, изменённые после прошлого Flush
+func (ix *Index) Flush() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for user := range ix.dirty {
+		if err := ix.save(user, ix.users[user]); err != nil {
+			return fmt.Errorf("save index %s: %w", user, err)
+		}
+		delete(ix.dirty, user)
+	}
+	return nil
+}
+
+// Run сбрасывает индексы на диск раз в interval до отмены ctx
+func (ix *Index) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ix.Flush(); err != nil {
+				log.Printf("⚠️ Не удалось сохранить поисковый индекс: %v", err)
+			}
+		}
+	}
+}
+
+func (ix *Index) path(user string) string {
+	if user == "" {
+		user = "_anonymous"
+	}
+	return filepath.Join(ix.dir, url.PathEscape(user)+".gob")
+}
+
+// save пишет индекс атомарно: во временный файл и rename
+func (ix *Index) save(user string, u *userIndex) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(u); err != nil {
+		return err
+	}
+	return crypt.WriteFile(ix.keys, user, ix.path(user), buf.Bytes())
+}
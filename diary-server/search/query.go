@@ -0,0 +1,188 @@
+package search
+
+import (
+	"context"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Query поисковый запрос. Text — слова (все должны встретиться, в любой форме)
+// и фразы в кавычках (слова подряд): `дача "новый забор"`.
+type Query struct {
+	User  string
+	Text  string
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// Hit найденная запись с подсвеченным фрагментом (<mark>...</mark>, HTML-экранирован)
+type Hit struct {
+	EntryID   string    `json:"entry_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Score     float64   `json:"score"`
+	Snippet   string    `json:"snippet"`
+}
+
+// snippetWords сколько слов показывать вокруг первого совпадения
+const snippetWords = 12
+
+// parseQuery делит запрос на фразы; одиночное слово — фраза из одного слова
+func parseQuery(q string) [][]string {
+	var phrases [][]string
+	parts := strings.Split(q, `"`)
+	for i, part := range parts {
+		var stems []string
+		for _, t := range tokenize(part) {
+			stems = append(stems, t.stem)
+		}
+		if i%2 == 1 {
+			if len(stems) > 0 {
+				phrases = append(phrases, stems)
+			}
+			continue
+		}
+		// вне кавычек стоп-слова не ищем, если есть что-то ещё
+		words := strings.FieldsFunc(part, func(r rune) bool { return !isWordRune(r) })
+		for j, st := range stems {
+			if len(stems) > 1 && j < len(words) && isStopWord(words[j]) {
+				continue
+			}
+			phrases = append(phrases, []string{st})
+		}
+	}
+	return phrases
+}
+
+// Search ищет записи пользователя; лучшие совпадения первыми, при равенстве — новые
+func (ix *Index) Search(ctx context.Context, q Query) ([]Hit, error) {
+	phrases := parseQuery(q.Text)
+	if len(phrases) == 0 {
+		return []Hit{}, nil
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	u, err := ix.user(ctx, q.User)
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		d     *doc
+		score float64
+		pos   map[int]bool // позиции совпавших слов
+	}
+	var matches []match
+
+	for id, d := range u.Docs {
+		if !q.From.IsZero() && d.Created.Before(q.From) || !q.To.IsZero() && !d.Created.Before(q.To) {
+			continue
+		}
+		m := match{d: d, pos: map[int]bool{}}
+		ok := true
+		for _, ph := range phrases {
+			starts := phraseStarts(u, id, ph)
+			if len(starts) == 0 {
+				ok = false
+				break
+			}
+			for _, s := range starts {
+				for k := range ph {
+					m.pos[s+k] = true
+				}
+			}
+			// tf-idf по первому слову фразы, нормированный на длину записи
+			df := float64(len(u.Postings[ph[0]]))
+			idf := math.Log(1 + float64(len(u.Docs))/df)
+			m.score += float64(len(starts)) * idf * float64(len(ph)) / math.Sqrt(float64(d.Length))
+		}
+		if ok {
+			matches = append(matches, m)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].d.Created.After(matches[j].d.Created)
+	})
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+
+	hits := make([]Hit, len(matches))
+	for i, m := range matches {
+		hits[i] = Hit{
+			EntryID:   m.d.ID,
+			CreatedAt: m.d.Created,
+			Score:     math.Round(m.score*1000) / 1000,
+			Snippet:   snippet(m.d.Text, m.pos),
+		}
+	}
+	return hits, nil
+}
+
+// phraseStarts позиции, с которых в записи идут слова фразы подряд
+func phraseStarts(u *userIndex, id string, phrase []string) []int {
+	first := u.Postings[phrase[0]][id]
+	var out []int
+	for _, start := range first {
+		ok := true
+		for k := 1; k < len(phrase) && ok; k++ {
+			ok = containsInt(u.Postings[phrase[k]][id], start+k)
+		}
+		if ok {
+			out = append(out, start)
+		}
+	}
+	return out
+}
+
+func containsInt(s []int, v int) bool {
+	i := sort.SearchInts(s, v)
+	return i < len(s) && s[i] == v
+}
+
+// snippet фрагмент текста вокруг первого совпадения с подсветкой
+func snippet(text string, pos map[int]bool) string {
+	toks := tokenize(text)
+	first := len(toks)
+	for p := range pos {
+		if p < first {
+			first = p
+		}
+	}
+	if first == len(toks) {
+		return ""
+	}
+
+	from := max(first-snippetWords/2, 0)
+	to := min(from+snippetWords, len(toks))
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("… ")
+	}
+	cursor := toks[from].start
+	for i := from; i < to; i++ {
+		t := toks[i]
+		b.WriteString(html.EscapeString(text[cursor:t.start]))
+		if pos[i] {
+			b.WriteString("<mark>" + html.EscapeString(text[t.start:t.end]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(text[t.start:t.end]))
+		}
+		cursor = t.end
+	}
+	if to < len(toks) {
+		b.WriteString(" …")
+	} else {
+		b.WriteString(html.EscapeString(text[cursor:]))
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"context"
+	"log"
+
+	"bhl-diary/store"
+)
+
+// IndexedStore обёртка над store.Store: каждая запись, правка и удаление
+// сразу отражаются в поисковом индексе.
+type IndexedStore struct {
+	store.Store
+	Index *Index
+}
+
+func NewIndexedStore(st store.Store, ix *Index) *IndexedStore {
+	return &IndexedStore{Store: st, Index: ix}
+}
+
+func (s *IndexedStore) CreateEntry(ctx context.Context, e *store.Entry) error {
+	if err := s.Store.CreateEntry(ctx, e); err != nil {
+		return err
+	}
+	s.reindex(ctx, e)
+	return nil
+}
+
+func (s *IndexedStore) UpdateEntry(ctx context.Context, e *store.Entry) error {
+	if err := s.Store.UpdateEntry(ctx, e); err != nil {
+		return err
+	}
+	s.reindex(ctx, e)
+	return nil
+}
+
+func (s *IndexedStore) DeleteEntry(ctx context.Context, user, id string) error {
+	if err := s.Store.DeleteEntry(ctx, user, id); err != nil {
+		return err
+	}
+	if err := s.Index.Delete(ctx, user, id); err != nil {
+		log.Printf("⚠️ Индекс: не удалось убрать %s: %v", id, err)
+	}
+	return nil
+}
+
+// reindex ошибка индекса не отменяет запись: при следующей загрузке
+// индекс сверится с хранилищем и перестроится
+func (s *IndexedStore) reindex(ctx context.Context, e *store.Entry) {
+	if err := s.Index.Put(ctx, e); err != nil {
+		log.Printf("⚠️ Индекс: не удалось обновить %s: %v", e.ID, err)
+	}
+}
@@ -0,0 +1,49 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball/russian"
+)
+
+// token слово текста с позицией в байтах — для подсветки
+type token struct {
+	stem       string
+	start, end int
+}
+
+// tokenize режет текст на слова и приводит их к основе (Snowball).
+// "дача", "даче", "дачу" дают одну основу "дач".
+func tokenize(text string) []token {
+	var out []token
+	start := -1
+	for i, r := range text {
+		isWord := isWordRune(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			out = append(out, token{stem: stem(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		out = append(out, token{stem: stem(text[start:]), start: start, end: len(text)})
+	}
+	return out
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func stem(word string) string {
+	w := strings.ToLower(word)
+	w = strings.ReplaceAll(w, "ё", "е")
+	return russian.Stem(w, true)
+}
+
+func isStopWord(word string) bool {
+	return russian.IsStopWord(strings.ToLower(word))
+}
@@ -0,0 +1,84 @@
+// Package segment деление продиктованной сессии на несколько записей
+// по сменам темы. Абзацы складывает wshandler, здесь решается только,
+// где между ними начинается новая запись.
+package segment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"bhl-diary/llm"
+	"bhl-diary/store"
+)
+
+// TopicConfig секция segmentation.topics в config.yaml
+type TopicConfig struct {
+	Enabled       bool       `yaml:"enabled"`
+	MinParagraphs int        `yaml:"min_paragraphs"` // короче — не делим, по умолчанию 4
+	LLM           llm.Config `yaml:"llm"`
+}
+
+const topicPrompt = `Ты делишь продиктованную запись дневника на части по темам.
+Тебе дают пронумерованные абзацы. Новая часть начинается только при явной
+смене темы: другое событие, другой день, другие люди или место.
+Продолжение той же истории — не новая тема.
+Ответь JSON: {"starts": [номера абзацев, с которых начинается новая тема]}.
+Первый абзац не указывай. Если тема одна — {"starts": []}.`
+
+// TopicSplitter спрашивает локальную модель, где в сессии сменилась тема
+type TopicSplitter struct {
+	client        *llm.Client
+	minParagraphs int
+}
+
+func NewTopicSplitter(cfg TopicConfig) *TopicSplitter {
+	if cfg.MinParagraphs <= 0 {
+		cfg.MinParagraphs = 4
+	}
+	return &TopicSplitter{client: llm.New(cfg.LLM), minParagraphs: cfg.MinParagraphs}
+}
+
+// Split делит абзацы на группы — будущие записи. При ошибке модели
+// сессия остаётся одной записью, ошибка возвращается для лога.
+func (t *TopicSplitter) Split(ctx context.Context, paras []store.Paragraph) ([][]store.Paragraph, error) {
+	whole := [][]store.Paragraph{paras}
+	if len(paras) < t.minParagraphs {
+		return whole, nil
+	}
+
+	var b strings.Builder
+	for i, p := range paras {
+		fmt.Fprintf(&b, "[%d] %s\n", i+1, p.Text)
+	}
+	var answer struct {
+		Starts []int `json:"starts"`
+	}
+	if _, err := t.client.Chat(ctx, topicPrompt, b.String(), &answer); err != nil {
+		return whole, err
+	}
+
+	// номера с 1; мусор и повторы отбрасываем
+	starts := []int{0}
+	sort.Ints(answer.Starts)
+	for _, n := range answer.Starts {
+		if i := n - 1; i > starts[len(starts)-1] && i < len(paras) {
+			starts = append(starts, i)
+		}
+	}
+
+	groups := make([][]store.Paragraph, len(starts))
+	for g, from := range starts {
+		to := len(paras)
+		if g+1 < len(starts) {
+			to = starts[g+1]
+		}
+		groups[g] = paras[from:to]
+	}
+	return groups, nil
+}
+
+func (t *TopicSplitter) Close() {
+	t.client.Close()
+}
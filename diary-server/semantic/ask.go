@@ -0,0 +1,120 @@
+package semantic
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"bhl-diary/llm"
+)
+
+const askSystem = `Ты отвечаешь на вопросы автора о его личном дневнике.
+Опирайся только на приведённые отрывки записей, ничего не выдумывай.
+Если в отрывках нет ответа, так и скажи. Отвечай по-русски, коротко,
+обращаясь к автору на «ты». После утверждения ставь номер отрывка в
+квадратных скобках, например [2].`
+
+const askUser = `Сегодня %s.
+
+Отрывки из дневника:
+%s
+Вопрос: %s
+
+Ответь JSON: {"answer": "ответ с номерами отрывков в скобках", "sources": [номера использованных отрывков]}`
+
+// noAnswer когда в дневнике не нашлось ничего близкого
+const noAnswer = "В дневнике об этом ничего не нашлось."
+
+// Citation запись, на которую опирается ответ; N — номер в тексте ответа
+type Citation struct {
+	N int `json:"n"`
+	Hit
+}
+
+// Answer ответ модели со ссылками на записи
+type Answer struct {
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+}
+
+// Asker ответы на вопросы: поиск близких записей и вопрос к модели
+type Asker struct {
+	ix       *Index
+	client   *llm.Client
+	topK     int
+	minScore float64
+	now      func() time.Time
+}
+
+func NewAsker(ix *Index, cfg Config) *Asker {
+	if cfg.TopK <= 0 {
+		cfg.TopK = 5
+	}
+	if cfg.MinScore == 0 {
+		cfg.MinScore = 0.3
+	}
+	return &Asker{ix: ix, client: llm.New(cfg.LLM), topK: cfg.TopK, minScore: cfg.MinScore, now: time.Now}
+}
+
+// Ask отвечает на вопрос по записям пользователя; k ≤ 0 — из конфига
+func (a *Asker) Ask(ctx context.Context, user, question string, k int) (*Answer, error) {
+	if k <= 0 {
+		k = a.topK
+	}
+	hits, err := a.ix.Search(ctx, user, question, k)
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range hits {
+		if h.Score < a.minScore {
+			hits = hits[:i]
+			break
+		}
+	}
+	if len(hits) == 0 {
+		return &Answer{Answer: noAnswer, Citations: []Citation{}}, nil
+	}
+
+	// отрывки в хронологическом порядке: модели так проще рассуждать о времени
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].CreatedAt.Before(hits[j].CreatedAt) })
+	var excerpts strings.Builder
+	for i, h := range hits {
+		fmt.Fprintf(&excerpts, "[%d] %s", i+1, h.CreatedAt.Format("02.01.2006"))
+		if h.Title != "" {
+			fmt.Fprintf(&excerpts, ", «%s»", h.Title)
+		}
+		fmt.Fprintf(&excerpts, ":\n%s\n\n", h.Snippet)
+	}
+	prompt := fmt.Sprintf(askUser, a.now().Format("02.01.2006"), excerpts.String(), question)
+
+	var out struct {
+		Answer  string `json:"answer"`
+		Sources []int  `json:"sources"`
+	}
+	if _, err := a.client.Chat(ctx, askSystem, prompt, &out); err != nil {
+		return nil, err
+	}
+	answer := strings.TrimSpace(out.Answer)
+	if answer == "" {
+		return nil, fmt.Errorf("llm answer is empty")
+	}
+
+	// номера, которых не было среди отрывков, отбрасываем
+	res := &Answer{Answer: answer, Citations: []Citation{}}
+	seen := map[int]bool{}
+	for _, n := range out.Sources {
+		if n < 1 || n > len(hits) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		res.Citations = append(res.Citations, Citation{N: n, Hit: hits[n-1]})
+	}
+	sort.Slice(res.Citations, func(i, j int) bool { return res.Citations[i].N < res.Citations[j].N })
+	return res, nil
+}
+
+func (a *Asker) Close() {
+	a.client.Close()
+}
@@ -0,0 +1,128 @@
+package semantic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Провайдеры векторов
+const (
+	ProviderOllama = "ollama" // Ollama-совместимый /api/embed
+	ProviderONNX   = "onnx"   // BERT-подобная модель через onnxruntime
+)
+
+// EmbedConfig откуда брать векторы
+type EmbedConfig struct {
+	Provider   string `yaml:"provider"`    // ollama (по умолчанию) или onnx
+	Model      string `yaml:"model"`       // ollama: имя модели, например bge-m3
+	URL        string `yaml:"url"`         // ollama: http://localhost:11434/api/embed
+	TimeoutSec int    `yaml:"timeout_sec"` // ollama: по умолчанию 60
+	ModelDir   string `yaml:"model_dir"`   // onnx: model.onnx и vocab.txt
+	Dim        int    `yaml:"dim"`         // onnx: размер вектора, по умолчанию 312 (rubert-tiny2)
+	MaxTokens  int    `yaml:"max_tokens"`  // onnx: длина входа, по умолчанию 512
+}
+
+// Embedder превращает тексты в векторы единичной длины
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Close()
+}
+
+// NewEmbedder создаёт провайдер по конфигу
+func NewEmbedder(cfg EmbedConfig) (Embedder, error) {
+	switch cfg.Provider {
+	case "", ProviderOllama:
+		return newOllamaEmbedder(cfg), nil
+	case ProviderONNX:
+		return newONNXEmbedder(cfg)
+	}
+	return nil, fmt.Errorf("unknown embeddings provider %q", cfg.Provider)
+}
+
+type ollamaEmbedder struct {
+	cfg  EmbedConfig
+	http *http.Client
+}
+
+func newOllamaEmbedder(cfg EmbedConfig) *ollamaEmbedder {
+	if cfg.TimeoutSec <= 0 {
+		cfg.TimeoutSec = 60
+	}
+	return &ollamaEmbedder{cfg: cfg, http: &http.Client{Timeout: time.Duration(cfg.TimeoutSec) * time.Second}}
+}
+
+// Embed один запрос на пачку: {"model", "input": [...]} → {"embeddings": [[...]]}
+func (o *ollamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": o.cfg.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read embeddings: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings status %d: %s", resp.StatusCode, data)
+	}
+
+	var r struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse embeddings: %w", err)
+	}
+	if len(r.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embeddings: got %d vectors for %d texts", len(r.Embeddings), len(texts))
+	}
+	for _, v := range r.Embeddings {
+		normalize(v)
+	}
+	return r.Embeddings, nil
+}
+
+func (o *ollamaEmbedder) Close() {
+	o.http.CloseIdleConnections()
+}
+
+// normalize приводит вектор к единичной длине: косинус становится скалярным произведением
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= n
+	}
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return float64(s)
+}
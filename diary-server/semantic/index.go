@@ -0,0 +1,289 @@
+package semantic
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"bhl-diary/crypt"
+	"bhl-diary/store"
+)
+
+// chunkChars примерный размер фрагмента записи: абзацы склеиваются, пока влезают
+const chunkChars = 1000
+
+// embedBatch сколько фрагментов отправлять в модель за раз
+const embedBatch = 16
+
+// chunk фрагмент записи с вектором
+type chunk struct {
+	Text   string
+	Vector []float32
+}
+
+// vdoc векторы одной записи; Updated — по нему понятно, что запись устарела
+type vdoc struct {
+	ID      string
+	Created time.Time
+	Updated time.Time
+	Title   string
+	Chunks  []chunk
+}
+
+// userVectors векторы одного пользователя; сохраняются в vectors/<user>.gob
+type userVectors struct {
+	Docs map[string]*vdoc
+}
+
+// Hit запись, близкая по смыслу к запросу; Snippet — лучший её фрагмент
+type Hit struct {
+	EntryID   string    `json:"entry_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Title     string    `json:"title,omitempty"`
+	Snippet   string    `json:"snippet"`
+	Score     float64   `json:"score"`
+}
+
+// Index векторный индекс записей. В отличие от полнотекстового, векторы
+// считаются не в момент сохранения записи (модель медленная), а догоняют
+// хранилище в Sync — из фоновой задачи или перед поиском.
+type Index struct {
+	dir   string
+	store store.Store
+	emb   Embedder
+	keys  *crypt.Keyring
+
+	mu    sync.Mutex
+	users map[string]*userVectors
+}
+
+func Open(dir string, st store.Store, emb Embedder) (*Index, error) {
+	dir = filepath.Join(dir, "vectors")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create vectors dir: %w", err)
+	}
+	return &Index{dir: dir, store: st, emb: emb, users: map[string]*userVectors{}}, nil
+}
+
+// SetKeyring шифровать файлы векторов: в них фрагменты записей
+func (ix *Index) SetKeyring(k *crypt.Keyring) {
+	ix.keys = k
+}
+
+// user векторы пользователя с диска; вызывать под ix.mu
+func (ix *Index) user(user string) *userVectors {
+	if u, ok := ix.users[user]; ok {
+		return u
+	}
+	u := &userVectors{Docs: map[string]*vdoc{}}
+	if data, err := crypt.ReadFile(ix.keys, user, ix.path(user)); err == nil {
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(u); err != nil || u.Docs == nil {
+			u = &userVectors{Docs: map[string]*vdoc{}}
+		}
+	}
+	ix.users[user] = u
+	return u
+}
+
+// Sync досчитывает векторы новых и изменённых записей и убирает удалённые.
+// Возвращает число пересчитанных записей.
+func (ix *Index) Sync(ctx context.Context, user string) (int, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	entries, err := ix.store.ListEntries(ctx, store.Filter{User: user})
+	if err != nil {
+		return 0, err
+	}
+	u := ix.user(user)
+
+	live := make(map[string]bool, len(entries))
+	var stale []*store.Entry
+	for _, e := range entries {
+		live[e.ID] = true
+		if d, ok := u.Docs[e.ID]; !ok || !d.Updated.Equal(e.UpdatedAt) || d.Title != e.Title {
+			stale = append(stale, e)
+		}
+	}
+	changed := false
+	for id := range u.Docs {
+		if !live[id] {
+			delete(u.Docs, id)
+			changed = true
+		}
+	}
+
+	for _, e := range stale {
+		d, err := ix.embedEntry(ctx, e)
+		if err != nil {
+			if changed {
+				ix.save(user, u)
+			}
+			return 0, err
+		}
+		u.Docs[e.ID] = d
+		changed = true
+	}
+	if !changed {
+		return 0, nil
+	}
+	return len(stale), ix.save(user, u)
+}
+
+func (ix *Index) embedEntry(ctx context.Context, e *store.Entry) (*vdoc, error) {
+	d := &vdoc{ID: e.ID, Created: e.CreatedAt, Updated: e.UpdatedAt, Title: e.Title}
+	texts := chunks(e.Text)
+	if len(texts) == 0 {
+		return d, nil
+	}
+
+	// заголовок помогает модели понять, о чём запись, — добавляем к первому фрагменту
+	inputs := append([]string(nil), texts...)
+	if e.Title != "" {
+		inputs[0] = e.Title + "\n" + inputs[0]
+	}
+	for from := 0; from < len(inputs); from += embedBatch {
+		to := min(from+embedBatch, len(inputs))
+		vecs, err := ix.emb.Embed(ctx, inputs[from:to])
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vecs {
+			d.Chunks = append(d.Chunks, chunk{Text: texts[from+i], Vector: v})
+		}
+	}
+	return d, nil
+}
+
+// Search k записей, ближайших к запросу; у каждой записи считается лучший фрагмент
+func (ix *Index) Search(ctx context.Context, user, q string, k int) ([]Hit, error) {
+	if k <= 0 {
+		k = 5
+	}
+	vecs, err := ix.emb.Embed(ctx, []string{q})
+	if err != nil {
+		return nil, err
+	}
+	qv := vecs[0]
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var hits []Hit
+	for _, d := range ix.user(user).Docs {
+		best, score := -1, 0.0
+		for i, c := range d.Chunks {
+			if s := dot(qv, c.Vector); best < 0 || s > score {
+				best, score = i, s
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		hits = append(hits, Hit{
+			EntryID:   d.ID,
+			CreatedAt: d.Created,
+			Title:     d.Title,
+			Snippet:   d.Chunks[best].Text,
+			Score:     score,
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].CreatedAt.After(hits[j].CreatedAt)
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// chunks режет текст по абзацам; слишком длинный абзац — по предложениям
+func chunks(text string) []string {
+	var out []string
+	var cur strings.Builder
+	size := 0 // символов в cur
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			out = append(out, s)
+		}
+		cur.Reset()
+		size = 0
+	}
+	add := func(part, sep string) {
+		n := utf8.RuneCountInString(part)
+		if size > 0 && size+1+n > chunkChars {
+			flush()
+		}
+		size += n + 1
+		if cur.Len() > 0 {
+			cur.WriteString(sep)
+		}
+		cur.WriteString(part)
+	}
+
+	for _, para := range strings.Split(text, "\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if utf8.RuneCountInString(para) <= chunkChars {
+			add(para, "\n")
+			continue
+		}
+		for _, s := range sentences(para) {
+			add(s, " ")
+		}
+	}
+	flush()
+	return out
+}
+
+func sentences(text string) []string {
+	var out []string
+	start := 0
+	for i, r := range text {
+		if r == '.' || r == '!' || r == '?' || r == '…' {
+			end := i + len(string(r))
+			if s := strings.TrimSpace(text[start:end]); s != "" {
+				out = append(out, s)
+			}
+			start = end
+		}
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+func (ix *Index) path(user string) string {
+	if user == "" {
+		user = "_anonymous"
+	}
+	return filepath.Join(ix.dir, url.PathEscape(user)+".gob")
+}
+
+// save пишет векторы атомарно: во временный файл и rename
+func (ix *Index) save(user string, u *userVectors) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(u); err != nil {
+		return err
+	}
+	return crypt.WriteFile(ix.keys, user, ix.path(user), buf.Bytes())
+}
+
+// Close освобождает модель векторов
+func (ix *Index) Close() {
+	ix.emb.Close()
+}
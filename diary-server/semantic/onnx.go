@@ -0,0 +1,144 @@
+package semantic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	tokenizer "github.com/Hank-Kuo/go-bert-tokenizer"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// onnxEmbedder BERT-подобная модель (например, rubert-tiny2), выгруженная
+// в ONNX: входы input_ids, attention_mask, token_type_ids, выход
+// last_hidden_state; вектор — среднее по токенам. Как и у vosk-punct,
+// библиотека onnxruntime берётся из $ORT_HOME/lib.
+type onnxEmbedder struct {
+	session   *ort.DynamicSession[int64, float32]
+	tokenizer *tokenizer.FullTokenizer
+	dim       int
+	seqLen    int
+	mu        sync.Mutex
+}
+
+func newONNXEmbedder(cfg EmbedConfig) (*onnxEmbedder, error) {
+	if cfg.Dim <= 0 {
+		cfg.Dim = 312
+	}
+	if cfg.MaxTokens <= 0 {
+		cfg.MaxTokens = 512
+	}
+
+	ortHome := os.Getenv("ORT_HOME")
+	if ortHome == "" {
+		return nil, fmt.Errorf("onnx embeddings: ORT_HOME is not set")
+	}
+	ort.SetSharedLibraryPath(filepath.Join(ortHome, "lib", "libonnxruntime.so"))
+	if !ort.IsInitialized() {
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := ort.NewDynamicSession[int64, float32](
+		filepath.Join(cfg.ModelDir, "model.onnx"),
+		[]string{"input_ids", "attention_mask", "token_type_ids"},
+		[]string{"last_hidden_state"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("onnx embeddings: %w", err)
+	}
+	vocab, err := tokenizer.FromFile(filepath.Join(cfg.ModelDir, "vocab.txt"))
+	if err != nil {
+		session.Destroy()
+		return nil, err
+	}
+
+	return &onnxEmbedder{
+		session:   session,
+		tokenizer: tokenizer.NewFullTokenizer(vocab, cfg.MaxTokens, true),
+		dim:       cfg.Dim,
+		seqLen:    cfg.MaxTokens,
+	}, nil
+}
+
+func (o *onnxEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		v, err := o.embed(text)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (o *onnxEmbedder) embed(text string) ([]float32, error) {
+	enc := o.tokenizer.Tokenize(text)
+
+	// хвост из паддинга модели не нужен
+	n := 0
+	for n < len(enc.MaskIDs) && enc.MaskIDs[n] == 1 {
+		n++
+	}
+	shape := ort.NewShape(1, int64(n))
+	ids, err := ort.NewTensor(shape, toInt64(enc.TokenIDs[:n]))
+	if err != nil {
+		return nil, err
+	}
+	defer ids.Destroy()
+	mask, err := ort.NewTensor(shape, toInt64(enc.MaskIDs[:n]))
+	if err != nil {
+		return nil, err
+	}
+	defer mask.Destroy()
+	types, err := ort.NewTensor(shape, toInt64(enc.TypeIDs[:n]))
+	if err != nil {
+		return nil, err
+	}
+	defer types.Destroy()
+
+	hidden, err := ort.NewEmptyTensor[float32](ort.NewShape(1, int64(n), int64(o.dim)))
+	if err != nil {
+		return nil, err
+	}
+	defer hidden.Destroy()
+
+	if err := o.session.Run([]*ort.Tensor[int64]{ids, mask, types}, []*ort.Tensor[float32]{hidden}); err != nil {
+		return nil, fmt.Errorf("onnx embeddings: %w", err)
+	}
+
+	data := hidden.GetData()
+	v := make([]float32, o.dim)
+	for t := 0; t < n; t++ {
+		for d := 0; d < o.dim; d++ {
+			v[d] += data[t*o.dim+d]
+		}
+	}
+	for d := range v {
+		v[d] /= float32(n)
+	}
+	normalize(v)
+	return v, nil
+}
+
+func (o *onnxEmbedder) Close() {
+	o.session.Destroy()
+}
+
+func toInt64(s []int32) []int64 {
+	out := make([]int64, len(s))
+	for i, v := range s {
+		out[i] = int64(v)
+	}
+	return out
+}
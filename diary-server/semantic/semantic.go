@@ -0,0 +1,45 @@
+// Package semantic смысловой поиск и ответы на вопросы по дневнику:
+// векторы фрагментов записей, индекс с косинусной близостью и RAG
+// поверх локальной модели.
+package semantic
+
+import (
+	"context"
+	"strconv"
+
+	"bhl-diary/jobs"
+	"bhl-diary/llm"
+	"bhl-diary/store"
+)
+
+// Kind вид задачи в очереди: досчитать векторы пользователя
+const Kind = "embed"
+
+// Config секция semantic в config.yaml
+type Config struct {
+	Enabled    bool        `yaml:"enabled"`
+	Embeddings EmbedConfig `yaml:"embeddings"`
+	LLM        llm.Config  `yaml:"llm"`       // модель для ответов на вопросы
+	TopK       int         `yaml:"top_k"`     // сколько записей давать модели, по умолчанию 5
+	MinScore   float64     `yaml:"min_score"` // отсекать фрагменты с меньшей близостью, по умолчанию 0.3
+}
+
+// Enqueue ставит пересчёт векторов пользователя в очередь
+func Enqueue(ctx context.Context, q *jobs.Queue, user string) (*store.Job, error) {
+	j := &store.Job{User: user, Kind: Kind, Input: "{}"}
+	if err := q.Submit(ctx, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Handler обработчик задач Kind; результат — число пересчитанных записей
+func (ix *Index) Handler() jobs.Handler {
+	return func(ctx context.Context, j *store.Job, progress func(float64)) (string, error) {
+		n, err := ix.Sync(ctx, j.User)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(n), nil
+	}
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SetAudioChecksum запоминает контрольную сумму файла аудио
+func (s *SQLite) SetAudioChecksum(ctx context.Context, a *AudioFile) error {
+	if a.CheckedAt.IsZero() {
+		a.CheckedAt = time.Now()
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO audio_checksums (path, user, sha256, size, checked_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET user = excluded.user, sha256 = excluded.sha256, size = excluded.size, checked_at = excluded.checked_at`,
+		a.Path, a.User, a.SHA256, a.Size, a.CheckedAt.UnixNano(),
+	); err != nil {
+		return fmt.Errorf("set audio checksum: %w", err)
+	}
+	return nil
+}
+
+// ListAudioFiles аудио всех записей с контрольными суммами. Не в пределах
+// пользователя: нужно проверке и резервному копированию всего дневника.
+func (s *SQLite) ListAudioFiles(ctx context.Context) ([]AudioFile, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT e.audio, MIN(e.user), COALESCE(c.sha256, ''), COALESCE(c.size, 0), COALESCE(c.checked_at, 0)
+		FROM entries e LEFT JOIN audio_checksums c ON c.path = e.audio
+		WHERE e.audio != '' GROUP BY e.audio ORDER BY e.audio`)
+	if err != nil {
+		return nil, fmt.Errorf("list audio: %w", err)
+	}
+	defer rows.Close()
+
+	var out []AudioFile
+	for rows.Next() {
+		var a AudioFile
+		var checked int64
+		if err := rows.Scan(&a.Path, &a.User, &a.SHA256, &a.Size, &checked); err != nil {
+			return nil, err
+		}
+		if checked > 0 {
+			a.CheckedAt = time.Unix(0, checked)
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// RecordAudio считает и запоминает контрольную сумму аудио записи: после
+// сохранения сессии и после перешифровки
+func RecordAudio(ctx context.Context, st Store, user, path string) error {
+	sum, size, err := FileChecksum(path)
+	if err != nil {
+		return err
+	}
+	return st.SetAudioChecksum(ctx, &AudioFile{Path: path, User: user, SHA256: sum, Size: size})
+}
+
+// FileChecksum SHA-256 файла в hex и его размер
+func FileChecksum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Cipher шифрует текст дневника перед записью на диск; реализация —
+// crypt.Keyring. Данные одного пользователя другим ключом не открываются.
+type Cipher interface {
+	Seal(user string, plain []byte) ([]byte, error)
+	Open(user string, sealed []byte) ([]byte, error)
+}
+
+// SealedPrefix так начинается зашифрованное значение столбца. Пустые
+// строки не шифруются: по ним видно только, что поле не заполнено.
+const SealedPrefix = "enc1:"
+
+// seal шифрует значения для пользователя на месте
+func (s *SQLite) seal(user string, values ...*string) error {
+	if s.cipher == nil {
+		return nil
+	}
+	for _, v := range values {
+		if *v == "" {
+			continue
+		}
+		b, err := s.cipher.Seal(user, []byte(*v))
+		if err != nil {
+			return fmt.Errorf("encrypt: %w", err)
+		}
+		*v = SealedPrefix + base64.RawStdEncoding.EncodeToString(b)
+	}
+	return nil
+}
+
+// open расшифровывает значения на месте; незашифрованные (записи до
+// включения шифрования) остаются как есть
+func (s *SQLite) open(user string, values ...*string) error {
+	for _, v := range values {
+		enc, ok := strings.CutPrefix(*v, SealedPrefix)
+		if !ok {
+			continue
+		}
+		if s.cipher == nil {
+			return ErrEncrypted
+		}
+		b, err := base64.RawStdEncoding.DecodeString(enc)
+		if err != nil {
+			return fmt.Errorf("decrypt: %w", err)
+		}
+		if b, err = s.cipher.Open(user, b); err != nil {
+			return fmt.Errorf("decrypt: %w", err)
+		}
+		*v = string(b)
+	}
+	return nil
+}
+
+// sealedColumns зашифрованные столбцы и чей это текст
+var sealedColumns = []struct {
+	table   string
+	user    string
+	columns []string
+}{
+	{"entries", "user", []string{"title", "text", "summary"}},
+	{"finals", "(SELECT user FROM entries WHERE id = entry_id)", []string{"text", "raw", "script", "words"}},
+	{"paragraphs", "(SELECT user FROM entries WHERE id = entry_id)", []string{"text"}},
+	{"revisions", "(SELECT user FROM entries WHERE id = entry_id)", []string{"text"}},
+	{"tasks", "user", []string{"text", "source"}},
+}
+
+// Reseal перешифровывает все зашифрованные столбцы действующими ключами,
+// незашифрованные — шифрует. Нужен после смены ключей и при включении
+// шифрования на уже накопленном дневнике. Возвращает число строк.
+func (s *SQLite) Reseal(ctx context.Context) (int, error) {
+	if s.cipher == nil {
+		return 0, fmt.Errorf("reseal: no cipher")
+	}
+	type row struct {
+		id     int64
+		user   string
+		values []string
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	total := 0
+	for _, t := range sealedColumns {
+		rows, err := tx.QueryContext(ctx, `SELECT rowid, `+t.user+`, `+strings.Join(t.columns, ", ")+` FROM `+t.table)
+		if err != nil {
+			return 0, fmt.Errorf("reseal %s: %w", t.table, err)
+		}
+		var all []row
+		for rows.Next() {
+			r := row{values: make([]string, len(t.columns))}
+			dest := []any{&r.id, &r.user}
+			for i := range r.values {
+				dest = append(dest, &r.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			all = append(all, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		set := strings.Join(t.columns, " = ?, ") + " = ?"
+		for _, r := range all {
+			ptrs := make([]*string, len(r.values))
+			for i := range r.values {
+				ptrs[i] = &r.values[i]
+			}
+			if err := s.open(r.user, ptrs...); err != nil {
+				return 0, fmt.Errorf("reseal %s: %w", t.table, err)
+			}
+			// open вернул открытый текст — seal зашифрует его заново
+			if err := s.seal(r.user, ptrs...); err != nil {
+				return 0, err
+			}
+			args := make([]any, 0, len(r.values)+1)
+			for _, v := range r.values {
+				args = append(args, v)
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE `+t.table+` SET `+set+` WHERE rowid = ?`, append(args, r.id)...); err != nil {
+				return 0, fmt.Errorf("reseal %s: %w", t.table, err)
+			}
+			total++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	// прежний текст остаётся в свободных страницах базы и в WAL, пока их
+	// не перепишет VACUUM и не сбросит checkpoint
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return total, fmt.Errorf("vacuum: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return total, fmt.Errorf("checkpoint: %w", err)
+	}
+	return total, nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const jobColumns = `SELECT id, user, kind, input, status, progress, error, result, created_at, updated_at FROM jobs`
+
+func scanJob(row rowScanner) (*Job, error) {
+	j := &Job{}
+	var created, updated int64
+	if err := row.Scan(&j.ID, &j.User, &j.Kind, &j.Input, &j.Status, &j.Progress, &j.Error, &j.Result, &created, &updated); err != nil {
+		return nil, err
+	}
+	j.CreatedAt = time.Unix(0, created)
+	j.UpdatedAt = time.Unix(0, updated)
+	return j, nil
+}
+
+// CreateJob ставит задачу в очередь
+func (s *SQLite) CreateJob(ctx context.Context, j *Job) error {
+	if j.CreatedAt.IsZero() {
+		j.CreatedAt = time.Now()
+	}
+	j.UpdatedAt = j.CreatedAt
+	if j.ID == "" {
+		j.ID = NewID(j.CreatedAt)
+	}
+	if j.Status == "" {
+		j.Status = JobQueued
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO jobs (id, user, kind, input, status, progress, error, result, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		j.ID, j.User, j.Kind, j.Input, j.Status, j.Progress, j.Error, j.Result, j.CreatedAt.UnixNano(), j.UpdatedAt.UnixNano(),
+	); err != nil {
+		return fmt.Errorf("insert job: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetJob(ctx context.Context, user, id string) (*Job, error) {
+	j, err := scanJob(s.db.QueryRowContext(ctx, jobColumns+` WHERE user = ? AND id = ?`, user, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get job: %w", err)
+	}
+	return j, nil
+}
+
+// ListJobs задачи пользователя, новые первыми
+func (s *SQLite) ListJobs(ctx context.Context, user string, limit int) ([]*Job, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, jobColumns+` WHERE user = ? ORDER BY created_at DESC, id DESC LIMIT ?`, user, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// UpdateJob сохраняет статус, прогресс, ошибку и результат. Отменённую
+// задачу не перезаписывает: отмена могла прийти, пока задача работала.
+func (s *SQLite) UpdateJob(ctx context.Context, j *Job) error {
+	j.UpdatedAt = time.Now()
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, progress = ?, error = ?, result = ?, updated_at = ?
+		WHERE user = ? AND id = ? AND (status != ? OR ? = ?)`,
+		j.Status, j.Progress, j.Error, j.Result, j.UpdatedAt.UnixNano(), j.User, j.ID, JobCanceled, j.Status, JobCanceled,
+	)
+	if err != nil {
+		return fmt.Errorf("update job: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// ClaimJob атомарно берёт самую старую задачу из очереди и переводит
+// её в running. Нет задач — nil без ошибки.
+func (s *SQLite) ClaimJob(ctx context.Context, kinds []string) (*Job, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	args := []any{JobRunning, time.Now().UnixNano(), JobQueued}
+	for _, k := range kinds {
+		args = append(args, k)
+	}
+	q := `UPDATE jobs SET status = ?, updated_at = ?
+		WHERE id = (SELECT id FROM jobs WHERE status = ? AND kind IN (?` + strings.Repeat(", ?", len(kinds)-1) + `)
+			ORDER BY created_at, id LIMIT 1)
+		RETURNING id, user, kind, input, status, progress, error, result, created_at, updated_at`
+	j, err := scanJob(s.db.QueryRowContext(ctx, q, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim job: %w", err)
+	}
+	return j, nil
+}
+
+// CancelJob помечает задачу отменённой, если она ещё не завершилась.
+// Возвращает задачу с новым статусом; завершённую — как есть.
+func (s *SQLite) CancelJob(ctx context.Context, user, id string) (*Job, error) {
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, updated_at = ? WHERE user = ? AND id = ? AND status IN (?, ?)`,
+		JobCanceled, time.Now().UnixNano(), user, id, JobQueued, JobRunning,
+	); err != nil {
+		return nil, fmt.Errorf("cancel job: %w", err)
+	}
+	return s.GetJob(ctx, user, id)
+}
+
+// RequeueRunningJobs возвращает в очередь задачи, прерванные остановкой
+// сервера. Вызывается при старте, до запуска обработчиков.
+func (s *SQLite) RequeueRunningJobs(ctx context.Context) (int, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE jobs SET status = ?, progress = 0, updated_at = ? WHERE status = ?`,
+		JobQueued, time.Now().UnixNano(), JobRunning)
+	if err != nil {
+		return 0, fmt.Errorf("requeue jobs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
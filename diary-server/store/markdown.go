@@ -0,0 +1,107 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatter YAML-шапка файла записи в Markdown-хранилище. Владелец
+// записи — по каталогу файла, в шапке его нет.
+type frontMatter struct {
+	ID      string    `yaml:"id,omitempty"`
+	Created time.Time `yaml:"created,omitempty"`
+	Title   string    `yaml:"title,omitempty"`
+	Tags    []string  `yaml:"tags,omitempty"`
+	Session string    `yaml:"session,omitempty"`
+	Audio   string    `yaml:"audio,omitempty"`
+}
+
+var yearDir = regexp.MustCompile(`^\d{4}$`)
+
+// vaultPath путь файла записи в хранилище: [<user>/]YYYY/MM/<id>.md
+func vaultPath(e *Entry) string {
+	p := path.Join(e.CreatedAt.Format("2006"), e.CreatedAt.Format("01"), e.ID+".md")
+	if e.User != "" {
+		p = path.Join(e.User, p)
+	}
+	return p
+}
+
+// vaultUser владелец файла по пути. Записи — только под каталогом года
+// (или <user>/год): заметки и шаблоны в других местах не трогаются.
+func vaultUser(rel string) (string, bool) {
+	if !strings.HasSuffix(rel, ".md") {
+		return "", false
+	}
+	parts := strings.Split(rel, "/")
+	for _, p := range parts {
+		if strings.HasPrefix(p, ".") {
+			return "", false
+		}
+	}
+	switch {
+	case len(parts) >= 2 && yearDir.MatchString(parts[0]):
+		return "", true
+	case len(parts) >= 3 && yearDir.MatchString(parts[1]):
+		return parts[0], true
+	}
+	return "", false
+}
+
+// renderMarkdown файл записи: шапка и текст
+func renderMarkdown(e *Entry) ([]byte, error) {
+	fm := frontMatter{
+		ID:      e.ID,
+		Created: e.CreatedAt.Truncate(time.Second),
+		Title:   e.Title,
+		Tags:    e.Tags,
+		Session: e.SessionID,
+		Audio:   e.Audio,
+	}
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(fm); err != nil {
+		return nil, err
+	}
+	enc.Close()
+	b.WriteString("---\n\n")
+	b.WriteString(e.Text)
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// parseMarkdown шапка и текст файла; файл без шапки — один текст.
+// Теги в стиле Obsidian (#тег) приводятся к обычным.
+func parseMarkdown(data []byte) (frontMatter, string, error) {
+	var fm frontMatter
+	s := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(s, "---\n"); ok {
+		head, body, found := strings.Cut(rest, "\n---\n")
+		if !found {
+			head, found = strings.CutSuffix(rest, "\n---")
+		}
+		if !found {
+			return fm, "", fmt.Errorf("front matter is not closed")
+		}
+		if err := yaml.Unmarshal([]byte(head), &fm); err != nil {
+			return fm, "", fmt.Errorf("front matter: %w", err)
+		}
+		s = body
+	}
+	tags := fm.Tags[:0]
+	for _, t := range fm.Tags {
+		if t = NormalizeTag(strings.TrimPrefix(t, "#")); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	fm.Tags = tags
+	return fm, strings.TrimSpace(s), nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations схема по версиям. Только добавлять в конец, не править старые.
+var migrations = []string{
+	// 1: записи и их фразы
+	`CREATE TABLE entries (
+		id         TEXT PRIMARY KEY,
+		user       TEXT NOT NULL,
+		session_id TEXT NOT NULL DEFAULT '',
+		title      TEXT NOT NULL DEFAULT '',
+		text       TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX entries_user_created ON entries(user, created_at);
+	CREATE TABLE finals (
+		entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		seq      INTEGER NOT NULL,
+		type     TEXT NOT NULL,
+		text     TEXT NOT NULL DEFAULT '',
+		name     TEXT NOT NULL DEFAULT '',
+		script   TEXT NOT NULL DEFAULT '',
+		at       INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, seq)
+	);`,
+
+	// 2: теги
+	`CREATE TABLE entry_tags (
+		entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		tag      TEXT NOT NULL,
+		PRIMARY KEY (entry_id, tag)
+	);
+	CREATE INDEX entry_tags_tag ON entry_tags(tag);`,
+
+	// 3: сырой текст распознавателя и история правок
+	`ALTER TABLE finals ADD COLUMN raw TEXT NOT NULL DEFAULT '';
+	CREATE TABLE revisions (
+		entry_id      TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		n             INTEGER NOT NULL,
+		kind          TEXT NOT NULL,
+		text          TEXT NOT NULL DEFAULT '',
+		author        TEXT NOT NULL DEFAULT '',
+		restored_from INTEGER NOT NULL DEFAULT 0,
+		created_at    INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, n)
+	);
+	INSERT INTO revisions (entry_id, n, kind, text, author, created_at)
+		SELECT id, 1, 'created', text, user, created_at FROM entries;`,
+
+	// 4: замены, выученные из правок
+	`CREATE TABLE correction_rules (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		user        TEXT NOT NULL,
+		from_text   TEXT NOT NULL,
+		to_text     TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		hits        INTEGER NOT NULL DEFAULT 0,
+		created_at  INTEGER NOT NULL,
+		last_hit_at INTEGER NOT NULL DEFAULT 0,
+		UNIQUE (user, from_text)
+	);`,
+
+	// 5: абзацы записи; у старых записей они собираются из текста при чтении
+	`CREATE TABLE paragraphs (
+		entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		seq      INTEGER NOT NULL,
+		text     TEXT NOT NULL,
+		start_at INTEGER NOT NULL DEFAULT 0,
+		end_at   INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (entry_id, seq)
+	);`,
+
+	// 6: очередь фоновых задач
+	`CREATE TABLE jobs (
+		id         TEXT PRIMARY KEY,
+		user       TEXT NOT NULL,
+		kind       TEXT NOT NULL,
+		input      TEXT NOT NULL DEFAULT '',
+		status     TEXT NOT NULL,
+		progress   REAL NOT NULL DEFAULT 0,
+		error      TEXT NOT NULL DEFAULT '',
+		result     TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX jobs_status_created ON jobs(status, created_at);
+	CREATE INDEX jobs_user_created ON jobs(user, created_at);`,
+
+	// 7: аудио сессии и время слов для воспроизведения
+	`ALTER TABLE entries ADD COLUMN audio TEXT NOT NULL DEFAULT '';
+	ALTER TABLE finals ADD COLUMN words TEXT NOT NULL DEFAULT '';`,
+
+	// 8: заголовок, краткое содержание, теги и настроение от локальной модели
+	`ALTER TABLE entries ADD COLUMN summary TEXT NOT NULL DEFAULT '';
+	ALTER TABLE entries ADD COLUMN mood TEXT NOT NULL DEFAULT '';
+	ALTER TABLE entries ADD COLUMN suggested_tags TEXT NOT NULL DEFAULT '';`,
+
+	// 9: дела и напоминания из диктовки
+	`CREATE TABLE tasks (
+		id         TEXT PRIMARY KEY,
+		user       TEXT NOT NULL,
+		entry_id   TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		text       TEXT NOT NULL,
+		source     TEXT NOT NULL DEFAULT '',
+		due        INTEGER NOT NULL DEFAULT 0,
+		has_time   INTEGER NOT NULL DEFAULT 0,
+		done_at    INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX tasks_user_due ON tasks(user, due);
+	CREATE INDEX tasks_entry ON tasks(entry_id);`,
+
+	// 10: учётные записи и сессии входа
+	`CREATE TABLE users (
+		name          TEXT PRIMARY KEY,
+		password_hash TEXT NOT NULL,
+		settings      TEXT NOT NULL DEFAULT '{}',
+		created_at    INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL
+	);
+	CREATE TABLE sessions (
+		token_hash TEXT PRIMARY KEY,
+		user       TEXT NOT NULL REFERENCES users(name) ON DELETE CASCADE,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL
+	);
+	CREATE INDEX sessions_user ON sessions(user);`,
+
+	// 11: контрольные суммы аудио для bhl-diary verify
+	`CREATE TABLE audio_checksums (
+		path       TEXT PRIMARY KEY,
+		user       TEXT NOT NULL,
+		sha256     TEXT NOT NULL,
+		size       INTEGER NOT NULL,
+		checked_at INTEGER NOT NULL
+	);`,
+}
+
+// SchemaVersion версия схемы, до которой доводит migrate
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// migrate применяет недостающие миграции, каждую в своей транзакции
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for v := current + 1; v <= len(migrations); v++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[v-1]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, v); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", v, err)
+		}
+	}
+	return nil
+}
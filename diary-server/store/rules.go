@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ListRules правила пользователя, самые полезные первыми
+func (s *SQLite) ListRules(ctx context.Context, user string) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user, from_text, to_text, status, hits, created_at, last_hit_at
+		FROM correction_rules WHERE user = ? ORDER BY hits DESC, id`, user)
+	if err != nil {
+		return nil, fmt.Errorf("list rules: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Rule
+	for rows.Next() {
+		var r Rule
+		var created, lastHit int64
+		if err := rows.Scan(&r.ID, &r.User, &r.From, &r.To, &r.Status, &r.Hits, &created, &lastHit); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.Unix(0, created)
+		if lastHit > 0 {
+			r.LastHitAt = time.Unix(0, lastHit)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SaveRule создаёт правило или, если у пользователя уже есть правило
+// для того же from, меняет его to и статус. Счётчик срабатываний сохраняется.
+func (s *SQLite) SaveRule(ctx context.Context, r *Rule) error {
+	r.From = strings.ToLower(strings.TrimSpace(r.From))
+	r.To = strings.TrimSpace(r.To)
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO correction_rules (user, from_text, to_text, status, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user, from_text) DO UPDATE SET to_text = excluded.to_text, status = excluded.status
+		RETURNING id, hits`,
+		r.User, r.From, r.To, r.Status, r.CreatedAt.UnixNano(),
+	).Scan(&r.ID, &r.Hits)
+	if err != nil {
+		return fmt.Errorf("save rule: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteRule(ctx context.Context, user string, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM correction_rules WHERE user = ? AND id = ?`, user, id)
+	if err != nil {
+		return fmt.Errorf("delete rule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// AddRuleHits прибавляет накопленные срабатывания: id правила → сколько раз
+func (s *SQLite) AddRuleHits(ctx context.Context, user string, hits map[int64]int) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	for id, n := range hits {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE correction_rules SET hits = hits + ?, last_hit_at = ? WHERE user = ? AND id = ?`,
+			n, now, user, id,
+		); err != nil {
+			return fmt.Errorf("add rule hits: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,455 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite бэкенд на чистом Go, один файл diary.db в каталоге данных
+type SQLite struct {
+	db     *sql.DB
+	cipher Cipher
+}
+
+func OpenSQLite(dir string) (*SQLite, error) {
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	dsn := "file:" + filepath.Join(dir, "diary.db") +
+		"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) CreateEntry(ctx context.Context, e *Entry) error {
+	now := time.Now()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = now
+	}
+	if e.UpdatedAt.IsZero() {
+		e.UpdatedAt = e.CreatedAt
+	}
+	if e.ID == "" {
+		e.ID = NewID(e.CreatedAt)
+	}
+	SyncParagraphs(e)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	title, text := e.Title, e.Text
+	if err := s.seal(e.User, &title, &text); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO entries (id, user, session_id, title, text, audio, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.User, e.SessionID, title, text, e.Audio, e.CreatedAt.UnixNano(), e.UpdatedAt.UnixNano(),
+	); err != nil {
+		return fmt.Errorf("insert entry: %w", err)
+	}
+	if err := s.insertFinals(ctx, tx, e); err != nil {
+		return err
+	}
+	if err := s.insertParagraphs(ctx, tx, e); err != nil {
+		return err
+	}
+	if len(e.Revisions) == 0 {
+		e.Revisions = []Revision{{Kind: RevisionCreated, Text: e.Text, Author: e.User, CreatedAt: e.CreatedAt}}
+	}
+	if err := s.insertRevisions(ctx, tx, e); err != nil {
+		return err
+	}
+	for _, t := range e.Tags {
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO entry_tags (entry_id, tag) VALUES (?, ?)`, e.ID, NormalizeTag(t)); err != nil {
+			return fmt.Errorf("insert tag: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) insertFinals(ctx context.Context, tx *sql.Tx, e *Entry) error {
+	for i, f := range e.Finals {
+		var words string
+		if len(f.Words) > 0 {
+			b, _ := json.Marshal(f.Words)
+			words = string(b)
+		}
+		if err := s.seal(e.User, &f.Text, &f.Raw, &f.Script, &words); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO finals (entry_id, seq, type, text, raw, name, script, at, words) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.ID, i, f.Type, f.Text, f.Raw, f.Name, f.Script, f.At.UnixNano(), words,
+		); err != nil {
+			return fmt.Errorf("insert final: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) insertParagraphs(ctx context.Context, tx *sql.Tx, e *Entry) error {
+	for i, p := range e.Paragraphs {
+		if err := s.seal(e.User, &p.Text); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO paragraphs (entry_id, seq, text, start_at, end_at) VALUES (?, ?, ?, ?, ?)`,
+			e.ID, i, p.Text, unixNano(p.Start), unixNano(p.End),
+		); err != nil {
+			return fmt.Errorf("insert paragraph: %w", err)
+		}
+	}
+	return nil
+}
+
+// unixNano нулевое время хранится как 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// insertRevisions дописывает e.Revisions в историю, проставляя номера
+func (s *SQLite) insertRevisions(ctx context.Context, tx *sql.Tx, e *Entry) error {
+	var last int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(n), 0) FROM revisions WHERE entry_id = ?`, e.ID).Scan(&last); err != nil {
+		return fmt.Errorf("last revision: %w", err)
+	}
+	for i := range e.Revisions {
+		r := &e.Revisions[i]
+		last++
+		r.N = last
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = e.UpdatedAt
+		}
+		text := r.Text
+		if err := s.seal(e.User, &text); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO revisions (entry_id, n, kind, text, author, restored_from, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			e.ID, r.N, r.Kind, text, r.Author, r.RestoredFrom, r.CreatedAt.UnixNano(),
+		); err != nil {
+			return fmt.Errorf("insert revision: %w", err)
+		}
+	}
+	e.Revisions = nil
+	return nil
+}
+
+// entryColumns общая часть SELECT: теги склеиваются через \x1f
+const entryColumns = `SELECT id, user, session_id, title, text, audio, summary, mood, suggested_tags, created_at, updated_at,
+	COALESCE((SELECT GROUP_CONCAT(tag, char(31)) FROM (SELECT tag FROM entry_tags WHERE entry_id = entries.id ORDER BY tag)), '')
+	FROM entries`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (s *SQLite) scanEntry(row rowScanner) (*Entry, error) {
+	e := &Entry{}
+	var created, updated int64
+	var tags, suggested string
+	if err := row.Scan(&e.ID, &e.User, &e.SessionID, &e.Title, &e.Text, &e.Audio, &e.Summary, &e.Mood, &suggested, &created, &updated, &tags); err != nil {
+		return nil, err
+	}
+	if err := s.open(e.User, &e.Title, &e.Text, &e.Summary); err != nil {
+		return nil, err
+	}
+	if suggested != "" {
+		e.SuggestedTags = strings.Split(suggested, "\x1f")
+	}
+	e.CreatedAt = time.Unix(0, created)
+	e.UpdatedAt = time.Unix(0, updated)
+	e.Tags = []string{}
+	if tags != "" {
+		e.Tags = strings.Split(tags, "\x1f")
+	}
+	return e, nil
+}
+
+func (s *SQLite) GetEntry(ctx context.Context, user, id string) (*Entry, error) {
+	e, err := s.scanEntry(s.db.QueryRowContext(ctx, entryColumns+` WHERE user = ? AND id = ?`, user, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get entry: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT type, text, raw, name, script, at, words FROM finals WHERE entry_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get finals: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f Final
+		var at int64
+		var words string
+		if err := rows.Scan(&f.Type, &f.Text, &f.Raw, &f.Name, &f.Script, &at, &words); err != nil {
+			return nil, err
+		}
+		if err := s.open(user, &f.Text, &f.Raw, &f.Script, &words); err != nil {
+			return nil, err
+		}
+		f.At = time.Unix(0, at)
+		if words != "" {
+			if err := json.Unmarshal([]byte(words), &f.Words); err != nil {
+				return nil, fmt.Errorf("final words: %w", err)
+			}
+		}
+		e.Finals = append(e.Finals, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	prows, err := s.db.QueryContext(ctx,
+		`SELECT text, start_at, end_at FROM paragraphs WHERE entry_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get paragraphs: %w", err)
+	}
+	defer prows.Close()
+	for prows.Next() {
+		var p Paragraph
+		var start, end int64
+		if err := prows.Scan(&p.Text, &start, &end); err != nil {
+			return nil, err
+		}
+		if err := s.open(user, &p.Text); err != nil {
+			return nil, err
+		}
+		p.Start, p.End = fromUnixNano(start), fromUnixNano(end)
+		e.Paragraphs = append(e.Paragraphs, p)
+	}
+	if err := prows.Err(); err != nil {
+		return nil, err
+	}
+	// записи до миграции 5: абзацы из текста
+	SyncParagraphs(e)
+	return e, nil
+}
+
+// ListEntries возвращает записи без фраз, новые первыми
+func (s *SQLite) ListEntries(ctx context.Context, f Filter) ([]*Entry, error) {
+	q := entryColumns + ` WHERE user = ?`
+	args := []any{f.User}
+	if !f.From.IsZero() {
+		q += ` AND created_at >= ?`
+		args = append(args, f.From.UnixNano())
+	}
+	if !f.To.IsZero() {
+		q += ` AND created_at < ?`
+		args = append(args, f.To.UnixNano())
+	}
+	if f.Tag != "" {
+		q += ` AND id IN (SELECT entry_id FROM entry_tags WHERE tag = ?)`
+		args = append(args, NormalizeTag(f.Tag))
+	}
+	q += ` ORDER BY created_at DESC, id DESC`
+	if f.Limit > 0 {
+		q += ` LIMIT ? OFFSET ?`
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list entries: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*Entry
+	for rows.Next() {
+		e, err := s.scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// UpdateEntry сохраняет заголовок, текст и фразы записи.
+// Изменённый текст попадает в историю ревизий.
+func (s *SQLite) UpdateEntry(ctx context.Context, e *Entry) error {
+	e.UpdatedAt = time.Now()
+	SyncParagraphs(e)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldText string
+	err = tx.QueryRowContext(ctx, `SELECT text FROM entries WHERE user = ? AND id = ?`, e.User, e.ID).Scan(&oldText)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("update entry: %w", err)
+	}
+	if err := s.open(e.User, &oldText); err != nil {
+		return err
+	}
+
+	title, text := e.Title, e.Text
+	if err := s.seal(e.User, &title, &text); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE entries SET title = ?, text = ?, updated_at = ? WHERE user = ? AND id = ?`,
+		title, text, e.UpdatedAt.UnixNano(), e.User, e.ID,
+	); err != nil {
+		return fmt.Errorf("update entry: %w", err)
+	}
+	if len(e.Revisions) == 0 && e.Text != oldText {
+		e.Revisions = []Revision{{Kind: RevisionEdit, Text: e.Text, Author: e.User}}
+	}
+	if err := s.insertRevisions(ctx, tx, e); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM finals WHERE entry_id = ?`, e.ID); err != nil {
+		return fmt.Errorf("replace finals: %w", err)
+	}
+	if err := s.insertFinals(ctx, tx, e); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM paragraphs WHERE entry_id = ?`, e.ID); err != nil {
+		return fmt.Errorf("replace paragraphs: %w", err)
+	}
+	if err := s.insertParagraphs(ctx, tx, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetInsights сохраняет краткое содержание, настроение и предложенные
+// теги. Заголовок ставится, только если пользователь не задал свой;
+// время изменения записи не трогается.
+func (s *SQLite) SetInsights(ctx context.Context, user, id string, in Insights) error {
+	if err := s.seal(user, &in.Title, &in.Summary); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE entries SET title = CASE WHEN title = '' THEN ? ELSE title END, summary = ?, mood = ?, suggested_tags = ?
+		WHERE user = ? AND id = ?`,
+		in.Title, in.Summary, in.Mood, strings.Join(in.Tags, "\x1f"), user, id)
+	if err != nil {
+		return fmt.Errorf("set insights: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteEntry(ctx context.Context, user, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM entries WHERE user = ? AND id = ?`, user, id)
+	if err != nil {
+		return fmt.Errorf("delete entry: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddTag добавляет тег; повторное добавление не ошибка
+func (s *SQLite) AddTag(ctx context.Context, user, id, tag string) error {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO entry_tags (entry_id, tag) SELECT id, ? FROM entries WHERE user = ? AND id = ?`,
+		NormalizeTag(tag), user, id)
+	if err != nil {
+		return fmt.Errorf("add tag: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// либо записи нет, либо тег уже стоит
+		if _, err := s.GetEntry(ctx, user, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) RemoveTag(ctx context.Context, user, id, tag string) error {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM entry_tags WHERE tag = ? AND entry_id IN (SELECT id FROM entries WHERE user = ? AND id = ?)`,
+		NormalizeTag(tag), user, id)
+	if err != nil {
+		return fmt.Errorf("remove tag: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListRevisions история текста записи, старые первыми
+func (s *SQLite) ListRevisions(ctx context.Context, user, id string) ([]Revision, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT n, kind, text, author, restored_from, created_at FROM revisions
+		WHERE entry_id = (SELECT id FROM entries WHERE user = ? AND id = ?) ORDER BY n`, user, id)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Revision
+	for rows.Next() {
+		var r Revision
+		var at int64
+		if err := rows.Scan(&r.N, &r.Kind, &r.Text, &r.Author, &r.RestoredFrom, &at); err != nil {
+			return nil, err
+		}
+		if err := s.open(user, &r.Text); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.Unix(0, at)
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		// у существующей записи всегда есть хотя бы одна ревизия
+		return nil, ErrNotFound
+	}
+	return out, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
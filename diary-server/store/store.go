@@ -0,0 +1,361 @@
+// Package store хранение записей дневника. Бэкенды взаимозаменяемы
+// через интерфейс Store; по умолчанию — встроенный SQLite.
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound         = errors.New("entry not found")
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrRuleNotFound     = errors.New("rule not found")
+	ErrJobNotFound      = errors.New("job not found")
+	ErrTaskNotFound     = errors.New("task not found")
+	ErrEncrypted        = errors.New("diary is encrypted, encryption is not enabled")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUserExists       = errors.New("user already exists")
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrVaultEncrypted   = errors.New("vault storage keeps entries as plain Markdown and cannot be encrypted")
+)
+
+// Типы фрагментов записи
+const (
+	FinalText    = "final"   // распознанная фраза
+	FinalCommand = "command" // формула от command-qwen
+	FinalEdit    = "edit"    // голосовая команда правки, Text — её вид
+)
+
+// Final одна фраза сессии в том виде, в каком её получил клиент
+type Final struct {
+	Type   string    `json:"type"`
+	Text   string    `json:"text"`
+	Raw    string    `json:"raw,omitempty"`    // вывод распознавателя до пост-обработки
+	Name   string    `json:"name,omitempty"`   // createLatex / editLatex
+	Script string    `json:"script,omitempty"` // LaTeX
+	At     time.Time `json:"at"`
+	Words  []Word    `json:"words,omitempty"` // слова Raw со временем в аудио записи
+}
+
+// Word произнесённое слово, время в секундах от начала аудио записи
+type Word struct {
+	Text  string  `json:"text"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Paragraph абзац записи. Время — от первой до последней фразы абзаца,
+// у абзацев из импорта и ручной правки его нет.
+type Paragraph struct {
+	Text  string    `json:"text"`
+	Start time.Time `json:"start,omitzero"`
+	End   time.Time `json:"end,omitzero"`
+}
+
+// Entry запись дневника — одна сессия диктовки
+type Entry struct {
+	ID         string      `json:"id"`
+	User       string      `json:"user"`
+	SessionID  string      `json:"session_id,omitempty"`
+	Title      string      `json:"title,omitempty"`
+	Text       string      `json:"text"` // абзацы через пустую строку, формулы как $$...$$
+	Paragraphs []Paragraph `json:"paragraphs,omitempty"`
+	Finals     []Final     `json:"finals,omitempty"`
+	Tags       []string    `json:"tags"`
+	Audio      string      `json:"-"` // WAV сессии (16 кГц моно), если аудио записывалось
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+
+	// Summary, Mood и SuggestedTags пишет локальная модель (SetInsights)
+	Summary       string   `json:"summary,omitempty"`
+	Mood          string   `json:"mood,omitempty"`
+	SuggestedTags []string `json:"suggested_tags,omitempty"`
+
+	// Revisions ревизии, которые CreateEntry/UpdateEntry запишут вместе
+	// с записью. Если пусто: при создании — одна ревизия created, при
+	// изменении текста — edit от владельца записи.
+	Revisions []Revision `json:"-"`
+}
+
+// Виды ревизий текста записи
+const (
+	RevisionASR       = "asr"       // сырой вывод распознавателя
+	RevisionProcessed = "processed" // после пунктуации и других стадий конвейера
+	RevisionCreated   = "created"   // запись создана не диктовкой
+	RevisionImport    = "import"    // перенесена из другого дневника
+	RevisionEdit      = "edit"      // ручная правка
+	RevisionRestore   = "restore"   // возврат к одной из прежних ревизий
+)
+
+// Revision одна версия текста записи. Ревизии только добавляются.
+type Revision struct {
+	N            int       `json:"n"` // номер с 1 в пределах записи
+	Kind         string    `json:"kind"`
+	Text         string    `json:"text"`
+	Author       string    `json:"author"`
+	RestoredFrom int       `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Статусы правил замены
+const (
+	RuleAccepted = "accepted" // применяется к диктовке
+	RuleRejected = "rejected" // отклонённая подсказка, больше не предлагается
+)
+
+// Rule пользовательская замена "как слышит распознаватель" → "как надо"
+type Rule struct {
+	ID        int64     `json:"id"`
+	User      string    `json:"-"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Status    string    `json:"status"`
+	Hits      int       `json:"hits"` // сколько раз сработало в диктовке
+	CreatedAt time.Time `json:"created_at"`
+	LastHitAt time.Time `json:"last_hit_at,omitzero"`
+}
+
+// Статусы фоновых задач
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// Job фоновая задача: расшифровка загруженного аудио и т.п.
+type Job struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Kind      string    `json:"kind"`            // transcribe, ...
+	Input     string    `json:"input,omitempty"` // параметры задачи, обычно JSON
+	Status    string    `json:"status"`
+	Progress  float64   `json:"progress"` // 0..100
+	Error     string    `json:"error,omitempty"`
+	Result    string    `json:"result,omitempty"` // например, ID созданной записи
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Task дело или напоминание, найденное в записи
+type Task struct {
+	ID        string    `json:"id"`
+	User      string    `json:"-"`
+	EntryID   string    `json:"entry_id"`
+	Text      string    `json:"text"`             // "Позвонить маме"
+	Source    string    `json:"source,omitempty"` // предложение записи, откуда взято дело
+	Due       time.Time `json:"due,omitzero"`     // нулевое — без срока
+	HasTime   bool      `json:"has_time"`         // срок с временем, иначе — на весь день
+	Done      bool      `json:"done"`
+	DoneAt    time.Time `json:"done_at,omitzero"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TaskFilter выборка дел одного пользователя
+type TaskFilter struct {
+	User    string
+	EntryID string    // только дела этой записи
+	Done    *bool     // nil — и открытые, и сделанные
+	From    time.Time // срок не раньше, включительно; дела без срока не попадают
+	To      time.Time // срок раньше, не включительно
+	Limit   int
+}
+
+// User учётная запись. Имя — то же, что в Entry.User и остальных таблицах.
+type User struct {
+	Name         string       `json:"name"`
+	PasswordHash string       `json:"-"` // Argon2id в формате PHC
+	Settings     UserSettings `json:"settings"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// UserSettings личные настройки диктовки. Словарь замен — правила
+// пользователя (ListRules), здесь его нет.
+type UserSettings struct {
+	Hotwords []string        `json:"hotwords,omitempty"` // свои горячие слова распознавателя
+	Stages   map[string]bool `json:"stages,omitempty"`   // стадии конвейера: {"punctuation": false}
+}
+
+// Session вход пользователя; хранится только хеш токена
+type Session struct {
+	TokenHash string
+	User      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// AudioFile аудио, на которое ссылаются записи, и его контрольная сумма;
+// пустая SHA256 — сумма ещё не записана
+type AudioFile struct {
+	Path      string
+	User      string
+	SHA256    string
+	Size      int64
+	CheckedAt time.Time
+}
+
+// Insights то, что локальная модель поняла о записи
+type Insights struct {
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	Tags    []string `json:"tags"`
+	Mood    string   `json:"mood"`
+}
+
+// Filter выборка записей одного пользователя
+type Filter struct {
+	User   string
+	From   time.Time // включительно, нулевое — без ограничения
+	To     time.Time // не включительно
+	Tag    string    // только записи с этим тегом
+	Limit  int
+	Offset int
+}
+
+// Store интерфейс хранилища. Все методы работают в пределах одного пользователя.
+type Store interface {
+	CreateEntry(ctx context.Context, e *Entry) error
+	GetEntry(ctx context.Context, user, id string) (*Entry, error)
+	ListEntries(ctx context.Context, f Filter) ([]*Entry, error)
+	UpdateEntry(ctx context.Context, e *Entry) error
+	DeleteEntry(ctx context.Context, user, id string) error
+	AddTag(ctx context.Context, user, id, tag string) error
+	RemoveTag(ctx context.Context, user, id, tag string) error
+	ListRevisions(ctx context.Context, user, id string) ([]Revision, error)
+	ListRules(ctx context.Context, user string) ([]Rule, error)
+	SaveRule(ctx context.Context, r *Rule) error
+	DeleteRule(ctx context.Context, user string, id int64) error
+	AddRuleHits(ctx context.Context, user string, hits map[int64]int) error
+	SetInsights(ctx context.Context, user, id string, in Insights) error
+	CreateJob(ctx context.Context, j *Job) error
+	GetJob(ctx context.Context, user, id string) (*Job, error)
+	ListJobs(ctx context.Context, user string, limit int) ([]*Job, error)
+	UpdateJob(ctx context.Context, j *Job) error
+	ClaimJob(ctx context.Context, kinds []string) (*Job, error)
+	CancelJob(ctx context.Context, user, id string) (*Job, error)
+	RequeueRunningJobs(ctx context.Context) (int, error)
+	CreateTask(ctx context.Context, t *Task) error
+	GetTask(ctx context.Context, user, id string) (*Task, error)
+	ListTasks(ctx context.Context, f TaskFilter) ([]*Task, error)
+	UpdateTask(ctx context.Context, t *Task) error
+	DeleteTask(ctx context.Context, user, id string) error
+	CreateUser(ctx context.Context, u *User) error
+	GetUser(ctx context.Context, name string) (*User, error)
+	ListUsers(ctx context.Context) ([]*User, error)
+	UpdateUser(ctx context.Context, u *User) error
+	DeleteUser(ctx context.Context, name string) error
+	CreateSession(ctx context.Context, s *Session) error
+	GetSession(ctx context.Context, tokenHash string) (*Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteSessions(ctx context.Context, user string) error
+	SetAudioChecksum(ctx context.Context, a *AudioFile) error
+	ListAudioFiles(ctx context.Context) ([]AudioFile, error)
+	Close() error
+}
+
+// Config выбор и настройка бэкенда
+type Config struct {
+	Driver string `yaml:"driver"` // sqlite (по умолчанию) или vault
+	Dir    string `yaml:"dir"`    // каталог данных
+	Vault  string `yaml:"vault"`  // репозиторий Markdown для vault, по умолчанию <dir>/vault
+
+	// Cipher шифрование текста на диске; nil — текст хранится открытым
+	Cipher Cipher `yaml:"-"`
+}
+
+// Open открывает хранилище по конфигу
+func Open(cfg Config) (Store, error) {
+	switch cfg.Driver {
+	case "", "sqlite":
+		s, err := OpenSQLite(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		s.cipher = cfg.Cipher
+		return s, nil
+	case "vault":
+		// файлы Markdown открыты по замыслу: их читают Obsidian и git
+		if cfg.Cipher != nil {
+			return nil, ErrVaultEncrypted
+		}
+		return OpenVault(cfg.Dir, cfg.Vault)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// SyncParagraphs приводит абзацы в соответствие с текстом: если текст
+// правили напрямую, абзацы пересобираются по пустым строкам, а время
+// сохраняется у тех, что не изменились.
+func SyncParagraphs(e *Entry) {
+	parts := SplitParagraphs(e.Text)
+	if len(parts) == len(e.Paragraphs) {
+		same := true
+		for i, p := range parts {
+			if e.Paragraphs[i].Text != p {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+
+	old := map[string]Paragraph{}
+	for _, p := range e.Paragraphs {
+		old[p.Text] = p
+	}
+	paras := make([]Paragraph, len(parts))
+	for i, p := range parts {
+		paras[i] = Paragraph{Text: p}
+		if o, ok := old[p]; ok {
+			paras[i] = o
+		}
+	}
+	e.Paragraphs = paras
+}
+
+// SplitParagraphs абзацы текста: разделитель — пустая строка
+func SplitParagraphs(text string) []string {
+	var out []string
+	for _, p := range paragraphSep.Split(strings.TrimSpace(text), -1) {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+var paragraphSep = regexp.MustCompile(`\n[ \t]*\n\s*`)
+
+// JoinParagraphs текст записи из абзацев
+func JoinParagraphs(paras []Paragraph) string {
+	parts := make([]string, len(paras))
+	for i, p := range paras {
+		parts[i] = p.Text
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// NormalizeTag теги хранятся в нижнем регистре без пробелов по краям
+func NormalizeTag(t string) string {
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+// NewID сортируемый по времени идентификатор записи: 20261018T153000-1a2b3c
+func NewID(t time.Time) string {
+	buf := make([]byte, 3)
+	rand.Read(buf)
+	return t.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(buf)
+}
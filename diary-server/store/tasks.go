@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const taskColumns = `SELECT id, user, entry_id, text, source, due, has_time, done_at, created_at, updated_at FROM tasks`
+
+func (s *SQLite) scanTask(row rowScanner) (*Task, error) {
+	t := &Task{}
+	var due, doneAt, created, updated int64
+	if err := row.Scan(&t.ID, &t.User, &t.EntryID, &t.Text, &t.Source, &due, &t.HasTime, &doneAt, &created, &updated); err != nil {
+		return nil, err
+	}
+	if err := s.open(t.User, &t.Text, &t.Source); err != nil {
+		return nil, err
+	}
+	if due != 0 {
+		t.Due = time.Unix(0, due)
+	}
+	if doneAt != 0 {
+		t.Done, t.DoneAt = true, time.Unix(0, doneAt)
+	}
+	t.CreatedAt = time.Unix(0, created)
+	t.UpdatedAt = time.Unix(0, updated)
+	return t, nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// CreateTask сохраняет дело; запись должна принадлежать тому же пользователю
+func (s *SQLite) CreateTask(ctx context.Context, t *Task) error {
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	t.UpdatedAt = t.CreatedAt
+	if t.ID == "" {
+		t.ID = NewID(t.CreatedAt)
+	}
+	if t.Done && t.DoneAt.IsZero() {
+		t.DoneAt = t.CreatedAt
+	}
+	text, source := t.Text, t.Source
+	if err := s.seal(t.User, &text, &source); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO tasks (id, user, entry_id, text, source, due, has_time, done_at, created_at, updated_at)
+		SELECT ?, user, id, ?, ?, ?, ?, ?, ?, ? FROM entries WHERE user = ? AND id = ?`,
+		t.ID, text, source, unixOrZero(t.Due), t.HasTime, unixOrZero(t.DoneAt),
+		t.CreatedAt.UnixNano(), t.UpdatedAt.UnixNano(), t.User, t.EntryID,
+	)
+	if err != nil {
+		return fmt.Errorf("insert task: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) GetTask(ctx context.Context, user, id string) (*Task, error) {
+	t, err := s.scanTask(s.db.QueryRowContext(ctx, taskColumns+` WHERE user = ? AND id = ?`, user, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get task: %w", err)
+	}
+	return t, nil
+}
+
+// ListTasks дела по сроку: ближайшие первыми, без срока — в конце
+func (s *SQLite) ListTasks(ctx context.Context, f TaskFilter) ([]*Task, error) {
+	where := []string{"user = ?"}
+	args := []any{f.User}
+	if f.EntryID != "" {
+		where = append(where, "entry_id = ?")
+		args = append(args, f.EntryID)
+	}
+	if f.Done != nil {
+		if *f.Done {
+			where = append(where, "done_at != 0")
+		} else {
+			where = append(where, "done_at = 0")
+		}
+	}
+	if !f.From.IsZero() {
+		where = append(where, "due >= ?")
+		args = append(args, f.From.UnixNano())
+	}
+	if !f.To.IsZero() {
+		where = append(where, "due != 0 AND due < ?")
+		args = append(args, f.To.UnixNano())
+	}
+	query := taskColumns + ` WHERE ` + strings.Join(where, " AND ") + ` ORDER BY due = 0, due, created_at, id`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*Task
+	for rows.Next() {
+		t, err := s.scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// UpdateTask сохраняет текст, срок и отметку о выполнении
+func (s *SQLite) UpdateTask(ctx context.Context, t *Task) error {
+	t.UpdatedAt = time.Now()
+	switch {
+	case t.Done && t.DoneAt.IsZero():
+		t.DoneAt = t.UpdatedAt
+	case !t.Done:
+		t.DoneAt = time.Time{}
+	}
+	text := t.Text
+	if err := s.seal(t.User, &text); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE tasks SET text = ?, due = ?, has_time = ?, done_at = ?, updated_at = ? WHERE user = ? AND id = ?`,
+		text, unixOrZero(t.Due), t.HasTime, unixOrZero(t.DoneAt), t.UpdatedAt.UnixNano(), t.User, t.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update task: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteTask(ctx context.Context, user, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM tasks WHERE user = ? AND id = ?`, user, id)
+	if err != nil {
+		return fmt.Errorf("delete task: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const userColumns = `SELECT name, password_hash, settings, created_at, updated_at FROM users`
+
+// CreateUser заводит учётную запись; имя занято — ErrUserExists
+func (s *SQLite) CreateUser(ctx context.Context, u *User) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	u.UpdatedAt = u.CreatedAt
+	settings, err := json.Marshal(u.Settings)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (name, password_hash, settings, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO NOTHING`,
+		u.Name, u.PasswordHash, string(settings), u.CreatedAt.UnixNano(), u.UpdatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserExists
+	}
+	return nil
+}
+
+func (s *SQLite) GetUser(ctx context.Context, name string) (*User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx, userColumns+` WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	return u, nil
+}
+
+func (s *SQLite) ListUsers(ctx context.Context) ([]*User, error) {
+	rows, err := s.db.QueryContext(ctx, userColumns+` ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// UpdateUser сохраняет хеш пароля и настройки
+func (s *SQLite) UpdateUser(ctx context.Context, u *User) error {
+	u.UpdatedAt = time.Now()
+	settings, err := json.Marshal(u.Settings)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE users SET password_hash = ?, settings = ?, updated_at = ? WHERE name = ?`,
+		u.PasswordHash, string(settings), u.UpdatedAt.UnixNano(), u.Name,
+	)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUser удаляет учётную запись и её сессии. Записи дневника
+// остаются: их удаляют отдельно.
+func (s *SQLite) DeleteUser(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) CreateSession(ctx context.Context, ss *Session) error {
+	if ss.CreatedAt.IsZero() {
+		ss.CreatedAt = time.Now()
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO sessions (token_hash, user, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		ss.TokenHash, ss.User, ss.CreatedAt.UnixNano(), ss.ExpiresAt.UnixNano(),
+	); err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+// GetSession сессия по хешу токена; истёкшая удаляется и не находится
+func (s *SQLite) GetSession(ctx context.Context, tokenHash string) (*Session, error) {
+	var ss Session
+	var created, expires int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT token_hash, user, created_at, expires_at FROM sessions WHERE token_hash = ?`, tokenHash,
+	).Scan(&ss.TokenHash, &ss.User, &created, &expires)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	ss.CreatedAt = time.Unix(0, created)
+	ss.ExpiresAt = time.Unix(0, expires)
+	if !time.Now().Before(ss.ExpiresAt) {
+		s.DeleteSession(ctx, tokenHash)
+		return nil, ErrSessionNotFound
+	}
+	return &ss, nil
+}
+
+func (s *SQLite) DeleteSession(ctx context.Context, tokenHash string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = ?`, tokenHash); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSessions завершает все входы пользователя и заодно чистит истёкшие
+func (s *SQLite) DeleteSessions(ctx context.Context, user string) error {
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user = ? OR expires_at <= ?`, user, time.Now().UnixNano(),
+	); err != nil {
+		return fmt.Errorf("delete sessions: %w", err)
+	}
+	return nil
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	var u User
+	var settings string
+	var created, updated int64
+	if err := row.Scan(&u.Name, &u.PasswordHash, &settings, &created, &updated); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(settings), &u.Settings); err != nil {
+		return nil, fmt.Errorf("user %s settings: %w", u.Name, err)
+	}
+	u.CreatedAt = time.Unix(0, created)
+	u.UpdatedAt = time.Unix(0, updated)
+	return &u, nil
+}
@@ -0,0 +1,531 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// vaultAuthor подпись коммитов сервера и ревизий без пользователя
+const vaultAuthor = "bhl-diary"
+
+var errStaleEdit = errors.New("file changed again while applying the edit")
+
+// Vault Markdown-хранилище (driver: vault): каждая запись — файл
+// [<user>/]YYYY/MM/<id>.md с YAML-шапкой в git-репозитории, каждое
+// сохранение — коммит, история текста (ListRevisions) — из git. Рядом
+// работает SQLite: фразы со временем слов, абзацы, дела, правила и
+// учётные записи живут в нём, а по записям он служит кешем для выборок.
+// Правки файлов на диске подхватывают Sync и Watch.
+type Vault struct {
+	*SQLite
+	dir  string
+	repo *git.Repository
+
+	mu    sync.Mutex        // файлы и репозиторий
+	paths map[string]string // id записи → путь её файла
+}
+
+// OpenVault кеш в dir, репозиторий в vaultDir (по умолчанию <dir>/vault).
+// Репозиторий создаётся, если его нет; файлы сразу сверяются с кешем.
+func OpenVault(dir, vaultDir string) (*Vault, error) {
+	db, err := OpenSQLite(dir)
+	if err != nil {
+		return nil, err
+	}
+	if vaultDir == "" {
+		vaultDir = filepath.Join(dir, "vault")
+	}
+	if err := os.MkdirAll(vaultDir, 0o700); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create vault dir: %w", err)
+	}
+	repo, err := git.PlainOpen(vaultDir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		repo, err = git.PlainInit(vaultDir, false)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open vault repository: %w", err)
+	}
+	v := &Vault{SQLite: db, dir: vaultDir, repo: repo, paths: map[string]string{}}
+	if err := v.Sync(context.Background(), v); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return v, nil
+}
+
+// Dir каталог репозитория
+func (v *Vault) Dir() string {
+	return v.dir
+}
+
+// diskEdit правка файла на диске, которую применяет Sync: файл уже
+// такой, каким должен попасть в коммит, переписывать его не нужно
+type diskEdit struct {
+	path string
+	data []byte // содержимое при чтении, nil — файл удалён
+	id   string // id из шапки: другой — в шапку надо вписать id записи
+}
+
+type diskEditKey struct{}
+
+func onDisk(ctx context.Context) *diskEdit {
+	d, _ := ctx.Value(diskEditKey{}).(*diskEdit)
+	return d
+}
+
+// fresh файл всё ещё такой, каким его прочитал Sync; вызывать под v.mu.
+// Иначе правку применит следующее событие.
+func (v *Vault) fresh(ctx context.Context) error {
+	d := onDisk(ctx)
+	if d == nil {
+		return nil
+	}
+	data, err := os.ReadFile(v.abs(d.path))
+	switch {
+	case d.data == nil && errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil || !bytes.Equal(data, d.data):
+		return errStaleEdit
+	}
+	return nil
+}
+
+func (v *Vault) CreateEntry(ctx context.Context, e *Entry) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.fresh(ctx); err != nil {
+		return err
+	}
+	// id и время — до файла, как их проставил бы SQLite
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if e.ID == "" {
+		e.ID = NewID(e.CreatedAt)
+	}
+	revs := e.Revisions
+	if len(revs) == 0 {
+		revs = []Revision{{Kind: RevisionCreated, Text: e.Text, Author: e.User, CreatedAt: e.CreatedAt}}
+	}
+	file := *e
+	file.Tags = fileTags(e.Tags)
+	return v.save(ctx, &file, revs, "create", func() error {
+		return v.SQLite.CreateEntry(ctx, e)
+	})
+}
+
+func (v *Vault) UpdateEntry(ctx context.Context, e *Entry) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.fresh(ctx); err != nil {
+		return err
+	}
+	old, err := v.SQLite.GetEntry(ctx, e.User, e.ID)
+	if err != nil {
+		return err
+	}
+	revs := e.Revisions
+	if len(revs) == 0 && e.Text != old.Text {
+		revs = []Revision{{Kind: RevisionEdit, Text: e.Text, Author: e.User}}
+	}
+	file := *old
+	file.Title, file.Text = e.Title, e.Text
+	return v.save(ctx, &file, revs, "update", func() error {
+		return v.SQLite.UpdateEntry(ctx, e)
+	})
+}
+
+func (v *Vault) SetInsights(ctx context.Context, user, id string, in Insights) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	file, err := v.SQLite.GetEntry(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	// заголовок модели — только если пользователь не задал свой
+	if file.Title == "" {
+		file.Title = in.Title
+	}
+	return v.save(ctx, file, nil, "insights", func() error {
+		return v.SQLite.SetInsights(ctx, user, id, in)
+	})
+}
+
+func (v *Vault) AddTag(ctx context.Context, user, id, tag string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.fresh(ctx); err != nil {
+		return err
+	}
+	file, err := v.SQLite.GetEntry(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	file.Tags = fileTags(append(file.Tags, tag))
+	return v.save(ctx, file, nil, "tags", func() error {
+		return v.SQLite.AddTag(ctx, user, id, tag)
+	})
+}
+
+func (v *Vault) RemoveTag(ctx context.Context, user, id, tag string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.fresh(ctx); err != nil {
+		return err
+	}
+	file, err := v.SQLite.GetEntry(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	file.Tags = slices.DeleteFunc(file.Tags, func(t string) bool { return t == NormalizeTag(tag) })
+	return v.save(ctx, file, nil, "tags", func() error {
+		return v.SQLite.RemoveTag(ctx, user, id, tag)
+	})
+}
+
+func (v *Vault) DeleteEntry(ctx context.Context, user, id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.fresh(ctx); err != nil {
+		return err
+	}
+	e, err := v.SQLite.GetEntry(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	rel := v.pathOf(e)
+	undo := v.checkpoint(ctx, id, rel)
+	err = os.Remove(v.abs(rel))
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		err = v.commit("delete "+id, user, time.Now(), false, rel)
+	}
+	if err == nil {
+		err = v.SQLite.DeleteEntry(ctx, user, id)
+	}
+	if err != nil {
+		undo()
+		return err
+	}
+	delete(v.paths, id)
+	return nil
+}
+
+// save пишет файл записи и коммитит: по коммиту на ревизию (в файле —
+// текст ревизии), затем итоговый файл e, если он другой. Правка с диска
+// коммитится как есть. Кеш обновляет apply — после git: если он не
+// сработал, репозиторий и файл возвращаются к прежнему состоянию, а
+// если не сработал git — кеш не трогается вовсе. Вызывать под v.mu.
+func (v *Vault) save(ctx context.Context, e *Entry, revs []Revision, what string, apply func() error) error {
+	d := onDisk(ctx)
+	if d != nil {
+		v.paths[e.ID] = d.path
+	}
+	rel := v.pathOf(e)
+	undo := v.checkpoint(ctx, e.ID, rel)
+	err := v.commitRevisions(e, rel, revs, what, d)
+	if err == nil && apply != nil {
+		err = apply()
+	}
+	if err != nil {
+		undo()
+	}
+	return err
+}
+
+func (v *Vault) commitRevisions(e *Entry, rel string, revs []Revision, what string, d *diskEdit) error {
+	for _, r := range revs {
+		if d == nil {
+			at := *e
+			at.Text = r.Text
+			if err := v.write(rel, &at); err != nil {
+				return err
+			}
+		}
+		// пустой коммит тоже ревизия: после пунктуации текст мог не измениться
+		if err := v.commit(revisionMessage(e.ID, rel, r), r.Author, r.CreatedAt, true, rel); err != nil {
+			return err
+		}
+	}
+	if d == nil || d.id != e.ID {
+		if err := v.write(rel, e); err != nil {
+			return err
+		}
+	}
+	return v.commit(what+" "+e.ID, e.User, time.Now(), false, rel)
+}
+
+// checkpoint запоминает ветку, путь записи и её файл; undo возвращает
+// их после неудачного сохранения. Правку с диска undo оставляет на
+// диске, какой её прочитал Sync: её применит следующая сверка.
+func (v *Vault) checkpoint(ctx context.Context, id, rel string) (undo func()) {
+	head, err := v.repo.Head()
+	if err != nil {
+		head = nil // пустой репозиторий
+	}
+	path, hadPath := v.paths[id]
+	d := onDisk(ctx)
+	return func() {
+		if hadPath {
+			v.paths[id] = path
+		} else {
+			delete(v.paths, id)
+		}
+		if err := v.resetTo(head); err != nil {
+			log.Printf("⚠️ Хранилище: не удалось откатить git: %v", err)
+		}
+
+		var data []byte
+		switch {
+		case d != nil:
+			data = d.data
+		case head != nil:
+			if c, err := v.repo.CommitObject(head.Hash()); err == nil {
+				if f, err := c.File(rel); err == nil {
+					contents, _ := f.Contents()
+					data = []byte(contents)
+				}
+			}
+		}
+		target := rel
+		if d != nil {
+			target = d.path
+		}
+		if data == nil {
+			err = os.Remove(v.abs(target))
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = os.WriteFile(v.abs(target), data, 0o600)
+		}
+		if err != nil {
+			log.Printf("⚠️ Хранилище: не удалось вернуть %s: %v", target, err)
+		}
+	}
+}
+
+// resetTo переводит ветку и индекс git на коммит head; nil — на пустой
+// репозиторий. Файлы на диске не трогает.
+func (v *Vault) resetTo(head *plumbing.Reference) error {
+	if head != nil {
+		wt, err := v.repo.Worktree()
+		if err != nil {
+			return err
+		}
+		return wt.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MixedReset})
+	}
+	if ref, err := v.repo.Head(); err == nil {
+		if err := v.repo.Storer.RemoveReference(ref.Name()); err != nil {
+			return err
+		}
+	}
+	return v.repo.Storer.SetIndex(&index.Index{Version: 2})
+}
+
+// fileTags теги для шапки файла так, как их вернёт кеш: нормализованные,
+// без повторов, по алфавиту
+func fileTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		if t = NormalizeTag(t); t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// ListRevisions история текста из коммитов-ревизий записи, старые первыми.
+// Под v.mu — только чтение HEAD: коммиты неизменяемы, и обход истории не
+// задерживает сохранения (разбор правок зовёт его на каждую запись).
+func (v *Vault) ListRevisions(ctx context.Context, user, id string) ([]Revision, error) {
+	e, err := v.SQLite.GetEntry(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	head, err := v.repo.Head()
+	v.mu.Unlock()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vault head: %w", err)
+	}
+	commits, err := v.repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, fmt.Errorf("vault log: %w", err)
+	}
+	defer commits.Close()
+
+	// коммиты записи не старше её самой: дальше можно не идти
+	since := e.CreatedAt.Truncate(time.Second).Add(-time.Second)
+	var out []Revision
+	err = commits.ForEach(func(c *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if c.Committer.When.Before(since) {
+			return storer.ErrStop
+		}
+		t := trailers(c.Message)
+		if t["Entry"] != id || t["Revision"] == "" {
+			return nil
+		}
+		f, err := c.File(t["File"])
+		if err != nil {
+			return fmt.Errorf("revision %s: %w", c.Hash, err)
+		}
+		data, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		_, text, err := parseMarkdown([]byte(data))
+		if err != nil {
+			text = strings.TrimSpace(data)
+		}
+		r := Revision{Kind: t["Revision"], Text: text, Author: c.Author.Name, CreatedAt: c.Author.When}
+		if r.Author == vaultAuthor {
+			r.Author = ""
+		}
+		r.RestoredFrom, _ = strconv.Atoi(t["Restored-From"])
+		out = append(out, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	for i := range out {
+		out[i].N = i + 1
+	}
+	return out, nil
+}
+
+// revisionMessage коммит ревизии: по трейлерам ListRevisions находит
+// её и файл, в котором был текст
+func revisionMessage(id, rel string, r Revision) string {
+	msg := fmt.Sprintf("%s %s\n\nEntry: %s\nRevision: %s\nFile: %s\n", r.Kind, id, id, r.Kind, rel)
+	if r.RestoredFrom > 0 {
+		msg += fmt.Sprintf("Restored-From: %d\n", r.RestoredFrom)
+	}
+	return msg
+}
+
+func trailers(msg string) map[string]string {
+	out := map[string]string{}
+	for _, line := range strings.Split(msg, "\n") {
+		if k, val, ok := strings.Cut(line, ": "); ok && !strings.Contains(k, " ") {
+			out[k] = strings.TrimSpace(val)
+		}
+	}
+	return out
+}
+
+// pathOf путь файла записи; вызывать под v.mu
+func (v *Vault) pathOf(e *Entry) string {
+	if p, ok := v.paths[e.ID]; ok {
+		return p
+	}
+	return vaultPath(e)
+}
+
+func (v *Vault) abs(rel string) string {
+	return filepath.Join(v.dir, filepath.FromSlash(rel))
+}
+
+// write пишет файл записи, если он изменился: лишняя запись — лишнее
+// событие для Watch и лишняя перезагрузка в открытом редакторе
+func (v *Vault) write(rel string, e *Entry) error {
+	data, err := renderMarkdown(e)
+	if err != nil {
+		return err
+	}
+	path := v.abs(rel)
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// commit фиксирует файлы как они есть на диске (удалённые — удаляет из
+// git). Без allowEmpty коммит без изменений не создаётся.
+func (v *Vault) commit(msg, author string, when time.Time, allowEmpty bool, rels ...string) error {
+	wt, err := v.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		if _, err := os.Lstat(v.abs(rel)); err == nil {
+			if err := wt.AddWithOptions(&git.AddOptions{Path: rel, SkipStatus: true}); err != nil {
+				return fmt.Errorf("git add %s: %w", rel, err)
+			}
+		} else if v.tracked(rel) {
+			if _, err := wt.Remove(rel); err != nil {
+				return fmt.Errorf("git rm %s: %w", rel, err)
+			}
+		}
+	}
+	if author == "" {
+		author = vaultAuthor
+	}
+	if when.IsZero() {
+		when = time.Now()
+	}
+	_, err = wt.Commit(msg, &git.CommitOptions{
+		Author:            &object.Signature{Name: author, Email: author + "@localhost", When: when},
+		Committer:         &object.Signature{Name: vaultAuthor, Email: vaultAuthor + "@localhost", When: time.Now()},
+		AllowEmptyCommits: allowEmpty,
+	})
+	if errors.Is(err, git.ErrEmptyCommit) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("git commit: %w", err)
+	}
+	return nil
+}
+
+// tracked файл есть в индексе git
+func (v *Vault) tracked(rel string) bool {
+	idx, err := v.repo.Storer.Index()
+	if err != nil {
+		return false
+	}
+	_, err = idx.Entry(rel)
+	return err == nil
+}
@@ -0,0 +1,403 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// watchDelay сколько ждать тишины после события: редакторы сохраняют
+// файл в несколько шагов
+const watchDelay = 500 * time.Millisecond
+
+// Sync сверяет файлы хранилища с кешем. Правки на диске применяются
+// через apply — обёртку с индексами или сам Vault; новый файл под
+// каталогом года становится записью; удалённый файл, который был в git,
+// удаляет запись; запись без файла выгружается вместе с историей ревизий
+// из кеша (так же заполняется новый репозиторий).
+func (v *Vault) Sync(ctx context.Context, apply Store) error {
+	var rels []string
+	err := filepath.WalkDir(v.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != v.dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(v.dir, path)
+		if _, ok := vaultUser(filepath.ToSlash(rel)); ok && !d.IsDir() {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scan vault: %w", err)
+	}
+	v.syncFiles(ctx, apply, rels)
+
+	removed, err := v.removedFiles()
+	if err != nil {
+		return err
+	}
+	rows, err := v.db.QueryContext(ctx, `SELECT id, user FROM entries ORDER BY created_at`)
+	if err != nil {
+		return fmt.Errorf("list entries: %w", err)
+	}
+	type ref struct{ id, user string }
+	var missing []ref
+	for rows.Next() {
+		var r ref
+		if err := rows.Scan(&r.id, &r.user); err != nil {
+			rows.Close()
+			return err
+		}
+		v.mu.Lock()
+		_, ok := v.paths[r.id]
+		v.mu.Unlock()
+		if !ok {
+			missing = append(missing, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var exported int
+	for _, r := range missing {
+		if rel, ok := removed[r.id]; ok {
+			v.mu.Lock()
+			v.paths[r.id] = rel
+			v.mu.Unlock()
+			v.syncRemoved(ctx, apply, rel)
+			continue
+		}
+		if err := v.export(ctx, r.user, r.id); err != nil {
+			return fmt.Errorf("export %s: %w", r.id, err)
+		}
+		exported++
+	}
+	if exported > 0 {
+		log.Printf("📤 Хранилище %s: выгружено записей %d", v.dir, exported)
+	}
+	return nil
+}
+
+// export кладёт запись из кеша в репозиторий с её историей ревизий
+func (v *Vault) export(ctx context.Context, user, id string) error {
+	revs, err := v.SQLite.ListRevisions(ctx, user, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	e, err := v.SQLite.GetEntry(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.save(ctx, e, revs, "export", nil)
+}
+
+// removedFiles id записей, чьи файлы есть в git, но удалены с диска
+func (v *Vault) removedFiles() (map[string]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	out := map[string]string{}
+	idx, err := v.repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("vault index: %w", err)
+	}
+	for _, ie := range idx.Entries {
+		if _, ok := vaultUser(ie.Name); !ok {
+			continue
+		}
+		if _, err := os.Lstat(v.abs(ie.Name)); err == nil {
+			continue
+		}
+		blob, err := object.GetBlob(v.repo.Storer, ie.Hash)
+		if err != nil {
+			continue
+		}
+		r, err := blob.Reader()
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			continue
+		}
+		if fm, _, err := parseMarkdown(data); err == nil && fm.ID != "" {
+			out[fm.ID] = ie.Name
+		}
+	}
+	return out, nil
+}
+
+// syncFiles сверяет файлы: сначала существующие (перенос файла — это
+// новый путь и пропавший старый), потом пропавшие
+func (v *Vault) syncFiles(ctx context.Context, apply Store, rels []string) {
+	exists := func(rel string) bool {
+		_, err := os.Lstat(v.abs(rel))
+		return err == nil
+	}
+	slices.SortStableFunc(rels, func(a, b string) int {
+		switch ea, eb := exists(a), exists(b); {
+		case ea && !eb:
+			return -1
+		case !ea && eb:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	for _, rel := range rels {
+		if ctx.Err() != nil {
+			return
+		}
+		var err error
+		if exists(rel) {
+			err = v.syncFile(ctx, apply, rel)
+		} else {
+			err = v.syncRemoved(ctx, apply, rel)
+		}
+		if err != nil && !errors.Is(err, errStaleEdit) {
+			log.Printf("⚠️ Хранилище: %s: %v", rel, err)
+		}
+	}
+}
+
+// syncFile применяет файл к кешу: новая запись, правка текста,
+// заголовка и тегов, перенос файла
+func (v *Vault) syncFile(ctx context.Context, apply Store, rel string) error {
+	user, ok := vaultUser(rel)
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(v.abs(rel))
+	if err != nil {
+		return err
+	}
+	fm, text, err := parseMarkdown(data)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	id, moved := fm.ID, ""
+	if old, ok := v.paths[id]; ok && id != "" && old != rel {
+		if _, err := os.Lstat(v.abs(old)); err == nil {
+			id = "" // копия файла — новая запись
+		} else {
+			moved = old
+		}
+	}
+	if id != "" {
+		v.paths[id] = rel
+	}
+	v.mu.Unlock()
+
+	ctx = context.WithValue(ctx, diskEditKey{}, &diskEdit{path: rel, data: data, id: fm.ID})
+	var cur *Entry
+	if id != "" {
+		var owner string
+		err := v.db.QueryRowContext(ctx, `SELECT user FROM entries WHERE id = ?`, id).Scan(&owner)
+		switch {
+		case err == nil && owner != user:
+			return fmt.Errorf("entry %s belongs to %q", id, owner)
+		case err == nil:
+			if cur, err = v.SQLite.GetEntry(ctx, user, id); err != nil {
+				return err
+			}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+	}
+
+	if cur == nil {
+		e := &Entry{ID: id, User: user, Title: fm.Title, Text: text, Tags: fm.Tags,
+			SessionID: fm.Session, Audio: fm.Audio, CreatedAt: fm.Created}
+		if e.CreatedAt.IsZero() {
+			if info, err := os.Stat(v.abs(rel)); err == nil {
+				e.CreatedAt = info.ModTime()
+			}
+		}
+		if err := apply.CreateEntry(ctx, e); err != nil {
+			return err
+		}
+		log.Printf("📝 Запись %s из файла %s", e.ID, rel)
+		return nil
+	}
+
+	if cur.Title != fm.Title || strings.TrimSpace(cur.Text) != text {
+		cur.Title, cur.Text = fm.Title, text
+		if err := apply.UpdateEntry(ctx, cur); err != nil {
+			return err
+		}
+		log.Printf("✏️ Запись %s изменена в файле %s", id, rel)
+	}
+	for _, t := range fm.Tags {
+		if !slices.Contains(cur.Tags, t) {
+			if err := apply.AddTag(ctx, user, id, t); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range cur.Tags {
+		if !slices.Contains(fm.Tags, t) {
+			if err := apply.RemoveTag(ctx, user, id, t); err != nil {
+				return err
+			}
+		}
+	}
+	if moved != "" {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return v.commit("move "+id, user, time.Now(), false, moved, rel)
+	}
+	return nil
+}
+
+// syncRemoved файл удалён с диска: удаляется и запись
+func (v *Vault) syncRemoved(ctx context.Context, apply Store, rel string) error {
+	user, _ := vaultUser(rel)
+	v.mu.Lock()
+	id := ""
+	for k, p := range v.paths {
+		if p == rel {
+			id = k
+			break
+		}
+	}
+	if id == "" {
+		// файл без записи: убрать его и из git
+		defer v.mu.Unlock()
+		return v.commit("remove "+rel, user, time.Now(), false, rel)
+	}
+	v.mu.Unlock()
+
+	ctx = context.WithValue(ctx, diskEditKey{}, &diskEdit{path: rel, id: id})
+	err := apply.DeleteEntry(ctx, user, id)
+	if errors.Is(err, ErrNotFound) {
+		v.mu.Lock()
+		delete(v.paths, id)
+		v.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("🗑 Запись %s удалена вместе с файлом %s", id, rel)
+	return nil
+}
+
+// Watch следит за файлами хранилища до отмены ctx. Правки применяются
+// через apply — обёртку хранилища с индексами, чтобы поиск и статистика
+// видели и ручные правки.
+func (v *Vault) Watch(ctx context.Context, apply Store) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if _, err := v.watchDirs(w, v.dir); err != nil {
+		return err
+	}
+	// правки между открытием хранилища и началом слежения
+	if err := v.Sync(ctx, apply); err != nil {
+		log.Printf("⚠️ Хранилище: %v", err)
+	}
+
+	pending := map[string]bool{}
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("⚠️ Слежение за хранилищем: %v", err)
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(v.dir, ev.Name)
+			if err != nil {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+				// новый каталог: файлы могли появиться раньше, чем за ним начали следить
+				if ev.Has(fsnotify.Create) {
+					files, err := v.watchDirs(w, ev.Name)
+					if err != nil {
+						log.Printf("⚠️ Слежение за хранилищем: %v", err)
+					}
+					for _, f := range files {
+						pending[f] = true
+					}
+					timer.Reset(watchDelay)
+				}
+				continue
+			}
+			if _, ok := vaultUser(rel); ok {
+				pending[rel] = true
+			} else if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+				// убран каталог: всё, что было в нём
+				v.mu.Lock()
+				for _, p := range v.paths {
+					if strings.HasPrefix(p, rel+"/") {
+						pending[p] = true
+					}
+				}
+				v.mu.Unlock()
+			}
+			timer.Reset(watchDelay)
+		case <-timer.C:
+			rels := make([]string, 0, len(pending))
+			for rel := range pending {
+				rels = append(rels, rel)
+			}
+			clear(pending)
+			v.syncFiles(ctx, apply, rels)
+		}
+	}
+}
+
+// watchDirs ставит слежение на dir и подкаталоги (кроме скрытых, в том
+// числе .git) и возвращает файлы записей в них
+func (v *Vault) watchDirs(w *fsnotify.Watcher, dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(v.dir, path)
+		rel = filepath.ToSlash(rel)
+		if !d.IsDir() {
+			if _, ok := vaultUser(rel); ok {
+				files = append(files, rel)
+			}
+			return nil
+		}
+		if path != v.dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+	return files, err
+}
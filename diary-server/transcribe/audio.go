@@ -0,0 +1,269 @@
+package transcribe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SampleRate частота, которую ждёт распознаватель
+const SampleRate = 16000
+
+// Source моно-поток float32 с частотой SampleRate
+type Source interface {
+	// Read заполняет buf отсчётами, в конце — io.EOF
+	Read(buf []float32) (int, error)
+	// Duration длительность в секундах, 0 — неизвестна
+	Duration() float64
+	Close() error
+}
+
+// Open открывает аудиофайл: WAV читается сам, остальное — через ffmpeg
+func Open(ctx context.Context, path string) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var head [12]byte
+	if _, err := io.ReadFull(f, head[:]); err == nil && string(head[:4]) == "RIFF" && string(head[8:]) == "WAVE" {
+		src, err := newWAV(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return src, nil
+	}
+	f.Close()
+	return openFFmpeg(ctx, path)
+}
+
+// wavSource PCM 16/24/32 бит или float32, любое число каналов и частота
+type wavSource struct {
+	f        *os.File
+	r        *bufio.Reader
+	channels int
+	format   int // 1 — PCM, 3 — float
+	bits     int
+	left     int64 // байт данных до конца
+	duration float64
+	rs       resampler
+}
+
+func newWAV(f *os.File) (*wavSource, error) {
+	r := bufio.NewReaderSize(f, 64<<10)
+	w := &wavSource{f: f, r: r}
+	var rate int
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, fmt.Errorf("wav: no data chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		switch string(hdr[:4]) {
+		case "fmt ":
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(r, buf); err != nil || size < 16 {
+				return nil, fmt.Errorf("wav: bad fmt chunk")
+			}
+			w.format = int(binary.LittleEndian.Uint16(buf[0:]))
+			w.channels = int(binary.LittleEndian.Uint16(buf[2:]))
+			rate = int(binary.LittleEndian.Uint32(buf[4:]))
+			w.bits = int(binary.LittleEndian.Uint16(buf[14:]))
+			if w.format == 0xFFFE && size >= 26 { // WAVE_FORMAT_EXTENSIBLE: формат в GUID
+				w.format = int(binary.LittleEndian.Uint16(buf[24:]))
+			}
+		case "data":
+			if w.channels == 0 {
+				return nil, fmt.Errorf("wav: data before fmt")
+			}
+			if !(w.format == 1 && (w.bits == 16 || w.bits == 24 || w.bits == 32)) && !(w.format == 3 && w.bits == 32) {
+				return nil, fmt.Errorf("wav: unsupported format %d/%d bit", w.format, w.bits)
+			}
+			w.left = size
+			frame := int64(w.channels * w.bits / 8)
+			w.duration = float64(size/frame) / float64(rate)
+			w.rs = resampler{ratio: float64(rate) / SampleRate}
+			return w, nil
+		default:
+			if _, err := r.Discard(int(size + size%2)); err != nil {
+				return nil, fmt.Errorf("wav: truncated")
+			}
+		}
+	}
+}
+
+func (w *wavSource) Read(buf []float32) (int, error) {
+	frameBytes := w.channels * w.bits / 8
+	for len(w.rs.out) < len(buf) && w.left >= int64(frameBytes) {
+		chunk := make([]float32, 0, 4096)
+		for len(chunk) < cap(chunk) && w.left >= int64(frameBytes) {
+			v, err := w.frame(frameBytes)
+			if err != nil {
+				w.left = 0
+				break
+			}
+			chunk = append(chunk, v)
+		}
+		w.rs.push(chunk)
+	}
+	n := copy(buf, w.rs.out)
+	w.rs.out = w.rs.out[n:]
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// frame один отсчёт, усреднённый по каналам
+func (w *wavSource) frame(size int) (float32, error) {
+	var b [32 * 4]byte
+	p := b[:size]
+	if size > len(b) {
+		p = make([]byte, size)
+	}
+	if _, err := io.ReadFull(w.r, p); err != nil {
+		return 0, err
+	}
+	w.left -= int64(size)
+
+	var sum float64
+	step := w.bits / 8
+	for c := 0; c < w.channels; c++ {
+		s := p[c*step:]
+		switch {
+		case w.format == 3:
+			sum += float64(math.Float32frombits(binary.LittleEndian.Uint32(s)))
+		case w.bits == 16:
+			sum += float64(int16(binary.LittleEndian.Uint16(s))) / 32768
+		case w.bits == 24:
+			v := int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24) >> 8
+			sum += float64(v) / (1 << 23)
+		case w.bits == 32:
+			sum += float64(int32(binary.LittleEndian.Uint32(s))) / (1 << 31)
+		}
+	}
+	return float32(sum / float64(w.channels)), nil
+}
+
+func (w *wavSource) Duration() float64 { return w.duration }
+func (w *wavSource) Close() error      { return w.f.Close() }
+
+// resampler линейная интерполяция в SampleRate; для речи достаточно
+type resampler struct {
+	ratio float64 // входная частота / выходная
+	pos   float64 // позиция следующего выходного отсчёта во входном потоке
+	prev  float32 // последний отсчёт предыдущего куска
+	seen  bool
+	base  float64 // номер первого отсчёта текущего куска
+	out   []float32
+}
+
+func (r *resampler) push(in []float32) {
+	if r.ratio == 1 {
+		r.out = append(r.out, in...)
+		return
+	}
+	at := func(i int) float32 {
+		if i < 0 {
+			return r.prev
+		}
+		return in[i]
+	}
+	end := r.base + float64(len(in))
+	for r.pos < end-1 {
+		x := r.pos - r.base
+		i := int(math.Floor(x))
+		if i < 0 && !r.seen {
+			i = 0
+		}
+		frac := float32(x - float64(i))
+		r.out = append(r.out, at(i)+(at(i+1)-at(i))*frac)
+		r.pos += r.ratio
+	}
+	if len(in) > 0 {
+		r.prev = in[len(in)-1]
+		r.seen = true
+	}
+	r.base = end
+}
+
+// ffmpegSource mp3, m4a, ogg и прочее через внешний ffmpeg
+type ffmpegSource struct {
+	cmd      *exec.Cmd
+	out      io.ReadCloser
+	r        *bufio.Reader
+	duration float64
+	stderr   bytes.Buffer
+}
+
+func openFFmpeg(ctx context.Context, path string) (*ffmpegSource, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, fmt.Errorf("unsupported audio format: only WAV without ffmpeg")
+	}
+	s := &ffmpegSource{duration: probeDuration(ctx, path)}
+	s.cmd = exec.CommandContext(ctx, "ffmpeg", "-nostdin", "-v", "error", "-i", path,
+		"-f", "f32le", "-ac", "1", "-ar", strconv.Itoa(SampleRate), "-")
+	s.cmd.Stderr = &s.stderr
+	out, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	s.out = out
+	s.r = bufio.NewReaderSize(out, 64<<10)
+	return s, nil
+}
+
+func (s *ffmpegSource) Read(buf []float32) (int, error) {
+	raw := make([]byte, len(buf)*4)
+	n, err := io.ReadFull(s.r, raw)
+	n /= 4
+	for i := 0; i < n; i++ {
+		buf[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	if err == io.EOF {
+		if werr := s.cmd.Wait(); werr != nil {
+			return 0, fmt.Errorf("ffmpeg: %v: %s", werr, strings.TrimSpace(s.stderr.String()))
+		}
+		s.cmd = nil
+	}
+	return n, err
+}
+
+func (s *ffmpegSource) Duration() float64 { return s.duration }
+
+func (s *ffmpegSource) Close() error {
+	s.out.Close()
+	if s.cmd != nil {
+		s.cmd.Wait()
+	}
+	return nil
+}
+
+// probeDuration длительность по ffprobe; без него прогресс неизвестен
+func probeDuration(ctx context.Context, path string) float64 {
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0
+	}
+	d, _ := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	return d
+}
@@ -0,0 +1,148 @@
+// Package transcribe расшифровка загруженного аудиофайла тем же
+// распознавателем и конвейером, что и живая диктовка.
+package transcribe
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/mbykov/wshandler-go"
+)
+
+// Engine потоковый распознаватель; *asr.ASRModule подходит как есть
+type Engine interface {
+	Write(pcm []float32) asr.Response
+	Finish() asr.Response
+	Close()
+}
+
+// chunk 100 мс — как присылает браузер при диктовке
+const chunk = SampleRate / 10
+
+// Transcriber собирает из файла запись так же, как из сессии WebSocket
+type Transcriber struct {
+	// NewEngine создаёт распознаватель; hotwords — файл горячих слов или ""
+	NewEngine func(hotwords string) (Engine, error)
+	Pipeline  *wshandler.Pipeline
+	Segment   wshandler.SegmentConfig
+	// Hotwords файл горячих слов пользователя, может быть nil
+	Hotwords func(user string) string
+	// Stages стадии конвейера, включённые или выключенные пользователем, может быть nil
+	Stages func(user string) map[string]bool
+	// AudioDir куда сохранять WAV 16 кГц для воспроизведения; пусто — не сохранять
+	AudioDir string
+}
+
+// Run расшифровывает файл. Время фраз и абзацев — started плюс смещение
+// в записи, так что паузы в файле делят текст на абзацы как вживую.
+func (t *Transcriber) Run(ctx context.Context, id, user, path string, started time.Time, progress func(float64)) (wshandler.SessionRecord, error) {
+	rec := wshandler.SessionRecord{ID: id, User: user, Started: started}
+
+	src, err := Open(ctx, path)
+	if err != nil {
+		return rec, err
+	}
+	defer src.Close()
+
+	hotwords := ""
+	if t.Hotwords != nil {
+		hotwords = t.Hotwords(user)
+	}
+	var stages map[string]bool
+	if t.Stages != nil {
+		stages = t.Stages(user)
+	}
+	engine, err := t.NewEngine(hotwords)
+	if err != nil {
+		return rec, err
+	}
+	defer engine.Close()
+
+	// копия в том же формате, что и запись живой сессии: время слов
+	// отсчитывается от начала файла
+	var recorder *wshandler.Recorder
+	var audio string
+	if t.AudioDir != "" {
+		audio = filepath.Join(t.AudioDir, strings.ReplaceAll(id, ":", "-")+".wav")
+		if recorder, err = wshandler.NewRecorder(audio); err != nil {
+			return rec, err
+		}
+		// ошибка или отмена: недописанный файл не нужен
+		defer func() {
+			if recorder != nil {
+				recorder.Close()
+				os.Remove(audio)
+			}
+		}()
+	}
+
+	doc := wshandler.NewDocument(0, t.Segment)
+	var samples int
+	at := func() time.Time {
+		return started.Add(time.Duration(samples) * time.Second / SampleRate)
+	}
+
+	var uttStart time.Time
+	handle := func(resp asr.Response) {
+		if resp.Text == "" {
+			return
+		}
+		if uttStart.IsZero() {
+			uttStart = at()
+		}
+		if resp.Type != "final" {
+			return
+		}
+		seg := &wshandler.Segment{Type: resp.Type, Text: resp.Text, Raw: resp.Text, User: user, Start: uttStart}
+		uttStart = time.Time{}
+		t.Pipeline.Run(seg, stages)
+		if seg.Text == "" {
+			return
+		}
+		end := at()
+		rec.Finals = append(rec.Finals, wshandler.FinalRecord{Type: "final", Text: seg.Text, Raw: seg.Raw, Words: resp.Words, Tasks: seg.Tasks, At: end})
+		doc.AppendText(seg.Text, seg.Start, end)
+	}
+
+	buf := make([]float32, chunk)
+	total := src.Duration() * SampleRate
+	for {
+		if err := ctx.Err(); err != nil {
+			return rec, err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			samples += n
+			if recorder != nil {
+				recorder.Write(buf[:n])
+			}
+			handle(engine.Write(buf[:n]))
+			if progress != nil && total > 0 {
+				progress(min(float64(samples)/total*100, 99))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rec, err
+		}
+	}
+	handle(engine.Finish())
+
+	rec.Ended = at()
+	rec.Paragraphs = doc.Paragraphs()
+	if recorder != nil {
+		err, recorder = recorder.Close(), nil
+		if err != nil {
+			return rec, err
+		}
+		rec.Audio = audio
+	}
+	return rec, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"bhl-diary/accounts"
+	"golang.org/x/term"
+)
+
+// runUsers bhl-diary users add|passwd|delete|list -user anna [-config config.yaml]
+func runUsers(args []string) {
+	if len(args) == 0 {
+		log.Fatal("❌ bhl-diary users add|passwd|delete|list")
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("users "+action, flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "путь к конфигу")
+	name := fs.String("user", "", "имя пользователя")
+	fs.Parse(args[1:])
+
+	cfg := loadConfig(*configPath)
+	// учётные записи не шифруются: парольная фраза дневника не нужна
+	st := openPlainStore(cfg)
+	defer st.Close()
+	m := accounts.New(st, cfg.Accounts)
+	ctx := context.Background()
+
+	if action != "list" && *name == "" {
+		log.Fatal("❌ Не указан -user")
+	}
+	switch action {
+	case "add":
+		pass, err := password()
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if _, err := m.Create(ctx, *name, pass); err != nil {
+			log.Fatalf("❌ Не удалось завести пользователя: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "✅ Пользователь %s заведён\n", *name)
+
+	case "passwd":
+		pass, err := password()
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := m.SetPassword(ctx, *name, pass); err != nil {
+			log.Fatalf("❌ Не удалось сменить пароль: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "✅ Пароль %s изменён, все входы закрыты\n", *name)
+
+	case "delete":
+		if err := st.DeleteUser(ctx, *name); err != nil {
+			log.Fatalf("❌ Не удалось удалить пользователя: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "✅ Учётная запись %s удалена; записи дневника остались\n", *name)
+
+	case "list":
+		users, err := st.ListUsers(ctx)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		for _, u := range users {
+			fmt.Printf("%-32s %s\n", u.Name, u.CreatedAt.Format("2006-01-02 15:04"))
+		}
+
+	default:
+		log.Fatalf("❌ Неизвестное действие %q: add, passwd, delete или list", action)
+	}
+}
+
+// password пароль пользователя: BHL_DIARY_PASSWORD или дважды из терминала
+func password() (string, error) {
+	if p := os.Getenv("BHL_DIARY_PASSWORD"); p != "" {
+		return p, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("no password: set BHL_DIARY_PASSWORD")
+	}
+	p, err := ask("Пароль: ")
+	if err != nil {
+		return "", err
+	}
+	again, err := ask("Пароль ещё раз: ")
+	if err != nil {
+		return "", err
+	}
+	if p != again {
+		return "", errors.New("passwords do not match")
+	}
+	return p, nil
+}
@@ -0,0 +1,79 @@
+package grpchandler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mbykov/wshandler-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type userKey struct{}
+
+// UserFromContext пользователь вызова, которого пропустил Authenticator;
+// без проверки доступа — ""
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// Interceptors проверка доступа для grpc.NewServer тем же Authenticator,
+// что и у HTTP и WebSocket: метаданные вызова (authorization: Bearer,
+// cookie) он видит как заголовки запроса. nil — без проверки.
+func Interceptors(auth wshandler.Authenticator) []grpc.ServerOption {
+	if auth == nil {
+		return nil
+	}
+	unary := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, auth)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), auth)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	}
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream)}
+}
+
+// authorize собирает из метаданных HTTP-запрос для Authenticator
+func authorize(ctx context.Context, auth wshandler.Authenticator) (context.Context, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	user, ok := auth(r)
+	if !ok {
+		logger.Warn("gRPC call unauthorized", "remote", r.RemoteAddr)
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return context.WithValue(ctx, userKey{}, user), nil
+}
+
+// authStream стрим с контекстом, в котором уже есть пользователь
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,89 @@
+// Package client — Go-клиент для потокового распознавания через gRPC.
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mbykov/grpchandler-go/recognizepb"
+	"google.golang.org/grpc"
+)
+
+// Client обёртка над соединением с сервисом Recognizer
+type Client struct {
+	conn *grpc.ClientConn
+	rc   recognizepb.RecognizerClient
+}
+
+// Dial подключается к серверу. Транспорт (TLS, bufconn и т.п.) задаётся через opts.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", target, err)
+	}
+	return &Client{
+		conn: conn,
+		rc:   recognizepb.NewRecognizerClient(conn),
+	}, nil
+}
+
+// WithToken токен доступа сервера (auth.tokens или сессия учётной записи)
+// в каждом вызове: authorization: Bearer <token>. Без TLS токен идёт
+// открытым — только для локальной сети и тестов.
+func WithToken(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(tokenCreds(token))
+}
+
+type tokenCreds string
+
+func (t tokenCreds) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCreds) RequireTransportSecurity() bool { return false }
+
+// Recognize открывает стрим и сразу отправляет конфиг сессии
+func (c *Client) Recognize(ctx context.Context, cfg *recognizepb.RecognitionConfig) (*Stream, error) {
+	if cfg == nil {
+		cfg = &recognizepb.RecognitionConfig{}
+	}
+	s, err := c.rc.Recognize(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	if err := s.Send(&recognizepb.RecognizeRequest{
+		Payload: &recognizepb.RecognizeRequest_Config{Config: cfg},
+	}); err != nil {
+		return nil, fmt.Errorf("send config: %w", err)
+	}
+	return &Stream{s: s}, nil
+}
+
+// Close закрывает соединение
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Stream одна сессия распознавания.
+// SendAudio и Recv можно вызывать из разных горутин.
+type Stream struct {
+	s recognizepb.Recognizer_RecognizeClient
+}
+
+// SendAudio отправляет чанк аудио в формате, заявленном в конфиге
+func (s *Stream) SendAudio(chunk []byte) error {
+	return s.s.Send(&recognizepb.RecognizeRequest{
+		Payload: &recognizepb.RecognizeRequest_Audio{Audio: chunk},
+	})
+}
+
+// CloseSend сообщает серверу, что аудио закончилось.
+// После этого Recv вернёт оставшиеся события и io.EOF.
+func (s *Stream) CloseSend() error {
+	return s.s.CloseSend()
+}
+
+// Recv возвращает следующее событие (interim, final, command или error)
+func (s *Stream) Recv() (*recognizepb.RecognizeResponse, error) {
+	return s.s.Recv()
+}
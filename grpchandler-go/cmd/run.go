@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/mbykov/grpchandler-go"
+	"github.com/mbykov/grpchandler-go/client"
+	"github.com/mbykov/grpchandler-go/recognizepb"
+	"github.com/mbykov/wshandler-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Демонстрация на настоящей модели: сервер и клиент в одном процессе,
+// соединены через bufconn. Автоматическая проверка — handler_test.go.
+func main() {
+	modelDir := flag.String("model", "../../Models/streaming-zipformer-small-ru-vosk-int8", "путь к папке модели")
+	wavPath := flag.String("wav", "../../Models/example.wav", "путь к аудио файлу (16 кГц, s16le)")
+	flag.Parse()
+
+	audioData, err := os.ReadFile(*wavPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rawPCM := audioData[44:]
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	pipeline, err := wshandler.BuildPipeline(nil, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	grpchandler.NewServer(asr.Config{ModelDir: *modelDir, SampleRate: 16000}, pipeline).Register(gs)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	c, err := client.Dial("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	stream, err := c.Recognize(ctx, &recognizepb.RecognitionConfig{
+		SampleRate: 16000,
+		Encoding:   recognizepb.AudioEncoding_AUDIO_ENCODING_PCM_S16LE,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("🎙️ Обработка %s через bufconn...\n", *wavPath)
+
+	go func() {
+		chunkSize := 3200 // 100ms
+		for i := 0; i < len(rawPCM); i += chunkSize {
+			end := i + chunkSize
+			if end > len(rawPCM) {
+				end = len(rawPCM)
+			}
+			if err := stream.SendAudio(rawPCM[i:end]); err != nil {
+				log.Printf("❌ send: %v", err)
+				return
+			}
+		}
+		stream.CloseSend()
+	}()
+
+	finals := 0
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("❌ recv: %v", err)
+		}
+		switch e := ev.Event.(type) {
+		case *recognizepb.RecognizeResponse_Interim:
+			fmt.Printf("\r\033[K⏳ INTERIM: %s", e.Interim.Text)
+		case *recognizepb.RecognizeResponse_Final:
+			finals++
+			fmt.Printf("\r\033[K✅ FINAL: %s\n", e.Final.Text)
+		case *recognizepb.RecognizeResponse_Command:
+			fmt.Printf("\r\033[K🧮 COMMAND %s: %s\n", e.Command.Name, e.Command.Script)
+		case *recognizepb.RecognizeResponse_Error:
+			fmt.Printf("\r\033[K⚠️ ERROR %s: %s\n", e.Error.Code, e.Error.Message)
+		}
+	}
+
+	if finals == 0 {
+		log.Fatal("❌ Ни одного final не получено")
+	}
+	fmt.Printf("\n✨ Готово, финалов: %d\n", finals)
+}
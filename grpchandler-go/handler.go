@@ -0,0 +1,403 @@
+package grpchandler
+
+//go:generate protoc -I proto --go_out=. --go_opt=module=github.com/mbykov/grpchandler-go --go-grpc_out=. --go-grpc_opt=module=github.com/mbykov/grpchandler-go proto/recognize.proto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/mbykov/grpchandler-go/recognizepb"
+	"github.com/mbykov/wshandler-go"
+	"github.com/michael/bhl-qwen-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// Engine потоковый распознаватель; *asr.ASRModule подходит как есть
+type Engine interface {
+	Write(pcm []float32) asr.Response
+	Finish() asr.Response
+	Close()
+}
+
+// Server реализует recognizepb.RecognizerServer: тот же распознаватель,
+// конвейер пост-обработки и command-qwen, что и WSHandler, только с
+// типизированными сообщениями.
+type Server struct {
+	recognizepb.UnimplementedRecognizerServer
+	asrCfg     asr.Config
+	pipeline   *wshandler.Pipeline
+	newEngine  func(hotwords string) (Engine, error)
+	resolver   *command.CommandResolver
+	cmdTimeout time.Duration
+	hotwords   func(user string) string
+	userStages func(user string) map[string]bool
+	segment    wshandler.SegmentConfig
+
+	onSession    func(wshandler.SessionStart)
+	onSessionEnd func(wshandler.SessionRecord)
+	onCommand    func(wshandler.CommandRecord)
+
+	liveMu  sync.Mutex // closing и добавление в live
+	closing bool
+	live    sync.WaitGroup
+}
+
+func NewServer(cfg asr.Config, pipeline *wshandler.Pipeline) *Server {
+	s := &Server{asrCfg: cfg, pipeline: pipeline}
+	s.newEngine = func(hotwords string) (Engine, error) {
+		c := s.asrCfg
+		if hotwords != "" {
+			c.HotwordsFile = hotwords
+		}
+		m, err := asr.New(c)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return s
+}
+
+// Register регистрирует сервис на gRPC-сервере
+func (s *Server) Register(gs *grpc.Server) {
+	recognizepb.RegisterRecognizerServer(gs, s)
+}
+
+// SetEngine подменяет распознаватель (другая модель, тесты);
+// hotwords — файл горячих слов пользователя или ""
+func (s *Server) SetEngine(fn func(hotwords string) (Engine, error)) {
+	s.newEngine = fn
+}
+
+// SetCommandResolver подключает command-qwen: финальные фразы, которые
+// конвейер пометил как команды, приходят клиенту событием Command; при
+// ошибке или таймауте — обычным Final.
+func (s *Server) SetCommandResolver(r *command.CommandResolver, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	s.resolver = r
+	s.cmdTimeout = timeout
+}
+
+// SetHotwords задаёт файл горячих слов распознавателя для пользователя
+func (s *Server) SetHotwords(fn func(user string) string) {
+	s.hotwords = fn
+}
+
+// SetUserStages задаёт стадии конвейера, которые пользователь включил
+// или выключил у себя; disable_punctuation из конфига сессии главнее
+func (s *Server) SetUserStages(fn func(user string) map[string]bool) {
+	s.userStages = fn
+}
+
+// SetSegmentation задаёт пороги разбиения текста сессии на абзацы
+func (s *Server) SetSegmentation(cfg wshandler.SegmentConfig) {
+	s.segment = cfg
+}
+
+// OnSessionStart задаёт обработчик начала сессии, как у WSHandler
+func (s *Server) OnSessionStart(fn func(wshandler.SessionStart)) {
+	s.onSession = fn
+}
+
+// OnSessionEnd задаёт обработчик завершённой сессии (запись в дневник).
+// Вызывается после того, как доставлены все финальные фразы и команды,
+// в том числе когда клиент оборвал стрим.
+func (s *Server) OnSessionEnd(fn func(wshandler.SessionRecord)) {
+	s.onSessionEnd = fn
+}
+
+// OnCommand задаёт обработчик разобранной команды; вызывается после
+// отправки клиенту
+func (s *Server) OnCommand(fn func(wshandler.CommandRecord)) {
+	s.onCommand = fn
+}
+
+// Wait ждёт, пока завершатся сессии и их OnSessionEnd; новые сессии
+// получают Unavailable. Вызывать после grpc.Server.Stop: тот обрывает
+// стримы, но не ждёт обработчиков.
+func (s *Server) Wait(ctx context.Context) error {
+	s.liveMu.Lock()
+	s.closing = true
+	s.liveMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.live.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enter false — сервер останавливается
+func (s *Server) enter() bool {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.live.Add(1)
+	return true
+}
+
+// session одна сессия Recognize. Финальные фразы обрабатывает одна
+// горутина по очереди: ответ command-qwen приходит не сразу, а в документ
+// и клиенту фразы должны попасть в порядке диктовки.
+type session struct {
+	id        string
+	user      string
+	stream    recognizepb.Recognizer_RecognizeServer
+	sendMu    sync.Mutex // grpc.ServerStream допускает только одного писателя
+	overrides map[string]bool
+	uttStart  time.Time // начало текущей фразы, только из читающей горутины
+	started   time.Time
+
+	finals chan *wshandler.Segment
+	done   chan struct{}
+	// дальше — только из горутины финальных фраз
+	cmdCtx  command.CommandContext
+	records []wshandler.FinalRecord
+	doc     *wshandler.Document
+}
+
+func (s *Server) Recognize(stream recognizepb.Recognizer_RecognizeServer) error {
+	if !s.enter() {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	defer s.live.Done()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	cfg := first.GetConfig()
+	if cfg == nil {
+		return status.Error(codes.InvalidArgument, "first message must be config")
+	}
+	if cfg.SampleRate != 0 && int(cfg.SampleRate) != s.asrCfg.SampleRate {
+		return status.Errorf(codes.InvalidArgument, "unsupported sample rate %d, server expects %d", cfg.SampleRate, s.asrCfg.SampleRate)
+	}
+
+	user := UserFromContext(stream.Context())
+	hotwords := ""
+	if s.hotwords != nil {
+		hotwords = s.hotwords(user)
+	}
+	engine, err := s.newEngine(hotwords)
+	if err != nil {
+		logger.Error("ASR Init failed", "err", err)
+		return status.Errorf(codes.Internal, "asr init: %v", err)
+	}
+	defer engine.Close()
+
+	sess := &session{
+		id:        newSessionID(),
+		user:      user,
+		stream:    stream,
+		overrides: map[string]bool{},
+		started:   time.Now(),
+		finals:    make(chan *wshandler.Segment, 64),
+		done:      make(chan struct{}),
+		cmdCtx:    command.CommandContext{Type: string(command.TypeFinal)},
+		doc:       wshandler.NewDocument(0, s.segment),
+	}
+	if s.userStages != nil {
+		for name, on := range s.userStages(user) {
+			sess.overrides[name] = on
+		}
+	}
+	if cfg.DisablePunctuation {
+		sess.overrides["punctuation"] = false
+	}
+	logger.Info("New gRPC session", "session", sess.id, "user", user, "encoding", cfg.Encoding.String(), "punctuation", !cfg.DisablePunctuation)
+	if s.onSession != nil {
+		s.onSession(wshandler.SessionStart{ID: sess.id, User: user, Started: sess.started})
+	}
+	if s.onSessionEnd != nil {
+		defer func() {
+			s.onSessionEnd(wshandler.SessionRecord{ID: sess.id, User: user, Started: sess.started, Ended: time.Now(),
+				Finals: sess.records, Paragraphs: sess.doc.Paragraphs()})
+		}()
+	}
+
+	go func() {
+		defer close(sess.done)
+		for seg := range sess.finals {
+			s.deliverFinal(sess, seg)
+		}
+	}()
+	// все финальные фразы доставлены до выхода из Recognize
+	defer func() {
+		close(sess.finals)
+		<-sess.done
+	}()
+
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			if final := engine.Finish(); final.Text != "" {
+				if err := s.handle(sess, final); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				logger.Info("gRPC session closed", "session", sess.id)
+				return nil
+			}
+			logger.Info("gRPC session aborted", "session", sess.id, "err", err)
+			return err
+		}
+
+		if req.GetConfig() != nil {
+			if err := sess.sendError("unexpected_config", "config is accepted only as the first message"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pcm, err := decodeAudio(cfg.Encoding, req.GetAudio())
+		if err != nil {
+			if err := sess.sendError("bad_audio", err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		logger.Debug("Received audio", "bytes", len(req.GetAudio()), "samples", len(pcm))
+
+		if resp := engine.Write(pcm); resp.Text != "" {
+			if err := s.handle(sess, resp); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handle прогоняет результат ASR через конвейер: interim сразу уходит
+// клиенту, final — в очередь финальных фраз
+func (s *Server) handle(sess *session, resp asr.Response) error {
+	// начало фразы — первый результат после предыдущего final
+	if sess.uttStart.IsZero() {
+		sess.uttStart = time.Now()
+	}
+	seg := &wshandler.Segment{Type: resp.Type, Text: resp.Text, Raw: resp.Text, Words: resp.Words, User: sess.user, Start: sess.uttStart}
+	if resp.Type == "final" {
+		sess.uttStart = time.Time{}
+	}
+	s.pipeline.Run(seg, sess.overrides)
+	logger.Info("ASR Result", "type", seg.Type, "text", seg.Text, "command", seg.Command)
+	if seg.Text == "" {
+		return nil
+	}
+	if seg.Type != "final" {
+		return sess.send(&recognizepb.RecognizeResponse{
+			Event: &recognizepb.RecognizeResponse_Interim{Interim: &recognizepb.Interim{Text: seg.Text}},
+		})
+	}
+	sess.finals <- seg
+	return nil
+}
+
+// deliverFinal финальная фраза: команда через command-qwen или обычный текст
+func (s *Server) deliverFinal(sess *session, seg *wshandler.Segment) {
+	if seg.Command && s.resolver != nil && s.resolveCommand(sess, seg) {
+		return
+	}
+	sess.send(&recognizepb.RecognizeResponse{
+		Event: &recognizepb.RecognizeResponse_Final{Final: &recognizepb.Final{Text: seg.Text}},
+	})
+	sess.records = append(sess.records, wshandler.FinalRecord{Type: "final", Text: seg.Text, Raw: seg.Raw, Words: seg.Words, Tasks: seg.Tasks, At: time.Now()})
+	sess.cmdCtx = command.CommandContext{Type: string(command.TypeFinal), Text: seg.Text}
+	sess.doc.AppendText(seg.Text, seg.Start, time.Now())
+}
+
+// resolveCommand false — command-qwen не ответил, фраза уйдёт как текст
+func (s *Server) resolveCommand(sess *session, seg *wshandler.Segment) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cmdTimeout)
+	defer cancel()
+
+	start := time.Now()
+	cmdCtx := sess.cmdCtx
+	resp, err := s.resolver.Resolve(ctx, command.CommandRequest{Context: &cmdCtx, CurrentText: seg.Text})
+	if err != nil {
+		logger.Warn("Command resolve failed, sending plain final", "err", err, "text", seg.Text)
+		return false
+	}
+	dur := time.Since(start)
+	logger.Info("Command resolved", "name", resp.Name, "script", resp.Script, "dur", dur)
+	sess.send(&recognizepb.RecognizeResponse{
+		Event: &recognizepb.RecognizeResponse_Command{Command: &recognizepb.Command{Name: resp.Name, Script: resp.Script, Text: resp.Text}},
+	})
+	sess.records = append(sess.records, wshandler.FinalRecord{Type: string(resp.Type), Text: resp.Text, Raw: seg.Raw, Name: resp.Name, Script: resp.Script, Words: seg.Words, At: time.Now()})
+	sess.cmdCtx = command.CommandContext{Type: string(command.TypeCommand), Text: resp.Text, Script: resp.Script}
+	sess.doc.AppendFormula(resp.Script, resp.Name == "editLatex", time.Now())
+	if s.onCommand != nil {
+		s.onCommand(wshandler.CommandRecord{Session: sess.id, User: sess.user, Name: resp.Name,
+			Text: resp.Text, Script: resp.Script, Raw: seg.Raw, Duration: dur})
+	}
+	return true
+}
+
+// send безопасно из любой горутины сессии
+func (sess *session) send(resp *recognizepb.RecognizeResponse) error {
+	sess.sendMu.Lock()
+	defer sess.sendMu.Unlock()
+	return sess.stream.Send(resp)
+}
+
+func (sess *session) sendError(code, msg string) error {
+	return sess.send(&recognizepb.RecognizeResponse{
+		Event: &recognizepb.RecognizeResponse_Error{Error: &recognizepb.Error{Code: code, Message: msg}},
+	})
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// decodeAudio приводит чанк к float32 — формату, который ест asr
+func decodeAudio(enc recognizepb.AudioEncoding, b []byte) ([]float32, error) {
+	switch enc {
+	case recognizepb.AudioEncoding_AUDIO_ENCODING_UNSPECIFIED, recognizepb.AudioEncoding_AUDIO_ENCODING_FLOAT32_LE:
+		if len(b)%4 != 0 {
+			return nil, fmt.Errorf("float32 chunk length %d is not a multiple of 4", len(b))
+		}
+		samples := make([]float32, len(b)/4)
+		for i := 0; i < len(b); i += 4 {
+			samples[i/4] = math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4]))
+		}
+		return samples, nil
+	case recognizepb.AudioEncoding_AUDIO_ENCODING_PCM_S16LE:
+		if len(b)%2 != 0 {
+			return nil, fmt.Errorf("s16 chunk length %d is not a multiple of 2", len(b))
+		}
+		samples := make([]float32, len(b)/2)
+		for i := 0; i < len(b); i += 2 {
+			samples[i/2] = float32(int16(binary.LittleEndian.Uint16(b[i:i+2]))) / 32768.0
+		}
+		return samples, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %v", enc)
+	}
+}
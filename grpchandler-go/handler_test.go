@@ -0,0 +1,259 @@
+package grpchandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/mbykov/grpchandler-go/client"
+	"github.com/mbykov/grpchandler-go/recognizepb"
+	"github.com/mbykov/wshandler-go"
+	"github.com/michael/bhl-qwen-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeEngine отвечает на каждый чанк аудио следующим результатом из списка
+type fakeEngine struct {
+	script []asr.Response
+	tail   asr.Response
+}
+
+func (e *fakeEngine) Write([]float32) asr.Response {
+	if len(e.script) == 0 {
+		return asr.Response{}
+	}
+	r := e.script[0]
+	e.script = e.script[1:]
+	return r
+}
+
+func (e *fakeEngine) Finish() asr.Response { return e.tail }
+func (e *fakeEngine) Close()               {}
+
+// event событие стрима строкой: "final: текст"
+func event(r *recognizepb.RecognizeResponse) string {
+	switch e := r.Event.(type) {
+	case *recognizepb.RecognizeResponse_Interim:
+		return "interim: " + e.Interim.Text
+	case *recognizepb.RecognizeResponse_Final:
+		return "final: " + e.Final.Text
+	case *recognizepb.RecognizeResponse_Command:
+		return fmt.Sprintf("command %s: %s | %s", e.Command.Name, e.Command.Text, e.Command.Script)
+	case *recognizepb.RecognizeResponse_Error:
+		return "error: " + e.Error.Code
+	}
+	return fmt.Sprintf("unknown %T", r.Event)
+}
+
+// startServer сервер на bufconn: токен "secret" — пользователь anna,
+// command-qwen — httptest, отвечает с задержкой; setup — до первого вызова
+func startServer(t *testing.T, engine func() Engine, setup func(*Server, *grpc.Server)) (dial func(opts ...grpc.DialOption) *client.Client, hotwords chan string) {
+	t.Helper()
+	qwen := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, `{"message":{"content":"x^2"}}`)
+	}))
+	t.Cleanup(qwen.Close)
+
+	pipeline, err := wshandler.BuildPipeline([]wshandler.StageConfig{{Name: "command", On: wshandler.OnFinal}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(asr.Config{SampleRate: 16000}, pipeline)
+	hotwords = make(chan string, 1)
+	srv.SetEngine(func(hw string) (Engine, error) {
+		hotwords <- hw
+		return engine(), nil
+	})
+	srv.SetHotwords(func(user string) string { return "hotwords-" + user })
+	srv.SetCommandResolver(command.New(command.Config{Qwen: command.QwenConfig{URL: qwen.URL, TimeoutSec: 5}}), 5*time.Second)
+
+	auth := func(r *http.Request) (string, bool) {
+		return "anna", r.Header.Get("Authorization") == "Bearer secret"
+	}
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(Interceptors(auth)...)
+	srv.Register(gs)
+	if setup != nil {
+		setup(srv, gs)
+	}
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	dial = func(opts ...grpc.DialOption) *client.Client {
+		opts = append(opts,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		c, err := client.Dial("passthrough:///bufconn", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	return dial, hotwords
+}
+
+func TestRecognizeEventOrder(t *testing.T) {
+	ended := make(chan wshandler.SessionRecord, 1)
+	var started wshandler.SessionStart
+	var commands []wshandler.CommandRecord
+	dial, hotwords := startServer(t, func() Engine {
+		return &fakeEngine{
+			script: []asr.Response{
+				{Type: "interim", Text: "сегодня"},
+				{Type: "final", Text: "сегодня тепло"},
+				{Type: "interim", Text: "команда икс"},
+				{Type: "final", Text: "команда икс в квадрате"},
+				{Type: "final", Text: "потом гуляли"},
+			},
+			tail: asr.Response{Type: "final", Text: "до вечера"},
+		}
+	}, func(srv *Server, _ *grpc.Server) {
+		srv.OnSessionStart(func(s wshandler.SessionStart) { started = s })
+		srv.OnCommand(func(c wshandler.CommandRecord) { commands = append(commands, c) })
+		srv.OnSessionEnd(func(rec wshandler.SessionRecord) { ended <- rec })
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := dial(client.WithToken("secret")).Recognize(ctx, &recognizepb.RecognitionConfig{
+		SampleRate: 16000,
+		Encoding:   recognizepb.AudioEncoding_AUDIO_ENCODING_PCM_S16LE,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, 3200)
+	next := func() string {
+		t.Helper()
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		return event(ev)
+	}
+	send := func(b []byte) {
+		t.Helper()
+		if err := stream.SendAudio(b); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	var got []string
+	// по событию на чанк: порядок не зависит от планировщика
+	for _, b := range [][]byte{chunk, chunk, chunk[:3], chunk} {
+		send(b)
+		got = append(got, next())
+	}
+	// команда ещё разбирается, а следующая фраза уже продиктована
+	send(chunk)
+	send(chunk)
+	got = append(got, next(), next())
+	stream.CloseSend()
+	got = append(got, next())
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("after last final: %v, want EOF", err)
+	}
+
+	want := []string{
+		"interim: сегодня",
+		"final: сегодня тепло",
+		"error: bad_audio",
+		"interim: команда икс", // стадия command только для окончательных
+		"command createLatex: икс в квадрате | x^2",
+		"final: потом гуляли",
+		"final: до вечера",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events:\n got %q\nwant %q", got, want)
+	}
+	if hw := <-hotwords; hw != "hotwords-anna" {
+		t.Errorf("hotwords %q, want hotwords-anna: user is not in the session", hw)
+	}
+
+	// запись сессии для дневника — в порядке диктовки, с командой
+	rec := <-ended
+	var finals []string
+	for _, f := range rec.Finals {
+		finals = append(finals, f.Type+": "+f.Text)
+	}
+	wantFinals := []string{"final: сегодня тепло", "command: икс в квадрате", "final: потом гуляли", "final: до вечера"}
+	if fmt.Sprint(finals) != fmt.Sprint(wantFinals) {
+		t.Errorf("session finals:\n got %q\nwant %q", finals, wantFinals)
+	}
+	if rec.User != "anna" || rec.ID == "" || rec.ID != started.ID || len(rec.Paragraphs) == 0 {
+		t.Errorf("session record %+v, start %+v", rec, started)
+	}
+	if len(commands) != 1 || commands[0].Session != rec.ID || commands[0].Script != "x^2" || commands[0].Raw != "команда икс в квадрате" {
+		t.Errorf("commands %+v", commands)
+	}
+}
+
+// TestRecognizeStopSavesSession остановка сервера посреди диктовки:
+// Wait дожидается сессии, хвост распознавания попадает в запись
+func TestRecognizeStopSavesSession(t *testing.T) {
+	var srv *Server
+	var gs *grpc.Server
+	var rec wshandler.SessionRecord
+	dial, _ := startServer(t, func() Engine {
+		return &fakeEngine{
+			script: []asr.Response{{Type: "final", Text: "первая фраза"}},
+			tail:   asr.Response{Type: "final", Text: "недосказанное"},
+		}
+	}, func(s *Server, g *grpc.Server) {
+		srv, gs = s, g
+		s.OnSessionEnd(func(r wshandler.SessionRecord) {
+			time.Sleep(50 * time.Millisecond) // медленное сохранение
+			rec = r
+		})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := dial(client.WithToken("secret")).Recognize(ctx, &recognizepb.RecognitionConfig{SampleRate: 16000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendAudio(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if ev, err := stream.Recv(); err != nil || event(ev) != "final: первая фраза" {
+		t.Fatalf("first event %v, %v", ev, err)
+	}
+
+	gs.Stop()
+	if err := srv.Wait(ctx); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	var finals []string
+	for _, f := range rec.Finals {
+		finals = append(finals, f.Text)
+	}
+	if fmt.Sprint(finals) != "[первая фраза недосказанное]" {
+		t.Errorf("saved finals %q", finals)
+	}
+}
+
+func TestRecognizeUnauthenticated(t *testing.T) {
+	dial, _ := startServer(t, func() Engine { return &fakeEngine{} }, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, c := range []*client.Client{dial(), dial(client.WithToken("wrong"))} {
+		stream, err := c.Recognize(ctx, nil)
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("without a valid token: %v, want Unauthenticated", err)
+		}
+	}
+}
@@ -0,0 +1,643 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: recognize.proto
+
+package recognizepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// AudioEncoding формат аудио-чанков.
+type AudioEncoding int32
+
+const (
+	AudioEncoding_AUDIO_ENCODING_UNSPECIFIED AudioEncoding = 0 // как в WebSocket: float32 little-endian
+	AudioEncoding_AUDIO_ENCODING_FLOAT32_LE  AudioEncoding = 1
+	AudioEncoding_AUDIO_ENCODING_PCM_S16LE   AudioEncoding = 2
+)
+
+// Enum value maps for AudioEncoding.
+var (
+	AudioEncoding_name = map[int32]string{
+		0: "AUDIO_ENCODING_UNSPECIFIED",
+		1: "AUDIO_ENCODING_FLOAT32_LE",
+		2: "AUDIO_ENCODING_PCM_S16LE",
+	}
+	AudioEncoding_value = map[string]int32{
+		"AUDIO_ENCODING_UNSPECIFIED": 0,
+		"AUDIO_ENCODING_FLOAT32_LE":  1,
+		"AUDIO_ENCODING_PCM_S16LE":   2,
+	}
+)
+
+func (x AudioEncoding) Enum() *AudioEncoding {
+	p := new(AudioEncoding)
+	*p = x
+	return p
+}
+
+func (x AudioEncoding) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AudioEncoding) Descriptor() protoreflect.EnumDescriptor {
+	return file_recognize_proto_enumTypes[0].Descriptor()
+}
+
+func (AudioEncoding) Type() protoreflect.EnumType {
+	return &file_recognize_proto_enumTypes[0]
+}
+
+func (x AudioEncoding) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AudioEncoding.Descriptor instead.
+func (AudioEncoding) EnumDescriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{0}
+}
+
+type RecognitionConfig struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	SampleRate         int32                  `protobuf:"varint,1,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"` // 0 — частота из конфига сервера
+	Encoding           AudioEncoding          `protobuf:"varint,2,opt,name=encoding,proto3,enum=bhl.recognize.v1.AudioEncoding" json:"encoding,omitempty"`
+	DisablePunctuation bool                   `protobuf:"varint,3,opt,name=disable_punctuation,json=disablePunctuation,proto3" json:"disable_punctuation,omitempty"` // по умолчанию пунктуация включена, если сервер её поддерживает
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *RecognitionConfig) Reset() {
+	*x = RecognitionConfig{}
+	mi := &file_recognize_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecognitionConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecognitionConfig) ProtoMessage() {}
+
+func (x *RecognitionConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_recognize_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecognitionConfig.ProtoReflect.Descriptor instead.
+func (*RecognitionConfig) Descriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RecognitionConfig) GetSampleRate() int32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *RecognitionConfig) GetEncoding() AudioEncoding {
+	if x != nil {
+		return x.Encoding
+	}
+	return AudioEncoding_AUDIO_ENCODING_UNSPECIFIED
+}
+
+func (x *RecognitionConfig) GetDisablePunctuation() bool {
+	if x != nil {
+		return x.DisablePunctuation
+	}
+	return false
+}
+
+type RecognizeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*RecognizeRequest_Config
+	//	*RecognizeRequest_Audio
+	Payload       isRecognizeRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecognizeRequest) Reset() {
+	*x = RecognizeRequest{}
+	mi := &file_recognize_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecognizeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecognizeRequest) ProtoMessage() {}
+
+func (x *RecognizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recognize_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecognizeRequest.ProtoReflect.Descriptor instead.
+func (*RecognizeRequest) Descriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RecognizeRequest) GetPayload() isRecognizeRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *RecognizeRequest) GetConfig() *RecognitionConfig {
+	if x != nil {
+		if x, ok := x.Payload.(*RecognizeRequest_Config); ok {
+			return x.Config
+		}
+	}
+	return nil
+}
+
+func (x *RecognizeRequest) GetAudio() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*RecognizeRequest_Audio); ok {
+			return x.Audio
+		}
+	}
+	return nil
+}
+
+type isRecognizeRequest_Payload interface {
+	isRecognizeRequest_Payload()
+}
+
+type RecognizeRequest_Config struct {
+	Config *RecognitionConfig `protobuf:"bytes,1,opt,name=config,proto3,oneof"` // только первым сообщением
+}
+
+type RecognizeRequest_Audio struct {
+	Audio []byte `protobuf:"bytes,2,opt,name=audio,proto3,oneof"` // моно PCM в формате config.encoding
+}
+
+func (*RecognizeRequest_Config) isRecognizeRequest_Payload() {}
+
+func (*RecognizeRequest_Audio) isRecognizeRequest_Payload() {}
+
+type Interim struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Interim) Reset() {
+	*x = Interim{}
+	mi := &file_recognize_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Interim) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Interim) ProtoMessage() {}
+
+func (x *Interim) ProtoReflect() protoreflect.Message {
+	mi := &file_recognize_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Interim.ProtoReflect.Descriptor instead.
+func (*Interim) Descriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Interim) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type Final struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Final) Reset() {
+	*x = Final{}
+	mi := &file_recognize_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Final) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Final) ProtoMessage() {}
+
+func (x *Final) ProtoReflect() protoreflect.Message {
+	mi := &file_recognize_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Final.ProtoReflect.Descriptor instead.
+func (*Final) Descriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Final) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+// Command — результат command-qwen (createLatex / editLatex).
+type Command struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Script        string                 `protobuf:"bytes,2,opt,name=script,proto3" json:"script,omitempty"`
+	Text          string                 `protobuf:"bytes,3,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Command) Reset() {
+	*x = Command{}
+	mi := &file_recognize_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Command) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command) ProtoMessage() {}
+
+func (x *Command) ProtoReflect() protoreflect.Message {
+	mi := &file_recognize_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command.ProtoReflect.Descriptor instead.
+func (*Command) Descriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Command) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Command) GetScript() string {
+	if x != nil {
+		return x.Script
+	}
+	return ""
+}
+
+func (x *Command) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_recognize_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_recognize_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type RecognizeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*RecognizeResponse_Interim
+	//	*RecognizeResponse_Final
+	//	*RecognizeResponse_Command
+	//	*RecognizeResponse_Error
+	Event         isRecognizeResponse_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecognizeResponse) Reset() {
+	*x = RecognizeResponse{}
+	mi := &file_recognize_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecognizeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecognizeResponse) ProtoMessage() {}
+
+func (x *RecognizeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_recognize_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecognizeResponse.ProtoReflect.Descriptor instead.
+func (*RecognizeResponse) Descriptor() ([]byte, []int) {
+	return file_recognize_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RecognizeResponse) GetEvent() isRecognizeResponse_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *RecognizeResponse) GetInterim() *Interim {
+	if x != nil {
+		if x, ok := x.Event.(*RecognizeResponse_Interim); ok {
+			return x.Interim
+		}
+	}
+	return nil
+}
+
+func (x *RecognizeResponse) GetFinal() *Final {
+	if x != nil {
+		if x, ok := x.Event.(*RecognizeResponse_Final); ok {
+			return x.Final
+		}
+	}
+	return nil
+}
+
+func (x *RecognizeResponse) GetCommand() *Command {
+	if x != nil {
+		if x, ok := x.Event.(*RecognizeResponse_Command); ok {
+			return x.Command
+		}
+	}
+	return nil
+}
+
+func (x *RecognizeResponse) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Event.(*RecognizeResponse_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isRecognizeResponse_Event interface {
+	isRecognizeResponse_Event()
+}
+
+type RecognizeResponse_Interim struct {
+	Interim *Interim `protobuf:"bytes,1,opt,name=interim,proto3,oneof"`
+}
+
+type RecognizeResponse_Final struct {
+	Final *Final `protobuf:"bytes,2,opt,name=final,proto3,oneof"`
+}
+
+type RecognizeResponse_Command struct {
+	Command *Command `protobuf:"bytes,3,opt,name=command,proto3,oneof"`
+}
+
+type RecognizeResponse_Error struct {
+	Error *Error `protobuf:"bytes,4,opt,name=error,proto3,oneof"`
+}
+
+func (*RecognizeResponse_Interim) isRecognizeResponse_Event() {}
+
+func (*RecognizeResponse_Final) isRecognizeResponse_Event() {}
+
+func (*RecognizeResponse_Command) isRecognizeResponse_Event() {}
+
+func (*RecognizeResponse_Error) isRecognizeResponse_Event() {}
+
+var File_recognize_proto protoreflect.FileDescriptor
+
+const file_recognize_proto_rawDesc = "" +
+	"\n" +
+	"\x0frecognize.proto\x12\x10bhl.recognize.v1\"\xa2\x01\n" +
+	"\x11RecognitionConfig\x12\x1f\n" +
+	"\vsample_rate\x18\x01 \x01(\x05R\n" +
+	"sampleRate\x12;\n" +
+	"\bencoding\x18\x02 \x01(\x0e2\x1f.bhl.recognize.v1.AudioEncodingR\bencoding\x12/\n" +
+	"\x13disable_punctuation\x18\x03 \x01(\bR\x12disablePunctuation\"t\n" +
+	"\x10RecognizeRequest\x12=\n" +
+	"\x06config\x18\x01 \x01(\v2#.bhl.recognize.v1.RecognitionConfigH\x00R\x06config\x12\x16\n" +
+	"\x05audio\x18\x02 \x01(\fH\x00R\x05audioB\t\n" +
+	"\apayload\"\x1d\n" +
+	"\aInterim\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\"\x1b\n" +
+	"\x05Final\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\"I\n" +
+	"\aCommand\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06script\x18\x02 \x01(\tR\x06script\x12\x12\n" +
+	"\x04text\x18\x03 \x01(\tR\x04text\"5\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\xec\x01\n" +
+	"\x11RecognizeResponse\x125\n" +
+	"\ainterim\x18\x01 \x01(\v2\x19.bhl.recognize.v1.InterimH\x00R\ainterim\x12/\n" +
+	"\x05final\x18\x02 \x01(\v2\x17.bhl.recognize.v1.FinalH\x00R\x05final\x125\n" +
+	"\acommand\x18\x03 \x01(\v2\x19.bhl.recognize.v1.CommandH\x00R\acommand\x12/\n" +
+	"\x05error\x18\x04 \x01(\v2\x17.bhl.recognize.v1.ErrorH\x00R\x05errorB\a\n" +
+	"\x05event*l\n" +
+	"\rAudioEncoding\x12\x1e\n" +
+	"\x1aAUDIO_ENCODING_UNSPECIFIED\x10\x00\x12\x1d\n" +
+	"\x19AUDIO_ENCODING_FLOAT32_LE\x10\x01\x12\x1c\n" +
+	"\x18AUDIO_ENCODING_PCM_S16LE\x10\x022f\n" +
+	"\n" +
+	"Recognizer\x12X\n" +
+	"\tRecognize\x12\".bhl.recognize.v1.RecognizeRequest\x1a#.bhl.recognize.v1.RecognizeResponse(\x010\x01B.Z,github.com/mbykov/grpchandler-go/recognizepbb\x06proto3"
+
+var (
+	file_recognize_proto_rawDescOnce sync.Once
+	file_recognize_proto_rawDescData []byte
+)
+
+func file_recognize_proto_rawDescGZIP() []byte {
+	file_recognize_proto_rawDescOnce.Do(func() {
+		file_recognize_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_recognize_proto_rawDesc), len(file_recognize_proto_rawDesc)))
+	})
+	return file_recognize_proto_rawDescData
+}
+
+var file_recognize_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_recognize_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_recognize_proto_goTypes = []any{
+	(AudioEncoding)(0),        // 0: bhl.recognize.v1.AudioEncoding
+	(*RecognitionConfig)(nil), // 1: bhl.recognize.v1.RecognitionConfig
+	(*RecognizeRequest)(nil),  // 2: bhl.recognize.v1.RecognizeRequest
+	(*Interim)(nil),           // 3: bhl.recognize.v1.Interim
+	(*Final)(nil),             // 4: bhl.recognize.v1.Final
+	(*Command)(nil),           // 5: bhl.recognize.v1.Command
+	(*Error)(nil),             // 6: bhl.recognize.v1.Error
+	(*RecognizeResponse)(nil), // 7: bhl.recognize.v1.RecognizeResponse
+}
+var file_recognize_proto_depIdxs = []int32{
+	0, // 0: bhl.recognize.v1.RecognitionConfig.encoding:type_name -> bhl.recognize.v1.AudioEncoding
+	1, // 1: bhl.recognize.v1.RecognizeRequest.config:type_name -> bhl.recognize.v1.RecognitionConfig
+	3, // 2: bhl.recognize.v1.RecognizeResponse.interim:type_name -> bhl.recognize.v1.Interim
+	4, // 3: bhl.recognize.v1.RecognizeResponse.final:type_name -> bhl.recognize.v1.Final
+	5, // 4: bhl.recognize.v1.RecognizeResponse.command:type_name -> bhl.recognize.v1.Command
+	6, // 5: bhl.recognize.v1.RecognizeResponse.error:type_name -> bhl.recognize.v1.Error
+	2, // 6: bhl.recognize.v1.Recognizer.Recognize:input_type -> bhl.recognize.v1.RecognizeRequest
+	7, // 7: bhl.recognize.v1.Recognizer.Recognize:output_type -> bhl.recognize.v1.RecognizeResponse
+	7, // [7:8] is the sub-list for method output_type
+	6, // [6:7] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_recognize_proto_init() }
+func file_recognize_proto_init() {
+	if File_recognize_proto != nil {
+		return
+	}
+	file_recognize_proto_msgTypes[1].OneofWrappers = []any{
+		(*RecognizeRequest_Config)(nil),
+		(*RecognizeRequest_Audio)(nil),
+	}
+	file_recognize_proto_msgTypes[6].OneofWrappers = []any{
+		(*RecognizeResponse_Interim)(nil),
+		(*RecognizeResponse_Final)(nil),
+		(*RecognizeResponse_Command)(nil),
+		(*RecognizeResponse_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_recognize_proto_rawDesc), len(file_recognize_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_recognize_proto_goTypes,
+		DependencyIndexes: file_recognize_proto_depIdxs,
+		EnumInfos:         file_recognize_proto_enumTypes,
+		MessageInfos:      file_recognize_proto_msgTypes,
+	}.Build()
+	File_recognize_proto = out.File
+	file_recognize_proto_goTypes = nil
+	file_recognize_proto_depIdxs = nil
+}
@@ -0,0 +1,129 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: recognize.proto
+
+package recognizepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Recognizer_Recognize_FullMethodName = "/bhl.recognize.v1.Recognizer/Recognize"
+)
+
+// RecognizerClient is the client API for Recognizer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Recognizer — потоковое распознавание речи.
+//
+// Клиент первым сообщением шлёт RecognitionConfig, затем аудио-чанки.
+// Сервер отвечает событиями interim/final/command/error по мере распознавания.
+// Закрытие отправляющей стороны (CloseSend) означает конец аудио:
+// сервер дочитывает хвост, шлёт последний final и завершает стрим.
+type RecognizerClient interface {
+	Recognize(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[RecognizeRequest, RecognizeResponse], error)
+}
+
+type recognizerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRecognizerClient(cc grpc.ClientConnInterface) RecognizerClient {
+	return &recognizerClient{cc}
+}
+
+func (c *recognizerClient) Recognize(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[RecognizeRequest, RecognizeResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Recognizer_ServiceDesc.Streams[0], Recognizer_Recognize_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RecognizeRequest, RecognizeResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Recognizer_RecognizeClient = grpc.BidiStreamingClient[RecognizeRequest, RecognizeResponse]
+
+// RecognizerServer is the server API for Recognizer service.
+// All implementations must embed UnimplementedRecognizerServer
+// for forward compatibility.
+//
+// Recognizer — потоковое распознавание речи.
+//
+// Клиент первым сообщением шлёт RecognitionConfig, затем аудио-чанки.
+// Сервер отвечает событиями interim/final/command/error по мере распознавания.
+// Закрытие отправляющей стороны (CloseSend) означает конец аудио:
+// сервер дочитывает хвост, шлёт последний final и завершает стрим.
+type RecognizerServer interface {
+	Recognize(grpc.BidiStreamingServer[RecognizeRequest, RecognizeResponse]) error
+	mustEmbedUnimplementedRecognizerServer()
+}
+
+// UnimplementedRecognizerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRecognizerServer struct{}
+
+func (UnimplementedRecognizerServer) Recognize(grpc.BidiStreamingServer[RecognizeRequest, RecognizeResponse]) error {
+	return status.Error(codes.Unimplemented, "method Recognize not implemented")
+}
+func (UnimplementedRecognizerServer) mustEmbedUnimplementedRecognizerServer() {}
+func (UnimplementedRecognizerServer) testEmbeddedByValue()                    {}
+
+// UnsafeRecognizerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RecognizerServer will
+// result in compilation errors.
+type UnsafeRecognizerServer interface {
+	mustEmbedUnimplementedRecognizerServer()
+}
+
+func RegisterRecognizerServer(s grpc.ServiceRegistrar, srv RecognizerServer) {
+	// If the following call panics, it indicates UnimplementedRecognizerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Recognizer_ServiceDesc, srv)
+}
+
+func _Recognizer_Recognize_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RecognizerServer).Recognize(&grpc.GenericServerStream[RecognizeRequest, RecognizeResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Recognizer_RecognizeServer = grpc.BidiStreamingServer[RecognizeRequest, RecognizeResponse]
+
+// Recognizer_ServiceDesc is the grpc.ServiceDesc for Recognizer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Recognizer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bhl.recognize.v1.Recognizer",
+	HandlerType: (*RecognizerServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Recognize",
+			Handler:       _Recognizer_Recognize_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "recognize.proto",
+}
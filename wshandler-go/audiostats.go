@@ -0,0 +1,192 @@
+package wshandler
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AudioStatsConfig периодическая обратная связь по уровню сигнала
+type AudioStatsConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	IntervalMs int  `yaml:"interval_ms"` // как часто слать audio_stats, по умолчанию 1000
+}
+
+// SetAudioStats включает сообщения audio_stats и audio_warning
+func (h *WSHandler) SetAudioStats(cfg AudioStatsConfig) {
+	if cfg.IntervalMs <= 0 {
+		cfg.IntervalMs = 1000
+	}
+	h.audioStats = cfg
+}
+
+// AudioStats сообщение клиенту с уровнями за последний интервал
+type AudioStats struct {
+	Type     string  `json:"type"` // "audio_stats"
+	RMSdB    float64 `json:"rms_db"`
+	PeakdB   float64 `json:"peak_db"`
+	Clipping float64 `json:"clipping"` // доля отсчётов у предела шкалы
+	SNRdB    float64 `json:"snr_db"`   // оценка по окну последних секунд
+}
+
+// AudioWarning предупреждение о проблеме с микрофоном
+type AudioWarning struct {
+	Type    string `json:"type"` // "audio_warning"
+	Code    string `json:"code"` // too_quiet, clipping, no_audio_for_10s
+	Message string `json:"message"`
+}
+
+const (
+	meterFrame      = 320   // 20 мс при 16 кГц
+	meterWindow     = 250   // кадров в окне оценки SNR (~5 с)
+	clipLevel       = 0.99  // отсчёт считается клипом
+	clipWarnRatio   = 0.001 // больше 0.1% клипов за интервал — предупреждение
+	silenceDB       = -60.0 // ниже — тишина или выключенный микрофон
+	quietDB         = -40.0 // речь тише этого плохо распознаётся
+	noAudioTimeout  = 10 * time.Second
+	warningCooldown = 10 * time.Second
+	minDB           = -100.0
+)
+
+// audioMeter считает уровни входящего аудио одной сессии
+type audioMeter struct {
+	mu       sync.Mutex
+	interval time.Duration
+
+	// накопители за текущий интервал
+	sumSq   float64
+	n       int
+	peak    float64
+	clipped int
+	// хвост, не добравший до целого кадра
+	frame []float32
+
+	window   []float64 // RMS кадров, кольцо из meterWindow
+	windowAt int
+
+	lastReport time.Time
+	lastSound  time.Time
+	warned     map[string]time.Time
+}
+
+func newAudioMeter(interval time.Duration, now time.Time) *audioMeter {
+	return &audioMeter{
+		interval:   interval,
+		lastReport: now,
+		lastSound:  now,
+		warned:     map[string]time.Time{},
+	}
+}
+
+// add учитывает чанк и возвращает сообщения, которые пора отправить
+func (m *audioMeter) add(pcm []float32, now time.Time) []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range pcm {
+		a := math.Abs(float64(v))
+		m.sumSq += a * a
+		m.n++
+		if a > m.peak {
+			m.peak = a
+		}
+		if a >= clipLevel {
+			m.clipped++
+		}
+
+		m.frame = append(m.frame, v)
+		if len(m.frame) == meterFrame {
+			rms := rmsOf(m.frame)
+			m.frame = m.frame[:0]
+			if len(m.window) < meterWindow {
+				m.window = append(m.window, rms)
+			} else {
+				m.window[m.windowAt] = rms
+				m.windowAt = (m.windowAt + 1) % meterWindow
+			}
+			if toDB(rms) > silenceDB {
+				m.lastSound = now
+			}
+		}
+	}
+
+	if now.Sub(m.lastReport) < m.interval || m.n == 0 {
+		return nil
+	}
+	return m.report(now)
+}
+
+// report закрывает интервал: статистика плюс предупреждения
+func (m *audioMeter) report(now time.Time) []interface{} {
+	stats := AudioStats{
+		Type:     "audio_stats",
+		RMSdB:    round1(toDB(math.Sqrt(m.sumSq / float64(m.n)))),
+		PeakdB:   round1(toDB(m.peak)),
+		Clipping: float64(m.clipped) / float64(m.n),
+	}
+
+	// шум — 10-й перцентиль RMS кадров, речь — 90-й
+	var speech float64
+	if len(m.window) > 0 {
+		sorted := append([]float64(nil), m.window...)
+		sort.Float64s(sorted)
+		noise := sorted[len(sorted)/10]
+		speech = sorted[len(sorted)*9/10]
+		stats.SNRdB = round1(toDB(speech) - toDB(noise))
+	}
+
+	out := []interface{}{stats}
+	if stats.Clipping > clipWarnRatio {
+		out = m.warn(out, now, "clipping", "Сигнал перегружен, уменьшите усиление микрофона")
+	}
+	if db := toDB(speech); db > silenceDB && db < quietDB {
+		out = m.warn(out, now, "too_quiet", "Слишком тихо, говорите ближе к микрофону")
+	}
+	out = m.idleLocked(out, now)
+
+	m.sumSq, m.n, m.peak, m.clipped = 0, 0, 0, 0
+	m.lastReport = now
+	return out
+}
+
+// idle проверка тишины, когда кадры не приходят вовсе
+func (m *audioMeter) idle(now time.Time) []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.idleLocked(nil, now)
+}
+
+func (m *audioMeter) idleLocked(out []interface{}, now time.Time) []interface{} {
+	if now.Sub(m.lastSound) >= noAudioTimeout {
+		out = m.warn(out, now, "no_audio_for_10s", "Нет звука больше 10 секунд, проверьте микрофон")
+	}
+	return out
+}
+
+func (m *audioMeter) warn(out []interface{}, now time.Time, code, msg string) []interface{} {
+	if last, ok := m.warned[code]; ok && now.Sub(last) < warningCooldown {
+		return out
+	}
+	m.warned[code] = now
+	return append(out, AudioWarning{Type: "audio_warning", Code: code, Message: msg})
+}
+
+func rmsOf(frame []float32) float64 {
+	var sum float64
+	for _, v := range frame {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(frame)))
+}
+
+func toDB(v float64) float64 {
+	if v <= 0 {
+		return minDB
+	}
+	return math.Max(20*math.Log10(v), minDB)
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
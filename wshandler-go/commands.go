@@ -0,0 +1,115 @@
+package wshandler
+
+import (
+	"context"
+	"time"
+
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/michael/bhl-qwen-go"
+)
+
+// SetCommandResolver подключает command-qwen. Финальные фразы, которые
+// конвейер пометил как команды, уходят в Resolve, не останавливая чтение
+// аудио; при ошибке или таймауте клиент получает обычный final.
+func (h *WSHandler) SetCommandResolver(r *command.CommandResolver, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	h.resolver = r
+	h.cmdTimeout = timeout
+}
+
+// finalsQueue сколько финальных фраз ждёт, пока разбирается команда,
+// прежде чем чтение аудио остановится
+const finalsQueue = 64
+
+// startDelivery запускает горутину доставки финальных фраз сессии. Фразы
+// идут по очереди: пока command-qwen разбирает команду, следующие ждут,
+// и в документ, запись сессии и контекст команд всё попадает в порядке
+// диктовки. stop дожидается доставки всего, что уже в очереди.
+func (h *WSHandler) startDelivery(s *session) (stop func()) {
+	s.queue = make(chan *Segment, finalsQueue)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for seg := range s.queue {
+			h.deliver(s, seg)
+		}
+	}()
+	return func() {
+		close(s.queue)
+		<-done
+	}
+}
+
+// deliverFinal ставит финальную фразу в очередь доставки
+func (h *WSHandler) deliverFinal(s *session, seg *Segment) {
+	s.queue <- seg
+}
+
+// deliver отправляет финальную фразу клиенту, при необходимости через command-qwen
+func (h *WSHandler) deliver(s *session, seg *Segment) {
+	if h.editing.Enabled {
+		if cmd, ok := ParseEdit(seg.Raw); ok {
+			h.applyEdit(s, cmd, seg)
+			return
+		}
+	}
+
+	if !seg.Command || h.resolver == nil || !h.resolveCommand(s, seg) {
+		s.deliverText(seg)
+	}
+}
+
+// resolveCommand false — command-qwen не ответил, фраза уйдёт как текст
+func (h *WSHandler) resolveCommand(s *session, seg *Segment) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cmdTimeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := h.resolver.Resolve(ctx, command.CommandRequest{
+		Context:     s.commandContext(),
+		CurrentText: seg.Text,
+	})
+	if err != nil {
+		logger.Warn("Command resolve failed, sending plain final", "err", err, "text", seg.Text)
+		return false
+	}
+
+	dur := time.Since(start)
+	logger.Info("Command resolved", "name", resp.Name, "script", resp.Script, "dur", dur)
+	s.emit(resp, true)
+	s.record(FinalRecord{Type: string(resp.Type), Text: resp.Text, Raw: seg.Raw, Name: resp.Name, Script: resp.Script, Words: seg.Words})
+	s.setCommandContext(command.CommandContext{Type: string(command.TypeCommand), Text: resp.Text, Script: resp.Script})
+	s.emit(s.doc.AppendFormula(resp.Script, resp.Name == "editLatex", time.Now()), false)
+	if h.onCommand != nil {
+		h.onCommand(CommandRecord{Session: s.bc.id, User: s.bc.user, Name: resp.Name,
+			Text: resp.Text, Script: resp.Script, Raw: seg.Raw, Duration: dur})
+	}
+	return true
+}
+
+// deliverText обычная финальная фраза
+func (s *session) deliverText(seg *Segment) {
+	s.emit(asr.Response{Type: seg.Type, Text: seg.Text}, true)
+	if len(seg.Tasks) > 0 {
+		s.emit(tasksMessage{Type: "tasks", Tasks: seg.Tasks}, true)
+	}
+	s.record(FinalRecord{Type: seg.Type, Text: seg.Text, Raw: seg.Raw, Words: seg.Words, Tasks: seg.Tasks})
+	s.setCommandContext(command.CommandContext{Type: string(command.TypeFinal), Text: seg.Text})
+	s.emit(s.doc.AppendText(seg.Text, seg.Start, time.Now()), false)
+}
+
+// tasksMessage дела, найденные в только что отправленном final
+type tasksMessage struct {
+	Type  string `json:"type"`
+	Tasks []Task `json:"tasks"`
+}
+
+// applyEdit голосовая команда правки: меняет текст сессии и шлёт его клиенту
+func (h *WSHandler) applyEdit(s *session, cmd EditCommand, seg *Segment) {
+	state := s.doc.Apply(cmd)
+	logger.Info("Voice edit", "command", cmd.Name, "applied", state.Applied, "raw", seg.Raw)
+	s.record(FinalRecord{Type: "edit", Text: cmd.Name, Raw: seg.Raw, Words: seg.Words})
+	s.emit(state, false)
+}
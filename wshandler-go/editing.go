@@ -0,0 +1,394 @@
+package wshandler
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EditingConfig голосовая правка текста во время диктовки
+type EditingConfig struct {
+	Enabled   bool `yaml:"enabled"`
+	UndoDepth int  `yaml:"undo_depth"` // сколько шагов можно отменить, по умолчанию 20
+}
+
+// SetEditing включает голосовые команды правки ("новый абзац",
+// "удали последнее предложение", "замени X на Y", "поставь точку", "отмени").
+// Они не уходят в command-qwen: это детерминированная грамматика.
+func (h *WSHandler) SetEditing(cfg EditingConfig) {
+	if cfg.UndoDepth <= 0 {
+		cfg.UndoDepth = 20
+	}
+	h.editing = cfg
+}
+
+// Виды команд правки
+const (
+	EditNewParagraph   = "new_paragraph"
+	EditDeleteSentence = "delete_sentence"
+	EditDeleteWord     = "delete_word"
+	EditReplace        = "replace"
+	EditPunctuate      = "punctuate"
+	EditUndo           = "undo"
+)
+
+// EditCommand разобранная команда правки
+type EditCommand struct {
+	Name string
+	From string // replace: что заменить
+	To   string // replace: на что; punctuate: знак
+}
+
+// DocumentState текущий текст сессии, шлётся после каждого изменения
+type DocumentState struct {
+	Type       string   `json:"type"`              // "document"
+	Command    string   `json:"command,omitempty"` // команда правки, если изменение от неё
+	Applied    bool     `json:"applied"`           // false — команда распознана, но применить нечего
+	Text       string   `json:"text"`
+	Paragraphs []string `json:"paragraphs"`
+	Version    int      `json:"version"`
+}
+
+var (
+	editNewParagraphRe = regexp.MustCompile(`^(новый абзац|новая строка|с новой строки|следующий абзац|абзац)$`)
+	editDeleteRe       = regexp.MustCompile(`^(удали|удалить|сотри|стереть|убери) (последнее|последнюю|последний) (предложение|фразу|слово)$`)
+	editReplaceRe      = regexp.MustCompile(`^(замени|заменить|исправь|исправить) (.+) на (.+)$`)
+	editPunctRe        = regexp.MustCompile(`^(поставь|поставить) (.+)$`)
+	editUndoRe         = regexp.MustCompile(`^(отмени|отменить|отмена)$`)
+)
+
+var punctMarks = map[string]string{
+	"точку":                ".",
+	"запятую":              ",",
+	"вопрос":               "?",
+	"вопросительный знак":  "?",
+	"знак вопроса":         "?",
+	"восклицательный знак": "!",
+	"восклицательный":      "!",
+	"двоеточие":            ":",
+	"точку с запятой":      ";",
+	"многоточие":           "…",
+	"тире":                 " —",
+}
+
+// ParseEdit разбирает сырой текст распознавателя. Фраза должна целиком
+// быть командой: "удали последнее предложение про дачу" — уже не команда.
+func ParseEdit(raw string) (EditCommand, bool) {
+	t := normalizeEdit(raw)
+	switch {
+	case editNewParagraphRe.MatchString(t):
+		return EditCommand{Name: EditNewParagraph}, true
+	case editUndoRe.MatchString(t):
+		return EditCommand{Name: EditUndo}, true
+	}
+	if m := editDeleteRe.FindStringSubmatch(t); m != nil {
+		if m[3] == "слово" {
+			return EditCommand{Name: EditDeleteWord}, true
+		}
+		return EditCommand{Name: EditDeleteSentence}, true
+	}
+	if m := editReplaceRe.FindStringSubmatch(t); m != nil {
+		return EditCommand{Name: EditReplace, From: m[2], To: m[3]}, true
+	}
+	if m := editPunctRe.FindStringSubmatch(t); m != nil {
+		if mark, ok := punctMarks[m[2]]; ok {
+			return EditCommand{Name: EditPunctuate, To: mark}, true
+		}
+	}
+	return EditCommand{}, false
+}
+
+// normalizeEdit нижний регистр, ё→е, без пунктуации, одиночные пробелы
+func normalizeEdit(s string) string {
+	s = strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	}), " ")
+}
+
+// piece фрагмент абзаца: фраза диктовки или формула $$...$$
+type piece struct {
+	text       string
+	formula    bool
+	start, end time.Time
+}
+
+// Document текст сессии с абзацами и историей для отмены. Абзацы
+// складываются по паузам (SegmentConfig) и по команде "новый абзац".
+type Document struct {
+	mu        sync.Mutex
+	paras     [][]piece
+	newPara   bool // следующая фраза начнёт новый абзац
+	undo      [][][]piece
+	undoDepth int
+	seg       SegmentConfig
+	version   int
+}
+
+// NewDocument пустой документ; undoDepth — глубина отмены
+func NewDocument(undoDepth int, seg SegmentConfig) *Document {
+	if undoDepth <= 0 {
+		undoDepth = 20
+	}
+	return &Document{undoDepth: undoDepth, seg: seg.withDefaults()}
+}
+
+// AppendText добавляет распознанную фразу: start — начало речи, end — final
+func (d *Document) AppendText(text string, start, end time.Time) DocumentState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.snapshot()
+
+	if last, ok := d.lastPiece(); ok && !d.newPara {
+		size := 0
+		for _, p := range d.paras[len(d.paras)-1] {
+			size += len([]rune(p.text)) + 1
+		}
+		if d.seg.breakBefore(last.text, size, start.Sub(last.end)) {
+			d.newPara = true
+		}
+	}
+	d.appendPiece(piece{text: text, start: start, end: end})
+	d.version++
+	return d.stateLocked("", true)
+}
+
+// AppendFormula добавляет формулу; replace — editLatex заменяет последнюю
+func (d *Document) AppendFormula(script string, replace bool, at time.Time) DocumentState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.snapshot()
+	d.version++
+	p := piece{text: "$$" + strings.Trim(script, "$ \n") + "$$", formula: true, start: at, end: at}
+	if replace {
+		for i := len(d.paras) - 1; i >= 0; i-- {
+			for j := len(d.paras[i]) - 1; j >= 0; j-- {
+				if d.paras[i][j].formula {
+					d.paras[i][j] = p
+					return d.stateLocked("", true)
+				}
+			}
+		}
+	}
+	d.appendPiece(p)
+	return d.stateLocked("", true)
+}
+
+func (d *Document) appendPiece(p piece) {
+	if len(d.paras) == 0 || d.newPara {
+		d.paras = append(d.paras, nil)
+		d.newPara = false
+	}
+	last := len(d.paras) - 1
+	d.paras[last] = append(d.paras[last], p)
+}
+
+// Apply выполняет команду правки
+func (d *Document) Apply(cmd EditCommand) DocumentState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if cmd.Name == EditUndo {
+		if len(d.undo) == 0 {
+			return d.stateLocked(cmd.Name, false)
+		}
+		d.paras = d.undo[len(d.undo)-1]
+		d.undo = d.undo[:len(d.undo)-1]
+		d.newPara = false
+		d.version++
+		return d.stateLocked(cmd.Name, true)
+	}
+
+	d.snapshot()
+	var ok bool
+	switch cmd.Name {
+	case EditNewParagraph:
+		ok = len(d.paras) > 0 && !d.newPara
+		d.newPara = true
+	case EditDeleteSentence:
+		ok = d.trimLast(lastSentenceStart)
+	case EditDeleteWord:
+		ok = d.trimLast(lastWordStart)
+	case EditReplace:
+		ok = d.replaceLast(cmd.From, cmd.To)
+	case EditPunctuate:
+		ok = d.punctuate(cmd.To)
+	}
+	if ok {
+		d.version++
+	} else {
+		d.undo = d.undo[:len(d.undo)-1] // ничего не изменилось
+	}
+	return d.stateLocked(cmd.Name, ok)
+}
+
+// snapshot сохраняет копию абзацев для отмены
+func (d *Document) snapshot() {
+	cp := make([][]piece, len(d.paras))
+	for i, p := range d.paras {
+		cp[i] = append([]piece(nil), p...)
+	}
+	d.undo = append(d.undo, cp)
+	if len(d.undo) > d.undoDepth {
+		d.undo = d.undo[1:]
+	}
+}
+
+// lastPiece последний фрагмент, пустые абзацы в конце убираются
+func (d *Document) lastPiece() (*piece, bool) {
+	for len(d.paras) > 0 && len(d.paras[len(d.paras)-1]) == 0 {
+		d.paras = d.paras[:len(d.paras)-1]
+	}
+	if len(d.paras) == 0 {
+		return nil, false
+	}
+	p := d.paras[len(d.paras)-1]
+	return &p[len(p)-1], true
+}
+
+// dropLastPiece убирает последний фрагмент вместе с опустевшим абзацем
+func (d *Document) dropLastPiece() {
+	last := len(d.paras) - 1
+	d.paras[last] = d.paras[last][:len(d.paras[last])-1]
+	if len(d.paras[last]) == 0 {
+		d.paras = d.paras[:last]
+	}
+}
+
+// trimLast отрезает хвост последнего фрагмента с позиции start(text).
+// Формула удаляется целиком.
+func (d *Document) trimLast(start func(string) int) bool {
+	p, ok := d.lastPiece()
+	if !ok {
+		return false
+	}
+	if p.formula {
+		d.dropLastPiece()
+		return true
+	}
+	p.text = strings.TrimRightFunc(p.text[:start(p.text)], unicode.IsSpace)
+	if p.text == "" {
+		d.dropLastPiece()
+	}
+	return true
+}
+
+var sentenceEndRe = regexp.MustCompile(`[.!?…]+["»)]*\s+`)
+
+// lastSentenceStart начало последнего предложения
+func lastSentenceStart(text string) int {
+	trimmed := strings.TrimRightFunc(text, unicode.IsSpace)
+	locs := sentenceEndRe.FindAllStringIndex(trimmed, -1)
+	if len(locs) == 0 {
+		return 0
+	}
+	return locs[len(locs)-1][1]
+}
+
+// lastWordStart начало последнего слова вместе с прилипшей пунктуацией
+func lastWordStart(text string) int {
+	trimmed := strings.TrimRightFunc(text, unicode.IsSpace)
+	return strings.LastIndexFunc(trimmed, unicode.IsSpace) + 1
+}
+
+// replaceLast меняет последнее вхождение фразы from (целые слова, без учёта регистра)
+func (d *Document) replaceLast(from, to string) bool {
+	words := strings.Fields(from)
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	re, err := regexp.Compile(`(?i)(^|[^\p{L}\p{N}])(` + strings.Join(words, `[\s,]+`) + `)([^\p{L}\p{N}]|$)`)
+	if err != nil {
+		return false
+	}
+
+	for i := len(d.paras) - 1; i >= 0; i-- {
+		for j := len(d.paras[i]) - 1; j >= 0; j-- {
+			p := &d.paras[i][j]
+			if p.formula {
+				continue
+			}
+			locs := re.FindAllStringSubmatchIndex(p.text, -1)
+			if len(locs) == 0 {
+				continue
+			}
+			m := locs[len(locs)-1]
+			orig := p.text[m[4]:m[5]]
+			p.text = p.text[:m[4]] + matchFirstCase(orig, to) + p.text[m[5]:]
+			return true
+		}
+	}
+	return false
+}
+
+// matchFirstCase заглавная буква исходного слова переходит на замену
+func matchFirstCase(orig, to string) string {
+	o, _ := utf8.DecodeRuneInString(orig)
+	t, size := utf8.DecodeRuneInString(to)
+	if unicode.IsUpper(o) && unicode.IsLower(t) {
+		return string(unicode.ToUpper(t)) + to[size:]
+	}
+	return to
+}
+
+// punctuate ставит знак в конце текста вместо того, что поставил пунктуатор
+func (d *Document) punctuate(mark string) bool {
+	p, ok := d.lastPiece()
+	if !ok || p.formula {
+		return false
+	}
+	p.text = strings.TrimRightFunc(p.text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(".,!?…:;—", r)
+	}) + mark
+	return true
+}
+
+// Paragraphs абзацы со временем для сохранения записи
+func (d *Document) Paragraphs() []Paragraph {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []Paragraph
+	for _, p := range d.paras {
+		if len(p) == 0 {
+			continue
+		}
+		parts := make([]string, len(p))
+		for i, pc := range p {
+			parts[i] = pc.text
+		}
+		out = append(out, Paragraph{Text: strings.Join(parts, " "), Start: p[0].start, End: p[len(p)-1].end})
+	}
+	return out
+}
+
+// State текущее состояние
+func (d *Document) State() DocumentState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stateLocked("", true)
+}
+
+func (d *Document) stateLocked(cmd string, applied bool) DocumentState {
+	paras := make([]string, 0, len(d.paras))
+	for _, p := range d.paras {
+		if len(p) == 0 {
+			continue
+		}
+		parts := make([]string, len(p))
+		for i, pc := range p {
+			parts[i] = pc.text
+		}
+		paras = append(paras, strings.Join(parts, " "))
+	}
+	return DocumentState{
+		Type:       "document",
+		Command:    cmd,
+		Applied:    applied,
+		Text:       strings.Join(paras, "\n\n"),
+		Paragraphs: paras,
+		Version:    d.version,
+	}
+}
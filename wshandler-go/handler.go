@@ -7,55 +7,161 @@ import (
 	"net/http"
 	"os"
 	"log/slog"
+	"path/filepath"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/mbykov/asr-zipformer-go"
-	"github.com/mbykov/vosk-punct"
+	"github.com/michael/bhl-qwen-go"
 )
 
 var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
 type WSHandler struct {
-	upgrader    websocket.Upgrader
-	asrCfg      asr.Config
-	punctuator  *voskpunct.Punctuator
+	upgrader     websocket.Upgrader
+	asrCfg       asr.Config
+	pipeline     *Pipeline
+	resolver     *command.CommandResolver
+	cmdTimeout   time.Duration
+	auth         Authenticator
+	hub          *hub
+	audioStats   AudioStatsConfig
+	onSessionEnd func(SessionRecord)
+	onSession    func(SessionStart)
+	onCommand    func(CommandRecord)
+	hotwords     func(user string) string
+	userStages   func(user string) map[string]bool
+	editing      EditingConfig
+	segment      SegmentConfig
+	recording    RecordingConfig
+	live         liveSessions
 }
 
-func NewWSHandler(cfg asr.Config, p *voskpunct.Punctuator) *WSHandler {
+// controlMessage управляющее сообщение от клиента.
+// {"type":"pipeline","stages":{"profanity":false}} включает/выключает стадии в этой сессии.
+type controlMessage struct {
+	Type   string          `json:"type"`
+	Stages map[string]bool `json:"stages,omitempty"`
+}
+
+func NewWSHandler(cfg asr.Config, pipeline *Pipeline) *WSHandler {
 	return &WSHandler{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
-		asrCfg:     cfg,
-		punctuator: p,
+		asrCfg:   cfg,
+		pipeline: pipeline,
+		hub:      newHub(),
 	}
 }
 
 func (h *WSHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if !h.live.enter() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	// после OnSessionEnd: Shutdown ждёт, пока сессия сохранится
+	defer h.live.leave()
+
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Error("Upgrade failed", "err", err)
 		return
 	}
 	defer conn.Close()
+	h.live.add(conn)
+	defer h.live.remove(conn)
 
-	engine, err := asr.New(h.asrCfg)
+	asrCfg := h.asrCfg
+	if h.hotwords != nil {
+		if f := h.hotwords(user); f != "" {
+			asrCfg.HotwordsFile = f
+		}
+	}
+	engine, err := asr.New(asrCfg)
 	if err != nil {
 		logger.Error("ASR Init failed", "err", err)
 		return
 	}
 	defer engine.Close()
 
-	logger.Info("New session", "remote", r.RemoteAddr)
+	sess := newSession(conn)
+	if h.userStages != nil {
+		// личные настройки — до управляющих сообщений клиента, те главнее
+		for name, on := range h.userStages(user) {
+			sess.overrides[name] = on
+		}
+	}
+	bc := h.hub.open(user, sess.write) // Notify пишет диктующему напрямую
+	defer h.hub.close(bc)
+	sess.bc = bc
+
+	logger.Info("New session", "remote", r.RemoteAddr, "session", bc.id)
+	if h.onSession != nil {
+		h.onSession(SessionStart{ID: bc.id, User: user, Started: sess.started})
+	}
+
+	sess.doc = NewDocument(h.editing.UndoDepth, h.segment)
+	if h.onSessionEnd != nil {
+		defer func() { h.onSessionEnd(sess.sessionRecord()) }()
+	}
+
+	// аудио закрываем раньше OnSessionEnd: запись дневника ссылается на готовый файл
+	var recorder *Recorder
+	if h.recording.Enabled {
+		path := filepath.Join(h.recording.Dir, bc.id+".wav")
+		if recorder, err = NewRecorder(path); err != nil {
+			logger.Error("Recording disabled for session", "err", err)
+		} else {
+			sess.audio = path
+			defer func() {
+				if err := recorder.Close(); err != nil {
+					logger.Error("Recording failed", "err", err)
+				}
+			}()
+		}
+	}
+	// Доставляем очередь до конца, пока соединение ещё открыто
+	defer h.startDelivery(sess)()
+
+	// ID сессии нужен клиенту, чтобы позвать подписчиков (/subscribe?session=ID)
+	sess.send(map[string]string{"type": "session", "id": bc.id})
+
+	var meter *audioMeter
+	if h.audioStats.Enabled {
+		interval := time.Duration(h.audioStats.IntervalMs) * time.Millisecond
+		meter = newAudioMeter(interval, time.Now())
+
+		// Кадры могут не приходить вовсе — тишину проверяем и по таймеру
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case now := <-ticker.C:
+					for _, msg := range meter.idle(now) {
+						sess.send(msg)
+					}
+				}
+			}
+		}()
+	}
 
 	for {
 		mt, message, err := conn.ReadMessage()
 		if err != nil {
 			final := engine.Finish()
 			if final.Text != "" {
-				// Применяем пунктуацию к финальному тексту
-				text := h.processText(final.Text)
-				sendJSON(conn, asr.Response{Type: final.Type, Text: text})
+				seg := h.processText(final, sess)
+				h.deliverFinal(sess, seg)
 			}
 			logger.Info("Session closed", "remote", r.RemoteAddr)
 			break
@@ -65,31 +171,63 @@ func (h *WSHandler) Handle(w http.ResponseWriter, r *http.Request) {
 			pcm := bytesToFloat32Slice(message)
 			logger.Debug("Received audio", "bytes", len(message), "samples", len(pcm))
 
+			if meter != nil {
+				for _, msg := range meter.add(pcm, time.Now()) {
+					sess.send(msg)
+				}
+			}
+
+			if recorder != nil {
+				recorder.Write(pcm)
+			}
 			resp := engine.Write(pcm)
 
 			if resp.Text != "" {
-				// Применяем пунктуацию к тексту
-				text := h.processText(resp.Text)
-				logger.Info("ASR Result", "type", resp.Type, "text", text)
-				sendJSON(conn, asr.Response{Type: resp.Type, Text: text})
+				seg := h.processText(resp, sess)
+				logger.Info("ASR Result", "type", seg.Type, "text", seg.Text, "command", seg.Command)
+				if seg.Type == "final" {
+					h.deliverFinal(sess, seg)
+				} else {
+					sess.emit(asr.Response{Type: seg.Type, Text: seg.Text}, false)
+				}
 			}
 		} else if mt == websocket.TextMessage {
 			logger.Info("Control message", "msg", string(message))
+
+			var ctrl controlMessage
+			if err := json.Unmarshal(message, &ctrl); err == nil && ctrl.Type == "pipeline" {
+				for name, on := range ctrl.Stages {
+					sess.overrides[name] = on
+				}
+			}
 		}
 	}
 }
 
-// processText применяет пунктуацию, если доступен пунктуатор
-func (h *WSHandler) processText(text string) string {
-	if h.punctuator == nil {
-		return text
+// processText прогоняет результат ASR через конвейер пост-обработки
+func (h *WSHandler) processText(resp asr.Response, s *session) *Segment {
+	// начало фразы — первый результат после предыдущего final
+	if s.uttStart.IsZero() {
+		s.uttStart = time.Now()
 	}
-	return h.punctuator.Process(text)
+	seg := &Segment{Type: resp.Type, Text: resp.Text, Raw: resp.Text, Words: resp.Words, User: s.bc.user, Start: s.uttStart}
+	if resp.Type == "final" {
+		s.uttStart = time.Time{}
+	}
+	h.pipeline.Run(seg, s.overrides)
+	return seg
+}
+
+// SetHotwords задаёт файл горячих слов распознавателя для пользователя;
+// пустая строка — без них
+func (h *WSHandler) SetHotwords(fn func(user string) string) {
+	h.hotwords = fn
 }
 
-func sendJSON(conn *websocket.Conn, data interface{}) {
-	msg, _ := json.Marshal(data)
-	conn.WriteMessage(websocket.TextMessage, msg)
+// SetUserStages задаёт стадии конвейера, которые пользователь включил
+// или выключил у себя ({"punctuation": false}); действуют с начала сессии
+func (h *WSHandler) SetUserStages(fn func(user string) map[string]bool) {
+	h.userStages = fn
 }
 
 func bytesToFloat32Slice(b []byte) []float32 {
@@ -0,0 +1,205 @@
+package wshandler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Authenticator проверяет запрос и возвращает пользователя.
+// Одна и та же функция применяется к диктующему и к подписчикам.
+type Authenticator func(r *http.Request) (user string, ok bool)
+
+// SetAuthenticator включает проверку доступа для Handle и Subscribe
+func (h *WSHandler) SetAuthenticator(a Authenticator) {
+	h.auth = a
+}
+
+func (h *WSHandler) authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.auth == nil {
+		return "", true
+	}
+	user, ok := h.auth(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+	return user, ok
+}
+
+// subscriberBuffer сколько сообщений может отстать подписчик, прежде чем его отключат
+const subscriberBuffer = 256
+
+// hub реестр живых сессий, к которым можно подключиться на чтение
+type hub struct {
+	mu        sync.Mutex
+	sessions  map[string]*broadcast
+	listeners map[*listener]struct{}
+}
+
+func newHub() *hub {
+	return &hub{sessions: map[string]*broadcast{}, listeners: map[*listener]struct{}{}}
+}
+
+// open регистрирует сессию; producer пишет напрямую диктующему клиенту
+func (h *hub) open(user string, producer func([]byte)) *broadcast {
+	b := &broadcast{
+		id:       newSessionID(),
+		user:     user,
+		producer: producer,
+		subs:     map[*subscriber]struct{}{},
+	}
+	h.mu.Lock()
+	h.sessions[b.id] = b
+	h.mu.Unlock()
+	return b
+}
+
+func (h *hub) get(id string) *broadcast {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sessions[id]
+}
+
+func (h *hub) close(b *broadcast) {
+	h.mu.Lock()
+	delete(h.sessions, b.id)
+	h.mu.Unlock()
+	b.close()
+}
+
+// broadcast транскрипт одной сессии и её подписчики
+type broadcast struct {
+	id       string
+	user     string
+	producer func([]byte)
+
+	mu      sync.Mutex
+	history [][]byte // final и command с начала сессии — для опоздавших
+	subs    map[*subscriber]struct{}
+	closed  bool
+}
+
+type subscriber struct {
+	ch chan []byte
+}
+
+// publish рассылает сообщение подписчикам; keep — сохранить в транскрипт
+func (b *broadcast) publish(msg []byte, keep bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if keep {
+		b.history = append(b.history, msg)
+	}
+	for sub := range b.subs {
+		select {
+		case sub.ch <- msg:
+		default:
+			// медленный подписчик не должен тормозить диктовку
+			logger.Warn("Subscriber too slow, dropping", "session", b.id)
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// attach подключает подписчика и отдаёт ему транскрипт на текущий момент
+func (b *broadcast) attach() *subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	sub := &subscriber{ch: make(chan []byte, len(b.history)+subscriberBuffer)}
+	for _, msg := range b.history {
+		sub.ch <- msg
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *broadcast) detach(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeLocked(sub)
+}
+
+func (b *broadcast) removeLocked(sub *subscriber) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (b *broadcast) close() {
+	end, _ := json.Marshal(map[string]string{"type": "session_end", "session": b.id})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		select {
+		case sub.ch <- end:
+		default:
+		}
+		b.removeLocked(sub)
+	}
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Subscribe подключение только на чтение к живой сессии: /subscribe?session=ID.
+// Подписчик получает interim, final и command, опоздавший — сначала транскрипт.
+func (h *WSHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	b := h.hub.get(r.URL.Query().Get("session"))
+	if b == nil || b.user != user {
+		// чужую сессию не отличаем от несуществующей
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("Upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := b.attach()
+	if sub == nil {
+		return
+	}
+	logger.Info("Subscriber attached", "session", b.id, "remote", r.RemoteAddr)
+
+	// Входящие сообщения игнорируем, читаем только чтобы заметить закрытие
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				b.detach(sub)
+				return
+			}
+		}
+	}()
+
+	for msg := range sub.ch {
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			b.detach(sub)
+			break
+		}
+	}
+	logger.Info("Subscriber detached", "session", b.id, "remote", r.RemoteAddr)
+}
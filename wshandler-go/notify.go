@@ -0,0 +1,105 @@
+package wshandler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// listener подключение /events: только уведомления пользователя, без аудио
+type listener struct {
+	user string
+	ch   chan []byte
+}
+
+// Notify отправляет сообщение всем открытым WebSocket пользователя:
+// диктующим сессиям и подключениям /events. Например, прогресс фоновых задач.
+func (h *WSHandler) Notify(user string, msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Notify marshal failed", "err", err)
+		return
+	}
+	h.hub.notify(user, data)
+}
+
+func (h *hub) notify(user string, msg []byte) {
+	h.mu.Lock()
+	var producers []func([]byte)
+	for _, b := range h.sessions {
+		if b.user == user && b.producer != nil {
+			producers = append(producers, b.producer)
+		}
+	}
+	for l := range h.listeners {
+		if l.user != user {
+			continue
+		}
+		select {
+		case l.ch <- msg:
+		default:
+			logger.Warn("Events listener too slow, dropping message", "user", user)
+		}
+	}
+	h.mu.Unlock()
+
+	// запись в сокет может тормозить — не под блокировкой реестра
+	for _, p := range producers {
+		p(msg)
+	}
+}
+
+func (h *hub) listen(user string) *listener {
+	l := &listener{user: user, ch: make(chan []byte, subscriberBuffer)}
+	h.mu.Lock()
+	h.listeners[l] = struct{}{}
+	h.mu.Unlock()
+	return l
+}
+
+func (h *hub) unlisten(l *listener) {
+	h.mu.Lock()
+	delete(h.listeners, l)
+	h.mu.Unlock()
+}
+
+// Events подключение для уведомлений пользователя без диктовки: /events
+func (h *WSHandler) Events(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("Upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	l := h.hub.listen(user)
+	defer h.hub.unlisten(l)
+	logger.Info("Events listener attached", "remote", r.RemoteAddr)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case msg := <-l.ch:
+			if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package wshandler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mbykov/asr-zipformer-go"
+	"github.com/mbykov/vosk-punct"
+)
+
+// Когда стадия применяется к результату ASR
+const (
+	OnInterim = "interim"
+	OnFinal   = "final"
+	OnBoth    = "both"
+)
+
+// Segment — фраза, проходящая через конвейер пост-обработки
+type Segment struct {
+	Type    string // "interim" или "final"
+	Text    string
+	Raw     string     // текст распознавателя до всех стадий
+	Words   []asr.Word // слова Raw со временем от начала сессии
+	User    string     // владелец сессии, для пользовательских стадий
+	Start   time.Time  // когда распознаватель впервые услышал фразу
+	Command bool       // стадия детекции пометила фразу как команду
+	Tasks   []Task     // дела и напоминания, найденные стадией tasks
+}
+
+// TextProcessor одна стадия пост-обработки текста
+type TextProcessor interface {
+	Name() string
+	Process(seg *Segment)
+}
+
+// Stage стадия конвейера с правилами применения
+type Stage struct {
+	Processor TextProcessor
+	On        string // OnInterim, OnFinal или OnBoth
+	Enabled   bool   // состояние по умолчанию, сессия может переопределить
+}
+
+func (s Stage) appliesTo(typ string) bool {
+	return s.On == OnBoth || s.On == typ
+}
+
+// Pipeline упорядоченная цепочка стадий
+type Pipeline struct {
+	stages []Stage
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Names возвращает имена стадий в порядке выполнения
+func (p *Pipeline) Names() []string {
+	if p == nil {
+		return nil
+	}
+	names := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		names[i] = s.Processor.Name()
+	}
+	return names
+}
+
+// Run прогоняет сегмент через стадии. overrides — включение/выключение
+// стадий для конкретной сессии (по имени стадии), может быть nil.
+func (p *Pipeline) Run(seg *Segment, overrides map[string]bool) {
+	if p == nil || seg.Text == "" {
+		return
+	}
+
+	timings := []any{"type", seg.Type}
+	for _, s := range p.stages {
+		name := s.Processor.Name()
+		enabled := s.Enabled
+		if v, ok := overrides[name]; ok {
+			enabled = v
+		}
+		if !enabled || !s.appliesTo(seg.Type) {
+			continue
+		}
+
+		start := time.Now()
+		s.Processor.Process(seg)
+		timings = append(timings, name, time.Since(start))
+	}
+
+	if len(timings) > 2 {
+		logger.Info("Pipeline timing", timings...)
+	}
+}
+
+// SetCorrector подключает пользовательские замены к стадии corrections.
+// Без него стадия ничего не делает.
+func (p *Pipeline) SetCorrector(c Corrector) {
+	if p == nil {
+		return
+	}
+	for _, s := range p.stages {
+		if cs, ok := s.Processor.(*correctionsStage); ok {
+			cs.c = c
+		}
+	}
+}
+
+// StageConfig описание стадии в YAML-конфиге diary-server
+type StageConfig struct {
+	Name     string            `yaml:"name"`     // punctuation, corrections, itn, replace, profanity, pii, command, math, tasks
+	On       string            `yaml:"on"`       // interim, final, both (по умолчанию both)
+	Enabled  *bool             `yaml:"enabled"`  // по умолчанию true
+	Words    []string          `yaml:"words"`    // profanity: корни (вместо встроенных корней и форм); command: слова-триггеры; math: термины; tasks: маркеры дел
+	Replace  map[string]string `yaml:"replace"`  // replace: словарь замен
+	Mask     string            `yaml:"mask"`     // profanity: символ маски
+	Patterns []string          `yaml:"patterns"` // pii: какие виды данных скрывать
+}
+
+// BuildPipeline собирает конвейер из конфига. Пустой конфиг даёт
+// прежнее поведение: только пунктуация для interim и final.
+func BuildPipeline(cfgs []StageConfig, p *voskpunct.Punctuator) (*Pipeline, error) {
+	if len(cfgs) == 0 {
+		cfgs = []StageConfig{{Name: "punctuation"}}
+	}
+
+	var stages []Stage
+	for _, c := range cfgs {
+		on := c.On
+		switch on {
+		case "":
+			on = OnBoth
+		case OnInterim, OnFinal, OnBoth:
+		default:
+			return nil, fmt.Errorf("stage %s: unknown on %q", c.Name, c.On)
+		}
+
+		var proc TextProcessor
+		switch c.Name {
+		case "punctuation":
+			if p == nil {
+				logger.Warn("Punctuation stage skipped: punctuator is not loaded")
+				continue
+			}
+			proc = &punctuationStage{p: p}
+		case "corrections":
+			proc = &correctionsStage{}
+		case "itn":
+			proc = &itnStage{}
+		case "replace":
+			r, err := newReplaceStage(c.Replace)
+			if err != nil {
+				return nil, err
+			}
+			proc = r
+		case "profanity":
+			proc = newProfanityStage(c.Words, c.Mask)
+		case "pii":
+			r, err := newPIIStage(c.Patterns)
+			if err != nil {
+				return nil, err
+			}
+			proc = r
+		case "command":
+			proc = newCommandStage(c.Words)
+		case "math":
+			proc = newMathStage(c.Words)
+		case "tasks":
+			proc = &tasksStage{x: NewTaskExtractor(c.Words)}
+		default:
+			return nil, fmt.Errorf("unknown stage %q", c.Name)
+		}
+
+		enabled := true
+		if c.Enabled != nil {
+			enabled = *c.Enabled
+		}
+		stages = append(stages, Stage{Processor: proc, On: on, Enabled: enabled})
+	}
+
+	return NewPipeline(stages...), nil
+}
@@ -0,0 +1,89 @@
+package wshandler
+
+import (
+	"time"
+
+	"github.com/mbykov/asr-zipformer-go"
+)
+
+// FinalRecord фраза сессии так, как её получил клиент
+type FinalRecord struct {
+	Type   string // "final", "command" или "edit"
+	Text   string
+	Raw    string // вывод распознавателя до пост-обработки
+	Name   string // createLatex / editLatex
+	Script string
+	At     time.Time
+	Words  []asr.Word // слова Raw со временем от начала аудио сессии
+	Tasks  []Task     // дела из этой фразы (стадия tasks)
+}
+
+// SessionRecord итог сессии диктовки для сохранения
+type SessionRecord struct {
+	ID      string
+	User    string
+	Started time.Time
+	Ended   time.Time
+	Finals  []FinalRecord
+	// Audio WAV сессии, если включена запись (SetRecording)
+	Audio string
+	// Paragraphs итоговый текст по абзацам, с голосовыми правками
+	Paragraphs []Paragraph
+}
+
+// SessionStart начало сессии диктовки
+type SessionStart struct {
+	ID      string
+	User    string
+	Started time.Time
+}
+
+// CommandRecord команда, которую разобрал command-qwen
+type CommandRecord struct {
+	Session  string
+	User     string
+	Name     string // createLatex / editLatex
+	Text     string
+	Script   string
+	Raw      string // фраза распознавателя, из которой разобрана команда
+	Duration time.Duration
+}
+
+// OnSessionStart задаёт обработчик начала сессии: вызывается, когда у сессии
+// уже есть ID, до первого аудио. Обработчик не должен блокировать.
+func (h *WSHandler) OnSessionStart(fn func(SessionStart)) {
+	h.onSession = fn
+}
+
+// OnCommand задаёт обработчик разобранной команды. Вызывается из горутины
+// доставки финальных фраз, после отправки клиенту.
+func (h *WSHandler) OnCommand(fn func(CommandRecord)) {
+	h.onCommand = fn
+}
+
+// OnSessionEnd задаёт обработчик завершённой сессии (например, запись в дневник).
+// Вызывается после того, как доставлены все финальные фразы и команды.
+func (h *WSHandler) OnSessionEnd(fn func(SessionRecord)) {
+	h.onSessionEnd = fn
+}
+
+func (s *session) record(f FinalRecord) {
+	f.At = time.Now()
+	s.recMu.Lock()
+	s.finals = append(s.finals, f)
+	s.recMu.Unlock()
+}
+
+func (s *session) sessionRecord() SessionRecord {
+	s.recMu.Lock()
+	defer s.recMu.Unlock()
+	return SessionRecord{
+		ID:         s.bc.id,
+		User:       s.bc.user,
+		Started:    s.started,
+		Ended:      time.Now(),
+		Finals:     append([]FinalRecord(nil), s.finals...),
+		Audio:      s.audio,
+		Paragraphs: s.doc.Paragraphs(),
+	}
+}
@@ -0,0 +1,108 @@
+package wshandler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// RecordingConfig запись аудио сессий для воспроизведения из дневника
+type RecordingConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"` // каталог WAV-файлов, имя — ID сессии
+}
+
+// SetRecording включает запись аудио сессий в WAV. Время слов в
+// FinalRecord.Words отсчитывается от начала этого файла.
+func (h *WSHandler) SetRecording(cfg RecordingConfig) {
+	h.recording = cfg
+}
+
+// RecordingRate частота записи — та же, что у распознавателя
+const RecordingRate = 16000
+
+// wavHeaderSize заголовок PCM WAV без дополнительных блоков
+const wavHeaderSize = 44
+
+// Recorder пишет моно 16 кГц 16 бит PCM WAV. Размеры в заголовке
+// проставляются при Close, до этого файл читается как пустой.
+type Recorder struct {
+	f       *os.File
+	w       *bufio.Writer
+	samples int64
+	err     error
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{f: f, w: bufio.NewWriterSize(f, 64<<10)}
+	r.w.Write(WAVHeader(0))
+	return r, nil
+}
+
+// Write дописывает отсчёты float32 в диапазоне -1..1
+func (r *Recorder) Write(pcm []float32) {
+	if r.err != nil {
+		return
+	}
+	var b [2]byte
+	for _, v := range pcm {
+		s := math.Max(-1, math.Min(1, float64(v)))
+		binary.LittleEndian.PutUint16(b[:], uint16(int16(math.Round(s*32767))))
+		if _, err := r.w.Write(b[:]); err != nil {
+			r.err = err
+			return
+		}
+	}
+	r.samples += int64(len(pcm))
+}
+
+// Samples сколько отсчётов записано
+func (r *Recorder) Samples() int64 {
+	return r.samples
+}
+
+// Close проставляет размеры в заголовке и закрывает файл
+func (r *Recorder) Close() error {
+	err := r.err
+	if ferr := r.w.Flush(); err == nil {
+		err = ferr
+	}
+	if err == nil {
+		_, err = r.f.WriteAt(WAVHeader(r.samples*2), 0)
+	}
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("recording %s: %w", r.f.Name(), err)
+	}
+	return nil
+}
+
+// WAVHeader заголовок моно 16 кГц 16 бит PCM с dataSize байт данных
+func WAVHeader(dataSize int64) []byte {
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(36+dataSize))
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:], 1) // моно
+	binary.LittleEndian.PutUint32(h[24:], RecordingRate)
+	binary.LittleEndian.PutUint32(h[28:], RecordingRate*2)
+	binary.LittleEndian.PutUint16(h[32:], 2)
+	binary.LittleEndian.PutUint16(h[34:], 16)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(dataSize))
+	return h
+}
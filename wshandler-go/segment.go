@@ -0,0 +1,61 @@
+package wshandler
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SegmentConfig разбиение диктовки на абзацы по паузам и пунктуации
+type SegmentConfig struct {
+	PauseMs     int `yaml:"pause_ms"`      // пауза, после которой законченное предложение закрывает абзац, по умолчанию 2000
+	LongPauseMs int `yaml:"long_pause_ms"` // пауза, после которой абзац закрывается всегда, по умолчанию 8000
+	MaxChars    int `yaml:"max_chars"`     // длинный абзац закрывается на первом конце предложения, по умолчанию 1000
+}
+
+// SetSegmentation задаёт пороги разбиения на абзацы
+func (h *WSHandler) SetSegmentation(cfg SegmentConfig) {
+	h.segment = cfg
+}
+
+func (c SegmentConfig) withDefaults() SegmentConfig {
+	if c.PauseMs <= 0 {
+		c.PauseMs = 2000
+	}
+	if c.LongPauseMs <= 0 {
+		c.LongPauseMs = 8000
+	}
+	if c.MaxChars <= 0 {
+		c.MaxChars = 1000
+	}
+	return c
+}
+
+// Paragraph абзац документа с временем первой и последней фразы
+type Paragraph struct {
+	Text  string
+	Start time.Time
+	End   time.Time
+}
+
+// breakBefore начинать ли новый абзац перед фразой. pause — тишина между
+// концом предыдущей фразы и началом этой, size — длина текущего абзаца.
+// Незаконченное предложение (запятая, тире, нет точки) держит абзац,
+// пока пауза не станет совсем длинной.
+func (c SegmentConfig) breakBefore(prev string, size int, pause time.Duration) bool {
+	if pause >= time.Duration(c.LongPauseMs)*time.Millisecond {
+		return true
+	}
+	if !endsSentence(prev) {
+		return false
+	}
+	return pause >= time.Duration(c.PauseMs)*time.Millisecond || size >= c.MaxChars
+}
+
+func endsSentence(text string) bool {
+	text = strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"»)`, r)
+	})
+	return strings.HasSuffix(text, ".") || strings.HasSuffix(text, "!") ||
+		strings.HasSuffix(text, "?") || strings.HasSuffix(text, "…")
+}
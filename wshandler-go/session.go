@@ -0,0 +1,82 @@
+package wshandler
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/michael/bhl-qwen-go"
+)
+
+// session состояние одного WebSocket-подключения
+type session struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex // gorilla/websocket допускает только одного писателя
+	bc      *broadcast // трансляция для подписчиков
+
+	// Переопределения стадий конвейера для этой сессии
+	overrides map[string]bool
+
+	// Контекст для command-qwen: предыдущий final или command
+	cmdMu  sync.Mutex
+	cmdCtx *command.CommandContext
+
+	// Очередь доставки финальных фраз (startDelivery)
+	queue chan *Segment
+
+	// Текст сессии по абзацам, с голосовыми правками
+	doc      *Document
+	uttStart time.Time // начало текущей фразы, только из читающей горутины
+
+	// Фразы сессии для OnSessionEnd
+	started time.Time
+	recMu   sync.Mutex
+	finals  []FinalRecord
+	audio   string // путь к записи сессии
+}
+
+func newSession(conn *websocket.Conn) *session {
+	return &session{
+		conn:      conn,
+		overrides: map[string]bool{},
+		started:   time.Now(),
+	}
+}
+
+// send отправляет сообщение только диктующему клиенту, безопасно из любой горутины
+func (s *session) send(data interface{}) {
+	msg, _ := json.Marshal(data)
+	s.write(msg)
+}
+
+// emit отправляет событие распознавания клиенту и подписчикам;
+// keep — событие войдёт в транскрипт для опоздавших (final, command)
+func (s *session) emit(data interface{}, keep bool) {
+	msg, _ := json.Marshal(data)
+	s.write(msg)
+	s.bc.publish(msg, keep)
+}
+
+func (s *session) write(msg []byte) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// commandContext возвращает копию текущего контекста (пустой final, если его ещё нет)
+func (s *session) commandContext() *command.CommandContext {
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+	if s.cmdCtx == nil {
+		return &command.CommandContext{Type: string(command.TypeFinal)}
+	}
+	c := *s.cmdCtx
+	return &c
+}
+
+func (s *session) setCommandContext(c command.CommandContext) {
+	s.cmdMu.Lock()
+	s.cmdCtx = &c
+	s.cmdMu.Unlock()
+}
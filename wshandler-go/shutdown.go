@@ -0,0 +1,84 @@
+package wshandler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// liveSessions диктующие подключения. http.Server.Shutdown не ждёт
+// соединений после Upgrade, поэтому сессии дожидаемся сами.
+type liveSessions struct {
+	mu      sync.Mutex
+	closing bool
+	conns   map[*websocket.Conn]struct{}
+	wg      sync.WaitGroup
+}
+
+// enter false — сервер останавливается, новую сессию не начинаем
+func (l *liveSessions) enter() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.wg.Add(1)
+	return true
+}
+
+// leave вызывается, когда сессия полностью завершена, после OnSessionEnd
+func (l *liveSessions) leave() {
+	l.wg.Done()
+}
+
+func (l *liveSessions) add(conn *websocket.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns == nil {
+		l.conns = map[*websocket.Conn]struct{}{}
+	}
+	l.conns[conn] = struct{}{}
+	if l.closing {
+		interrupt(conn)
+	}
+}
+
+func (l *liveSessions) remove(conn *websocket.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+}
+
+// interrupt прощается с клиентом и обрывает чтение: цикл сессии выходит
+// как при отключении клиента и дописывает хвост распознавания
+func interrupt(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.UnderlyingConn().SetReadDeadline(time.Now())
+}
+
+// Shutdown завершает диктующие сессии и ждёт их OnSessionEnd. Вызывать
+// после http.Server.Shutdown и до закрытия того, чем пользуются сессии:
+// конвейера, command-qwen, хранилища. Новые сессии получают 503.
+func (h *WSHandler) Shutdown(ctx context.Context) error {
+	h.live.mu.Lock()
+	h.live.closing = true
+	for conn := range h.live.conns {
+		interrupt(conn)
+	}
+	h.live.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.live.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
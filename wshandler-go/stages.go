@@ -0,0 +1,528 @@
+package wshandler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mbykov/vosk-punct"
+)
+
+// punctuationStage расстановка пунктуации и регистра через voskpunct
+type punctuationStage struct {
+	p *voskpunct.Punctuator
+}
+
+func (s *punctuationStage) Name() string { return "punctuation" }
+
+func (s *punctuationStage) Process(seg *Segment) {
+	seg.Text = s.p.Process(seg.Text)
+}
+
+// itnStage обратная нормализация: "двадцать пять" → "25"
+type itnStage struct{}
+
+func (s *itnStage) Name() string { return "itn" }
+
+// Классы числительных: порядок внутри группы сотни → десятки → единицы
+const (
+	numUnits    = 1
+	numTens     = 2
+	numHundreds = 3
+)
+
+type numWord struct {
+	value int64
+	class int
+}
+
+var numWords = map[string]numWord{
+	"ноль": {0, numUnits}, "один": {1, numUnits}, "одна": {1, numUnits}, "одно": {1, numUnits},
+	"два": {2, numUnits}, "две": {2, numUnits}, "три": {3, numUnits}, "четыре": {4, numUnits},
+	"пять": {5, numUnits}, "шесть": {6, numUnits}, "семь": {7, numUnits}, "восемь": {8, numUnits},
+	"девять": {9, numUnits}, "десять": {10, numUnits}, "одиннадцать": {11, numUnits},
+	"двенадцать": {12, numUnits}, "тринадцать": {13, numUnits}, "четырнадцать": {14, numUnits},
+	"пятнадцать": {15, numUnits}, "шестнадцать": {16, numUnits}, "семнадцать": {17, numUnits},
+	"восемнадцать": {18, numUnits}, "девятнадцать": {19, numUnits},
+	"двадцать": {20, numTens}, "тридцать": {30, numTens}, "сорок": {40, numTens},
+	"пятьдесят": {50, numTens}, "шестьдесят": {60, numTens}, "семьдесят": {70, numTens},
+	"восемьдесят": {80, numTens}, "девяносто": {90, numTens},
+	"сто": {100, numHundreds}, "двести": {200, numHundreds}, "триста": {300, numHundreds},
+	"четыреста": {400, numHundreds}, "пятьсот": {500, numHundreds}, "шестьсот": {600, numHundreds},
+	"семьсот": {700, numHundreds}, "восемьсот": {800, numHundreds}, "девятьсот": {900, numHundreds},
+}
+
+var numMultipliers = map[string]int64{
+	"тысяча": 1e3, "тысячи": 1e3, "тысяч": 1e3,
+	"миллион": 1e6, "миллиона": 1e6, "миллионов": 1e6,
+	"миллиард": 1e9, "миллиарда": 1e9, "миллиардов": 1e9,
+}
+
+// numRun накопитель подряд идущих числительных
+type numRun struct {
+	out        []string
+	words      []string
+	total      int64
+	group      int64
+	groupWords int // слов в group после последнего множителя
+	lastClass  int
+	lastMult   int64
+}
+
+func (r *numRun) active() bool { return len(r.words) > 0 }
+
+// flush выводит накопленное число; trail — пунктуация после последнего слова
+func (r *numRun) flush(trail string) {
+	if !r.active() {
+		return
+	}
+	if len(r.words) == 1 && numWords[strings.ToLower(r.words[0])].value == 1 {
+		// одиночное "один" чаще местоимение, чем число
+		r.out = append(r.out, r.words[0]+trail)
+	} else {
+		r.out = append(r.out, strconv.FormatInt(r.total+r.group, 10)+trail)
+	}
+	*r = numRun{out: r.out}
+}
+
+func (s *itnStage) Process(seg *Segment) {
+	r := &numRun{}
+	for _, tok := range strings.Fields(seg.Text) {
+		core := strings.TrimRightFunc(tok, unicode.IsPunct)
+		trail := tok[len(core):]
+		lower := strings.ToLower(core)
+
+		if w, ok := numWords[lower]; ok {
+			// "два три" — два разных числа, "двадцать три" — одно
+			if r.active() && (w.value == 0 ||
+				r.lastClass != 0 && w.class >= r.lastClass ||
+				r.lastClass == numTens && w.value >= 10) {
+				r.flush("")
+			}
+			r.words = append(r.words, core)
+			r.group += w.value
+			r.groupWords++
+			r.lastClass = w.class
+			if w.value == 0 {
+				r.flush(trail)
+				continue
+			}
+		} else if m, ok := numMultipliers[lower]; ok && (r.active() || lower == "тысяча" || lower == "миллион" || lower == "миллиард") {
+			if r.lastMult != 0 && m >= r.lastMult {
+				// "пять тысяч три миллиона": "три" относится к миллиону,
+				// выводим только "пять тысяч"
+				pending, group := r.words[len(r.words)-r.groupWords:], r.group
+				r.words = r.words[:len(r.words)-r.groupWords]
+				r.group = 0
+				r.flush("")
+				r.words = append(r.words, pending...)
+				r.group = group
+			}
+			if r.group == 0 {
+				r.group = 1
+			}
+			r.words = append(r.words, core)
+			r.total += r.group * m
+			r.group = 0
+			r.groupWords = 0
+			r.lastClass = 0
+			r.lastMult = m
+		} else {
+			r.flush("")
+			r.out = append(r.out, tok)
+			continue
+		}
+
+		if trail != "" {
+			r.flush(trail)
+		}
+	}
+	r.flush("")
+	seg.Text = strings.Join(r.out, " ")
+}
+
+// Corrector замены, выученные из правок пользователя (diary-server).
+// final — окончательная фраза: промежуточные повторяют одни и те же
+// слова, срабатывания по ним не считаются.
+type Corrector interface {
+	Correct(user, text string, final bool) string
+}
+
+// correctionsStage применяет замены владельца сессии
+type correctionsStage struct {
+	c Corrector
+}
+
+func (s *correctionsStage) Name() string { return "corrections" }
+
+func (s *correctionsStage) Process(seg *Segment) {
+	if s.c != nil {
+		seg.Text = s.c.Correct(seg.User, seg.Text, seg.Type == "final")
+	}
+}
+
+// replaceStage пользовательский словарь замен (целые слова, без учёта регистра).
+// Все фразы словаря — одно выражение: текст проходится один раз, в каждой
+// позиции берётся самая длинная фраза, заменённое повторно не сканируется.
+type replaceStage struct {
+	re *regexp.Regexp
+	to map[string]string // фраза в нижнем регистре → замена
+}
+
+func newReplaceStage(dict map[string]string) (*replaceStage, error) {
+	from := make([]string, 0, len(dict))
+	for k := range dict {
+		from = append(from, k)
+	}
+	// RE2 берёт первую подошедшую альтернативу: длинные фразы раньше
+	// коротких, чтобы "новый год" не съел "год"
+	sort.Slice(from, func(i, j int) bool {
+		if len(from[i]) != len(from[j]) {
+			return len(from[i]) > len(from[j])
+		}
+		return from[i] < from[j]
+	})
+
+	s := &replaceStage{to: map[string]string{}}
+	alts := make([]string, 0, len(from))
+	for _, f := range from {
+		key := strings.ToLower(f)
+		if _, dup := s.to[key]; dup {
+			continue
+		}
+		s.to[key] = dict[f]
+		alts = append(alts, regexp.QuoteMeta(f))
+	}
+	if len(alts) == 0 {
+		return s, nil
+	}
+	re, err := regexp.Compile(`(?i)(?:` + strings.Join(alts, "|") + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("replace: %w", err)
+	}
+	s.re = re
+	return s, nil
+}
+
+func (s *replaceStage) Name() string { return "replace" }
+
+func (s *replaceStage) Process(seg *Segment) {
+	if s.re == nil {
+		return
+	}
+	seg.Text, _ = ReplaceWords(s.re, seg.Text, func(m string) string { return s.to[strings.ToLower(m)] })
+}
+
+// ReplaceWords заменяет совпадения re, которые стоят отдельными словами,
+// и возвращает их число; им же пользуются замены diary-server. Границы слов проверяем сами: в RE2 нет просмотра
+// вокруг, а разделитель внутри шаблона съедался бы и не доставался
+// следующему совпадению ("кот кот"). Если совпадение обрывает слово, в той
+// же позиции ищется более короткое: "новый год" в "новый годик дома".
+func ReplaceWords(re *regexp.Regexp, text string, repl func(m string) string) (string, int) {
+	var b strings.Builder
+	n, last, pos := 0, 0, 0
+	for pos < len(text) {
+		loc := re.FindStringIndex(text[pos:])
+		if loc == nil || loc[0] == loc[1] {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		if start == 0 || !isWordRune(before) {
+			end = wordEnd(re, text, start, end)
+		} else {
+			end = -1
+		}
+		if end > start {
+			b.WriteString(text[last:start])
+			b.WriteString(repl(text[start:end]))
+			last, pos = end, end
+			n++
+			continue
+		}
+		// внутри слова; следующее совпадение может начаться на руну дальше
+		_, size := utf8.DecodeRuneInString(text[start:])
+		pos = start + size
+	}
+	if n == 0 {
+		return text, 0
+	}
+	b.WriteString(text[last:])
+	return b.String(), n
+}
+
+// wordEnd конец самого длинного совпадения re с начала start, после
+// которого не продолжается слово; -1 — такого нет
+func wordEnd(re *regexp.Regexp, text string, start, end int) int {
+	for end > start {
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if end == len(text) || !isWordRune(after) {
+			return end
+		}
+		// короче найденного: ищем в тексте, обрезанном перед его последней руной
+		_, size := utf8.DecodeLastRuneInString(text[start:end])
+		loc := re.FindStringIndex(text[start : end-size])
+		if loc == nil || loc[0] != 0 {
+			return -1
+		}
+		end = start + loc[1]
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// profanityStage маскирует слова, начинающиеся с нецензурных корней,
+// и отдельные словоформы
+type profanityStage struct {
+	roots []string
+	forms map[string]bool
+	mask  string
+}
+
+var defaultProfanityRoots = []string{"хуй", "хуе", "хуё", "хуя", "пизд", "ебл", "ебан", "ебат", "бляд", "мудак", "мудил", "залуп", "пидор", "пидар"}
+
+// Короткие корни совпали бы с обычными словами ("бляшка", "сукно"),
+// поэтому у них маскируются только эти формы целиком
+var defaultProfanityForms = []string{"бля", "блять", "сука", "суки", "суке", "суку", "сукой", "суками"}
+
+var wordRe = regexp.MustCompile(`\p{L}+`)
+
+func newProfanityStage(words []string, mask string) *profanityStage {
+	forms := map[string]bool{}
+	if len(words) == 0 {
+		words = defaultProfanityRoots
+		for _, f := range defaultProfanityForms {
+			forms[f] = true
+		}
+	}
+	if mask == "" {
+		mask = "*"
+	}
+	roots := make([]string, len(words))
+	for i, w := range words {
+		roots[i] = strings.ToLower(w)
+	}
+	return &profanityStage{roots: roots, forms: forms, mask: mask}
+}
+
+func (s *profanityStage) Name() string { return "profanity" }
+
+func (s *profanityStage) Process(seg *Segment) {
+	seg.Text = wordRe.ReplaceAllStringFunc(seg.Text, func(w string) string {
+		lower := strings.ToLower(w)
+		if s.forms[lower] {
+			return s.masked(w)
+		}
+		for _, root := range s.roots {
+			if strings.HasPrefix(lower, root) {
+				return s.masked(w)
+			}
+		}
+		return w
+	})
+}
+
+func (s *profanityStage) masked(w string) string {
+	runes := []rune(w)
+	return string(runes[0]) + strings.Repeat(s.mask, len(runes)-1)
+}
+
+// piiStage скрывает персональные данные: почту, номера карт и телефонов
+type piiStage struct {
+	rules []piiRule
+}
+
+type piiRule struct {
+	re    *regexp.Regexp
+	label string
+}
+
+// порядок важен: номер карты длиннее телефона и должен сработать раньше
+var piiPatterns = []struct {
+	name, expr, label string
+}{
+	{"email", `[\w.+-]+@[\w-]+(\.[\w-]+)+`, "[email]"},
+	{"card", `\b\d(?:[ -]?\d){12,18}\b`, "[карта]"},
+	{"phone", `(?:\+7|\b8)[\s(-]*\d{3}[\s)-]*\d{3}[\s-]*\d{2}[\s-]*\d{2}\b`, "[телефон]"},
+}
+
+func newPIIStage(only []string) (*piiStage, error) {
+	want := map[string]bool{}
+	for _, n := range only {
+		want[n] = true
+	}
+	s := &piiStage{}
+	for _, p := range piiPatterns {
+		if len(want) > 0 && !want[p.name] {
+			continue
+		}
+		delete(want, p.name)
+		s.rules = append(s.rules, piiRule{re: regexp.MustCompile(p.expr), label: p.label})
+	}
+	for n := range want {
+		return nil, fmt.Errorf("pii: unknown pattern %q", n)
+	}
+	return s, nil
+}
+
+func (s *piiStage) Name() string { return "pii" }
+
+func (s *piiStage) Process(seg *Segment) {
+	for _, r := range s.rules {
+		seg.Text = r.re.ReplaceAllString(seg.Text, r.label)
+	}
+}
+
+// commandStage помечает фразы, начинающиеся со слова-триггера, как команды
+type commandStage struct {
+	triggers map[string]bool
+}
+
+func newCommandStage(words []string) *commandStage {
+	if len(words) == 0 {
+		words = []string{"команда"}
+	}
+	s := &commandStage{triggers: map[string]bool{}}
+	for _, w := range words {
+		s.triggers[strings.ToLower(w)] = true
+	}
+	return s
+}
+
+func (s *commandStage) Name() string { return "command" }
+
+func (s *commandStage) Process(seg *Segment) {
+	first, rest, _ := strings.Cut(seg.Text, " ")
+	if !s.triggers[strings.ToLower(strings.TrimRightFunc(first, unicode.IsPunct))] {
+		return
+	}
+	rest = strings.TrimLeftFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsPunct(r) })
+	if rest == "" {
+		return
+	}
+	seg.Text = rest
+	seg.Command = true
+}
+
+// mathStage помечает фразу как команду, если она похожа на математическое
+// выражение (аналог isMath): в ней хотя бы два разных математических
+// термина, и вместе с числами и глаголами правки они составляют не меньше
+// половины слов. Одного термина с числом мало: "в какой-то степени два"
+// и "сумму двух тысяч" — обычная речь; "корень из трёх" надёжнее
+// продиктовать через слово-триггер стадии command. Термины сравниваются
+// с допуском в одну опечатку ASR.
+type mathStage struct {
+	terms []string
+	canon map[string]string // форма термина → первая форма того же термина в списке
+}
+
+var defaultMathTerms = []string{
+	"плюс", "минус", "умножить", "разделить", "делённое", "деленное", "равно", "равняется",
+	"корень", "квадрат", "квадрате", "куб", "кубе", "степень", "степени", "дробь",
+	"интеграл", "производная", "производную", "предел", "сумма", "сумму", "скобка", "скобки",
+	"синус", "косинус", "тангенс", "котангенс", "логарифм", "икс", "игрек", "зет",
+	"пи", "альфа", "бета", "гамма", "дельта", "сигма", "формула", "формулу", "уравнение",
+}
+
+// Слова, которые сами по себе не математика, но усиливают термин:
+// косвенные падежи числительных и глаголы правки ("добавь корень из трёх")
+var mathSupportWords = map[string]bool{
+	"нуля": true, "одного": true, "двух": true, "трех": true, "трёх": true, "четырех": true,
+	"четырёх": true, "пяти": true, "шести": true, "семи": true, "восьми": true, "девяти": true,
+	"десяти": true, "добавь": true, "замени": true, "убери": true, "поменяй": true, "умножь": true,
+	"раздели": true, "возведи": true,
+}
+
+func newMathStage(words []string) *mathStage {
+	if len(words) == 0 {
+		words = defaultMathTerms
+	}
+	s := &mathStage{canon: map[string]string{}}
+	for _, w := range words {
+		t := strings.ToLower(w)
+		s.terms = append(s.terms, t)
+		for _, u := range s.terms {
+			if sameStem(t, u) {
+				s.canon[t] = u
+				break
+			}
+		}
+	}
+	return s
+}
+
+// sameStem формы одного термина: "сумма" и "сумму", "куб" и "кубе" —
+// совпадают первые четыре буквы (или всё короткое слово)
+func sameStem(a, b string) bool {
+	ra := []rune(strings.ReplaceAll(a, "ё", "е"))
+	rb := []rune(strings.ReplaceAll(b, "ё", "е"))
+	n := min(4, len(ra), len(rb))
+	return string(ra[:n]) == string(rb[:n])
+}
+
+func (s *mathStage) Name() string { return "math" }
+
+func (s *mathStage) Process(seg *Segment) {
+	words := strings.Fields(seg.Text)
+	terms := map[string]bool{}
+	math := 0
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimFunc(w, unicode.IsPunct))
+		if _, ok := numWords[w]; ok {
+			math++
+		} else if _, err := strconv.Atoi(w); err == nil || mathSupportWords[w] {
+			math++
+		} else if t, ok := s.isTerm(w); ok {
+			terms[t] = true
+			math++
+		}
+	}
+	if len(terms) >= 2 && 2*math >= len(words) {
+		seg.Command = true
+	}
+}
+
+// isTerm термин, которому соответствует слово: разные формы одного
+// термина ("сумма суммы") считаются одним
+func (s *mathStage) isTerm(w string) (string, bool) {
+	for _, t := range s.terms {
+		if w == t {
+			return s.canon[t], true
+		}
+	}
+	for _, t := range s.terms {
+		// короткие слова только точно: "пи" и "из" не должны совпадать
+		if len([]rune(t)) >= 5 && levenshtein(w, t) <= 1 {
+			return s.canon[t], true
+		}
+	}
+	return "", false
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,592 @@
+package wshandler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Task дело или напоминание, найденное в надиктованной фразе
+type Task struct {
+	Text    string     `json:"text"`           // что сделать: "Позвонить маме"
+	Source  string     `json:"source"`         // предложение целиком
+	Due     *time.Time `json:"due,omitempty"`  // срок; nil — без срока
+	HasTime bool       `json:"has_time"`       // срок с временем, иначе — на весь день
+	When    string     `json:"when,omitempty"` // как сказано: "в следующий вторник в пять"
+}
+
+// Слова, с которых начинается дело: "надо позвонить маме"
+var defaultTaskMarkers = []string{
+	"надо", "нужно", "необходимо", "не забыть", "не забудь", "напомни", "напомнить",
+	"напомните", "должен", "должна", "должны", "обязательно", "запланировать",
+}
+
+// TaskExtractor находит дела и сроки в тексте. Дело — предложение со словом
+// из списка или с однозначно будущим сроком ("завтра", "через неделю");
+// срок считается от времени фразы.
+type TaskExtractor struct {
+	markers [][]string
+}
+
+func NewTaskExtractor(words []string) *TaskExtractor {
+	if len(words) == 0 {
+		words = defaultTaskMarkers
+	}
+	x := &TaskExtractor{}
+	for _, w := range words {
+		if f := strings.Fields(normWord(w)); len(f) > 0 {
+			x.markers = append(x.markers, f)
+		}
+	}
+	return x
+}
+
+// Extract дела из текста; ref — когда это было сказано
+func (x *TaskExtractor) Extract(text string, ref time.Time) []Task {
+	var out []Task
+	for _, sent := range splitSentences(text) {
+		if strings.HasSuffix(sent, "?") {
+			continue
+		}
+		toks := whenTokens(sent)
+		marker := x.findMarker(toks)
+		w := parseWhen(toks, ref)
+		if marker[0] < 0 && !w.future {
+			continue
+		}
+
+		t := Task{Source: sent, Text: taskText(sent, toks, w.spans, marker)}
+		if w.found() {
+			due := w.due()
+			t.Due = &due
+			t.HasTime = w.hasTime
+			t.When = w.phrase(sent, toks)
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// findMarker токены первого маркера [from, to); {-1, -1} — маркера нет
+func (x *TaskExtractor) findMarker(toks []wtok) [2]int {
+	for i := range toks {
+		for _, m := range x.markers {
+			if i+len(m) > len(toks) {
+				continue
+			}
+			ok := true
+			for j, w := range m {
+				if toks[i+j].w != w {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return [2]int{i, i + len(m)}
+			}
+		}
+	}
+	return [2]int{-1, -1}
+}
+
+// taskText предложение без срока и без вводной части до маркера:
+// "Завтра надо позвонить маме." → "Позвонить маме"
+func taskText(sent string, toks []wtok, spans [][2]int, marker [2]int) string {
+	skip := make([]bool, len(toks))
+	for _, sp := range append(spans, marker) {
+		for i := max(sp[0], 0); i < sp[1]; i++ {
+			skip[i] = true
+		}
+	}
+	// маркер в начале предложения — дело начинается после него
+	from := 0
+	if marker[0] >= 0 && marker[0] < 3 {
+		from = marker[1]
+	}
+	for from < len(toks) && (skip[from] || taskFillers[toks[from].w]) {
+		from++
+	}
+	if from == len(toks) {
+		return strings.TrimRight(sent, ".!… ")
+	}
+
+	var b strings.Builder
+	cursor := toks[from].start
+	for i := from; i < len(toks); i++ {
+		if !skip[i] {
+			continue
+		}
+		b.WriteString(sent[cursor:toks[i].start])
+		cursor = toks[i].end
+	}
+	b.WriteString(sent[cursor:])
+
+	text := strings.Join(strings.Fields(b.String()), " ")
+	text = strings.ReplaceAll(text, " ,", ",")
+	text = strings.TrimFunc(text, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSpace(r) })
+	r, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(r)) + text[size:]
+}
+
+// Слова между маркером и делом: "надо мне бы", "напомни мне"
+var taskFillers = map[string]bool{"мне": true, "себе": true, "бы": true, "я": true, "мы": true, "нам": true, "будет": true}
+
+// splitSentences делит текст после пунктуации на предложения
+func splitSentences(text string) []string {
+	var out []string
+	start := 0
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' && r != '…' {
+			continue
+		}
+		end := i + utf8.RuneLen(r)
+		if end < len(text) && text[end] != ' ' {
+			continue // 17.30, сокращения
+		}
+		if s := strings.TrimSpace(text[start:end]); s != "" {
+			out = append(out, s)
+		}
+		start = end
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// wtok слово предложения в нижнем регистре и его место в тексте
+type wtok struct {
+	w          string
+	start, end int
+}
+
+func normWord(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+}
+
+// whenTokens слова и числа; "17:30" — один токен
+func whenTokens(s string) []wtok {
+	var out []wtok
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r) || r == ':' && start >= 0
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			out = append(out, wtok{w: normWord(s[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		out = append(out, wtok{w: normWord(s[start:]), start: start, end: len(s)})
+	}
+	return out
+}
+
+var weekdays = map[string]time.Weekday{
+	"понедельник": time.Monday, "вторник": time.Tuesday, "среду": time.Wednesday, "среда": time.Wednesday,
+	"четверг": time.Thursday, "пятницу": time.Friday, "пятница": time.Friday,
+	"субботу": time.Saturday, "суббота": time.Saturday, "воскресенье": time.Sunday,
+}
+
+var months = map[string]time.Month{
+	"января": time.January, "февраля": time.February, "марта": time.March, "апреля": time.April,
+	"мая": time.May, "июня": time.June, "июля": time.July, "августа": time.August,
+	"сентября": time.September, "октября": time.October, "ноября": time.November, "декабря": time.December,
+}
+
+// Основы порядковых числительных для дат: "пятнадцатого", "двадцать первое"
+var ordinalStems = map[string]int{
+	"перв": 1, "втор": 2, "трет": 3, "четверт": 4, "пят": 5, "шест": 6, "седьм": 7, "восьм": 8,
+	"девят": 9, "десят": 10, "одиннадцат": 11, "двенадцат": 12, "тринадцат": 13, "четырнадцат": 14,
+	"пятнадцат": 15, "шестнадцат": 16, "семнадцат": 17, "восемнадцат": 18, "девятнадцат": 19,
+	"двадцат": 20, "тридцат": 30,
+}
+
+// Части суток: "завтра вечером" без часа — 19:00
+var dayParts = map[string]int{"утром": 9, "днем": 13, "вечером": 19, "ночью": 23}
+
+// when разобранный срок
+type when struct {
+	ref     time.Time
+	date    time.Time // полночь дня срока
+	hasDate bool
+	hour    int
+	min     int
+	hasTime bool
+	part    int // час части суток, 0 — не сказано
+	future  bool
+	spans   [][2]int // токены выражения, [from, to)
+}
+
+func (w *when) found() bool { return w.hasDate || w.hasTime || w.part > 0 }
+
+func (w *when) due() time.Time {
+	day := w.date
+	if !w.hasDate {
+		day = midnight(w.ref)
+	}
+	if !w.hasTime && w.part > 0 {
+		w.hour, w.hasTime = w.part, true
+	}
+	if !w.hasTime {
+		return day
+	}
+	due := time.Date(day.Year(), day.Month(), day.Day(), w.hour, w.min, 0, 0, day.Location())
+	// "в пять" без дня, а пять уже прошло — значит завтра
+	if !w.hasDate && due.Before(w.ref) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return due
+}
+
+// phrase срок так, как его сказали
+func (w *when) phrase(sent string, toks []wtok) string {
+	var parts []string
+	for _, sp := range w.spans {
+		parts = append(parts, sent[toks[sp[0]].start:toks[sp[1]-1].end])
+	}
+	return strings.Join(parts, " ")
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (w *when) setDate(d time.Time) {
+	w.date, w.hasDate = midnight(d), true
+}
+
+// parseWhen ищет в предложении выражения даты и времени
+func parseWhen(toks []wtok, ref time.Time) *when {
+	w := &when{ref: ref}
+	for i := 0; i < len(toks); {
+		n := w.match(toks, i)
+		if n == 0 {
+			i++
+			continue
+		}
+		w.spans = append(w.spans, [2]int{i, i + n})
+		i += n
+	}
+	return w
+}
+
+// match пробует выражения с токена i; возвращает, сколько токенов занято
+func (w *when) match(toks []wtok, i int) int {
+	tok := toks[i].w
+	next := func(k int) string {
+		if i+k < len(toks) {
+			return toks[i+k].w
+		}
+		return ""
+	}
+
+	switch tok {
+	case "сегодня":
+		w.setDate(w.ref)
+		return 1
+	case "завтра":
+		w.setDate(w.ref.AddDate(0, 0, 1))
+		w.future = true
+		return 1
+	case "послезавтра":
+		w.setDate(w.ref.AddDate(0, 0, 2))
+		w.future = true
+		return 1
+	case "через":
+		return w.matchAfter(toks, i)
+	case "полдень":
+		w.hour, w.min, w.hasTime = 12, 0, true
+		return 1
+	}
+	if h, ok := dayParts[tok]; ok {
+		w.part = h
+		return 1
+	}
+
+	// на следующей неделе, на выходных, в выходные
+	if tok == "на" && (next(1) == "следующей" || next(1) == "будущей") && next(2) == "неделе" {
+		w.setDate(weekStart(w.ref).AddDate(0, 0, 7))
+		w.future = true
+		return 3
+	}
+	if (tok == "на" && next(1) == "выходных") || (tok == "в" && next(1) == "выходные") {
+		w.setDate(upcoming(w.ref, time.Saturday))
+		return 2
+	}
+
+	// [в|во] [следующий|этот] день недели
+	n := 0
+	if tok == "в" || tok == "во" {
+		n = 1
+	}
+	mod := ""
+	switch m := next(n); {
+	case strings.HasPrefix(m, "следующ"), strings.HasPrefix(m, "будущ"):
+		mod, n = "next", n+1
+	case m == "этот" || m == "эту" || m == "это" || m == "ближайший" || m == "ближайшую" || m == "ближайшее":
+		mod, n = "this", n+1
+	}
+	if wd, ok := weekdays[next(n)]; ok && (n > 0 || mod != "") {
+		switch mod {
+		case "next":
+			start := weekStart(w.ref).AddDate(0, 0, 7)
+			w.setDate(start.AddDate(0, 0, (int(wd)+6)%7))
+			w.future = true
+		case "this":
+			w.setDate(weekStart(w.ref).AddDate(0, 0, (int(wd)+6)%7))
+		default:
+			w.setDate(upcoming(w.ref, wd))
+		}
+		return n + 1
+	}
+
+	// пятнадцатого мая, 15 мая 2027, до двадцать первого июня
+	if n := w.matchDate(toks, i); n > 0 {
+		return n
+	}
+	if tok == "до" || tok == "к" || tok == "ко" || tok == "на" || tok == "с" {
+		if n := w.matchDate(toks, i+1); n > 0 {
+			return n + 1
+		}
+	}
+
+	// в пять, к 17:30, в пять тридцать вечера, в час дня
+	if tok == "в" || tok == "к" {
+		return w.matchTime(toks, i+1)
+	}
+	return 0
+}
+
+// matchAfter "через два дня", "через неделю", "через полчаса"
+func (w *when) matchAfter(toks []wtok, i int) int {
+	j := i + 1
+	if j >= len(toks) {
+		return 0
+	}
+	if toks[j].w == "полчаса" {
+		w.setExact(w.ref.Add(30 * time.Minute))
+		return 2
+	}
+	num := 1
+	if toks[j].w == "пару" {
+		num, j = 2, j+1
+	} else if v, n := parseNumber(toks, j); n > 0 {
+		num, j = v, j+n
+	}
+	if j >= len(toks) {
+		return 0
+	}
+	unit := toks[j].w
+	switch {
+	case strings.HasPrefix(unit, "минут"):
+		w.setExact(w.ref.Add(time.Duration(num) * time.Minute))
+	case strings.HasPrefix(unit, "час"):
+		w.setExact(w.ref.Add(time.Duration(num) * time.Hour))
+	case unit == "день" || unit == "дня" || unit == "дней" || unit == "сутки":
+		w.setDate(w.ref.AddDate(0, 0, num))
+	case strings.HasPrefix(unit, "недел"):
+		w.setDate(w.ref.AddDate(0, 0, 7*num))
+	case strings.HasPrefix(unit, "месяц"):
+		w.setDate(w.ref.AddDate(0, num, 0))
+	case unit == "год" || unit == "года" || unit == "лет":
+		w.setDate(w.ref.AddDate(num, 0, 0))
+	default:
+		return 0
+	}
+	w.future = true
+	return j - i + 1
+}
+
+// setExact срок до минуты: "через два часа"
+func (w *when) setExact(t time.Time) {
+	w.setDate(t)
+	w.hour, w.min, w.hasTime = t.Hour(), t.Minute(), true
+}
+
+// matchDate число или порядковое числительное и месяц, необязательно год
+func (w *when) matchDate(toks []wtok, i int) int {
+	day, n := parseOrdinal(toks, i)
+	if n == 0 || day < 1 || day > 31 || i+n >= len(toks) {
+		return 0
+	}
+	month, ok := months[toks[i+n].w]
+	if !ok {
+		return 0
+	}
+	n++
+
+	year := w.ref.Year()
+	explicit := false
+	if i+n < len(toks) {
+		if y, err := strconv.Atoi(toks[i+n].w); err == nil && y >= 2000 && y < 2200 {
+			year, explicit = y, true
+			n++
+			if i+n < len(toks) && (toks[i+n].w == "года" || toks[i+n].w == "г") {
+				n++
+			}
+		}
+	}
+	d := time.Date(year, month, day, 0, 0, 0, 0, w.ref.Location())
+	if d.Month() != month {
+		return 0 // 31 апреля
+	}
+	// прошедшая дата без года — в следующем году
+	if !explicit && d.Before(midnight(w.ref)) {
+		d = d.AddDate(1, 0, 0)
+	}
+	w.setDate(d)
+	return n
+}
+
+// matchTime час, минуты и "утра/дня/вечера/ночи" после предлога на позиции i-1
+func (w *when) matchTime(toks []wtok, i int) int {
+	if i >= len(toks) {
+		return 0
+	}
+	hour, minute, n := -1, 0, 0
+	if h, m, ok := strings.Cut(toks[i].w, ":"); ok {
+		hv, err1 := strconv.Atoi(h)
+		mv, err2 := strconv.Atoi(m)
+		if err1 != nil || err2 != nil {
+			return 0
+		}
+		hour, minute, n = hv, mv, 1
+	} else if toks[i].w == "час" {
+		hour, n = 1, 1
+	} else if v, k := parseNumber(toks, i); k > 0 {
+		hour, n = v, k
+		if i+n < len(toks) && strings.HasPrefix(toks[i+n].w, "час") {
+			n++
+		}
+		if v, k := parseNumber(toks, i+n); k > 0 && v < 60 {
+			minute, n = v, n+k
+			if i+n < len(toks) && strings.HasPrefix(toks[i+n].w, "минут") {
+				n++
+			}
+		}
+	}
+	if hour < 0 || hour > 24 || minute > 59 {
+		return 0
+	}
+
+	qualified := false
+	if i+n < len(toks) {
+		switch toks[i+n].w {
+		case "утра":
+			qualified, n = true, n+1
+			if hour == 12 {
+				hour = 0
+			}
+		case "дня", "вечера":
+			qualified, n = true, n+1
+			if hour < 12 {
+				hour += 12
+			}
+		case "ночи":
+			qualified, n = true, n+1
+			if hour == 12 {
+				hour = 0
+			} else if hour >= 9 && hour < 12 {
+				hour += 12
+			}
+		}
+	}
+	if !qualified {
+		switch {
+		case w.part >= 13 && hour < 12:
+			hour += 12
+		case w.part == 0 && hour >= 1 && hour <= 7:
+			// "встреча в пять" — скорее 17:00, чем 5 утра
+			hour += 12
+		}
+	}
+	if hour == 24 {
+		hour = 0
+	}
+	w.hour, w.min, w.hasTime = hour, minute, true
+	return n + 1
+}
+
+// parseNumber число цифрами или словами до ста: "5", "двадцать один"
+func parseNumber(toks []wtok, i int) (int, int) {
+	if i >= len(toks) {
+		return 0, 0
+	}
+	if v, err := strconv.Atoi(toks[i].w); err == nil {
+		return v, 1
+	}
+	nw, ok := numWords[toks[i].w]
+	if !ok || nw.class == numHundreds {
+		return 0, 0
+	}
+	if nw.class == numTens && i+1 < len(toks) {
+		if u, ok := numWords[toks[i+1].w]; ok && u.class == numUnits && u.value > 0 && u.value < 10 {
+			return int(nw.value + u.value), 2
+		}
+	}
+	return int(nw.value), 1
+}
+
+// parseOrdinal день месяца: "15", "пятнадцатого", "двадцать первое"
+func parseOrdinal(toks []wtok, i int) (int, int) {
+	if i >= len(toks) {
+		return 0, 0
+	}
+	if v, err := strconv.Atoi(toks[i].w); err == nil {
+		return v, 1
+	}
+	if v, ok := ordinal(toks[i].w); ok {
+		return v, 1
+	}
+	if nw, ok := numWords[toks[i].w]; ok && nw.class == numTens && i+1 < len(toks) {
+		if v, ok := ordinal(toks[i+1].w); ok && v < 10 {
+			return int(nw.value) + v, 2
+		}
+	}
+	return 0, 0
+}
+
+func ordinal(word string) (int, bool) {
+	for _, suffix := range []string{"ьего", "ого", "ье", "ое"} {
+		if stem, ok := strings.CutSuffix(word, suffix); ok {
+			v, ok := ordinalStems[stem]
+			return v, ok
+		}
+	}
+	return 0, false
+}
+
+// weekStart полночь понедельника недели t
+func weekStart(t time.Time) time.Time {
+	return midnight(t).AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+// upcoming ближайший такой день недели после t; сегодняшний — через неделю
+func upcoming(t time.Time, wd time.Weekday) time.Time {
+	days := (int(wd) - int(t.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return t.AddDate(0, 0, days)
+}
+
+// tasksStage выделяет дела и напоминания; ставится после пунктуации,
+// чтобы делить текст на предложения
+type tasksStage struct {
+	x *TaskExtractor
+}
+
+func (s *tasksStage) Name() string { return "tasks" }
+
+func (s *tasksStage) Process(seg *Segment) {
+	ref := seg.Start
+	if ref.IsZero() {
+		ref = time.Now()
+	}
+	seg.Tasks = s.x.Extract(seg.Text, ref)
+}